@@ -0,0 +1,9 @@
+package main
+
+import (
+	"github.com/fabien-marty/github-next-semantic-version/internal/infra/controllers/cli"
+)
+
+func main() {
+	cli.ExportPullRequestsMain()
+}
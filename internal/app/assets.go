@@ -0,0 +1,131 @@
+package app
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/fabien-marty/github-next-semantic-version/internal/app/repo"
+)
+
+// ChecksumsAssetName is the name of the checksums file generated (and uploaded) with release assets
+const ChecksumsAssetName = "SHA256SUMS"
+
+// assetUploadRetryDelay returns the delay to wait before the given retry (starting at 1) of a failed asset upload
+var assetUploadRetryDelay = func(retry int) time.Duration {
+	return time.Duration(retry) * 2 * time.Second
+}
+
+// sha256File returns the (hex) sha256 of the given file
+func sha256File(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// getReleaseAssets returns the assets (sorted by name) corresponding to the files matching the given glob patterns
+// and a generated checksums file (see ChecksumsAssetName, "sha256sum" format) as the last asset
+//
+// If contentType is empty, the content type of each asset is guessed from its extension.
+// An error is returned if a glob pattern doesn't match any file or if two files have the same name.
+func getReleaseAssets(globs []string, contentType string) ([]repo.ReleaseAsset, error) {
+	if len(globs) == 0 {
+		return nil, nil
+	}
+	byName := map[string]repo.ReleaseAsset{}
+	for _, glob := range globs {
+		paths, err := filepath.Glob(glob)
+		if err != nil {
+			return nil, fmt.Errorf("bad asset glob pattern %s: %w", glob, err)
+		}
+		found := false
+		for _, path := range paths {
+			stat, err := os.Stat(path)
+			if err != nil {
+				return nil, fmt.Errorf("can't stat the asset %s: %w", path, err)
+			}
+			if stat.IsDir() {
+				continue
+			}
+			found = true
+			path = filepath.Clean(path)
+			name := filepath.Base(path)
+			if name == ChecksumsAssetName {
+				return nil, fmt.Errorf("the asset name %s is reserved for the generated checksums file", name)
+			}
+			if existing, ok := byName[name]; ok {
+				if existing.Path == path {
+					continue // the same file matched by several patterns
+				}
+				return nil, fmt.Errorf("several assets with the same name: %s and %s", existing.Path, path)
+			}
+			assetContentType := contentType
+			if assetContentType == "" {
+				assetContentType = mime.TypeByExtension(filepath.Ext(name))
+			}
+			byName[name] = repo.ReleaseAsset{Name: name, ContentType: assetContentType, Path: path}
+		}
+		if !found {
+			return nil, fmt.Errorf("no file matches the asset glob pattern: %s", glob)
+		}
+	}
+	names := []string{}
+	for name := range byName {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	res := []repo.ReleaseAsset{}
+	var checksums bytes.Buffer
+	for _, name := range names {
+		asset := byName[name]
+		sum, err := sha256File(asset.Path)
+		if err != nil {
+			return nil, fmt.Errorf("can't compute the checksum of the asset %s: %w", asset.Path, err)
+		}
+		fmt.Fprintf(&checksums, "%s  %s\n", sum, name)
+		res = append(res, asset)
+	}
+	return append(res, repo.ReleaseAsset{
+		Name:        ChecksumsAssetName,
+		ContentType: "text/plain; charset=utf-8",
+		Content:     checksums.Bytes(),
+	}), nil
+}
+
+// uploadReleaseAssets uploads the given assets to the given release
+// (each failed upload is retried at most the given number of times)
+func (s *Service) uploadReleaseAssets(release *repo.Release, assets []repo.ReleaseAsset, retries int) error {
+	for _, asset := range assets {
+		logger := s.logger.With(slog.String("tagName", release.TagName), slog.String("asset", asset.Name))
+		for attempt := 0; ; attempt++ {
+			err := s.RepoAdapter.UploadReleaseAsset(release, asset)
+			if err == nil {
+				break
+			}
+			if attempt >= retries {
+				return fmt.Errorf("can't upload the asset %s (after %d attempt(s)): %w", asset.Name, attempt+1, err)
+			}
+			delay := assetUploadRetryDelay(attempt + 1)
+			logger.Warn(fmt.Sprintf("can't upload the asset => let's retry in %s", delay), slog.String("err", err.Error()), slog.Int("attempt", attempt+1), slog.Int("maxRetries", retries))
+			time.Sleep(delay)
+		}
+		logger.Debug("release asset uploaded")
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fabien-marty/github-next-semantic-version/internal/app/git"
+	"github.com/fabien-marty/github-next-semantic-version/internal/app/repo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeAssets(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+	return dir
+}
+
+func TestGetReleaseAssets(t *testing.T) {
+	dir := writeAssets(t, map[string]string{
+		"dist/foo_linux":  "foo",
+		"dist/bar.json":   "bar",
+		"other/foo_linux": "other",
+		"SHA256SUMS":      "",
+	})
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "dist", "subdir"), 0755))
+
+	assets, err := getReleaseAssets(nil, "")
+	assert.Nil(t, err)
+	assert.Nil(t, assets)
+
+	assets, err = getReleaseAssets([]string{filepath.Join(dir, "dist", "*"), filepath.Join(dir, "dist", "foo_*")}, "")
+	require.NoError(t, err)
+	require.Len(t, assets, 3)
+	assert.Equal(t, repo.ReleaseAsset{Name: "bar.json", ContentType: "application/json", Path: filepath.Join(dir, "dist", "bar.json")}, assets[0])
+	assert.Equal(t, repo.ReleaseAsset{Name: "foo_linux", Path: filepath.Join(dir, "dist", "foo_linux")}, assets[1])
+	assert.Equal(t, ChecksumsAssetName, assets[2].Name)
+	assert.Equal(t, "fcde2b2edba56bf408601fb721fe9b5c338d10ee429ea04fae5511b68fbf8fb9  bar.json\n"+
+		"2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae  foo_linux\n", string(assets[2].Content))
+
+	assets, err = getReleaseAssets([]string{filepath.Join(dir, "dist", "bar.json")}, "application/x-foo")
+	require.NoError(t, err)
+	assert.Equal(t, "application/x-foo", assets[0].ContentType)
+
+	_, err = getReleaseAssets([]string{filepath.Join(dir, "dist", "*.exe")}, "")
+	assert.ErrorContains(t, err, "no file matches")
+	_, err = getReleaseAssets([]string{filepath.Join(dir, "*", "foo_linux")}, "")
+	assert.ErrorContains(t, err, "several assets with the same name")
+	_, err = getReleaseAssets([]string{filepath.Join(dir, "SHA256SUMS")}, "")
+	assert.ErrorContains(t, err, "reserved")
+	_, err = getReleaseAssets([]string{"[bad"}, "")
+	assert.ErrorContains(t, err, "bad asset glob pattern")
+}
+
+func TestCreateReleaseWithAssets(t *testing.T) {
+	defer func(old func(int) time.Duration) { assetUploadRetryDelay = old }(assetUploadRetryDelay)
+	assetUploadRetryDelay = func(int) time.Duration { return 0 }
+	dir := writeAssets(t, map[string]string{"foo.txt": "foo"})
+	gitAdapter := &gitDummyAdapter{tags: []*git.Tag{git.NewTag("v1.0.0", time.Now())}}
+	now := time.Now()
+	repoAdapter := &repoDummyAdapter{
+		prs:            []*repo.PullRequest{{Number: 1, Title: "PR1", Labels: []string{}, MergedAt: &now}},
+		uploadFailures: 2,
+	}
+	service := NewService(NewDefaultConfig(), repoAdapter, gitAdapter)
+	opts := ReleaseOptions{Assets: []string{filepath.Join(dir, "*.txt")}, AssetUploadRetries: 2}
+
+	newTag, err := service.CreateNextRelease([]string{"main"}, false, opts)
+	require.NoError(t, err)
+	assert.Equal(t, "v1.0.1", newTag)
+	require.Len(t, repoAdapter.assets, 2)
+	assert.Equal(t, "foo.txt", repoAdapter.assets[0].Name)
+	assert.Equal(t, ChecksumsAssetName, repoAdapter.assets[1].Name)
+
+	// too many failures (on a re-run with the already published release)
+	repoAdapter.uploadFailures = 3
+	_, err = service.CreateNextRelease([]string{"main"}, false, opts)
+	assert.ErrorContains(t, err, "can't upload the assets of the release v1.0.1: can't upload the asset foo.txt (after 3 attempt(s))")
+
+	// a re-run completes the upload (existing assets are replaced)
+	_, err = service.CreateNextRelease([]string{"main"}, false, opts)
+	require.NoError(t, err)
+	assert.Len(t, repoAdapter.releases, 1)
+	require.Len(t, repoAdapter.assets, 2)
+	assert.Equal(t, "foo.txt", repoAdapter.assets[0].Name)
+	assert.Equal(t, ChecksumsAssetName, repoAdapter.assets[1].Name)
+
+	// assets are checked before creating the release
+	repoAdapter = &repoDummyAdapter{prs: repoAdapter.prs}
+	service = NewService(NewDefaultConfig(), repoAdapter, gitAdapter)
+	_, err = service.CreateNextRelease([]string{"main"}, false, ReleaseOptions{Assets: []string{filepath.Join(dir, "*.exe")}})
+	assert.ErrorContains(t, err, "no file matches")
+	assert.Len(t, repoAdapter.releases, 0)
+}
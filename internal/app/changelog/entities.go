@@ -2,6 +2,7 @@ package changelog
 
 import (
 	"slices"
+	"strings"
 	"time"
 
 	"github.com/fabien-marty/github-next-semantic-version/internal/app/git"
@@ -13,6 +14,7 @@ type Config struct {
 	Future                  bool
 	RepoOwner               string
 	RepoName                string
+	WebBaseURL              string // web base url of the GitHub instance (without trailing slash), empty => https://github.com
 	PullRequestIgnoreLabels []string
 }
 
@@ -22,9 +24,10 @@ type Section struct {
 }
 
 type Changelog struct {
-	Sections  []*Section
-	RepoOwner string // Repository owner name (organization)
-	RepoName  string // Repository name (without owner/organization part)
+	Sections   []*Section
+	RepoOwner  string // Repository owner name (organization)
+	RepoName   string // Repository name (without owner/organization part)
+	WebBaseURL string // Web base url of the GitHub instance (without trailing slash, example: https://github.com)
 }
 
 func (c *Changelog) ReversedSections() []*Section {
@@ -128,9 +131,14 @@ func New(tags []*git.Tag, prs []*repo.PullRequest, config Config) *Changelog {
 		sections = append(sections, section)
 		previousTag = tag
 	}
+	webBaseURL := strings.TrimSuffix(config.WebBaseURL, "/")
+	if webBaseURL == "" {
+		webBaseURL = "https://github.com"
+	}
 	return &Changelog{
-		RepoOwner: config.RepoOwner,
-		RepoName:  config.RepoName,
-		Sections:  sections,
+		RepoOwner:  config.RepoOwner,
+		RepoName:   config.RepoName,
+		WebBaseURL: webBaseURL,
+		Sections:   sections,
 	}
 }
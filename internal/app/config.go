@@ -1,13 +1,25 @@
 package app
 
+// Labels fallbacks (for providers without labels, see Config.LabelsFallback)
+const (
+	LabelsFallbackNone         = ""              // no fallback
+	LabelsFallbackTitlePrefix  = "title-prefix"  // "feature: foo" => "feature" label ("fix!: foo" => "fix" and "breaking" labels)
+	LabelsFallbackBranchPrefix = "branch-prefix" // "feature/foo" source branch => "feature" label
+)
+
 // Config is the configuration of the application
 type Config struct {
 	RepoOwner                 string   // Repository owner name (organization)
 	RepoName                  string   // Repository name (without owner/organization part)
+	WebBaseURL                string   // Web base url of the GitHub instance (without trailing slash), empty => https://github.com
 	PullRequestMajorLabels    []string // list of labels for considering a PR as major (OR condition)
 	PullRequestMinorLabels    []string // list of labels for considering a PR as minor (OR condition)
 	PullRequestIgnoreLabels   []string // list of labels for completely ignoring a PR (OR condition)
 	PullRequestMustHaveLabels []string // list of labels a PR must have to be considered (OR condition), if empty => no filtering
 	MinimalDelayInSeconds     int      // minimal delay in seconds between a PR and a tag (if less, we consider that the tag is always AFTER the PR)
 	TagRegex                  string   // regex to match tags (if empty string => no filtering)
+	ResolveLinkedIssues       bool     // if true, resolve the issues closed by PRs (available in templates as .LinkedIssues)
+	UseLinkedIssuesLabels     bool     // if true, linked issues labels are also used for major/minor classification (implies ResolveLinkedIssues)
+	Concurrency               int      // maximum number of branches to fetch PRs for at the same time (<= 1 => sequential)
+	LabelsFallback            string   // how to guess labels of PRs without labels (see LabelsFallback* constants)
 }
@@ -6,4 +6,8 @@ type Port interface {
 	GetContainedTags(branch string) ([]*Tag, error)
 	GuessGHRepo() (owner string, repo string)
 	GuessDefaultBranch() string
+	// GetRemoteUrls returns the (fetch) urls of the configured remotes (indexed by remote name).
+	GetRemoteUrls() (map[string]string, error)
+	// GetBranchHeadSha returns the sha of the last commit of the given branch (of the remote).
+	GetBranchHeadSha(branch string) (string, error)
 }
@@ -0,0 +1,141 @@
+package app
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/fabien-marty/github-next-semantic-version/internal/app/repo"
+)
+
+// findVersionMilestone returns the milestone named after the given version (nil if not found)
+//
+// A milestone with exactly the same title is preferred, else the first one with a title
+// parsed as the same semantic version (example: "1.4.0" or "1.4" for "v1.4.0").
+func findVersionMilestone(milestones []*repo.Milestone, version *semver.Version) *repo.Milestone {
+	for _, milestone := range milestones {
+		if milestone.Title == version.Original() {
+			return milestone
+		}
+	}
+	for _, milestone := range milestones {
+		v, err := semver.NewVersion(milestone.Title)
+		if err == nil && v.Equal(version) {
+			return milestone
+		}
+	}
+	return nil
+}
+
+// nextMilestoneTitle returns the title of the milestone following the given version
+// (with the "v" prefix if the given title has one and with the same number of version
+// components, example: "1.4" => "1.5", as long as the bump can be expressed with them)
+func nextMilestoneTitle(title string, version *semver.Version, bump string) (string, error) {
+	var next semver.Version
+	var minComponents int
+	switch bump {
+	case "major":
+		next = version.IncMajor()
+		minComponents = 1
+	case "minor", "":
+		next = version.IncMinor()
+		minComponents = 2
+	case "patch":
+		next = version.IncPatch()
+		minComponents = 3
+	default:
+		return "", fmt.Errorf("bad milestone bump: %s (must be 'major', 'minor' or 'patch')", bump)
+	}
+	nextTitle := next.String()
+	components := strings.Count(strings.TrimPrefix(title, "v"), ".") + 1
+	if next.Prerelease() == "" && next.Metadata() == "" && components < 3 {
+		switch max(components, minComponents) {
+		case 1:
+			nextTitle = fmt.Sprintf("%d", next.Major())
+		case 2:
+			nextTitle = fmt.Sprintf("%d.%d", next.Major(), next.Minor())
+		}
+	}
+	if strings.HasPrefix(title, "v") {
+		return "v" + nextTitle, nil
+	}
+	return nextTitle, nil
+}
+
+// updateMilestones closes the milestone named after the given (new) version and moves its open
+// issues/pull requests to the next milestone (created if it doesn't exist, see nextMilestoneTitle)
+//
+// It's idempotent (a closed milestone is not closed again, an existing next milestone is reused). If there
+// is no milestone named after the given version, only the next milestone is created. In dry-run mode,
+// nothing is changed (actions are only logged).
+func (s *Service) updateMilestones(newTag string, bump string, dryRun bool) error {
+	logger := s.logger.With(slog.String("tagName", newTag), slog.Bool("dryRun", dryRun))
+	version, err := semver.NewVersion(newTag)
+	if err != nil {
+		return fmt.Errorf("can't parse the version %s: %w", newTag, err)
+	}
+	milestones, err := s.RepoAdapter.GetMilestones()
+	if err != nil {
+		return err
+	}
+	current := findVersionMilestone(milestones, version)
+	title := newTag
+	if current != nil {
+		title = current.Title
+	} else {
+		logger.Info("no milestone named after the new version => let's only create the next one")
+	}
+	nextTitle, err := nextMilestoneTitle(title, version, bump)
+	if err != nil {
+		return err
+	}
+	nextVersion, err := semver.NewVersion(nextTitle)
+	if err != nil {
+		return fmt.Errorf("can't parse the next milestone title %s: %w", nextTitle, err)
+	}
+	next := findVersionMilestone(milestones, nextVersion)
+	switch {
+	case next != nil:
+		logger.Debug("the next milestone already exists", slog.String("milestone", next.Title))
+	case dryRun:
+		logger.Info("the next milestone would be created", slog.String("milestone", nextTitle))
+	default:
+		next, err = s.RepoAdapter.CreateMilestone(nextTitle)
+		if err != nil {
+			return err
+		}
+		logger.Info("next milestone created", slog.String("milestone", next.Title))
+	}
+	if current == nil {
+		return nil
+	}
+	items, err := s.RepoAdapter.GetMilestoneOpenItems(current)
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		if dryRun {
+			logger.Info("the issue/PR would be moved to the next milestone", slog.Int("number", item.Number), slog.String("milestone", nextTitle))
+			continue
+		}
+		err = s.RepoAdapter.SetMilestone(item, next)
+		if err != nil {
+			return err
+		}
+		logger.Debug("issue/PR moved to the next milestone", slog.Int("number", item.Number), slog.String("milestone", next.Title))
+	}
+	switch {
+	case current.Closed:
+		logger.Debug("the milestone is already closed", slog.String("milestone", current.Title))
+	case dryRun:
+		logger.Info("the milestone would be closed", slog.String("milestone", current.Title))
+	default:
+		err = s.RepoAdapter.CloseMilestone(current)
+		if err != nil {
+			return err
+		}
+		logger.Info("milestone closed", slog.String("milestone", current.Title))
+	}
+	return nil
+}
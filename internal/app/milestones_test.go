@@ -0,0 +1,101 @@
+package app
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/fabien-marty/github-next-semantic-version/internal/app/changelog"
+	"github.com/fabien-marty/github-next-semantic-version/internal/app/git"
+	"github.com/fabien-marty/github-next-semantic-version/internal/app/repo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindVersionMilestone(t *testing.T) {
+	milestones := []*repo.Milestone{{ID: 1, Title: "Backlog"}, {ID: 2, Title: "1.4"}, {ID: 3, Title: "v1.4.0"}, {ID: 4, Title: "1.5.0"}}
+	assert.Equal(t, int64(3), findVersionMilestone(milestones, semver.MustParse("v1.4.0")).ID)
+	assert.Equal(t, int64(2), findVersionMilestone(milestones, semver.MustParse("1.4.0")).ID)
+	assert.Equal(t, int64(4), findVersionMilestone(milestones, semver.MustParse("v1.5.0")).ID)
+	assert.Nil(t, findVersionMilestone(milestones, semver.MustParse("v2.0.0")))
+}
+
+func TestNextMilestoneTitle(t *testing.T) {
+	version := semver.MustParse("v1.4.2")
+	for bump, expected := range map[string]string{"": "v1.5.0", "minor": "v1.5.0", "major": "v2.0.0", "patch": "v1.4.3"} {
+		title, err := nextMilestoneTitle("v1.4.2", version, bump)
+		require.NoError(t, err)
+		assert.Equal(t, expected, title)
+	}
+	title, err := nextMilestoneTitle("1.4.2", version, "minor")
+	require.NoError(t, err)
+	assert.Equal(t, "1.5.0", title)
+	// the number of version components of the title is kept (if the bump can be expressed with them)
+	version = semver.MustParse("1.4")
+	for bump, expected := range map[string]string{"minor": "1.5", "major": "2.0", "patch": "1.4.1"} {
+		title, err = nextMilestoneTitle("1.4", version, bump)
+		require.NoError(t, err)
+		assert.Equal(t, expected, title)
+	}
+	title, err = nextMilestoneTitle("v1", semver.MustParse("v1"), "major")
+	require.NoError(t, err)
+	assert.Equal(t, "v2", title)
+	_, err = nextMilestoneTitle("1.4.2", version, "foo")
+	assert.Error(t, err)
+}
+
+func TestCreateReleaseUpdatesMilestones(t *testing.T) {
+	gitAdapter := &gitDummyAdapter{tags: []*git.Tag{git.NewTag("v1.3.0", time.Now())}}
+	now := time.Now()
+	repoAdapter := &repoDummyAdapter{
+		prs:            []*repo.PullRequest{{Number: 1, Title: "PR1", Labels: []string{"feature"}, MergedAt: &now}},
+		milestones:     []*repo.Milestone{{ID: 1, Title: "1.4.0"}},
+		milestoneItems: map[int64][]repo.MilestoneItem{1: {{Number: 2}, {Number: 3, PullRequest: true}}},
+	}
+	config := NewDefaultConfig()
+	config.PullRequestMinorLabels = []string{"feature"}
+	service := NewService(config, repoAdapter, gitAdapter)
+
+	// dry-run => nothing is changed
+	newTag, err := service.CreateNextRelease([]string{"main"}, false, ReleaseOptions{Milestones: true, PostReleaseDryRun: true})
+	require.NoError(t, err)
+	assert.Equal(t, "v1.4.0", newTag)
+	assert.Len(t, repoAdapter.milestones, 1)
+	assert.False(t, repoAdapter.milestones[0].Closed)
+
+	// re-runs (with the already published release) are idempotent
+	for i := 0; i < 2; i++ {
+		_, err = service.CreateNextRelease([]string{"main"}, false, ReleaseOptions{Milestones: true})
+		require.NoError(t, err)
+		assert.Equal(t, []*repo.Milestone{{ID: 1, Title: "1.4.0", Closed: true}, {ID: 2, Title: "1.5.0"}}, repoAdapter.milestones)
+		assert.Len(t, repoAdapter.milestoneItems[1], 0)
+		assert.Equal(t, []repo.MilestoneItem{{Number: 2}, {Number: 3, PullRequest: true}}, repoAdapter.milestoneItems[2])
+	}
+
+	// no milestone named after the new version => only the next one is created
+	repoAdapter.milestones = nil
+	_, err = service.CreateNextRelease([]string{"main"}, false, ReleaseOptions{Milestones: true, MilestoneNextBump: "patch"})
+	require.NoError(t, err)
+	assert.Equal(t, []*repo.Milestone{{ID: 1, Title: "v1.4.1"}}, repoAdapter.milestones)
+}
+
+func TestGenerateChangelogWithMilestone(t *testing.T) {
+	now, err := time.Parse("2006-01-02", "2024-01-02")
+	require.NoError(t, err)
+	mergedAt := now.Add(2 * time.Hour)
+	gitAdapter := &gitDummyAdapter{tags: []*git.Tag{git.NewTag("1.0.0", now.Add(1*time.Hour))}}
+	repoAdapter := &repoDummyAdapter{
+		prs: []*repo.PullRequest{
+			{Number: 1, Title: "PR1", MergedAt: &mergedAt, Milestone: "1.1.0"},
+			{Number: 2, Title: "PR2", MergedAt: &mergedAt, Milestone: "1.2.0"},
+			{Number: 3, Title: "PR3", MergedAt: &mergedAt},
+		},
+	}
+	service := NewService(NewDefaultConfig(), repoAdapter, gitAdapter)
+	res, err := service.GenerateChangelog([]string{"main"}, true, true, "", "1.1.0", changelog.DefaultTemplateString)
+	require.NoError(t, err)
+	assert.Contains(t, res, "PR1")
+	assert.NotContains(t, res, "PR2")
+	assert.NotContains(t, res, "PR3")
+	assert.Len(t, repoAdapter.prs, 3)
+}
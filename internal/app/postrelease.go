@@ -0,0 +1,139 @@
+package app
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/Masterminds/sprig/v3"
+	"github.com/fabien-marty/github-next-semantic-version/internal/app/repo"
+)
+
+// NextRelease is a release prepared by Service.DryRunNextRelease (or internally by Service.CreateNextRelease)
+type NextRelease struct {
+	OldTag  string              // latest tag
+	Options repo.ReleaseOptions // options of the release to create (i.e. the would-be API payload)
+	Assets  []repo.ReleaseAsset // assets to upload (the generated checksums file included)
+
+	prs             []*repo.PullRequest
+	commentTemplate *template.Template
+}
+
+// releasedCommentData is the data given to the released pull request comment template
+type releasedCommentData struct {
+	NewVersion  string
+	OldVersion  string
+	Branch      string
+	Name        string // name of the release
+	PullRequest *repo.PullRequest
+}
+
+// parseReleasedCommentTemplate parses the released pull request comment template (nil if empty)
+func parseReleasedCommentTemplate(commentTemplateString string) (*template.Template, error) {
+	if commentTemplateString == "" {
+		return nil, nil
+	}
+	commentTemplate, err := template.New("comment").Funcs(sprig.FuncMap()).Parse(commentTemplateString)
+	if err != nil {
+		return nil, fmt.Errorf("can't parse the pull request comment template: %w", err)
+	}
+	return commentTemplate, nil
+}
+
+// updateReleasedPullRequest adds the comment (if commentTemplate is not nil) and the label (if not empty)
+// to the given released pull request
+//
+// To be idempotent, the comment is not added if the pull request already has a comment with the same body
+// and the label is not added if the pull request already has it. In dry-run mode, nothing is changed
+// (actions are only logged).
+func (s *Service) updateReleasedPullRequest(pr *repo.PullRequest, commentTemplate *template.Template, data releasedCommentData, label string, dryRun bool) error {
+	logger := s.logger.With(slog.Int("number", pr.Number), slog.Bool("dryRun", dryRun))
+	if commentTemplate != nil {
+		data.PullRequest = pr
+		var buf bytes.Buffer
+		err := commentTemplate.Execute(&buf, data)
+		if err != nil {
+			return fmt.Errorf("can't execute the pull request comment template: %w", err)
+		}
+		comment := strings.TrimSpace(buf.String())
+		comments, err := s.RepoAdapter.GetPullRequestComments(pr)
+		if err != nil {
+			return err
+		}
+		switch {
+		case comment == "":
+			logger.Debug("empty comment => no comment")
+		case slices.ContainsFunc(comments, func(c string) bool { return strings.TrimSpace(c) == comment }):
+			logger.Debug("the pull request is already commented => no comment")
+		case dryRun:
+			logger.Info("the pull request would be commented", slog.String("comment", comment))
+		default:
+			err = s.RepoAdapter.AddPullRequestComment(pr, comment)
+			if err != nil {
+				return err
+			}
+			logger.Debug("pull request commented")
+		}
+	}
+	if label != "" {
+		switch {
+		case slices.Contains(pr.Labels, label):
+			logger.Debug("the pull request already has the label => no label added", slog.String("label", label))
+		case dryRun:
+			logger.Info("the label would be added to the pull request", slog.String("label", label))
+		default:
+			err := s.RepoAdapter.AddPullRequestLabel(pr, label)
+			if err != nil {
+				return err
+			}
+			logger.Debug("label added to the pull request", slog.String("label", label))
+		}
+	}
+	return nil
+}
+
+// updateReleasedPullRequests calls updateReleasedPullRequest on each given pull request
+// (errors don't stop the loop, they are joined)
+func (s *Service) updateReleasedPullRequests(prs []*repo.PullRequest, commentTemplate *template.Template, data releasedCommentData, label string, dryRun bool) error {
+	if commentTemplate == nil && label == "" {
+		return nil
+	}
+	var errs []error
+	for _, pr := range prs {
+		err := s.updateReleasedPullRequest(pr, commentTemplate, data, label, dryRun)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("pull request #%d: %w", pr.Number, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// postRelease comments/labels the released PRs and updates the milestones (if the release is not a draft)
+//
+// For a draft release, nothing is done: it will be done by the first run finding the release published
+// (example: a draft published by hand, see createOrUpdateRelease).
+func (s *Service) postRelease(next *NextRelease, draft bool, opts ReleaseOptions, dryRun bool) error {
+	newTag := next.Options.TagName
+	if draft {
+		if next.commentTemplate != nil || opts.ReleasedLabel != "" || opts.Milestones {
+			s.logger.Info("draft release => released PRs are not commented/labelled (and milestones are not updated) until a run finds it published", slog.String("tagName", newTag))
+		}
+		return nil
+	}
+	commentData := releasedCommentData{NewVersion: newTag, OldVersion: next.OldTag, Branch: next.Options.Base, Name: next.Options.GetName()}
+	err := s.updateReleasedPullRequests(next.prs, next.commentTemplate, commentData, opts.ReleasedLabel, dryRun)
+	if err != nil {
+		return fmt.Errorf("can't comment/label the PRs of the release %s: %w", newTag, err)
+	}
+	if opts.Milestones {
+		err = s.updateMilestones(newTag, opts.MilestoneNextBump, dryRun)
+		if err != nil {
+			return fmt.Errorf("can't update the milestones of the release %s: %w", newTag, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package app
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fabien-marty/github-next-semantic-version/internal/app/git"
+	"github.com/fabien-marty/github-next-semantic-version/internal/app/repo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateReleaseCommentsAndLabelsPullRequests(t *testing.T) {
+	gitAdapter := &gitDummyAdapter{tags: []*git.Tag{git.NewTag("v1.0.0", time.Now())}}
+	now := time.Now()
+	repoAdapter := &repoDummyAdapter{
+		prs: []*repo.PullRequest{
+			{Number: 1, Title: "PR1", Labels: []string{}, MergedAt: &now},
+			{Number: 2, Title: "PR2", Labels: []string{"released"}, MergedAt: &now},
+		},
+		comments: map[int][]string{2: {"LGTM", "Released in v1.0.1 (PR2)\n"}},
+	}
+	service := NewService(NewDefaultConfig(), repoAdapter, gitAdapter)
+	opts := ReleaseOptions{
+		CommentTemplate: "Released in {{ .NewVersion }} ({{ .PullRequest.Title }})",
+		ReleasedLabel:   "released",
+	}
+
+	// draft releases => PRs are not commented/labelled
+	_, err := service.CreateNextRelease([]string{"main"}, false, ReleaseOptions{CommentTemplate: opts.CommentTemplate, ReleasedLabel: opts.ReleasedLabel, Draft: true})
+	require.NoError(t, err)
+	assert.Len(t, repoAdapter.comments[1], 0)
+	assert.Len(t, repoAdapter.labels, 0)
+
+	// the draft is published in post-release dry-run mode => nothing is changed
+	_, err = service.CreateNextRelease([]string{"main"}, false, ReleaseOptions{CommentTemplate: opts.CommentTemplate, ReleasedLabel: opts.ReleasedLabel, PostReleaseDryRun: true})
+	require.NoError(t, err)
+	assert.Len(t, repoAdapter.comments[1], 0)
+	assert.Len(t, repoAdapter.labels, 0)
+
+	// re-runs find the published release => already commented/labelled PRs are not commented/labelled again
+	for i := 0; i < 2; i++ {
+		newTag, err := service.CreateNextRelease([]string{"main"}, false, opts)
+		require.NoError(t, err)
+		assert.Equal(t, "v1.0.1", newTag)
+		assert.Equal(t, []repo.ReleaseOptions{{Base: "main", TagName: "v1.0.1", Name: "v1.0.1"}}, repoAdapter.releases)
+		assert.Equal(t, []string{"Released in v1.0.1 (PR1)"}, repoAdapter.comments[1])
+		assert.Equal(t, []string{"LGTM", "Released in v1.0.1 (PR2)\n"}, repoAdapter.comments[2])
+		assert.Equal(t, map[int][]string{1: {"released"}}, repoAdapter.labels)
+		repoAdapter.prs[0].Labels = []string{"released"}
+	}
+
+	// errors don't stop the loop
+	repoAdapter.prs = append([]*repo.PullRequest{{Number: -1, Title: "PR-1", Labels: []string{}, MergedAt: &now}}, repoAdapter.prs...)
+	repoAdapter.prs = append(repoAdapter.prs, &repo.PullRequest{Number: 3, Title: "PR3", Labels: []string{}, MergedAt: &now})
+	_, err = service.CreateNextRelease([]string{"main"}, false, opts)
+	assert.ErrorContains(t, err, "can't comment/label the PRs of the release v1.0.1: pull request #-1: comment failure")
+	assert.Equal(t, []string{"Released in v1.0.1 (PR3)"}, repoAdapter.comments[3])
+
+	// the comment template is parsed before doing anything
+	_, err = service.CreateNextRelease([]string{"main"}, false, ReleaseOptions{CommentTemplate: "{{ .Foo", BodyTemplate: "changed"})
+	assert.ErrorContains(t, err, "can't parse the pull request comment template")
+	assert.Equal(t, []repo.ReleaseOptions{{Base: "main", TagName: "v1.0.1", Name: "v1.0.1"}}, repoAdapter.releases)
+}
+
+func TestCreateReleaseCommentsPullRequestsOfDraftPublishedByHand(t *testing.T) {
+	gitAdapter := &gitDummyAdapter{tags: []*git.Tag{git.NewTag("v1.0.0", time.Now())}}
+	now := time.Now()
+	repoAdapter := &repoDummyAdapter{
+		prs: []*repo.PullRequest{{Number: 1, Title: "PR1", Labels: []string{}, MergedAt: &now}},
+	}
+	service := NewService(NewDefaultConfig(), repoAdapter, gitAdapter)
+	opts := ReleaseOptions{Draft: true, BodyTemplate: "body", CommentTemplate: "Released in {{ .NewVersion }}", ReleasedLabel: "released"}
+
+	_, err := service.CreateNextRelease([]string{"main"}, false, opts)
+	require.NoError(t, err)
+	assert.Len(t, repoAdapter.comments, 0)
+	assert.Len(t, repoAdapter.labels, 0)
+
+	// the draft is published by hand => the next run (with the same options) comments/labels the PRs
+	// (without touching the release)
+	repoAdapter.releases[0].Draft = false
+	_, err = service.CreateNextRelease([]string{"main"}, false, opts)
+	require.NoError(t, err)
+	assert.Equal(t, []repo.ReleaseOptions{{Base: "main", TagName: "v1.0.1", Name: "v1.0.1", Body: "body"}}, repoAdapter.releases)
+	assert.Equal(t, map[int][]string{1: {"Released in v1.0.1"}}, repoAdapter.comments)
+	assert.Equal(t, map[int][]string{1: {"released"}}, repoAdapter.labels)
+}
@@ -1,18 +1,164 @@
 package repo
 
-import "time"
+import (
+	"bytes"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
 
 // PullRequest represents a pull request.
 type PullRequest struct {
-	Number      int        // pull request number
-	Title       string     // pull request title
-	MergedAt    *time.Time // pull request merge date (nil if not merged)
-	UpdatedAt   *time.Time // pull request updated date (code, label...)
-	Labels      []string   // pull request labels
-	Branch      string     // pull request branch
-	Url         string     // pull request url
-	AuthorLogin string     // pull request author login
-	AuthorUrl   string     // pull request author url
+	Number             int        // pull request number
+	Title              string     // pull request title
+	MergedAt           *time.Time // pull request merge date (nil if not merged)
+	UpdatedAt          *time.Time // pull request updated date (code, label...)
+	Labels             []string   // pull request labels
+	Branch             string     // pull request branch
+	Url                string     // pull request url
+	AuthorLogin        string     // pull request author login
+	AuthorUrl          string     // pull request author url
+	Body               string     // pull request body (description)
+	Draft              bool       // true if the pull request is a draft
+	Milestone          string     // pull request milestone title (empty if no milestone)
+	Assignees          []string   // pull request assignees logins
+	RequestedReviewers []string   // pull request requested reviewers logins (or team slugs)
+	ApprovingReviewers []string   // logins of the reviewers who approved the pull request (empty if unknown, see the repo adapter)
+	BaseBranch         string     // pull request base (target) branch
+	MergeCommitSha     string     // pull request merge commit sha (empty if not merged)
+	CreatedAt          *time.Time // pull request creation date
+	ClosedAt           *time.Time // pull request close date (nil if not closed)
+	MergedBy           string     // login of the user who merged the pull request (empty if not merged or unknown, see the repo adapter)
+	LinkedIssues       []*Issue   // issues closed by the pull request (nil if not resolved, see repo.Port.GetLinkedIssues)
+}
+
+// Issue represents an issue (linked to a pull request).
+type Issue struct {
+	Number int      // issue number
+	Title  string   // issue title
+	Url    string   // issue url
+	Labels []string // issue labels
+}
+
+// ReleaseOptions are the options of a release creation (see Port.CreateRelease)
+type ReleaseOptions struct {
+	Base       string // base branch (the release targets its head if TargetSha is empty)
+	TagName    string // name of the tag to create
+	Name       string // release name (empty => TagName)
+	Body       string // release body (notes)
+	Draft      bool   // if true, the release is created in draft mode
+	Prerelease bool   // if true, the release is marked as a prerelease
+	MakeLatest string // "true", "false" or "legacy" (GitHub only, see the GitHub API), empty => "true"
+	TargetSha  string // exact commit sha to tag (empty => the head of Base at creation time)
+}
+
+// GetName returns the release name (TagName if Name is empty)
+func (o ReleaseOptions) GetName() string {
+	if o.Name == "" {
+		return o.TagName
+	}
+	return o.Name
+}
+
+// GetTarget returns the release target (TargetSha if set, else Base)
+func (o ReleaseOptions) GetTarget() string {
+	if o.TargetSha == "" {
+		return o.Base
+	}
+	return o.TargetSha
+}
+
+// Release represents a created release.
+type Release struct {
+	ID      int64  // provider id of the release (0 if the provider identifies releases by their tag)
+	TagName string // tag name of the release
+	Name    string // name of the release
+	Draft   bool   // true if the release is a draft
+}
+
+// ReleaseAsset represents a file to upload to a release.
+type ReleaseAsset struct {
+	Name        string // name of the asset in the release
+	ContentType string // content type of the asset (empty => application/octet-stream)
+	Path        string // local path of the asset content (used if Content is nil)
+	Content     []byte // in-memory content of the asset (example: a generated checksums file)
+}
+
+// GetContentType returns the content type of the asset (application/octet-stream if not set)
+func (a ReleaseAsset) GetContentType() string {
+	if a.ContentType == "" {
+		return "application/octet-stream"
+	}
+	return a.ContentType
+}
+
+// Open returns a reader on the asset content (to close by the caller) and its size
+// (it can be called several times, for example to retry an upload)
+func (a ReleaseAsset) Open() (io.ReadCloser, int64, error) {
+	if a.Content != nil {
+		return io.NopCloser(bytes.NewReader(a.Content)), int64(len(a.Content)), nil
+	}
+	f, err := os.Open(a.Path)
+	if err != nil {
+		return nil, 0, err
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	return f, stat.Size(), nil
+}
+
+// ReadAll returns the full content of the asset
+func (a ReleaseAsset) ReadAll() ([]byte, error) {
+	if a.Content != nil {
+		return a.Content, nil
+	}
+	return os.ReadFile(a.Path)
+}
+
+// Milestone represents a milestone.
+type Milestone struct {
+	ID     int64  // provider id (or number) of the milestone
+	Title  string // milestone title
+	Closed bool   // true if the milestone is closed
+}
+
+// MilestoneItem represents an issue or a pull request of a milestone.
+type MilestoneItem struct {
+	Number      int  // issue or pull request number
+	PullRequest bool // true if the item is a pull request
+}
+
+// titlePrefixRegex matches a "type(scope)!: " title prefix (scope and ! are optional)
+var titlePrefixRegex = regexp.MustCompile(`^\s*([\w-][\w -]*?)\s*(?:\([^)]*\))?\s*(!)?\s*:`)
+
+// LabelsFromTitlePrefix returns labels guessed from the pull request title prefix
+// (example: "feature: foo" => ["feature"], "fix(parser)!: foo" => ["fix", "breaking"]), empty if no prefix
+func (pr *PullRequest) LabelsFromTitlePrefix() []string {
+	match := titlePrefixRegex.FindStringSubmatch(pr.Title)
+	if match == nil {
+		return []string{}
+	}
+	res := []string{match[1]}
+	if match[2] != "" {
+		res = append(res, "breaking")
+	}
+	return res
+}
+
+// LabelsFromBranchPrefix returns labels guessed from the pull request (source) branch prefix
+// (example: "feature/foo" => ["feature"]), empty if no prefix
+func (pr *PullRequest) LabelsFromBranchPrefix() []string {
+	prefix, _, found := strings.Cut(pr.Branch, "/")
+	if !found || prefix == "" {
+		return []string{}
+	}
+	return []string{prefix}
 }
 
 // HasThisLabel returns true if the pull request has the given label
@@ -37,6 +183,18 @@ func (pr *PullRequest) HasOneOfTheseLabels(labels []string) bool {
 	return false
 }
 
+// LinkedIssuesHaveOneOfTheseLabels returns true if at least one of the linked issues has at least one of the given labels.
+func (pr *PullRequest) LinkedIssuesHaveOneOfTheseLabels(labels []string) bool {
+	for _, issue := range pr.LinkedIssues {
+		for _, label := range issue.Labels {
+			if slices.Contains(labels, label) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // IsMajor returns true if the pull request is a major one.
 // A pull request is considered major if it has at least one of the major labels.
 func (pr *PullRequest) IsMajor(majorLabels []string) bool {
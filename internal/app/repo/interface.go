@@ -1,13 +1,19 @@
 package repo
 
+import "time"
+
 // Port is the interface that must be implemented by repo adapters.
 type Port interface {
 
-	// GetPullRequestsSince returns the list of pull requests (targetting the given base)
+	// GetPullRequests returns the list of pull requests (targetting the given base)
 	// If onlyMerged is true, only the merged pull requests
 	// If onlyMerged is false, merged pull requests + (still) open pull requests.
 	GetPullRequests(base string, onlyMerged bool) ([]*PullRequest, error)
 
+	// GetPullRequestsSince is like GetPullRequests but merged pull requests merged before
+	// the given time are not returned (and implementations should avoid fetching them).
+	GetPullRequestsSince(base string, onlyMerged bool, since time.Time) ([]*PullRequest, error)
+
 	// GetLastUpdatedPullRequests returns the first page of pull requests (targetting the given base)
 	// sorted by "last updated". This method doesn't paginate so you won't get all the pull requests
 	// (only the first page).
@@ -16,5 +22,49 @@ type Port interface {
 	// The list is sorted by updatedAt (descending).
 	GetLastUpdatedPullRequests(base string, onlyMerged bool) ([]*PullRequest, error)
 
-	CreateRelease(base string, tagName string, body string, draft bool) error
+	// GetLinkedIssues returns the issues closed by the given pull request
+	// (if pr.LinkedIssues is not nil, the adapter already resolved them and they are returned as is).
+	GetLinkedIssues(pr *PullRequest) ([]*Issue, error)
+
+	// CreateRelease creates a release (and the corresponding tag) with the given options
+	// (options not supported by the provider are ignored or return an error, see the repo adapter).
+	CreateRelease(opts ReleaseOptions) (*Release, error)
+
+	// GetLastReleases returns the most recent releases (drafts included if the credentials allow it)
+	// sorted by creation date (descending). This method doesn't paginate (only the first page).
+	GetLastReleases() ([]*Release, error)
+
+	// UpdateRelease updates the given release (returned by CreateRelease or GetLastReleases) with the given
+	// options (the tag name and the target included, to retarget a draft release).
+	UpdateRelease(release *Release, opts ReleaseOptions) (*Release, error)
+
+	// UploadReleaseAsset uploads the given asset to the given release (returned by CreateRelease)
+	// (an existing asset with the same name, for example a partial upload, is replaced).
+	UploadReleaseAsset(release *Release, asset ReleaseAsset) error
+
+	// GetPullRequestComments returns the bodies of the (general, not review) comments of the given pull request
+	// (in creation order).
+	GetPullRequestComments(pr *PullRequest) ([]string, error)
+
+	// AddPullRequestComment adds a (general) comment with the given body to the given pull request.
+	AddPullRequestComment(pr *PullRequest, body string) error
+
+	// AddPullRequestLabel adds the given label to the given pull request (adding a label already set
+	// is not an error, a missing label is created or returns an error, see the repo adapter).
+	AddPullRequestLabel(pr *PullRequest, label string) error
+
+	// GetMilestones returns all the milestones (open and closed).
+	GetMilestones() ([]*Milestone, error)
+
+	// CreateMilestone creates an (open) milestone with the given title.
+	CreateMilestone(title string) (*Milestone, error)
+
+	// CloseMilestone closes the given milestone (returned by GetMilestones or CreateMilestone).
+	CloseMilestone(milestone *Milestone) error
+
+	// GetMilestoneOpenItems returns the open issues and pull requests of the given milestone.
+	GetMilestoneOpenItems(milestone *Milestone) ([]MilestoneItem, error)
+
+	// SetMilestone sets the milestone of the given issue or pull request.
+	SetMilestone(item MilestoneItem, milestone *Milestone) error
 }
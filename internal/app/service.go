@@ -9,6 +9,8 @@ import (
 	"regexp"
 	"slices"
 	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/Masterminds/sprig/v3"
@@ -98,11 +100,36 @@ func (s *Service) getContainedTags(branches []string, since *time.Time) ([]*git.
 	return res, nil
 }
 
+// applyLabelsFallback sets guessed labels (see Config.LabelsFallback) on PRs without labels
+func (s *Service) applyLabelsFallback(prs []*repo.PullRequest) {
+	for _, pr := range prs {
+		if len(pr.Labels) > 0 {
+			continue
+		}
+		switch s.Config.LabelsFallback {
+		case LabelsFallbackTitlePrefix:
+			pr.Labels = pr.LabelsFromTitlePrefix()
+		case LabelsFallbackBranchPrefix:
+			pr.Labels = pr.LabelsFromBranchPrefix()
+		default:
+			continue
+		}
+		s.logger.Debug("labels guessed", slog.Int("number", pr.Number), slog.Any("labels", pr.Labels))
+	}
+}
+
 // getPullRequests returns the list of PRs merged since the given time
 // (the list from the adapter is optionally filtered by the PullRequestIgnoreLabels configuration)
 // the returned slice is sorted by (ascending) mergedAt
 func (s *Service) getPullRequestsSingleBranch(branch string, since *time.Time, onlyMerged bool) ([]*repo.PullRequest, error) {
-	prs, err := s.RepoAdapter.GetPullRequests(branch, onlyMerged)
+	var prs []*repo.PullRequest
+	var err error
+	if since != nil {
+		prs, err = s.RepoAdapter.GetPullRequestsSince(branch, onlyMerged, *since)
+	} else {
+		prs, err = s.RepoAdapter.GetPullRequests(branch, onlyMerged)
+	}
+	s.applyLabelsFallback(prs)
 	prs = slices.DeleteFunc(prs, func(pr *repo.PullRequest) bool {
 		mergedAt := pr.MergedAt
 		if since != nil && mergedAt != nil && mergedAt.Before((*since).Add(time.Second*time.Duration(s.Config.MinimalDelayInSeconds))) {
@@ -120,6 +147,14 @@ func (s *Service) getPullRequestsSingleBranch(branch string, since *time.Time, o
 		}
 		return false
 	})
+	if err == nil && (s.Config.ResolveLinkedIssues || s.Config.UseLinkedIssuesLabels) {
+		for _, pr := range prs {
+			pr.LinkedIssues, err = s.RepoAdapter.GetLinkedIssues(pr)
+			if err != nil {
+				return nil, fmt.Errorf("can't get the issues linked to the PR #%d: %w", pr.Number, err)
+			}
+		}
+	}
 	sort.Slice(prs, func(i, j int) bool {
 		if prs[i].MergedAt == nil {
 			return false
@@ -133,14 +168,58 @@ func (s *Service) getPullRequestsSingleBranch(branch string, since *time.Time, o
 }
 
 func (s *Service) getPullRequests(branches []string, since *time.Time, onlyMerged bool) ([]*repo.PullRequest, error) {
+	// branches are fetched concurrently (bounded by Config.Concurrency)
+	// but results are concatenated in the branches order (to stay deterministic)
+	results := make([][]*repo.PullRequest, len(branches))
+	errs := make([]error, len(branches))
+	sem := make(chan struct{}, max(s.Config.Concurrency, 1))
+	var wg sync.WaitGroup
+	for i, branch := range branches {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			results[i], errs[i] = s.getPullRequestsSingleBranch(branch, since, onlyMerged)
+		}()
+	}
+	wg.Wait()
+	res := []*repo.PullRequest{}
+	for i := range branches {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		res = append(res, results[i]...)
+	}
+	return res, nil
+}
+
+// ExportPullRequests returns the pull requests targetting the given branches as returned by the repo adapter
+// (no label filtering, no labels fallback, duplicates removed), sorted by number
+// (with ResolveLinkedIssues, the linked issues are also resolved)
+func (s *Service) ExportPullRequests(branches []string, onlyMerged bool) ([]*repo.PullRequest, error) {
 	res := []*repo.PullRequest{}
 	for _, branch := range branches {
-		prs, err := s.getPullRequestsSingleBranch(branch, since, onlyMerged)
+		prs, err := s.RepoAdapter.GetPullRequests(branch, onlyMerged)
 		if err != nil {
 			return nil, err
 		}
-		res = append(res, prs...)
+		for _, pr := range prs {
+			if slices.ContainsFunc(res, func(p *repo.PullRequest) bool { return p.Number == pr.Number }) {
+				continue
+			}
+			if s.Config.ResolveLinkedIssues {
+				pr.LinkedIssues, err = s.RepoAdapter.GetLinkedIssues(pr)
+				if err != nil {
+					return nil, fmt.Errorf("can't get the issues linked to the PR #%d: %w", pr.Number, err)
+				}
+			}
+			res = append(res, pr)
+		}
 	}
+	slices.SortFunc(res, func(a, b *repo.PullRequest) int {
+		return a.Number - b.Number
+	})
 	return res, nil
 }
 
@@ -158,6 +237,24 @@ func (s *Service) getLatestSemanticNonPrereleaseTag(branches []string) (*git.Tag
 	return tags[len(tags)-1], nil
 }
 
+// isMajor returns true if the given PR is a major one
+// (with UseLinkedIssuesLabels, the labels of the linked issues are also considered)
+func (s *Service) isMajor(pr *repo.PullRequest) bool {
+	if pr.IsMajor(s.Config.PullRequestMajorLabels) {
+		return true
+	}
+	return s.Config.UseLinkedIssuesLabels && pr.LinkedIssuesHaveOneOfTheseLabels(s.Config.PullRequestMajorLabels)
+}
+
+// isMinor returns true if the given PR is a minor one
+// (with UseLinkedIssuesLabels, the labels of the linked issues are also considered)
+func (s *Service) isMinor(pr *repo.PullRequest) bool {
+	if pr.IsMinor(s.Config.PullRequestMinorLabels) {
+		return true
+	}
+	return s.Config.UseLinkedIssuesLabels && pr.LinkedIssuesHaveOneOfTheseLabels(s.Config.PullRequestMinorLabels)
+}
+
 // GetNextVersion returns the next semantic version based on the branch and the PRs merged since the last tag + PRs still opened (if onlyMerged is false)
 func (s *Service) GetNextVersion(branches []string, onlyMerged bool, dontIncrementIfNoPR bool) (oldVersion string, newVersion string, consideredPullRequests []*repo.PullRequest, err error) {
 	logger := s.logger
@@ -181,11 +278,11 @@ func (s *Service) GetNextVersion(branches []string, onlyMerged bool, dontIncreme
 			logger = logger.With(slog.String("mergedAt", pr.MergedAt.Format(time.RFC3339)))
 		}
 		consideredPullRequests = append(consideredPullRequests, pr)
-		if pr.IsMajor(s.Config.PullRequestMajorLabels) {
+		if s.isMajor(pr) {
 			logger.Debug("major PR found => break")
 			increment = major
 			break
-		} else if pr.IsMinor(s.Config.PullRequestMinorLabels) {
+		} else if s.isMinor(pr) {
 			logger.Debug("minor PR found")
 			if increment == nothing || increment == patch {
 				increment = minor
@@ -229,30 +326,259 @@ func (s *Service) getReleaseBodyFromPRs(prs []*repo.PullRequest, bodyTemplate *t
 	return body.String(), nil
 }
 
-func (s *Service) CreateNextRelease(branches []string, dontIncrementIfNoPR bool, draft bool, bodyTemplateString string) (newTag string, err error) {
+// TargetShaAuto is the special ReleaseOptions.TargetSha value to target the head of the branch
+// in the local repository (i.e. the commit used to compute the next version)
+const TargetShaAuto = "auto"
+
+// ReleaseOptions are the options of Service.CreateNextRelease
+type ReleaseOptions struct {
+	Draft        bool   // if true, the release is created in draft mode
+	RollingDraft bool   // if true, the most recent draft release created by a previous run is updated (retagged...) instead of creating a new one (implies Draft)
+	BodyTemplate string // golang template to generate the release body (data: the list of PRs)
+	NameTemplate string // golang template to generate the release name (data: .NewVersion, .OldVersion, .Branch), empty => the tag name
+	Prerelease   bool   // if true, the release is marked as a prerelease
+	MakeLatest   string // "true", "false" or "legacy" (see repo.ReleaseOptions), empty => "true"
+	TargetSha    string // exact commit sha to tag, TargetShaAuto => the head of the branch in the local repository, empty => the branch
+
+	Assets             []string // glob patterns of local files to upload to the release (with a generated checksums file, see ChecksumsAssetName)
+	AssetContentType   string   // content type of uploaded files, empty => guessed from the file extension
+	AssetUploadRetries int      // maximum number of retries of a failed asset upload
+
+	CommentTemplate   string // golang template to generate the comment added to each released PR (data: .NewVersion, .OldVersion, .Branch, .Name, .PullRequest), empty => no comment
+	ReleasedLabel     string // label added to each released PR, empty => no label
+	PostReleaseDryRun bool   // if true, the comments and labels of released PRs (and the milestones changes) are only logged (not done)
+
+	Milestones        bool   // if true, the milestone named after the new version is closed and its open issues/PRs are moved to the next milestone (created if needed)
+	MilestoneNextBump string // "major", "minor" or "patch": how the next milestone is computed from the new version, empty => "minor"
+}
+
+// releaseNameData is the data given to the release name template
+type releaseNameData struct {
+	NewVersion string
+	OldVersion string
+	Branch     string
+}
+
+func (s *Service) getReleaseName(nameTemplateString string, data releaseNameData) (string, error) {
+	if nameTemplateString == "" {
+		return data.NewVersion, nil
+	}
+	nameTemplate, err := template.New("name").Funcs(sprig.FuncMap()).Parse(nameTemplateString)
+	if err != nil {
+		return "", fmt.Errorf("can't parse the release name template: %w", err)
+	}
+	var name bytes.Buffer
+	err = nameTemplate.Execute(&name, data)
+	if err != nil {
+		return "", fmt.Errorf("can't execute the release name template: %w", err)
+	}
+	return strings.TrimSpace(name.String()), nil
+}
+
+// isRollingDraft returns true if the given draft release is a rolling draft created by a previous run
+// (and not a draft created by hand):
+//
+// - its tag matches the tag regex and is a possible next version of the latest tag (patch, minor or major increment)
+// - its name is the one given by the release name template for this tag
+func (s *Service) isRollingDraft(release *repo.Release, next *NextRelease, nameTemplate string) (bool, error) {
+	regex, err := regexp.Compile(s.Config.TagRegex)
+	if err != nil {
+		return false, fmt.Errorf("can't compile the regex %s: %w", s.Config.TagRegex, err)
+	}
+	if !regex.MatchString(release.TagName) {
+		return false, nil
+	}
+	oldTag := git.NewTag(next.OldTag, time.Time{})
+	if oldTag == nil || oldTag.Semver == nil {
+		return false, nil
+	}
+	candidates := []string{oldTag.NewName(oldTag.Semver.IncPatch()), oldTag.NewName(oldTag.Semver.IncMinor()), oldTag.NewName(oldTag.Semver.IncMajor())}
+	if !slices.Contains(candidates, release.TagName) {
+		return false, nil
+	}
+	name, err := s.getReleaseName(nameTemplate, releaseNameData{NewVersion: release.TagName, OldVersion: next.OldTag, Branch: next.Options.Base})
+	if err != nil {
+		return false, err
+	}
+	return release.Name == name, nil
+}
+
+// findExistingRelease returns the existing release with the tag of the given release (nil if not found)
+//
+// In rolling draft mode, if there is no release with the same tag, the most recent rolling draft release
+// (if any, see isRollingDraft) is returned.
+func (s *Service) findExistingRelease(next *NextRelease, opts ReleaseOptions) (*repo.Release, error) {
+	releases, err := s.RepoAdapter.GetLastReleases()
+	if err != nil {
+		return nil, err
+	}
+	for _, release := range releases {
+		if release.TagName == next.Options.TagName {
+			return release, nil
+		}
+	}
+	if opts.RollingDraft {
+		for _, release := range releases {
+			if !release.Draft {
+				continue
+			}
+			rollingDraft, err := s.isRollingDraft(release, next, opts.NameTemplate)
+			if err != nil {
+				return nil, err
+			}
+			if rollingDraft {
+				return release, nil
+			}
+			s.logger.Debug("draft release not created by a previous run => ignoring", slog.String("tagName", release.TagName), slog.String("name", release.Name))
+		}
+	}
+	return nil, nil
+}
+
+// createOrUpdateRelease creates the release with the given options but, to be idempotent, if a release
+// with the same tag already exists (see findExistingRelease):
+//
+// - if it's a draft, it's updated
+// - if it's published, it's returned as is
+//
+// In rolling draft mode, if there is no release with the same tag, the most recent rolling draft release (if any)
+// is updated (retagged, renamed...) instead of creating a new one.
+func (s *Service) createOrUpdateRelease(next *NextRelease, releaseOpts ReleaseOptions) (*repo.Release, error) {
+	opts := next.Options
+	logger := s.logger.With(slog.String("tagName", opts.TagName))
+	existing, err := s.findExistingRelease(next, releaseOpts)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case existing == nil:
+		logger.Debug("no existing release => let's create a new one")
+		return s.RepoAdapter.CreateRelease(opts)
+	case existing.Draft:
+		logger.Info(fmt.Sprintf("existing draft release found (tag: %s) => let's update it", existing.TagName))
+		return s.RepoAdapter.UpdateRelease(existing, opts)
+	default:
+		logger.Info("a published release already exists for this tag => let's keep it (assets and post-release steps are done again)")
+		return existing, nil
+	}
+}
+
+// prepareNextRelease computes the next version and prepares the corresponding release (without changing anything)
+func (s *Service) prepareNextRelease(branches []string, dontIncrementIfNoPR bool, opts ReleaseOptions) (*NextRelease, error) {
 	if len(branches) != 1 {
-		return "", errors.New("only one branch is supported")
+		return nil, errors.New("only one branch is supported")
 	}
 	oldTag, newTag, prs, err := s.GetNextVersion(branches, true, dontIncrementIfNoPR)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	if oldTag == newTag {
-		return "", ErrNoRelease
+		return nil, ErrNoRelease
 	}
 	bodyTemplate := template.New("body")
-	bodyTemplate, err = bodyTemplate.Parse(bodyTemplateString)
+	bodyTemplate, err = bodyTemplate.Parse(opts.BodyTemplate)
 	if err != nil {
-		return "", fmt.Errorf("can't parse the template: %w", err)
+		return nil, fmt.Errorf("can't parse the template: %w", err)
 	}
 	body, err := s.getReleaseBodyFromPRs(prs, bodyTemplate)
 	if err != nil {
-		return "", fmt.Errorf("can't create the release body: %w", err)
+		return nil, fmt.Errorf("can't create the release body: %w", err)
+	}
+	name, err := s.getReleaseName(opts.NameTemplate, releaseNameData{NewVersion: newTag, OldVersion: oldTag, Branch: branches[0]})
+	if err != nil {
+		return nil, err
+	}
+	targetSha := opts.TargetSha
+	if targetSha == TargetShaAuto {
+		targetSha, err = s.GitAdapter.GetBranchHeadSha(branches[0])
+		if err != nil {
+			return nil, fmt.Errorf("can't get the sha to target: %w", err)
+		}
+	}
+	// assets are read (and the comment template parsed) before creating the release (to fail early)
+	assets, err := getReleaseAssets(opts.Assets, opts.AssetContentType)
+	if err != nil {
+		return nil, err
+	}
+	commentTemplate, err := parseReleasedCommentTemplate(opts.CommentTemplate)
+	if err != nil {
+		return nil, err
+	}
+	return &NextRelease{
+		OldTag: oldTag,
+		Options: repo.ReleaseOptions{
+			Base:       branches[0],
+			TagName:    newTag,
+			Name:       name,
+			Body:       body,
+			Draft:      opts.Draft || opts.RollingDraft,
+			Prerelease: opts.Prerelease,
+			MakeLatest: opts.MakeLatest,
+			TargetSha:  targetSha,
+		},
+		Assets:          assets,
+		prs:             prs,
+		commentTemplate: commentTemplate,
+	}, nil
+}
+
+func (s *Service) CreateNextRelease(branches []string, dontIncrementIfNoPR bool, opts ReleaseOptions) (newTag string, err error) {
+	next, err := s.prepareNextRelease(branches, dontIncrementIfNoPR, opts)
+	if err != nil {
+		return "", err
+	}
+	newTag = next.Options.TagName
+	// (assets and post-release steps are idempotent => they are done on each run to complete a failed one)
+	release, err := s.createOrUpdateRelease(next, opts)
+	if err != nil {
+		return "", err
 	}
-	return newTag, s.RepoAdapter.CreateRelease(branches[0], newTag, body, draft)
+	err = s.uploadReleaseAssets(release, next.Assets, opts.AssetUploadRetries)
+	if err != nil {
+		return newTag, fmt.Errorf("can't upload the assets of the release %s: %w", newTag, err)
+	}
+	err = s.postRelease(next, release.Draft, opts, opts.PostReleaseDryRun)
+	if err != nil {
+		return newTag, err
+	}
+	return newTag, nil
 }
 
-func (s *Service) GenerateChangelog(branches []string, onlyMerged bool, future bool, sinceTag string, changelogTemplateString string) (string, error) {
+// DryRunNextRelease is like CreateNextRelease but nothing is changed: the prepared release is returned
+// and the actions that would be done are logged (the repo adapter is only used to read)
+func (s *Service) DryRunNextRelease(branches []string, dontIncrementIfNoPR bool, opts ReleaseOptions) (*NextRelease, error) {
+	next, err := s.prepareNextRelease(branches, dontIncrementIfNoPR, opts)
+	if err != nil {
+		return nil, err
+	}
+	logger := s.logger.With(slog.String("tagName", next.Options.TagName), slog.Bool("dryRun", true))
+	existing, err := s.findExistingRelease(next, opts)
+	if err != nil {
+		return nil, err
+	}
+	draft := next.Options.Draft
+	switch {
+	case existing == nil:
+		logger.Info("the release would be created")
+	case existing.Draft:
+		logger.Info(fmt.Sprintf("the existing draft release (tag: %s) would be updated", existing.TagName))
+	default:
+		logger.Info("a published release already exists for this tag => it would be kept")
+		draft = false
+	}
+	for _, asset := range next.Assets {
+		logger.Info("the asset would be uploaded", slog.String("asset", asset.Name))
+	}
+	err = s.postRelease(next, draft, opts, true)
+	if err != nil {
+		return nil, err
+	}
+	return next, nil
+}
+
+// GenerateChangelog generates a changelog with the given template
+// (if milestone is not empty, only the PRs in this milestone are considered)
+func (s *Service) GenerateChangelog(branches []string, onlyMerged bool, future bool, sinceTag string, milestone string, changelogTemplateString string) (string, error) {
 	if len(branches) == 0 {
 		return "", errors.New("at least one branch is required")
 	}
@@ -296,11 +622,21 @@ func (s *Service) GenerateChangelog(branches []string, onlyMerged bool, future b
 	if err != nil {
 		return "", err
 	}
+	if milestone != "" {
+		inMilestone := []*repo.PullRequest{}
+		for _, pr := range prs {
+			if pr.Milestone == milestone {
+				inMilestone = append(inMilestone, pr)
+			}
+		}
+		prs = inMilestone
+	}
 	changelog := changelog.New(tags, prs, changelog.Config{
 		MinimalDelayInSeconds:   s.Config.MinimalDelayInSeconds,
 		Future:                  future,
 		RepoOwner:               s.Config.RepoOwner,
 		RepoName:                s.Config.RepoName,
+		WebBaseURL:              s.Config.WebBaseURL,
 		PullRequestIgnoreLabels: s.Config.PullRequestIgnoreLabels,
 	})
 	var body bytes.Buffer
@@ -2,8 +2,12 @@ package app
 
 import (
 	_ "embed"
+	"errors"
 	"fmt"
 	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
 	"time"
@@ -13,6 +17,7 @@ import (
 	"github.com/fabien-marty/github-next-semantic-version/internal/app/repo"
 	"github.com/fabien-marty/slog-helpers/pkg/slogc"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 type gitDummyAdapter struct {
@@ -33,33 +38,129 @@ func (d *gitDummyAdapter) GuessDefaultBranch() string {
 	return "main"
 }
 
-type release struct {
-	base    string
-	tagName string
-	body    string
-	draft   bool
+func (d *gitDummyAdapter) GetRemoteUrls() (map[string]string, error) {
+	return map[string]string{"origin": "git@github.com:foo/bar.git"}, nil
+}
+
+func (d *gitDummyAdapter) GetBranchHeadSha(branch string) (string, error) {
+	return "sha-of-" + branch, nil
 }
 
 type repoDummyAdapter struct {
-	prs      []*repo.PullRequest
-	releases []release
+	prs            []*repo.PullRequest
+	prsByBranch    map[string][]*repo.PullRequest // if set, used instead of prs
+	releases       []repo.ReleaseOptions
+	assets         []repo.ReleaseAsset
+	uploadFailures int // number of next uploads to fail
+	linkedIssues   map[int][]*repo.Issue
+	comments       map[int][]string
+	labels         map[int][]string // added labels
+	milestones     []*repo.Milestone
+	milestoneItems map[int64][]repo.MilestoneItem
+}
+
+func (d *repoDummyAdapter) getPullRequests(base string) []*repo.PullRequest {
+	if d.prsByBranch != nil {
+		return slices.Clone(d.prsByBranch[base])
+	}
+	return d.prs
 }
 
 func (d *repoDummyAdapter) GetPullRequests(base string, onlyMerged bool) ([]*repo.PullRequest, error) {
-	return d.prs, nil
+	return d.getPullRequests(base), nil
+}
+
+func (d *repoDummyAdapter) GetPullRequestsSince(base string, onlyMerged bool, since time.Time) ([]*repo.PullRequest, error) {
+	return d.getPullRequests(base), nil
 }
 
 func (d *repoDummyAdapter) GetLastUpdatedPullRequests(base string, onlyMerged bool) ([]*repo.PullRequest, error) {
 	return d.prs, nil
 }
 
-func (d *repoDummyAdapter) CreateRelease(base string, tagName string, body string, draft bool) error {
-	d.releases = append(d.releases, release{
-		base:    base,
-		tagName: tagName,
-		body:    body,
-		draft:   draft,
-	})
+func (d *repoDummyAdapter) GetLinkedIssues(pr *repo.PullRequest) ([]*repo.Issue, error) {
+	return d.linkedIssues[pr.Number], nil
+}
+
+func (d *repoDummyAdapter) CreateRelease(opts repo.ReleaseOptions) (*repo.Release, error) {
+	d.releases = append(d.releases, opts)
+	return &repo.Release{ID: int64(len(d.releases)), TagName: opts.TagName, Name: opts.GetName(), Draft: opts.Draft}, nil
+}
+
+func (d *repoDummyAdapter) GetLastReleases() ([]*repo.Release, error) {
+	res := []*repo.Release{}
+	for i := len(d.releases) - 1; i >= 0; i-- {
+		res = append(res, &repo.Release{ID: int64(i + 1), TagName: d.releases[i].TagName, Name: d.releases[i].GetName(), Draft: d.releases[i].Draft})
+	}
+	return res, nil
+}
+
+func (d *repoDummyAdapter) UpdateRelease(release *repo.Release, opts repo.ReleaseOptions) (*repo.Release, error) {
+	d.releases[release.ID-1] = opts
+	return &repo.Release{ID: release.ID, TagName: opts.TagName, Name: opts.GetName(), Draft: opts.Draft}, nil
+}
+
+func (d *repoDummyAdapter) UploadReleaseAsset(release *repo.Release, asset repo.ReleaseAsset) error {
+	if d.uploadFailures > 0 {
+		d.uploadFailures--
+		return errors.New("upload failure")
+	}
+	// (like the real adapters, an existing asset with the same name is replaced)
+	d.assets = slices.DeleteFunc(d.assets, func(a repo.ReleaseAsset) bool { return a.Name == asset.Name })
+	d.assets = append(d.assets, asset)
+	return nil
+}
+
+func (d *repoDummyAdapter) GetPullRequestComments(pr *repo.PullRequest) ([]string, error) {
+	return d.comments[pr.Number], nil
+}
+
+func (d *repoDummyAdapter) AddPullRequestComment(pr *repo.PullRequest, body string) error {
+	if pr.Number < 0 {
+		return errors.New("comment failure")
+	}
+	if d.comments == nil {
+		d.comments = map[int][]string{}
+	}
+	d.comments[pr.Number] = append(d.comments[pr.Number], body)
+	return nil
+}
+
+func (d *repoDummyAdapter) AddPullRequestLabel(pr *repo.PullRequest, label string) error {
+	if d.labels == nil {
+		d.labels = map[int][]string{}
+	}
+	d.labels[pr.Number] = append(d.labels[pr.Number], label)
+	return nil
+}
+
+func (d *repoDummyAdapter) GetMilestones() ([]*repo.Milestone, error) {
+	return d.milestones, nil
+}
+
+func (d *repoDummyAdapter) CreateMilestone(title string) (*repo.Milestone, error) {
+	milestone := &repo.Milestone{ID: int64(len(d.milestones) + 1), Title: title}
+	d.milestones = append(d.milestones, milestone)
+	return milestone, nil
+}
+
+func (d *repoDummyAdapter) CloseMilestone(milestone *repo.Milestone) error {
+	milestone.Closed = true
+	return nil
+}
+
+func (d *repoDummyAdapter) GetMilestoneOpenItems(milestone *repo.Milestone) ([]repo.MilestoneItem, error) {
+	return slices.Clone(d.milestoneItems[milestone.ID]), nil
+}
+
+func (d *repoDummyAdapter) SetMilestone(item repo.MilestoneItem, milestone *repo.Milestone) error {
+	if d.milestoneItems == nil {
+		d.milestoneItems = map[int64][]repo.MilestoneItem{}
+	}
+	for id, items := range d.milestoneItems {
+		d.milestoneItems[id] = slices.DeleteFunc(items, func(i repo.MilestoneItem) bool { return i.Number == item.Number })
+	}
+	d.milestoneItems[milestone.ID] = append(d.milestoneItems[milestone.ID], item)
 	return nil
 }
 
@@ -278,15 +379,201 @@ func TestCreateRelease(t *testing.T) {
 		},
 	}
 	service := NewService(NewDefaultConfig(), repoAdapter, gitAdapter)
-	newTag, err := service.CreateNextRelease([]string{"main"}, false, false, "{{ range . }}- {{.Title}} (#{{.Number}})\n{{ end }}")
+	newTag, err := service.CreateNextRelease([]string{"main"}, false, ReleaseOptions{BodyTemplate: "{{ range . }}- {{.Title}} (#{{.Number}})\n{{ end }}"})
 	assert.Nil(t, err)
 	assert.Equal(t, 1, len(repoAdapter.releases))
 	r := repoAdapter.releases[0]
-	assert.Equal(t, "main", r.base)
-	assert.Equal(t, "v1.1.0", r.tagName)
+	assert.Equal(t, "main", r.Base)
+	assert.Equal(t, "v1.1.0", r.TagName)
 	assert.Equal(t, "v1.1.0", newTag)
-	assert.False(t, r.draft)
-	assert.Equal(t, "- PR1 (#1)\n- PR2 (#2)\n", r.body)
+	assert.False(t, r.Draft)
+	assert.Equal(t, "- PR1 (#1)\n- PR2 (#2)\n", r.Body)
+	assert.Equal(t, "v1.1.0", r.Name)
+	assert.Equal(t, "", r.TargetSha)
+
+	repoAdapter.releases = nil
+	newTag, err = service.CreateNextRelease([]string{"main"}, false, ReleaseOptions{
+		Draft:        true,
+		NameTemplate: "MyApp {{.NewVersion}} (from {{.OldVersion}} on {{.Branch}})",
+		Prerelease:   true,
+		MakeLatest:   "false",
+		TargetSha:    TargetShaAuto,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "v1.1.0", newTag)
+	assert.Equal(t, repo.ReleaseOptions{
+		Base:       "main",
+		TagName:    "v1.1.0",
+		Name:       "MyApp v1.1.0 (from v1.0.0 on main)",
+		Draft:      true,
+		Prerelease: true,
+		MakeLatest: "false",
+		TargetSha:  "sha-of-main",
+	}, repoAdapter.releases[0])
+
+	_, err = service.CreateNextRelease([]string{"main"}, false, ReleaseOptions{TargetSha: "0123abcd", NameTemplate: "{{ .Foo"})
+	assert.ErrorContains(t, err, "release name template")
+}
+
+func TestCreateReleaseIdempotent(t *testing.T) {
+	gitAdapter := &gitDummyAdapter{tags: []*git.Tag{git.NewTag("v1.0.0", time.Now())}}
+	now := time.Now()
+	repoAdapter := &repoDummyAdapter{
+		prs: []*repo.PullRequest{{Number: 1, Title: "PR1", Labels: []string{}, MergedAt: &now}},
+	}
+	service := NewService(NewDefaultConfig(), repoAdapter, gitAdapter)
+
+	// a draft with the same tag is updated
+	_, err := service.CreateNextRelease([]string{"main"}, false, ReleaseOptions{Draft: true, BodyTemplate: "body1"})
+	assert.Nil(t, err)
+	_, err = service.CreateNextRelease([]string{"main"}, false, ReleaseOptions{Draft: true, BodyTemplate: "body2"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(repoAdapter.releases))
+	assert.Equal(t, "body2", repoAdapter.releases[0].Body)
+
+	// publishing the draft
+	_, err = service.CreateNextRelease([]string{"main"}, false, ReleaseOptions{BodyTemplate: "body3"})
+	assert.Nil(t, err)
+	assert.Equal(t, []repo.ReleaseOptions{{Base: "main", TagName: "v1.0.1", Name: "v1.0.1", Body: "body3"}}, repoAdapter.releases)
+
+	// a published release with the same tag is not modified (but assets/post-release steps are done again)
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "foo.txt"), []byte("foo"), 0o600))
+	_, err = service.CreateNextRelease([]string{"main"}, false, ReleaseOptions{Draft: true, BodyTemplate: "body4", Assets: []string{filepath.Join(dir, "*.txt")}, CommentTemplate: "released"})
+	assert.Nil(t, err)
+	assert.Equal(t, []repo.ReleaseOptions{{Base: "main", TagName: "v1.0.1", Name: "v1.0.1", Body: "body3"}}, repoAdapter.releases)
+	require.Len(t, repoAdapter.assets, 2)
+	assert.Equal(t, "foo.txt", repoAdapter.assets[0].Name)
+	assert.Equal(t, map[int][]string{1: {"released"}}, repoAdapter.comments)
+}
+
+func TestCreateReleaseRollingDraft(t *testing.T) {
+	gitAdapter := &gitDummyAdapter{tags: []*git.Tag{git.NewTag("v1.0.0", time.Now())}}
+	now := time.Now()
+	repoAdapter := &repoDummyAdapter{
+		prs: []*repo.PullRequest{{Number: 1, Title: "PR1", Labels: []string{}, MergedAt: &now}},
+	}
+	service := NewService(NewDefaultConfig(), repoAdapter, gitAdapter)
+	opts := ReleaseOptions{RollingDraft: true, BodyTemplate: "{{ range . }}- {{.Title}}\n{{ end }}"}
+
+	newTag, err := service.CreateNextRelease([]string{"main"}, false, opts)
+	assert.Nil(t, err)
+	assert.Equal(t, "v1.0.1", newTag)
+	assert.Equal(t, []repo.ReleaseOptions{{Base: "main", TagName: "v1.0.1", Name: "v1.0.1", Body: "- PR1\n", Draft: true}}, repoAdapter.releases)
+
+	// a minor PR is merged => the draft is retagged (and its body updated)
+	repoAdapter.prs = append(repoAdapter.prs, &repo.PullRequest{Number: 2, Title: "PR2", Labels: []string{"minor1"}, MergedAt: &now})
+	newTag, err = service.CreateNextRelease([]string{"main"}, false, opts)
+	assert.Nil(t, err)
+	assert.Equal(t, "v1.1.0", newTag)
+	assert.Equal(t, []repo.ReleaseOptions{{Base: "main", TagName: "v1.1.0", Name: "v1.1.0", Body: "- PR1\n- PR2\n", Draft: true}}, repoAdapter.releases)
+}
+
+func TestCreateReleaseRollingDraftIgnoresUnrelatedDrafts(t *testing.T) {
+	gitAdapter := &gitDummyAdapter{tags: []*git.Tag{git.NewTag("v1.0.0", time.Now())}}
+	now := time.Now()
+	handWritten := []repo.ReleaseOptions{
+		{TagName: "v2.0.0", Name: "The big 2.0 release", Body: "hand-written", Draft: true},
+		{TagName: "v0.9.1", Body: "hand-written", Draft: true},
+		{TagName: "preview", Body: "hand-written", Draft: true},
+	}
+	repoAdapter := &repoDummyAdapter{
+		prs:      []*repo.PullRequest{{Number: 1, Title: "PR1", Labels: []string{}, MergedAt: &now}},
+		releases: slices.Clone(handWritten),
+	}
+	service := NewService(NewDefaultConfig(), repoAdapter, gitAdapter)
+	opts := ReleaseOptions{RollingDraft: true, BodyTemplate: "{{ range . }}- {{.Title}}\n{{ end }}"}
+
+	// drafts created by hand are left alone => a new rolling draft is created
+	_, err := service.CreateNextRelease([]string{"main"}, false, opts)
+	require.NoError(t, err)
+	require.Len(t, repoAdapter.releases, 4)
+	assert.Equal(t, handWritten, repoAdapter.releases[:3])
+	assert.Equal(t, repo.ReleaseOptions{Base: "main", TagName: "v1.0.1", Name: "v1.0.1", Body: "- PR1\n", Draft: true}, repoAdapter.releases[3])
+
+	// ... and only this one is updated by the next runs
+	repoAdapter.prs = append(repoAdapter.prs, &repo.PullRequest{Number: 2, Title: "PR2", Labels: []string{"minor1"}, MergedAt: &now})
+	_, err = service.CreateNextRelease([]string{"main"}, false, opts)
+	require.NoError(t, err)
+	require.Len(t, repoAdapter.releases, 4)
+	assert.Equal(t, handWritten, repoAdapter.releases[:3])
+	assert.Equal(t, repo.ReleaseOptions{Base: "main", TagName: "v1.1.0", Name: "v1.1.0", Body: "- PR1\n- PR2\n", Draft: true}, repoAdapter.releases[3])
+}
+
+// readOnlyRepoAdapter is a repoDummyAdapter failing the test on any mutating call
+type readOnlyRepoAdapter struct {
+	*repoDummyAdapter
+	t *testing.T
+}
+
+func (d *readOnlyRepoAdapter) CreateRelease(opts repo.ReleaseOptions) (*repo.Release, error) {
+	d.t.Error("unexpected CreateRelease call")
+	return nil, errors.New("read-only")
+}
+
+func (d *readOnlyRepoAdapter) UpdateRelease(release *repo.Release, opts repo.ReleaseOptions) (*repo.Release, error) {
+	d.t.Error("unexpected UpdateRelease call")
+	return nil, errors.New("read-only")
+}
+
+func (d *readOnlyRepoAdapter) UploadReleaseAsset(release *repo.Release, asset repo.ReleaseAsset) error {
+	d.t.Error("unexpected UploadReleaseAsset call")
+	return errors.New("read-only")
+}
+
+func (d *readOnlyRepoAdapter) AddPullRequestComment(pr *repo.PullRequest, body string) error {
+	d.t.Error("unexpected AddPullRequestComment call")
+	return errors.New("read-only")
+}
+
+func (d *readOnlyRepoAdapter) AddPullRequestLabel(pr *repo.PullRequest, label string) error {
+	d.t.Error("unexpected AddPullRequestLabel call")
+	return errors.New("read-only")
+}
+
+func (d *readOnlyRepoAdapter) CreateMilestone(title string) (*repo.Milestone, error) {
+	d.t.Error("unexpected CreateMilestone call")
+	return nil, errors.New("read-only")
+}
+
+func (d *readOnlyRepoAdapter) CloseMilestone(milestone *repo.Milestone) error {
+	d.t.Error("unexpected CloseMilestone call")
+	return errors.New("read-only")
+}
+
+func (d *readOnlyRepoAdapter) SetMilestone(item repo.MilestoneItem, milestone *repo.Milestone) error {
+	d.t.Error("unexpected SetMilestone call")
+	return errors.New("read-only")
+}
+
+func TestDryRunNextRelease(t *testing.T) {
+	gitAdapter := &gitDummyAdapter{tags: []*git.Tag{git.NewTag("v1.0.0", time.Now())}}
+	now := time.Now()
+	repoAdapter := &readOnlyRepoAdapter{t: t, repoDummyAdapter: &repoDummyAdapter{
+		prs:            []*repo.PullRequest{{Number: 1, Title: "PR1", Labels: []string{}, MergedAt: &now}},
+		milestones:     []*repo.Milestone{{ID: 1, Title: "v1.0.1"}},
+		milestoneItems: map[int64][]repo.MilestoneItem{1: {{Number: 2}}},
+	}}
+	service := NewService(NewDefaultConfig(), repoAdapter, gitAdapter)
+	opts := ReleaseOptions{
+		BodyTemplate:    "{{ range . }}- {{.Title}}\n{{ end }}",
+		NameTemplate:    "MyApp {{ .NewVersion }}",
+		Prerelease:      true,
+		TargetSha:       TargetShaAuto,
+		CommentTemplate: "Released in {{ .NewVersion }}",
+		ReleasedLabel:   "released",
+		Milestones:      true,
+	}
+
+	next, err := service.DryRunNextRelease([]string{"main"}, false, opts)
+	assert.Nil(t, err)
+	assert.Equal(t, "v1.0.0", next.OldTag)
+	assert.Equal(t, repo.ReleaseOptions{Base: "main", TagName: "v1.0.1", Name: "MyApp v1.0.1", Body: "- PR1\n", Prerelease: true, TargetSha: "sha-of-main"}, next.Options)
+
+	// same errors as a real run
+	repoAdapter.prs = nil
+	_, err = service.DryRunNextRelease([]string{"main"}, true, opts)
+	assert.Equal(t, ErrNoRelease, err)
 }
 
 func TestGenerateChangelog(t *testing.T) {
@@ -403,10 +690,213 @@ func TestGenerateChangelog(t *testing.T) {
 		},
 	}
 	service := NewService(NewDefaultConfig(), repoAdapter, gitAdapter)
-	res, err := service.GenerateChangelog([]string{"main"}, true, true, "", changelog.DefaultTemplateString)
+	res, err := service.GenerateChangelog([]string{"main"}, true, true, "", "", changelog.DefaultTemplateString)
 	assert.Nil(t, err)
 	fmt.Println("**********")
 	fmt.Println(res)
 	fmt.Println("**********")
 	assert.Equal(t, strings.TrimSpace(expected), strings.TrimSpace(res))
 }
+
+func TestGenerateChangelogWithWebBaseURL(t *testing.T) {
+	now, err := time.Parse("2006-01-02", "2024-01-02")
+	assert.Nil(t, err)
+	gitAdapter := &gitDummyAdapter{
+		tags: []*git.Tag{
+			git.NewTag("1.0.0", now.Add(1*time.Hour)),
+			git.NewTag("2.0.0", now.Add(10*time.Hour)),
+		},
+	}
+	repoAdapter := &repoDummyAdapter{}
+	config := NewDefaultConfig()
+	config.WebBaseURL = "https://github.example.com"
+	service := NewService(config, repoAdapter, gitAdapter)
+	res, err := service.GenerateChangelog([]string{"main"}, true, false, "", "", changelog.DefaultTemplateString)
+	assert.Nil(t, err)
+	assert.Contains(t, res, "## [2.0.0](https://github.example.com/foo/bar/tree/2.0.0)")
+	assert.Contains(t, res, "[Full Diff](https://github.example.com/foo/bar/compare/1.0.0...2.0.0)")
+	assert.NotContains(t, res, "https://github.com/")
+}
+
+func TestGetNextVersionWithLinkedIssuesLabels(t *testing.T) {
+	gitAdapter := &gitDummyAdapter{
+		tags: []*git.Tag{
+			git.NewTag("v1.0.0", time.Now()),
+		},
+	}
+	now := time.Now()
+	repoAdapter := &repoDummyAdapter{
+		prs: []*repo.PullRequest{
+			{
+				Number:   1,
+				Title:    "PR1",
+				Labels:   []string{"foo"},
+				MergedAt: &now,
+			},
+		},
+		linkedIssues: map[int][]*repo.Issue{
+			1: {{Number: 10, Title: "Issue10", Labels: []string{"minor1"}}},
+		},
+	}
+	config := NewDefaultConfig()
+	service := NewService(config, repoAdapter, gitAdapter)
+	_, version, prs, err := service.GetNextVersion([]string{"main"}, true, false)
+	assert.Nil(t, err)
+	assert.Equal(t, "v1.0.1", version) // linked issues are not resolved by default
+	assert.Nil(t, prs[0].LinkedIssues)
+
+	config.ResolveLinkedIssues = true
+	service = NewService(config, repoAdapter, gitAdapter)
+	_, version, prs, err = service.GetNextVersion([]string{"main"}, true, false)
+	assert.Nil(t, err)
+	assert.Equal(t, "v1.0.1", version) // resolved but not used for classification
+	assert.Equal(t, 10, prs[0].LinkedIssues[0].Number)
+
+	config.UseLinkedIssuesLabels = true
+	service = NewService(config, repoAdapter, gitAdapter)
+	_, version, _, err = service.GetNextVersion([]string{"main"}, true, false)
+	assert.Nil(t, err)
+	assert.Equal(t, "v1.1.0", version)
+}
+
+func TestGenerateChangelogWithLinkedIssues(t *testing.T) {
+	now, err := time.Parse("2006-01-02", "2024-01-02")
+	assert.Nil(t, err)
+	mergedAt := now.Add(2 * time.Hour)
+	gitAdapter := &gitDummyAdapter{
+		tags: []*git.Tag{
+			git.NewTag("1.0.0", now.Add(1*time.Hour)),
+			git.NewTag("2.0.0", now.Add(10*time.Hour)),
+		},
+	}
+	repoAdapter := &repoDummyAdapter{
+		prs: []*repo.PullRequest{
+			{Number: 1, Title: "PR1", MergedAt: &mergedAt, Url: "https://github.com/foo/bar/pull/1", AuthorLogin: "user", AuthorUrl: "https://github.com/user"},
+		},
+		linkedIssues: map[int][]*repo.Issue{
+			1: {
+				{Number: 123, Title: "Crash on startup", Url: "https://github.com/foo/bar/issues/123"},
+				{Number: 124, Title: "Crash on exit", Url: "https://github.com/foo/bar/issues/124"},
+			},
+		},
+	}
+	config := NewDefaultConfig()
+	config.ResolveLinkedIssues = true
+	service := NewService(config, repoAdapter, gitAdapter)
+	res, err := service.GenerateChangelog([]string{"main"}, true, false, "", "", changelog.DefaultTemplateString)
+	assert.Nil(t, err)
+	assert.Contains(t, res, "- PR1 [\\#1](https://github.com/foo/bar/pull/1) ([user](https://github.com/user)), fixes [\\#123](https://github.com/foo/bar/issues/123) (Crash on startup), [\\#124](https://github.com/foo/bar/issues/124) (Crash on exit)\n")
+}
+
+func TestGetPullRequestsSeveralBranches(t *testing.T) {
+	now := time.Now()
+	newPr := func(number int, mergedAt time.Time) *repo.PullRequest {
+		return &repo.PullRequest{Number: number, Title: fmt.Sprintf("PR %d", number), MergedAt: &mergedAt}
+	}
+	repoAdapter := &repoDummyAdapter{
+		prsByBranch: map[string][]*repo.PullRequest{
+			"main":   {newPr(2, now.Add(2*time.Hour)), newPr(1, now.Add(1*time.Hour))},
+			"v1":     {newPr(3, now.Add(3*time.Hour))},
+			"v2":     {},
+			"v3":     {newPr(5, now.Add(5*time.Hour)), newPr(4, now.Add(4*time.Hour))},
+			"legacy": {newPr(6, now)},
+		},
+	}
+	config := NewDefaultConfig()
+	for _, concurrency := range []int{0, 1, 2, 10} {
+		config.Concurrency = concurrency
+		service := NewService(config, repoAdapter, &gitDummyAdapter{})
+		prs, err := service.getPullRequests([]string{"main", "v1", "v2", "v3", "legacy"}, nil, true)
+		assert.Nil(t, err)
+		numbers := []int{}
+		for _, pr := range prs {
+			numbers = append(numbers, pr.Number)
+		}
+		assert.Equal(t, []int{1, 2, 3, 4, 5, 6}, numbers, "concurrency: %d", concurrency)
+	}
+}
+
+func TestLabelsFallback(t *testing.T) {
+	tests := []struct {
+		title          string
+		branch         string
+		titleLabels    []string
+		branchLabels   []string
+		existingLabels []string
+	}{
+		{"feature: add foo", "feature/foo", []string{"feature"}, []string{"feature"}, nil},
+		{"fix(parser)!: fix foo", "fix-foo", []string{"fix", "breaking"}, []string{}, nil},
+		{"add foo", "foo", []string{}, []string{}, nil},
+		{"major: foo", "major/foo", []string{"bar"}, []string{"bar"}, []string{"bar"}}, // labels are kept if any
+	}
+	for _, test := range tests {
+		newPr := func() *repo.PullRequest {
+			return &repo.PullRequest{Number: 1, Title: test.title, Branch: test.branch, Labels: test.existingLabels}
+		}
+		config := NewDefaultConfig()
+		config.LabelsFallback = LabelsFallbackTitlePrefix
+		pr := newPr()
+		NewService(config, &repoDummyAdapter{}, &gitDummyAdapter{}).applyLabelsFallback([]*repo.PullRequest{pr})
+		assert.Equal(t, test.titleLabels, pr.Labels, test.title)
+		config.LabelsFallback = LabelsFallbackBranchPrefix
+		pr = newPr()
+		NewService(config, &repoDummyAdapter{}, &gitDummyAdapter{}).applyLabelsFallback([]*repo.PullRequest{pr})
+		assert.Equal(t, test.branchLabels, pr.Labels, test.branch)
+		config.LabelsFallback = LabelsFallbackNone
+		pr = newPr()
+		NewService(config, &repoDummyAdapter{}, &gitDummyAdapter{}).applyLabelsFallback([]*repo.PullRequest{pr})
+		assert.Equal(t, test.existingLabels, pr.Labels)
+	}
+}
+
+func TestGetNextVersionWithLabelsFallback(t *testing.T) {
+	gitAdapter := &gitDummyAdapter{
+		tags: []*git.Tag{
+			git.NewTag("v1.0.0", time.Now()),
+		},
+	}
+	now := time.Now()
+	repoAdapter := &repoDummyAdapter{
+		prs: []*repo.PullRequest{
+			{Number: 1, Title: "minor1: add foo", Branch: "foo", MergedAt: &now},
+		},
+	}
+	config := NewDefaultConfig()
+	_, version, _, err := NewService(config, repoAdapter, gitAdapter).GetNextVersion([]string{"main"}, true, false)
+	assert.Nil(t, err)
+	assert.Equal(t, "v1.0.1", version)
+
+	config.LabelsFallback = LabelsFallbackTitlePrefix
+	_, version, _, err = NewService(config, repoAdapter, gitAdapter).GetNextVersion([]string{"main"}, true, false)
+	assert.Nil(t, err)
+	assert.Equal(t, "v1.1.0", version)
+}
+
+func TestExportPullRequests(t *testing.T) {
+	now := time.Now()
+	newPr := func(number int, labels ...string) *repo.PullRequest {
+		return &repo.PullRequest{Number: number, Title: fmt.Sprintf("PR %d", number), MergedAt: &now, Labels: labels}
+	}
+	repoAdapter := &repoDummyAdapter{
+		prsByBranch: map[string][]*repo.PullRequest{
+			"main": {newPr(3, "Type: Hidden"), newPr(1)},
+			"v1":   {newPr(2), newPr(1)},
+		},
+		linkedIssues: map[int][]*repo.Issue{
+			2: {{Number: 10, Title: "issue"}},
+		},
+	}
+	config := NewDefaultConfig()
+	config.PullRequestIgnoreLabels = []string{"Type: Hidden"}
+	config.LabelsFallback = LabelsFallbackTitlePrefix
+	config.ResolveLinkedIssues = true
+	prs, err := NewService(config, repoAdapter, &gitDummyAdapter{}).ExportPullRequests([]string{"main", "v1"}, true)
+	assert.Nil(t, err)
+	numbers := []int{}
+	for _, pr := range prs {
+		numbers = append(numbers, pr.Number)
+	}
+	assert.Equal(t, []int{1, 2, 3}, numbers) // no filtering, no duplicates
+	assert.Nil(t, prs[0].Labels)             // no labels fallback
+	assert.Equal(t, []*repo.Issue{{Number: 10, Title: "issue"}}, prs[1].LinkedIssues)
+}
@@ -0,0 +1,195 @@
+package gitcommon
+
+import (
+	"net/url"
+	"strings"
+)
+
+// ParseRemoteUrl returns the host (without port) and the path (without leading/trailing slashes
+// and without ".git" suffix) of a git remote url
+//
+// Supported formats:
+// - scp-like syntax: git@github.com:owner/repo.git
+// - urls: https://github.com/owner/repo.git, ssh://git@github.com:22/owner/repo...
+//
+// Empty strings are returned if the url is not in an expected format.
+func ParseRemoteUrl(remoteUrl string) (host string, path string) {
+	remoteUrl = strings.TrimSpace(remoteUrl)
+	if strings.Contains(remoteUrl, "://") {
+		u, err := url.Parse(remoteUrl)
+		if err != nil {
+			return "", ""
+		}
+		host = u.Hostname()
+		path = u.Path
+	} else {
+		before, after, found := strings.Cut(remoteUrl, ":")
+		if !found {
+			return "", ""
+		}
+		if i := strings.LastIndex(before, "@"); i >= 0 {
+			before = before[i+1:]
+		}
+		host = before
+		path = after
+	}
+	path = strings.Trim(path, "/")
+	path = strings.TrimSuffix(path, ".git")
+	path = strings.Trim(path, "/")
+	if host == "" || path == "" {
+		return "", ""
+	}
+	return strings.ToLower(host), path
+}
+
+// IsGitHubHost returns true if the given host is github.com, looks like a GitHub Enterprise host
+// (github.example.com or *.ghe.com) or is one of the given extra hosts
+func IsGitHubHost(host string, extraHosts ...string) bool {
+	host = strings.ToLower(host)
+	for _, extraHost := range extraHosts {
+		if host == strings.ToLower(extraHost) {
+			return true
+		}
+	}
+	return host == "github.com" || strings.HasPrefix(host, "github.") || strings.HasSuffix(host, ".ghe.com")
+}
+
+// ExtractGHRepoFromRemoteUrl returns the GitHub owner and repository name from a git remote url
+// (empty strings are returned if the url is not in an expected format or if the host is not a GitHub one,
+// see IsGitHubHost)
+func ExtractGHRepoFromRemoteUrl(remoteUrl string, extraHosts ...string) (owner string, repo string) {
+	host, _ := ParseRemoteUrl(remoteUrl)
+	if !IsGitHubHost(host, extraHosts...) {
+		return "", ""
+	}
+	return ExtractOwnerAndRepoFromRemoteUrl(remoteUrl)
+}
+
+// ExtractOwnerAndRepoFromRemoteUrl returns the owner and repository name from a git remote url
+// with an owner/repo path (whatever the host)
+// (empty strings are returned if the url is not in an expected format)
+func ExtractOwnerAndRepoFromRemoteUrl(remoteUrl string) (owner string, repo string) {
+	_, path := ParseRemoteUrl(remoteUrl)
+	tmp := strings.Split(path, "/")
+	if len(tmp) != 2 || tmp[0] == "" || tmp[1] == "" {
+		return "", ""
+	}
+	return tmp[0], tmp[1]
+}
+
+// GuessPreferredRemote returns the remote to use when the user didn't configure one explicitly
+//
+// It returns "upstream" if the "origin" remote looks like a fork of the "upstream" remote
+// (both remotes exist and point to different GitHub repositories), else "origin".
+func GuessPreferredRemote(remoteUrls map[string]string, extraHosts ...string) string {
+	originUrl, originFound := remoteUrls["origin"]
+	upstreamUrl, upstreamFound := remoteUrls["upstream"]
+	if !originFound || !upstreamFound {
+		return "origin"
+	}
+	originOwner, originRepo := ExtractGHRepoFromRemoteUrl(originUrl, extraHosts...)
+	upstreamOwner, upstreamRepo := ExtractGHRepoFromRemoteUrl(upstreamUrl, extraHosts...)
+	if originOwner == "" || upstreamOwner == "" {
+		return "origin"
+	}
+	if strings.EqualFold(originOwner, upstreamOwner) && strings.EqualFold(originRepo, upstreamRepo) {
+		return "origin"
+	}
+	return "upstream"
+}
+
+// IsGitLabHost returns true if the given host is gitlab.com, looks like a self-hosted GitLab host
+// (gitlab.example.com) or is one of the given extra hosts
+func IsGitLabHost(host string, extraHosts ...string) bool {
+	host = strings.ToLower(host)
+	for _, extraHost := range extraHosts {
+		if host == strings.ToLower(extraHost) {
+			return true
+		}
+	}
+	return host == "gitlab.com" || strings.HasPrefix(host, "gitlab.")
+}
+
+// ExtractGitLabRepoFromRemoteUrl returns the GitLab namespace (owner, it can contain subgroups: group/subgroup)
+// and project name from a git remote url (empty strings are returned if the url is not in an expected format
+// or if the host is not a GitLab one, see IsGitLabHost)
+func ExtractGitLabRepoFromRemoteUrl(remoteUrl string, extraHosts ...string) (owner string, repo string) {
+	host, path := ParseRemoteUrl(remoteUrl)
+	if !IsGitLabHost(host, extraHosts...) {
+		return "", ""
+	}
+	i := strings.LastIndex(path, "/")
+	if i <= 0 || i == len(path)-1 || strings.Contains(path, "//") {
+		return "", ""
+	}
+	return path[:i], path[i+1:]
+}
+
+// IsGiteaHost returns true if the given host is codeberg.org, looks like a self-hosted Gitea/Forgejo host
+// (gitea.example.com, forgejo.example.com) or is one of the given extra hosts
+func IsGiteaHost(host string, extraHosts ...string) bool {
+	host = strings.ToLower(host)
+	for _, extraHost := range extraHosts {
+		if host == strings.ToLower(extraHost) {
+			return true
+		}
+	}
+	return host == "codeberg.org" || strings.HasPrefix(host, "gitea.") || strings.HasPrefix(host, "forgejo.")
+}
+
+// IsBitbucketHost returns true if the given host is bitbucket.org, looks like a Bitbucket Server/Data Center host
+// (bitbucket.example.com) or is one of the given extra hosts
+func IsBitbucketHost(host string, extraHosts ...string) bool {
+	host = strings.ToLower(host)
+	for _, extraHost := range extraHosts {
+		if host == strings.ToLower(extraHost) {
+			return true
+		}
+	}
+	return host == "bitbucket.org" || strings.HasPrefix(host, "bitbucket.")
+}
+
+// ExtractBitbucketRepoFromRemoteUrl returns the Bitbucket workspace (Bitbucket Cloud) or project key
+// (Bitbucket Server) and the repository slug from a git remote url (empty strings are returned if the url
+// is not in an expected format or if the host is not a Bitbucket one, see IsBitbucketHost)
+//
+// Bitbucket Server http(s) clone urls (https://bitbucket.example.com/scm/proj/repo.git) are supported.
+func ExtractBitbucketRepoFromRemoteUrl(remoteUrl string, extraHosts ...string) (owner string, repo string) {
+	host, path := ParseRemoteUrl(remoteUrl)
+	if !IsBitbucketHost(host, extraHosts...) {
+		return "", ""
+	}
+	tmp := strings.Split(strings.TrimPrefix(path, "scm/"), "/")
+	if len(tmp) != 2 || tmp[0] == "" || tmp[1] == "" {
+		return "", ""
+	}
+	return tmp[0], tmp[1]
+}
+
+// ProviderHosts are the extra hosts of each provider (used by GuessProvider)
+type ProviderHosts struct {
+	GitHub    []string // extra GitHub hosts (see IsGitHubHost)
+	GitLab    []string // extra GitLab hosts (see IsGitLabHost)
+	Gitea     []string // extra Gitea/Forgejo hosts (see IsGiteaHost)
+	Bitbucket []string // extra Bitbucket hosts (see IsBitbucketHost)
+}
+
+// GuessProvider returns the provider ("github", "gitlab", "gitea" or "bitbucket") of the given git remote url
+// from its host (empty string if the host is not recognized)
+func GuessProvider(remoteUrl string, hosts ProviderHosts) string {
+	host, _ := ParseRemoteUrl(remoteUrl)
+	switch {
+	case host == "":
+		return ""
+	case IsGitHubHost(host, hosts.GitHub...):
+		return "github"
+	case IsGitLabHost(host, hosts.GitLab...):
+		return "gitlab"
+	case IsGiteaHost(host, hosts.Gitea...):
+		return "gitea"
+	case IsBitbucketHost(host, hosts.Bitbucket...):
+		return "bitbucket"
+	default:
+		return ""
+	}
+}
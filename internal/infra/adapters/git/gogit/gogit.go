@@ -0,0 +1,217 @@
+package gitgogit
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+
+	"github.com/fabien-marty/github-next-semantic-version/internal/app/git"
+	gitcommon "github.com/fabien-marty/github-next-semantic-version/internal/infra/adapters/git/common"
+)
+
+var _ git.Port = &Adapter{}
+
+type AdapterOptions struct {
+	LocalGitPath     string
+	OriginBranchName string   // default to "origin"
+	GitHubHosts      []string // extra GitHub (Enterprise) hosts accepted when guessing the repository
+}
+
+// Adapter is a pure-go git adapter (no git binary needed)
+type Adapter struct {
+	opts AdapterOptions
+}
+
+func NewAdapter(opts AdapterOptions) *Adapter {
+	if opts.LocalGitPath == "" {
+		opts.LocalGitPath = "."
+	}
+	if opts.OriginBranchName == "" {
+		opts.OriginBranchName = "origin"
+	}
+	return &Adapter{
+		opts: opts,
+	}
+}
+
+// open opens the local git repository
+// (we open it for each operation, so the adapter doesn't share any state between calls)
+func (r *Adapter) open() (*gogit.Repository, error) {
+	repository, err := gogit.PlainOpenWithOptions(r.opts.LocalGitPath, &gogit.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		return nil, fmt.Errorf("can't open the git repository %s: %w", r.opts.LocalGitPath, err)
+	}
+	return repository, nil
+}
+
+func (r *Adapter) GuessGHRepo() (owner string, repo string) {
+	logger := slog.Default().With("gitOperation", "guessRepoOwner")
+	repository, err := r.open()
+	if err != nil {
+		logger.Warn("can't open the git repository", slog.String("err", err.Error()))
+		return "", ""
+	}
+	remote, err := repository.Remote(r.opts.OriginBranchName)
+	if err != nil {
+		logger.Warn("can't find the remote", slog.String("remote", r.opts.OriginBranchName), slog.String("err", err.Error()))
+		return "", ""
+	}
+	urls := remote.Config().URLs
+	if len(urls) == 0 {
+		return "", ""
+	}
+	return gitcommon.ExtractGHRepoFromRemoteUrl(urls[0], r.opts.GitHubHosts...)
+}
+
+func (r *Adapter) GetRemoteUrls() (map[string]string, error) {
+	repository, err := r.open()
+	if err != nil {
+		return nil, err
+	}
+	remotes, err := repository.Remotes()
+	if err != nil {
+		return nil, fmt.Errorf("can't list remotes: %w", err)
+	}
+	res := map[string]string{}
+	for _, remote := range remotes {
+		config := remote.Config()
+		if len(config.URLs) == 0 {
+			continue
+		}
+		res[config.Name] = config.URLs[0]
+	}
+	return res, nil
+}
+
+func (r *Adapter) GuessDefaultBranch() string {
+	logger := slog.Default().With("gitOperation", "guessDefaultBranch")
+	repository, err := r.open()
+	if err != nil {
+		logger.Warn("can't open the git repository", slog.String("err", err.Error()))
+		return ""
+	}
+	// first, let's try offline with refs/remotes/<remote>/HEAD
+	ref, err := repository.Reference(plumbing.NewRemoteHEADReferenceName(r.opts.OriginBranchName), false)
+	if err == nil && ref.Type() == plumbing.SymbolicReference {
+		return strings.TrimPrefix(ref.Target().String(), "refs/remotes/"+r.opts.OriginBranchName+"/")
+	}
+	// then, let's ask the remote
+	remote, err := repository.Remote(r.opts.OriginBranchName)
+	if err != nil {
+		logger.Warn("can't find the remote", slog.String("remote", r.opts.OriginBranchName), slog.String("err", err.Error()))
+		return ""
+	}
+	logger.Debug("listing remote references...", slog.String("remote", r.opts.OriginBranchName))
+	refs, err := remote.List(&gogit.ListOptions{})
+	if err != nil {
+		logger.Warn("can't list the remote references", slog.String("remote", r.opts.OriginBranchName), slog.String("err", err.Error()))
+		return ""
+	}
+	for _, ref := range refs {
+		if ref.Name() == plumbing.HEAD && ref.Type() == plumbing.SymbolicReference {
+			return ref.Target().Short()
+		}
+	}
+	return ""
+}
+
+// GetBranchHeadSha returns the sha of refs/remotes/<origin>/<branch> (no network access)
+func (r *Adapter) GetBranchHeadSha(branch string) (string, error) {
+	repository, err := r.open()
+	if err != nil {
+		return "", err
+	}
+	refName := plumbing.NewRemoteReferenceName(r.opts.OriginBranchName, branch)
+	ref, err := repository.Reference(refName, true)
+	if err != nil {
+		return "", fmt.Errorf("can't find the head of %s: %w", refName, err)
+	}
+	return ref.Hash().String(), nil
+}
+
+// getReachableCommits returns the set of commits reachable from the given reference
+func (r *Adapter) getReachableCommits(repository *gogit.Repository, refName plumbing.ReferenceName) (map[plumbing.Hash]bool, error) {
+	ref, err := repository.Reference(refName, true)
+	if err != nil {
+		return nil, fmt.Errorf("can't resolve the reference %s: %w", refName, err)
+	}
+	iter, err := repository.Log(&gogit.LogOptions{From: ref.Hash()})
+	if err != nil {
+		return nil, fmt.Errorf("can't get the log of %s: %w", refName, err)
+	}
+	defer iter.Close()
+	res := map[plumbing.Hash]bool{}
+	err = iter.ForEach(func(c *object.Commit) error {
+		res[c.Hash] = true
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("can't iterate over the log of %s: %w", refName, err)
+	}
+	return res, nil
+}
+
+// resolveTag returns the commit pointed by the given tag reference and the "creator date" of the tag
+// (tagger date for annotated tags, committer date for lightweight tags)
+func (r *Adapter) resolveTag(repository *gogit.Repository, ref *plumbing.Reference) (plumbing.Hash, time.Time, error) {
+	tagObject, err := repository.TagObject(ref.Hash())
+	switch err {
+	case nil:
+		commit, err := tagObject.Commit()
+		if err != nil {
+			return plumbing.ZeroHash, time.Time{}, err
+		}
+		return commit.Hash, tagObject.Tagger.When, nil
+	case plumbing.ErrObjectNotFound:
+		commit, err := repository.CommitObject(ref.Hash())
+		if err != nil {
+			return plumbing.ZeroHash, time.Time{}, err
+		}
+		return commit.Hash, commit.Committer.When, nil
+	default:
+		return plumbing.ZeroHash, time.Time{}, err
+	}
+}
+
+func (r *Adapter) GetContainedTags(branch string) ([]*git.Tag, error) {
+	res := []*git.Tag{}
+	logger := slog.Default().With("branch", branch)
+	repository, err := r.open()
+	if err != nil {
+		return nil, err
+	}
+	var reachable map[plumbing.Hash]bool
+	if branch != "" {
+		reachable, err = r.getReachableCommits(repository, plumbing.NewRemoteReferenceName(r.opts.OriginBranchName, branch))
+		if err != nil {
+			return nil, err
+		}
+	}
+	iter, err := repository.Tags()
+	if err != nil {
+		return nil, fmt.Errorf("can't list tags: %w", err)
+	}
+	defer iter.Close()
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		tagName := ref.Name().Short()
+		commitHash, tagDate, err := r.resolveTag(repository, ref)
+		if err != nil {
+			logger.Warn("can't resolve the tag => ignoring it", slog.String("tagName", tagName), slog.String("err", err.Error()))
+			return nil
+		}
+		if reachable != nil && !reachable[commitHash] {
+			return nil
+		}
+		res = append(res, git.NewTag(tagName, tagDate))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("can't iterate over tags: %w", err)
+	}
+	return res, nil
+}
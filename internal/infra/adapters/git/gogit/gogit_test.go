@@ -0,0 +1,14 @@
+package gitgogit
+
+import (
+	"testing"
+
+	"github.com/fabien-marty/github-next-semantic-version/internal/app/git"
+	gittestsuite "github.com/fabien-marty/github-next-semantic-version/internal/infra/adapters/git/testsuite"
+)
+
+func TestPort(t *testing.T) {
+	gittestsuite.Run(t, func(localGitPath string) git.Port {
+		return NewAdapter(AdapterOptions{LocalGitPath: localGitPath})
+	})
+}
@@ -6,22 +6,29 @@ import (
 	"log/slog"
 	"os"
 	"os/exec"
+	"slices"
 	"strings"
+	"sync"
 
 	"github.com/relvacode/iso8601"
 
 	"github.com/fabien-marty/github-next-semantic-version/internal/app/git"
+	gitcommon "github.com/fabien-marty/github-next-semantic-version/internal/infra/adapters/git/common"
 )
 
 var _ git.Port = &Adapter{}
 
 type AdapterOptions struct {
 	LocalGitPath     string
-	OriginBranchName string // default to "origin"
+	OriginBranchName string   // default to "origin"
+	GitHubHosts      []string // extra GitHub (Enterprise) hosts accepted when guessing the repository
+	AutoFetch        bool     // if true, fetch tags (and unshallow) the repository if needed (instead of failing)
 }
 
 type Adapter struct {
-	opts AdapterOptions
+	opts            AdapterOptions
+	checkOnce       sync.Once
+	checkHistoryErr error
 }
 
 func NewAdapter(opts AdapterOptions) *Adapter {
@@ -41,35 +48,28 @@ func lastLine(output string) string {
 	return lines[len(lines)-1]
 }
 
-func extractGHRepoFromRemoteUrl(remoteUrl string) (owner string, repo string) {
-	if strings.HasPrefix(remoteUrl, "git@github.com:") && strings.HasSuffix(remoteUrl, ".git") {
-		url := strings.TrimSuffix(strings.TrimPrefix(remoteUrl, "git@github.com:"), ".git")
-		tmp := strings.Split(url, "/")
-		if len(tmp) != 2 {
-			return "", ""
-		}
-		return tmp[0], tmp[1]
-	}
-	if strings.HasPrefix(remoteUrl, "https://") && strings.HasSuffix(remoteUrl, ".git") && strings.Contains(remoteUrl, "github.com/") {
-		url := strings.TrimSuffix(strings.TrimPrefix(remoteUrl, "https://"), ".git")
-		tmp := strings.Split(url, "/")
-		if len(tmp) != 3 {
-			return "", ""
-		}
-		return tmp[1], tmp[2]
+// gitCommand returns a git command to execute inside the local git repository
+// (we use "git -C" instead of changing the process working directory so the adapter
+// can be used concurrently against several repositories in the same process)
+func (r *Adapter) gitCommand(args ...string) *exec.Cmd {
+	if r.opts.LocalGitPath != "" && r.opts.LocalGitPath != "." {
+		args = append([]string{"-C", r.opts.LocalGitPath}, args...)
 	}
-	return "", ""
+	return exec.Command("git", args...)
 }
 
-func (r *Adapter) cwdOrDie() {
-	if r.opts.LocalGitPath != "" && r.opts.LocalGitPath != "." {
-		err := os.Chdir(r.opts.LocalGitPath)
-		if err != nil {
-			slog.Error("can't change the directory to %s: %v", r.opts.LocalGitPath, err)
-			os.Exit(1)
+// executeCmd executes the given command and returns its output (or an error with the stderr content)
+func (r *Adapter) executeCmd(logger *slog.Logger, cmd *exec.Cmd) (string, error) {
+	logger.Debug(fmt.Sprintf("executing command: %s...", cmd.String()))
+	output, err := cmd.Output()
+	if err != nil {
+		eerr, ok := err.(*exec.ExitError)
+		if ok {
+			return string(output), fmt.Errorf("bad exit code (%d) for command: %s: %s", eerr.ExitCode(), cmd.String(), strings.TrimSpace(string(eerr.Stderr)))
 		}
-		slog.Debug("working directory changed", slog.String("newWorkingDirectory", r.opts.LocalGitPath))
+		return string(output), fmt.Errorf("can't execute command: %s: %w", cmd.String(), err)
 	}
+	return string(output), nil
 }
 
 func (r *Adapter) executeCmdOrDie(logger *slog.Logger, cmd *exec.Cmd) string {
@@ -90,18 +90,48 @@ func (r *Adapter) executeCmdOrDie(logger *slog.Logger, cmd *exec.Cmd) string {
 
 func (r *Adapter) GuessGHRepo() (owner string, repo string) {
 	logger := slog.Default().With("gitOperation", "guessRepoOwner")
-	r.cwdOrDie()
-	cmd := exec.Command("git", "remote", "get-url", r.opts.OriginBranchName)
+	cmd := r.gitCommand("remote", "get-url", r.opts.OriginBranchName)
 	output := r.executeCmdOrDie(logger, cmd)
 	url := lastLine(output)
-	return extractGHRepoFromRemoteUrl(url)
+	return gitcommon.ExtractGHRepoFromRemoteUrl(url, r.opts.GitHubHosts...)
+}
+
+func (r *Adapter) GetRemoteUrls() (map[string]string, error) {
+	logger := slog.Default().With("gitOperation", "getRemoteUrls")
+	output, err := r.executeCmd(logger, r.gitCommand("remote", "--verbose"))
+	if err != nil {
+		return nil, err
+	}
+	res := map[string]string{}
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 || fields[2] != "(fetch)" {
+			continue
+		}
+		res[fields[0]] = fields[1]
+	}
+	return res, nil
 }
 
 func (r *Adapter) GuessDefaultBranch() string {
 	logger := slog.Default().With("gitOperation", "guessDefaultBranch")
-	r.cwdOrDie()
-	cmd := exec.Command("git", "remote", "show", r.opts.OriginBranchName)
-	output := r.executeCmdOrDie(logger, cmd)
+	// first, let's try offline with refs/remotes/<remote>/HEAD (set by "git clone" or "git remote set-head")
+	remoteHead := "refs/remotes/" + r.opts.OriginBranchName + "/HEAD"
+	output, err := r.executeCmd(logger, r.gitCommand("symbolic-ref", "--quiet", remoteHead))
+	if err == nil {
+		branch := strings.TrimPrefix(lastLine(output), "refs/remotes/"+r.opts.OriginBranchName+"/")
+		if branch != "" {
+			return branch
+		}
+	}
+	// then, let's ask the remote (network access, slow)
+	logger.Debug(fmt.Sprintf("can't find %s => let's ask the remote", remoteHead))
+	cmd := r.gitCommand("remote", "show", r.opts.OriginBranchName)
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0") // no interactive prompt for https credentials
+	if os.Getenv("GIT_SSH_COMMAND") == "" {
+		cmd.Env = append(cmd.Env, "GIT_SSH_COMMAND=ssh -o BatchMode=yes") // no interactive prompt for ssh passphrases
+	}
+	output = r.executeCmdOrDie(logger, cmd)
 	lines := strings.Split(output, "\n")
 	for _, line := range lines {
 		trimmedLine := strings.TrimSpace(line)
@@ -112,16 +142,103 @@ func (r *Adapter) GuessDefaultBranch() string {
 	return ""
 }
 
+// GetBranchHeadSha returns the sha of refs/remotes/<origin>/<branch> (no network access)
+func (r *Adapter) GetBranchHeadSha(branch string) (string, error) {
+	logger := slog.Default().With("gitOperation", "getBranchHeadSha", "branch", branch)
+	ref := "refs/remotes/" + r.opts.OriginBranchName + "/" + branch
+	output, err := r.executeCmd(logger, r.gitCommand("rev-parse", "--verify", "--quiet", ref+"^{commit}"))
+	if err != nil {
+		return "", fmt.Errorf("can't find the head of %s: %w", ref, err)
+	}
+	return lastLine(output), nil
+}
+
+func (r *Adapter) isShallow(logger *slog.Logger) (bool, error) {
+	output, err := r.executeCmd(logger, r.gitCommand("rev-parse", "--is-shallow-repository"))
+	if err != nil {
+		return false, err
+	}
+	return lastLine(output) == "true", nil
+}
+
+func (r *Adapter) listTagNames(logger *slog.Logger) ([]string, error) {
+	output, err := r.executeCmd(logger, r.gitCommand("tag", "--list"))
+	if err != nil {
+		return nil, err
+	}
+	res := []string{}
+	for _, line := range strings.Split(output, "\n") {
+		tagName := strings.TrimSpace(line)
+		if tagName != "" {
+			res = append(res, tagName)
+		}
+	}
+	return res, nil
+}
+
+// checkHistory checks that the local repository is not shallow and contains tags
+// (this is typically not the case with the default "actions/checkout" configuration in GitHub Actions)
+//
+// If AutoFetch option is set, missing tags (and history) are fetched from the remote,
+// else an (actionable) error is returned for shallow repositories.
+func (r *Adapter) checkHistory() error {
+	logger := slog.Default().With("gitOperation", "checkHistory")
+	shallow, err := r.isShallow(logger)
+	if err != nil {
+		return err
+	}
+	tagNames, err := r.listTagNames(logger)
+	if err != nil {
+		return err
+	}
+	if !shallow && len(tagNames) > 0 {
+		return nil
+	}
+	if !r.opts.AutoFetch {
+		if shallow {
+			return fmt.Errorf("the local git repository is shallow, so tags and history are probably missing => fetch the full history with tags (for example with 'git fetch --unshallow --tags %s' or with 'fetch-depth: 0' in actions/checkout) or use --auto-fetch option", r.opts.OriginBranchName)
+		}
+		logger.Warn(fmt.Sprintf("no tag found in the local git repository => if tags exist on the remote, fetch them (for example with 'git fetch --tags %s') or use --auto-fetch option", r.opts.OriginBranchName))
+		return nil
+	}
+	args := []string{"fetch", "--tags"}
+	if shallow {
+		args = append(args, "--unshallow")
+	}
+	args = append(args, r.opts.OriginBranchName)
+	_, err = r.executeCmd(logger, r.gitCommand(args...))
+	if err != nil {
+		return fmt.Errorf("can't fetch tags from %s: %w", r.opts.OriginBranchName, err)
+	}
+	if shallow {
+		logger.Info(fmt.Sprintf("the local git repository was shallow => full history fetched from %s", r.opts.OriginBranchName))
+	}
+	newTagNames, err := r.listTagNames(logger)
+	if err != nil {
+		return err
+	}
+	fetched := slices.DeleteFunc(newTagNames, func(tagName string) bool {
+		return slices.Contains(tagNames, tagName)
+	})
+	logger.Info(fmt.Sprintf("%d tag(s) fetched from %s", len(fetched), r.opts.OriginBranchName), slog.String("tags", strings.Join(fetched, ",")))
+	return nil
+}
+
 func (r *Adapter) GetContainedTags(branch string) ([]*git.Tag, error) {
 	res := []*git.Tag{}
-	r.cwdOrDie()
+	r.checkOnce.Do(func() {
+		r.checkHistoryErr = r.checkHistory()
+	})
+	if r.checkHistoryErr != nil {
+		return nil, r.checkHistoryErr
+	}
 
 	logger := slog.Default().With("branch", branch)
 	args := []string{"for-each-ref", "--sort=taggerdate", "--format=%(refname:short)~~~%(creatordate:iso-strict)", "refs/tags"}
 	if branch != "" {
 		args = append(args, "--merged", "refs/remotes/"+r.opts.OriginBranchName+"/"+branch)
 	}
-	cmd := exec.Command("git", args...)
+	cmd := r.gitCommand(args...)
 	output := r.executeCmdOrDie(logger, cmd)
 	scanner := bufio.NewScanner(strings.NewReader(output))
 	for scanner.Scan() {
@@ -1,31 +1,64 @@
 package gitlocal
 
 import (
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/fabien-marty/github-next-semantic-version/internal/app/git"
+	gittestsuite "github.com/fabien-marty/github-next-semantic-version/internal/infra/adapters/git/testsuite"
 	"github.com/stretchr/testify/assert"
 )
 
-func TestExtractGHRepoFromRemoteUrl(t *testing.T) {
-	owner, repo := extractGHRepoFromRemoteUrl("git@github.com:fabien-marty/github-next-semantic-version.git")
-	assert.Equal(t, "fabien-marty", owner)
-	assert.Equal(t, "github-next-semantic-version", repo)
-	owner, repo = extractGHRepoFromRemoteUrl("git@github.com:fabien-martygithub-next-semantic-version.git")
-	assert.Equal(t, "", owner)
-	assert.Equal(t, "", repo)
-	owner, repo = extractGHRepoFromRemoteUrl("FIXME")
-	assert.Equal(t, "", owner)
-	assert.Equal(t, "", repo)
-	owner, repo = extractGHRepoFromRemoteUrl("https://github.com/fabien-marty/github-next-semantic-version.git")
-	assert.Equal(t, "fabien-marty", owner)
-	assert.Equal(t, "github-next-semantic-version", repo)
-	owner, repo = extractGHRepoFromRemoteUrl("https://foo@github.com/fabien-marty/github-next-semantic-version.git")
-	assert.Equal(t, "fabien-marty", owner)
-	assert.Equal(t, "github-next-semantic-version", repo)
-}
-
 func TestLastLine(t *testing.T) {
 	assert.Equal(t, "c", lastLine("a\nb\nc"))
 	assert.Equal(t, "c", lastLine("  c "))
 	assert.Equal(t, "", lastLine(""))
 }
+
+func TestPort(t *testing.T) {
+	gittestsuite.Run(t, func(localGitPath string) git.Port {
+		return NewAdapter(AdapterOptions{LocalGitPath: localGitPath})
+	})
+}
+
+// newShallowClone returns a shallow clone (depth=1, without tags) of the remote of the given repository
+func newShallowClone(t *testing.T, dir string) string {
+	t.Helper()
+	remote := lastLine(gittestsuite.Git(t, dir, time.Now(), "remote", "get-url", "origin"))
+	clone := filepath.Join(t.TempDir(), "shallow")
+	gittestsuite.Git(t, dir, time.Now(), "clone", "--quiet", "--depth=1", "--no-tags", "file://"+remote, clone)
+	return clone
+}
+
+func TestShallowWithoutAutoFetch(t *testing.T) {
+	clone := newShallowClone(t, gittestsuite.NewTestRepoWithRemote(t))
+	adapter := NewAdapter(AdapterOptions{LocalGitPath: clone})
+	_, err := adapter.GetContainedTags("main")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "shallow")
+	assert.Contains(t, err.Error(), "--auto-fetch")
+}
+
+func TestShallowWithAutoFetch(t *testing.T) {
+	clone := newShallowClone(t, gittestsuite.NewTestRepoWithRemote(t))
+	adapter := NewAdapter(AdapterOptions{LocalGitPath: clone, AutoFetch: true})
+	tags, err := adapter.GetContainedTags("main")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(tags))
+	output := gittestsuite.Git(t, clone, time.Now(), "rev-parse", "--is-shallow-repository")
+	assert.Equal(t, "false", lastLine(output))
+}
+
+func TestMissingTagsWithAutoFetch(t *testing.T) {
+	dir := gittestsuite.NewTestRepoWithRemote(t)
+	gittestsuite.Git(t, dir, time.Now(), "tag", "--delete", "v1.0.0", "v1.1.0", "v2.0.0")
+	adapter := NewAdapter(AdapterOptions{LocalGitPath: dir})
+	tags, err := adapter.GetContainedTags("main")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(tags))
+	adapter = NewAdapter(AdapterOptions{LocalGitPath: dir, AutoFetch: true})
+	tags, err = adapter.GetContainedTags("main")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(tags))
+}
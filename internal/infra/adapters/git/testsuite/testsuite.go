@@ -0,0 +1,216 @@
+// Package gittestsuite provides a common test suite that must be passed by all git.Port implementations.
+package gittestsuite
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fabien-marty/github-next-semantic-version/internal/app/git"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// AdapterFactory returns a new git.Port implementation for the given local git path.
+type AdapterFactory func(localGitPath string) git.Port
+
+// baseDate is the date of the first commit of test repositories
+// (each following commit is one hour later).
+var baseDate = time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+
+// Git executes a git command inside the given directory (with a fixed identity and a fixed date).
+func Git(t *testing.T, dir string, date time.Time, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=test",
+		"GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=test",
+		"GIT_COMMITTER_EMAIL=test@example.com",
+		"GIT_AUTHOR_DATE="+date.Format(time.RFC3339),
+		"GIT_COMMITTER_DATE="+date.Format(time.RFC3339),
+		"GIT_CONFIG_GLOBAL=/dev/null",
+		"GIT_CONFIG_NOSYSTEM=1",
+	)
+	output, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(output))
+	return string(output)
+}
+
+// NewTestRepo creates a new local git repository (in a temporary directory)
+// with one commit (on the main branch) per given tag and the given remote url for "origin".
+func NewTestRepo(t *testing.T, remoteUrl string, tags ...string) string {
+	t.Helper()
+	dir := t.TempDir()
+	Git(t, dir, baseDate, "init", "--quiet", "--initial-branch=main")
+	Git(t, dir, baseDate, "remote", "add", "origin", remoteUrl)
+	for i, tag := range tags {
+		date := baseDate.Add(time.Duration(i) * time.Hour)
+		Git(t, dir, date, "commit", "--quiet", "--allow-empty", "-m", tag)
+		Git(t, dir, date, "tag", tag)
+	}
+	return dir
+}
+
+// NewTestRepoWithRemote creates a local clone of a local bare repository (the "origin" remote) with:
+//
+// - v1.0.0 (lightweight tag) and v1.1.0 (annotated tag) on the main branch (the default one)
+// - v2.0.0 (lightweight tag) on a "feature" branch (forked from main after v1.1.0)
+//
+// It returns the path of the clone.
+func NewTestRepoWithRemote(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	seed := filepath.Join(root, "seed")
+	remote := filepath.Join(root, "remote.git")
+	clone := filepath.Join(root, "clone")
+	require.NoError(t, os.Mkdir(seed, 0700))
+	Git(t, seed, baseDate, "init", "--quiet", "--initial-branch=main")
+	Git(t, seed, baseDate, "commit", "--quiet", "--allow-empty", "-m", "first")
+	Git(t, seed, baseDate, "tag", "v1.0.0")
+	date := baseDate.Add(1 * time.Hour)
+	Git(t, seed, date, "commit", "--quiet", "--allow-empty", "-m", "second")
+	Git(t, seed, date.Add(30*time.Minute), "tag", "-a", "-m", "v1.1.0", "v1.1.0")
+	Git(t, seed, date, "checkout", "--quiet", "-b", "feature")
+	date = baseDate.Add(2 * time.Hour)
+	Git(t, seed, date, "commit", "--quiet", "--allow-empty", "-m", "third")
+	Git(t, seed, date, "tag", "v2.0.0")
+	Git(t, seed, date, "checkout", "--quiet", "main")
+	Git(t, root, date, "clone", "--quiet", "--bare", seed, remote)
+	Git(t, root, date, "clone", "--quiet", remote, clone)
+	return clone
+}
+
+func tagNames(tags []*git.Tag) []string {
+	res := []string{}
+	for _, tag := range tags {
+		res = append(res, tag.Name)
+	}
+	sort.Strings(res)
+	return res
+}
+
+func findTag(tags []*git.Tag, name string) *git.Tag {
+	for _, tag := range tags {
+		if tag.Name == name {
+			return tag
+		}
+	}
+	return nil
+}
+
+// Run executes the common test suite against adapters built by the given factory.
+func Run(t *testing.T, factory AdapterFactory) {
+	t.Run("GetContainedTagsWithoutBranch", func(t *testing.T) {
+		dir := NewTestRepo(t, "git@github.com:foo/bar.git", "v1.0.0", "foo", "v1.1.0")
+		tags, err := factory(dir).GetContainedTags("")
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"foo", "v1.0.0", "v1.1.0"}, tagNames(tags))
+		tag := findTag(tags, "v1.1.0")
+		require.NotNil(t, tag)
+		assert.NotNil(t, tag.Semver)
+		assert.True(t, tag.Time.Equal(baseDate.Add(2*time.Hour)), tag.Time.String())
+	})
+	t.Run("GetContainedTagsWithBranch", func(t *testing.T) {
+		dir := NewTestRepoWithRemote(t)
+		adapter := factory(dir)
+		tags, err := adapter.GetContainedTags("main")
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"v1.0.0", "v1.1.0"}, tagNames(tags))
+		tag := findTag(tags, "v1.1.0")
+		require.NotNil(t, tag)
+		assert.True(t, tag.Time.Equal(baseDate.Add(90*time.Minute)), tag.Time.String()) // annotated tag => tagger date
+		tags, err = adapter.GetContainedTags("feature")
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"v1.0.0", "v1.1.0", "v2.0.0"}, tagNames(tags))
+	})
+	t.Run("GuessGHRepo", func(t *testing.T) {
+		for _, remoteUrl := range []string{"git@github.com:foo/bar.git", "https://github.com/foo/bar.git"} {
+			dir := NewTestRepo(t, remoteUrl)
+			owner, repo := factory(dir).GuessGHRepo()
+			assert.Equal(t, "foo", owner, remoteUrl)
+			assert.Equal(t, "bar", repo, remoteUrl)
+		}
+		dir := NewTestRepo(t, "https://example.com/foo/bar")
+		owner, repo := factory(dir).GuessGHRepo()
+		assert.Equal(t, "", owner)
+		assert.Equal(t, "", repo)
+	})
+	t.Run("GetRemoteUrls", func(t *testing.T) {
+		dir := NewTestRepo(t, "git@github.com:foo/bar.git")
+		Git(t, dir, baseDate, "remote", "add", "upstream", "https://github.com/upstream/bar.git")
+		urls, err := factory(dir).GetRemoteUrls()
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]string{"origin": "git@github.com:foo/bar.git", "upstream": "https://github.com/upstream/bar.git"}, urls)
+	})
+	t.Run("GuessDefaultBranch", func(t *testing.T) {
+		dir := NewTestRepoWithRemote(t)
+		assert.Equal(t, "main", factory(dir).GuessDefaultBranch())
+		Git(t, dir, baseDate, "remote", "set-head", "origin", "--delete")
+		assert.Equal(t, "main", factory(dir).GuessDefaultBranch())
+	})
+	t.Run("GuessDefaultBranchOffline", func(t *testing.T) {
+		dir := NewTestRepoWithRemote(t)
+		Git(t, dir, baseDate, "remote", "set-head", "origin", "feature")
+		Git(t, dir, baseDate, "remote", "set-url", "origin", "https://invalid.invalid/foo/bar.git")
+		assert.Equal(t, "feature", factory(dir).GuessDefaultBranch())
+	})
+	t.Run("GetBranchHeadSha", func(t *testing.T) {
+		dir := NewTestRepoWithRemote(t)
+		adapter := factory(dir)
+		sha, err := adapter.GetBranchHeadSha("feature")
+		assert.Nil(t, err)
+		assert.Equal(t, strings.TrimSpace(Git(t, dir, baseDate, "rev-parse", "origin/feature")), sha)
+		assert.Len(t, sha, 40)
+		_, err = adapter.GetBranchHeadSha("unknown")
+		assert.Error(t, err)
+	})
+	t.Run("DoesNotChangeWorkingDirectory", func(t *testing.T) {
+		cwd, err := os.Getwd()
+		require.NoError(t, err)
+		dir := NewTestRepoWithRemote(t)
+		adapter := factory(dir)
+		_, err = adapter.GetContainedTags("main")
+		assert.Nil(t, err)
+		_, _ = adapter.GuessGHRepo()
+		_ = adapter.GuessDefaultBranch()
+		cwd2, err := os.Getwd()
+		require.NoError(t, err)
+		assert.Equal(t, cwd, cwd2)
+	})
+	t.Run("ConcurrentUseWithSeveralRepos", func(t *testing.T) {
+		dir1 := NewTestRepo(t, "git@github.com:foo/repo1.git", "v1.0.0", "v1.1.0")
+		dir2 := NewTestRepo(t, "https://github.com/bar/repo2.git", "v2.0.0")
+		adapter1 := factory(dir1)
+		adapter2 := factory(dir2)
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				tags, err := adapter1.GetContainedTags("")
+				assert.Nil(t, err)
+				assert.Equal(t, []string{"v1.0.0", "v1.1.0"}, tagNames(tags), fmt.Sprintf("iteration %d", i))
+				owner, repo := adapter1.GuessGHRepo()
+				assert.Equal(t, "foo", owner)
+				assert.Equal(t, "repo1", repo)
+			}()
+			go func() {
+				defer wg.Done()
+				tags, err := adapter2.GetContainedTags("")
+				assert.Nil(t, err)
+				assert.Equal(t, []string{"v2.0.0"}, tagNames(tags), fmt.Sprintf("iteration %d", i))
+				owner, repo := adapter2.GuessGHRepo()
+				assert.Equal(t, "bar", owner)
+				assert.Equal(t, "repo2", repo)
+			}()
+		}
+		wg.Wait()
+	})
+}
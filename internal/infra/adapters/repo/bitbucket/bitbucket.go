@@ -0,0 +1,394 @@
+package repobitbucket
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/fabien-marty/github-next-semantic-version/internal/app/repo"
+	"github.com/fabien-marty/github-next-semantic-version/internal/infra/adapters/repo/httpclient"
+)
+
+var _ repo.Port = &Adapter{}
+
+const defaultBaseURL = "https://api.bitbucket.org/2.0/"
+
+type state string
+
+const (
+	open   state = "OPEN"
+	merged state = "MERGED"
+)
+
+type AdapterOptions struct {
+	Token       string       // (repository, project or workspace) access token, used as a bearer token
+	Username    string       // username for basic authentication (with AppPassword, ignored if Token is set)
+	AppPassword string       // app password (Bitbucket Cloud) or password for basic authentication
+	BaseURL     string       // API base url, empty => https://api.bitbucket.org/2.0/ (Bitbucket Cloud)
+	Server      bool         // true for Bitbucket Server/Data Center (BaseURL is then the instance url, example: https://bitbucket.example.com/)
+	HTTPClient  *http.Client // http client to use, nil => http.DefaultClient
+}
+
+// authenticate sets the authentication headers of the given API request (bearer token or basic authentication)
+func (o AdapterOptions) authenticate(req *http.Request) {
+	if o.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+o.Token)
+	} else if o.Username != "" {
+		req.SetBasicAuth(o.Username, o.AppPassword)
+	}
+}
+
+// Adapter is a repo adapter using the Bitbucket Cloud (2.0) or the Bitbucket Server/Data Center (1.0) REST API
+//
+// With Bitbucket Cloud, the owner is the workspace and the repo is the repository slug.
+// With Bitbucket Server, the owner is the project key and the repo is the repository slug.
+//
+// Bitbucket has no pull request labels, so pull requests are returned without labels
+// (see the labels fallback of the app configuration) and releases are annotated tags.
+type Adapter struct {
+	opts    AdapterOptions
+	baseURL *url.URL
+	api     *httpclient.APIClient
+	server  bool // true for Bitbucket Server/Data Center
+	owner   string
+	repo    string
+}
+
+func NewAdapter(owner string, repo string, opts AdapterOptions) (*Adapter, error) {
+	if opts.BaseURL == "" {
+		if opts.Server {
+			return nil, fmt.Errorf("the Bitbucket Server url is mandatory")
+		}
+		opts.BaseURL = defaultBaseURL
+	}
+	baseURL, err := url.Parse(opts.BaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("can't parse the Bitbucket base url %s: %w", opts.BaseURL, err)
+	}
+	if baseURL.Scheme == "" || baseURL.Host == "" {
+		return nil, fmt.Errorf("bad Bitbucket base url: %s (scheme and host are mandatory)", opts.BaseURL)
+	}
+	if !strings.HasSuffix(baseURL.Path, "/") {
+		baseURL.Path += "/"
+	}
+	return &Adapter{
+		opts:    opts,
+		baseURL: baseURL,
+		api:     httpclient.NewAPIClient("Bitbucket", baseURL, opts.HTTPClient, opts.authenticate),
+		server:  opts.Server,
+		owner:   owner,
+		repo:    repo,
+	}, nil
+}
+
+// IsServerURL returns true if the given (not empty) API base url is not the Bitbucket Cloud one
+// (so it's a Bitbucket Server/Data Center url)
+func IsServerURL(baseURL string) bool {
+	u, err := url.Parse(baseURL)
+	return baseURL != "" && err == nil && u.Host != "api.bitbucket.org"
+}
+
+// WebBaseURL returns the web base url (without trailing slash) corresponding to the given API base url
+// (example: https://bitbucket.example.com/ => https://bitbucket.example.com)
+// If the API base url is empty (or the Bitbucket Cloud one), https://bitbucket.org is returned.
+func WebBaseURL(baseURL string) (string, error) {
+	if baseURL == "" {
+		baseURL = defaultBaseURL
+	}
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return "", fmt.Errorf("can't parse the url %s: %w", baseURL, err)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("bad url: %s (scheme and host are mandatory)", baseURL)
+	}
+	if u.Host == "api.bitbucket.org" {
+		return "https://bitbucket.org", nil
+	}
+	return u.Scheme + "://" + u.Host + strings.TrimSuffix(u.Path, "/"), nil
+}
+
+// request executes an API request on the given url (absolute or relative to the base url) and decodes
+// the JSON response into res (if not nil, see httpclient.APIClient.Request)
+func (r *Adapter) request(method string, path string, query url.Values, payload any, res any) error {
+	_, err := r.api.Request(method, path, query, payload, res)
+	return err
+}
+
+// pullRequestsPage is a page of pull requests (converted to repo.PullRequest) returned by the Bitbucket API
+type pullRequestsPage struct {
+	prs  []*repo.PullRequest
+	next string // url (Bitbucket Cloud) or start index (Bitbucket Server) of the next page, empty if this is the last page
+}
+
+// setCloudMergeDate sets MergedAt and ClosedAt of the given merged pull request with its merge date
+// (Bitbucket Cloud, see getCloudMergeDate)
+//
+// If the merge date can't be found in the activity, the last update date is used (with a warning).
+func (r *Adapter) setCloudMergeDate(pr *repo.PullRequest) error {
+	mergedAt, err := r.getCloudMergeDate(pr.Number)
+	if err != nil {
+		return err
+	}
+	if mergedAt == nil {
+		slog.Warn("can't find the merge date of the pull request => let's use its last update date", slog.Int("number", pr.Number))
+		mergedAt = pr.UpdatedAt
+	}
+	pr.MergedAt = mergedAt
+	pr.ClosedAt = mergedAt
+	return nil
+}
+
+// listPullRequests returns the list of pull requests (targetting the given base) in the given state
+// (sorted by updated date, descending, if sortByUpdated is true, else by creation date)
+//
+// If stopBefore is not nil, merged pull requests merged before this time are not returned and
+// (with Bitbucket Cloud and sortByUpdated) the pagination stops as soon as we get a pull request
+// updated before this time.
+//
+// With Bitbucket Cloud, the merge date of each returned merged pull request costs an extra request
+// (see setCloudMergeDate).
+func (r *Adapter) listPullRequests(state state, base string, sortByUpdated bool, usePagination bool, stopBefore *time.Time) ([]*repo.PullRequest, error) {
+	logger := slog.Default().With("base", base, "state", string(state), "sortByUpdated", sortByUpdated)
+	res := []*repo.PullRequest{}
+	next := ""
+	for pageNumber := 1; ; pageNumber++ {
+		logger := logger.With("page", pageNumber)
+		logger.Debug("fetching pull-requests...")
+		var page *pullRequestsPage
+		var err error
+		if r.server {
+			page, err = r.listServerPullRequestsPage(state, base, next)
+		} else {
+			page, err = r.listCloudPullRequestsPage(state, base, sortByUpdated, next)
+		}
+		if err != nil {
+			return nil, err
+		}
+		tooOld := false
+		for _, pr := range page.prs {
+			if stopBefore != nil && !r.server && sortByUpdated && pr.UpdatedAt.Before(*stopBefore) {
+				// the merge is an update => a PR updated before stopBefore can't be merged after stopBefore
+				// (but a PR updated after stopBefore can have been merged before, see below)
+				tooOld = true
+				continue
+			}
+			if state == merged && !r.server {
+				err = r.setCloudMergeDate(pr)
+				if err != nil {
+					return nil, err
+				}
+			}
+			if stopBefore != nil && pr.MergedAt != nil && pr.MergedAt.Before(*stopBefore) {
+				continue
+			}
+			res = append(res, pr)
+		}
+		if tooOld {
+			logger.Debug("pull-requests older than the cutoff found => stop paginating", slog.Time("cutoff", *stopBefore))
+			break
+		}
+		if !usePagination || page.next == "" {
+			break
+		}
+		next = page.next
+	}
+	logger.Debug("pull-requests fetched", slog.Int("count", len(res)))
+	return res, nil
+}
+
+func sortPRByUpdatedAt(a, b *repo.PullRequest) int {
+	return a.UpdatedAt.Compare(*b.UpdatedAt)
+}
+
+func (r *Adapter) GetLastUpdatedPullRequests(base string, onlyMerged bool) ([]*repo.PullRequest, error) {
+	if onlyMerged {
+		return r.listPullRequests(merged, base, true, false, nil)
+	}
+	opened, err := r.listPullRequests(open, base, true, false, nil)
+	if err != nil {
+		return nil, err
+	}
+	merged, err := r.listPullRequests(merged, base, true, false, nil)
+	if err != nil {
+		return nil, err
+	}
+	tmp := []*repo.PullRequest{}
+	tmp = append(tmp, opened...)
+	tmp = append(tmp, merged...)
+	slices.SortFunc(tmp, sortPRByUpdatedAt)
+	slices.Reverse(tmp)
+	return tmp, nil
+}
+
+func (r *Adapter) GetPullRequests(base string, onlyMerged bool) ([]*repo.PullRequest, error) {
+	if onlyMerged {
+		return r.listPullRequests(merged, base, false, true, nil)
+	}
+	opened, err := r.listPullRequests(open, base, false, true, nil)
+	if err != nil {
+		return nil, err
+	}
+	merged, err := r.listPullRequests(merged, base, false, true, nil)
+	if err != nil {
+		return nil, err
+	}
+	return append(opened, merged...), nil
+}
+
+// GetPullRequestsSince returns merged pull requests merged after the given time
+// (+ all open pull requests if onlyMerged is false)
+func (r *Adapter) GetPullRequestsSince(base string, onlyMerged bool, since time.Time) ([]*repo.PullRequest, error) {
+	if onlyMerged {
+		return r.listPullRequests(merged, base, true, true, &since)
+	}
+	opened, err := r.listPullRequests(open, base, false, true, nil)
+	if err != nil {
+		return nil, err
+	}
+	merged, err := r.listPullRequests(merged, base, true, true, &since)
+	if err != nil {
+		return nil, err
+	}
+	return append(opened, merged...), nil
+}
+
+// GetLinkedIssues returns the issues closed by the given pull request
+//
+// Bitbucket doesn't expose the issues closed by a pull request, so an empty list is returned.
+func (r *Adapter) GetLinkedIssues(pr *repo.PullRequest) ([]*repo.Issue, error) {
+	if pr.LinkedIssues != nil {
+		return pr.LinkedIssues, nil
+	}
+	return []*repo.Issue{}, nil
+}
+
+// CreateRelease creates an annotated tag (with the release body as message) on the target sha
+// (or on the head of the base branch if not set), Bitbucket has no releases
+//
+// Drafts are not supported, so an error is returned if draft is true. The release name,
+// the prerelease flag and the make-latest policy are ignored.
+func (r *Adapter) CreateRelease(opts repo.ReleaseOptions) (*repo.Release, error) {
+	if opts.Draft {
+		return nil, fmt.Errorf("draft releases are not supported by Bitbucket")
+	}
+	var err error
+	if r.server {
+		err = r.createServerTag(opts.Base, opts.TargetSha, opts.TagName, opts.Body)
+	} else {
+		err = r.createCloudTag(opts.Base, opts.TargetSha, opts.TagName, opts.Body)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("can't create the Bitbucket tag %s: %w", opts.TagName, err)
+	}
+	return &repo.Release{TagName: opts.TagName, Name: opts.TagName}, nil
+}
+
+// GetLastReleases returns the most recent tags (Bitbucket has no releases)
+func (r *Adapter) GetLastReleases() ([]*repo.Release, error) {
+	var names []string
+	var err error
+	if r.server {
+		names, err = r.listServerTags()
+	} else {
+		names, err = r.listCloudTags()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("can't list the Bitbucket tags: %w", err)
+	}
+	res := []*repo.Release{}
+	for _, name := range names {
+		res = append(res, &repo.Release{TagName: name, Name: name})
+	}
+	return res, nil
+}
+
+// UpdateRelease returns an error (Bitbucket tags can't be updated)
+func (r *Adapter) UpdateRelease(release *repo.Release, opts repo.ReleaseOptions) (*repo.Release, error) {
+	return nil, fmt.Errorf("can't update the Bitbucket tag %s (tags can't be updated)", release.TagName)
+}
+
+// UploadReleaseAsset uploads the asset to the "Downloads" section of the repository (Bitbucket Cloud only)
+//
+// Bitbucket has no releases, so the asset is not linked to the tag (and an existing download with the same
+// name is replaced). Bitbucket Server/Data Center has no downloads, so an error is returned.
+func (r *Adapter) UploadReleaseAsset(release *repo.Release, asset repo.ReleaseAsset) error {
+	if r.server {
+		return fmt.Errorf("release assets are not supported by Bitbucket Server/Data Center")
+	}
+	content, err := asset.ReadAll()
+	if err != nil {
+		return fmt.Errorf("can't read the asset %s: %w", asset.Name, err)
+	}
+	payload, err := httpclient.NewMultipartPayload("files", asset.Name, asset.GetContentType(), content)
+	if err != nil {
+		return err
+	}
+	err = r.request(http.MethodPost, r.cloudRepoPath()+"/downloads", nil, payload, nil)
+	if err != nil {
+		return fmt.Errorf("can't upload the asset %s: %w", asset.Name, err)
+	}
+	return nil
+}
+
+// GetPullRequestComments returns the bodies of the comments of the given pull request
+// (on Bitbucket Server, the order is the reverse creation order)
+func (r *Adapter) GetPullRequestComments(pr *repo.PullRequest) ([]string, error) {
+	var res []string
+	var err error
+	if r.server {
+		res, err = r.listServerComments(pr.Number)
+	} else {
+		res, err = r.listCloudComments(pr.Number)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("can't list the comments of the pull request #%d: %w", pr.Number, err)
+	}
+	return res, nil
+}
+
+func (r *Adapter) AddPullRequestComment(pr *repo.PullRequest, body string) error {
+	var err error
+	if r.server {
+		err = r.addServerComment(pr.Number, body)
+	} else {
+		err = r.addCloudComment(pr.Number, body)
+	}
+	if err != nil {
+		return fmt.Errorf("can't comment the pull request #%d: %w", pr.Number, err)
+	}
+	return nil
+}
+
+// AddPullRequestLabel returns an error (Bitbucket pull requests have no labels)
+func (r *Adapter) AddPullRequestLabel(pr *repo.PullRequest, label string) error {
+	return fmt.Errorf("can't add the label %s to the pull request #%d (labels are not supported by Bitbucket)", label, pr.Number)
+}
+
+// errNoMilestones is returned by milestone methods (Bitbucket pull requests have no milestones)
+var errNoMilestones = errors.New("milestones are not supported by Bitbucket")
+
+func (r *Adapter) GetMilestones() ([]*repo.Milestone, error) {
+	return nil, errNoMilestones
+}
+
+func (r *Adapter) CreateMilestone(title string) (*repo.Milestone, error) {
+	return nil, errNoMilestones
+}
+
+func (r *Adapter) CloseMilestone(milestone *repo.Milestone) error {
+	return errNoMilestones
+}
+
+func (r *Adapter) GetMilestoneOpenItems(milestone *repo.Milestone) ([]repo.MilestoneItem, error) {
+	return nil, errNoMilestones
+}
+
+func (r *Adapter) SetMilestone(item repo.MilestoneItem, milestone *repo.Milestone) error {
+	return errNoMilestones
+}
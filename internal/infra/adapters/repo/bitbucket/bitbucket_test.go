@@ -0,0 +1,419 @@
+package repobitbucket
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/fabien-marty/github-next-semantic-version/internal/app/repo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var fakeBase = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// fakeCloudMergeDate returns the merge date served by the fake Bitbucket Cloud API server for the given PR
+// (15 minutes before its last update, except for #20, merged long before it was commented, and #1, without
+// merge in its activity)
+func fakeCloudMergeDate(number int) time.Time {
+	if number == 1 || number == 20 {
+		return fakeBase.Add(time.Hour)
+	}
+	return fakeBase.Add(time.Duration(number)*time.Hour - 15*time.Minute)
+}
+
+// newFakeCloudServer returns a fake Bitbucket Cloud API server serving 25 merged PRs
+// (sorted by updated date, descending, 10 per page, with their activity) and a single open PR (#1000)
+func newFakeCloudServer(t *testing.T) (*httptest.Server, *[]string) {
+	t.Helper()
+	calls := []string{}
+	mux := http.NewServeMux()
+	var server *httptest.Server
+	mux.HandleFunc("GET /2.0/repositories/foo/bar/pullrequests", func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.URL.RawQuery)
+		user, password, ok := r.BasicAuth()
+		assert.True(t, ok)
+		assert.Equal(t, "user", user)
+		assert.Equal(t, "password", password)
+		query := r.URL.Query()
+		assert.Equal(t, `destination.branch.name = "main"`, query.Get("q"))
+		numbers := []int{1000}
+		if query.Get("state") == "MERGED" {
+			numbers = []int{}
+			for i := 25; i > 0; i-- {
+				numbers = append(numbers, i)
+			}
+		}
+		page := 1
+		if query.Get("page") != "" {
+			page, _ = strconv.Atoi(query.Get("page"))
+		}
+		start := min((page-1)*10, len(numbers))
+		end := min(start+10, len(numbers))
+		res := map[string]any{"values": []map[string]any{}}
+		if end < len(numbers) {
+			query.Set("page", strconv.Itoa(page+1))
+			res["next"] = server.URL + "/2.0/repositories/foo/bar/pullrequests?" + query.Encode()
+		}
+		for _, number := range numbers[start:end] {
+			state := "OPEN"
+			updatedOn := fakeBase.Add(time.Duration(number) * time.Hour)
+			if query.Get("state") == "MERGED" {
+				state = "MERGED"
+			}
+			res["values"] = append(res["values"].([]map[string]any), map[string]any{
+				"id":           number,
+				"title":        fmt.Sprintf("PR%d", number),
+				"description":  "description",
+				"state":        state,
+				"created_on":   updatedOn.Add(-time.Hour),
+				"updated_on":   updatedOn,
+				"author":       map[string]any{"nickname": "user", "links": map[string]any{"html": map[string]any{"href": "https://bitbucket.org/user"}}},
+				"closed_by":    map[string]any{"nickname": "merger"},
+				"source":       map[string]any{"branch": map[string]any{"name": fmt.Sprintf("branch%d", number)}},
+				"destination":  map[string]any{"branch": map[string]any{"name": "main"}},
+				"merge_commit": map[string]any{"hash": fmt.Sprintf("sha%d", number)},
+				"reviewers":    []map[string]any{{"nickname": "reviewer"}},
+				"participants": []map[string]any{{"approved": true, "user": map[string]any{"nickname": "approver"}}, {"approved": false, "user": map[string]any{"nickname": "other"}}},
+				"links":        map[string]any{"html": map[string]any{"href": fmt.Sprintf("https://bitbucket.org/foo/bar/pull-requests/%d", number)}},
+			})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(res)
+	})
+	mux.HandleFunc("GET /2.0/repositories/foo/bar/pullrequests/{number}/activity", func(w http.ResponseWriter, r *http.Request) {
+		number, err := strconv.Atoi(r.PathValue("number"))
+		require.NoError(t, err)
+		values := []map[string]any{{"comment": map[string]any{"content": map[string]any{"raw": "LGTM"}}}}
+		if number != 1 {
+			values = append(values, map[string]any{"update": map[string]any{"state": "MERGED", "date": fakeCloudMergeDate(number)}})
+		}
+		values = append(values, map[string]any{"update": map[string]any{"state": "OPEN", "date": fakeBase}})
+		res := map[string]any{"values": values}
+		if number == 20 && r.URL.Query().Get("page") == "" {
+			// (the merge is on the second page)
+			res = map[string]any{"values": values[:1], "next": server.URL + r.URL.Path + "?page=2"}
+		} else if number == 20 {
+			res = map[string]any{"values": values[1:]}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(res)
+	})
+	server = httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+func newFakeCloudAdapter(t *testing.T, server *httptest.Server) *Adapter {
+	t.Helper()
+	adapter, err := NewAdapter("foo", "bar", AdapterOptions{Username: "user", AppPassword: "password", BaseURL: server.URL + "/2.0/"})
+	require.NoError(t, err)
+	return adapter
+}
+
+func TestWebBaseURL(t *testing.T) {
+	res, err := WebBaseURL("")
+	require.NoError(t, err)
+	assert.Equal(t, "https://bitbucket.org", res)
+	res, err = WebBaseURL("https://bitbucket.example.com/")
+	require.NoError(t, err)
+	assert.Equal(t, "https://bitbucket.example.com", res)
+	assert.False(t, IsServerURL(""))
+	assert.False(t, IsServerURL("https://api.bitbucket.org/2.0/"))
+	assert.True(t, IsServerURL("https://bitbucket.example.com/"))
+	_, err = NewAdapter("PROJ", "bar", AdapterOptions{Server: true})
+	assert.Error(t, err)
+}
+
+func TestCloudGetPullRequests(t *testing.T) {
+	server, calls := newFakeCloudServer(t)
+	adapter := newFakeCloudAdapter(t, server)
+
+	res, err := adapter.GetPullRequests("main", false)
+	require.NoError(t, err)
+	require.Equal(t, 26, len(res))
+	assert.Equal(t, 4, len(*calls))
+	assert.Contains(t, (*calls)[1], "sort=-created_on")
+	updatedOn := fakeBase.Add(25 * time.Hour)
+	createdOn := updatedOn.Add(-time.Hour)
+	mergedAt := fakeCloudMergeDate(25)
+	expected := &repo.PullRequest{
+		Number:             25,
+		Title:              "PR25",
+		MergedAt:           &mergedAt,
+		UpdatedAt:          &updatedOn,
+		Labels:             []string{},
+		Branch:             "branch25",
+		Url:                "https://bitbucket.org/foo/bar/pull-requests/25",
+		AuthorLogin:        "user",
+		AuthorUrl:          "https://bitbucket.org/user",
+		Body:               "description",
+		Assignees:          []string{},
+		RequestedReviewers: []string{"reviewer"},
+		ApprovingReviewers: []string{"approver"},
+		BaseBranch:         "main",
+		MergeCommitSha:     "sha25",
+		CreatedAt:          &createdOn,
+		ClosedAt:           &mergedAt,
+		MergedBy:           "merger",
+	}
+	assert.Equal(t, expected, res[1])
+	assert.Equal(t, fakeCloudMergeDate(20), *res[6].MergedAt)
+	assert.Equal(t, fakeBase.Add(time.Hour), *res[25].MergedAt) // (no merge in the activity => last update date)
+	assert.Equal(t, 1000, res[0].Number)
+	assert.Nil(t, res[0].MergedAt)
+	assert.Nil(t, res[0].ClosedAt)
+	assert.Equal(t, "", res[0].MergedBy)
+}
+
+func TestCloudGetPullRequestsSince(t *testing.T) {
+	server, calls := newFakeCloudServer(t)
+	adapter := newFakeCloudAdapter(t, server)
+
+	res, err := adapter.GetPullRequestsSince("main", true, fakeBase.Add(12*time.Hour+30*time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 12, len(res)) // PRs 13 => 25 (except #20 merged before but commented after)
+	for _, pr := range res {
+		assert.NotEqual(t, 20, pr.Number)
+	}
+	assert.Equal(t, 2, len(*calls))
+	assert.Contains(t, (*calls)[0], "sort=-updated_on")
+}
+
+func TestCloudCreateRelease(t *testing.T) {
+	var payload map[string]any
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /2.0/repositories/foo/bar/refs/branches/main", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"name": "main", "target": {"hash": "abcdef"}}`))
+	})
+	mux.HandleFunc("POST /2.0/repositories/foo/bar/refs/tags", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	adapter := newFakeCloudAdapter(t, server)
+
+	_, err := adapter.CreateRelease(repo.ReleaseOptions{Base: "main", TagName: "v1.2.3", Body: "release notes"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"name": "v1.2.3", "target": map[string]any{"hash": "abcdef"}, "message": "release notes"}, payload)
+
+	// with an exact sha, the branch is not read
+	_, err = adapter.CreateRelease(repo.ReleaseOptions{Base: "unknown", TagName: "v1.2.4", Body: "release notes", TargetSha: "012345"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"hash": "012345"}, payload["target"])
+
+	_, err = adapter.CreateRelease(repo.ReleaseOptions{Base: "main", TagName: "v1.2.4", Body: "release notes", Draft: true})
+	assert.ErrorContains(t, err, "draft releases are not supported")
+	_, err = adapter.CreateRelease(repo.ReleaseOptions{Base: "unknown", TagName: "v1.2.4", Body: "release notes"})
+	assert.ErrorContains(t, err, "can't get the head of the branch unknown")
+}
+
+func TestServerGetPullRequests(t *testing.T) {
+	calls := []string{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /rest/api/1.0/projects/PROJ/repos/bar/pull-requests", func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.URL.RawQuery)
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		query := r.URL.Query()
+		assert.Equal(t, "refs/heads/main", query.Get("at"))
+		if query.Get("state") == "OPEN" {
+			_, _ = w.Write([]byte(`{"values": [], "isLastPage": true}`))
+			return
+		}
+		closedDate := fakeBase.Add(time.Hour).UnixMilli()
+		pr := map[string]any{
+			"title":       "PR",
+			"description": "description",
+			"state":       "MERGED",
+			"createdDate": fakeBase.UnixMilli(),
+			"updatedDate": closedDate,
+			"closedDate":  closedDate,
+			"author":      map[string]any{"user": map[string]any{"name": "user", "links": map[string]any{"self": []map[string]any{{"href": "https://bitbucket.example.com/users/user"}}}}},
+			"reviewers": []map[string]any{
+				{"user": map[string]any{"name": "approver"}, "status": "APPROVED"},
+				{"user": map[string]any{"name": "other"}, "status": "UNAPPROVED"},
+			},
+			"fromRef":    map[string]any{"displayId": "feature/foo"},
+			"toRef":      map[string]any{"displayId": "main"},
+			"properties": map[string]any{"mergeCommit": map[string]any{"id": "abcdef"}},
+		}
+		var res map[string]any
+		if query.Get("start") == "" {
+			pr["id"] = 2
+			res = map[string]any{"values": []map[string]any{pr}, "isLastPage": false, "nextPageStart": 1}
+		} else {
+			assert.Equal(t, "1", query.Get("start"))
+			pr["id"] = 1
+			res = map[string]any{"values": []map[string]any{pr}, "isLastPage": true}
+		}
+		pr["links"] = map[string]any{"self": []map[string]any{{"href": fmt.Sprintf("https://bitbucket.example.com/projects/PROJ/repos/bar/pull-requests/%d", pr["id"])}}}
+		_ = json.NewEncoder(w).Encode(res)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	adapter, err := NewAdapter("PROJ", "bar", AdapterOptions{Token: "secret", BaseURL: server.URL, Server: true})
+	require.NoError(t, err)
+
+	res, err := adapter.GetPullRequests("main", false)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(res))
+	assert.Equal(t, 3, len(calls))
+	createdAt := fakeBase
+	closedAt := fakeBase.Add(time.Hour)
+	expected := &repo.PullRequest{
+		Number:             2,
+		Title:              "PR",
+		MergedAt:           &closedAt,
+		UpdatedAt:          &closedAt,
+		Labels:             []string{},
+		Branch:             "feature/foo",
+		Url:                "https://bitbucket.example.com/projects/PROJ/repos/bar/pull-requests/2",
+		AuthorLogin:        "user",
+		AuthorUrl:          "https://bitbucket.example.com/users/user",
+		Body:               "description",
+		Assignees:          []string{},
+		RequestedReviewers: []string{"approver", "other"},
+		ApprovingReviewers: []string{"approver"},
+		BaseBranch:         "main",
+		MergeCommitSha:     "abcdef",
+		CreatedAt:          &createdAt,
+		ClosedAt:           &closedAt,
+	}
+	assert.Equal(t, expected, res[0])
+	assert.Equal(t, 1, res[1].Number)
+}
+
+func TestServerCreateRelease(t *testing.T) {
+	var payload map[string]any
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /rest/git/1.0/projects/PROJ/repos/bar/tags", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		_, _ = w.Write([]byte(`{}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	adapter, err := NewAdapter("PROJ", "bar", AdapterOptions{BaseURL: server.URL + "/", Server: true})
+	require.NoError(t, err)
+
+	_, err = adapter.CreateRelease(repo.ReleaseOptions{Base: "main", TagName: "v1.2.3", Body: "release notes"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"name": "v1.2.3", "startPoint": "refs/heads/main", "message": "release notes"}, payload)
+
+	_, err = adapter.CreateRelease(repo.ReleaseOptions{Base: "main", TagName: "v1.2.4", Body: "release notes", TargetSha: "012345"})
+	require.NoError(t, err)
+	assert.Equal(t, "012345", payload["startPoint"])
+}
+
+func TestUploadReleaseAsset(t *testing.T) {
+	var filename, uploaded string
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /2.0/repositories/foo/bar/downloads", func(w http.ResponseWriter, r *http.Request) {
+		file, header, err := r.FormFile("files")
+		require.NoError(t, err)
+		defer file.Close()
+		body, _ := io.ReadAll(file)
+		filename, uploaded = header.Filename, string(body)
+		w.WriteHeader(http.StatusCreated)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	adapter := newFakeCloudAdapter(t, server)
+
+	err := adapter.UploadReleaseAsset(&repo.Release{TagName: "v1.2.3"}, repo.ReleaseAsset{Name: "foo.txt", Content: []byte("foo")})
+	require.NoError(t, err)
+	assert.Equal(t, "foo.txt", filename)
+	assert.Equal(t, "foo", uploaded)
+
+	serverAdapter, err := NewAdapter("PROJ", "bar", AdapterOptions{BaseURL: server.URL + "/", Server: true})
+	require.NoError(t, err)
+	err = serverAdapter.UploadReleaseAsset(&repo.Release{TagName: "v1.2.3"}, repo.ReleaseAsset{Name: "foo.txt", Content: []byte("foo")})
+	assert.ErrorContains(t, err, "not supported")
+}
+
+func TestGetLastReleases(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /2.0/repositories/foo/bar/refs/tags", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "-target.date", r.URL.Query().Get("sort"))
+		_, _ = w.Write([]byte(`{"values": [{"name": "v1.1.0"}, {"name": "v1.0.0"}]}`))
+	})
+	mux.HandleFunc("GET /rest/api/1.0/projects/PROJ/repos/bar/tags", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "MODIFICATION", r.URL.Query().Get("orderBy"))
+		_, _ = w.Write([]byte(`{"values": [{"id": "refs/tags/v2.0.0", "displayId": "v2.0.0"}]}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	releases, err := newFakeCloudAdapter(t, server).GetLastReleases()
+	require.NoError(t, err)
+	assert.Equal(t, []*repo.Release{{TagName: "v1.1.0", Name: "v1.1.0"}, {TagName: "v1.0.0", Name: "v1.0.0"}}, releases)
+
+	adapter, err := NewAdapter("PROJ", "bar", AdapterOptions{BaseURL: server.URL + "/", Server: true})
+	require.NoError(t, err)
+	releases, err = adapter.GetLastReleases()
+	require.NoError(t, err)
+	assert.Equal(t, []*repo.Release{{TagName: "v2.0.0", Name: "v2.0.0"}}, releases)
+	_, err = adapter.UpdateRelease(releases[0], repo.ReleaseOptions{TagName: "v2.0.0"})
+	assert.Error(t, err)
+}
+
+func TestPullRequestComments(t *testing.T) {
+	var cloudComment, serverComment map[string]any
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /2.0/repositories/foo/bar/pullrequests/1/comments", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("page") == "2" {
+			_, _ = w.Write([]byte(`{"values": [{"content": {"raw": "Released in v1.0.0"}}]}`))
+			return
+		}
+		next := "http://" + r.Host + "/2.0/repositories/foo/bar/pullrequests/1/comments?page=2"
+		_, _ = w.Write([]byte(`{"values": [{"content": {"raw": "LGTM"}}, {"deleted": true, "content": {"raw": ""}}], "next": "` + next + `"}`))
+	})
+	mux.HandleFunc("POST /2.0/repositories/foo/bar/pullrequests/1/comments", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&cloudComment))
+		_, _ = w.Write([]byte(`{}`))
+	})
+	mux.HandleFunc("GET /rest/api/1.0/projects/PROJ/repos/bar/pull-requests/1/activities", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("start") == "" {
+			_, _ = w.Write([]byte(`{"values": [{"action": "APPROVED"}, {"action": "COMMENTED", "comment": {"text": "Released in v1.0.0"}}], "isLastPage": false, "nextPageStart": 2}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"values": [{"action": "COMMENTED", "comment": {"text": "LGTM"}}], "isLastPage": true}`))
+	})
+	mux.HandleFunc("POST /rest/api/1.0/projects/PROJ/repos/bar/pull-requests/1/comments", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&serverComment))
+		_, _ = w.Write([]byte(`{}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	pr := &repo.PullRequest{Number: 1}
+
+	cloudAdapter := newFakeCloudAdapter(t, server)
+	comments, err := cloudAdapter.GetPullRequestComments(pr)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"LGTM", "Released in v1.0.0"}, comments)
+	require.NoError(t, cloudAdapter.AddPullRequestComment(pr, "Released in v1.1.0"))
+	assert.Equal(t, map[string]any{"content": map[string]any{"raw": "Released in v1.1.0"}}, cloudComment)
+	assert.Error(t, cloudAdapter.AddPullRequestLabel(pr, "released"))
+
+	serverAdapter, err := NewAdapter("PROJ", "bar", AdapterOptions{BaseURL: server.URL + "/", Server: true})
+	require.NoError(t, err)
+	comments, err = serverAdapter.GetPullRequestComments(pr)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Released in v1.0.0", "LGTM"}, comments)
+	require.NoError(t, serverAdapter.AddPullRequestComment(pr, "Released in v1.1.0"))
+	assert.Equal(t, map[string]any{"text": "Released in v1.1.0"}, serverComment)
+}
+
+func TestMilestones(t *testing.T) {
+	adapter, err := NewAdapter("foo", "bar", AdapterOptions{})
+	require.NoError(t, err)
+	_, err = adapter.GetMilestones()
+	assert.ErrorIs(t, err, errNoMilestones)
+	assert.ErrorIs(t, adapter.SetMilestone(repo.MilestoneItem{Number: 1}, &repo.Milestone{ID: 1}), errNoMilestones)
+}
@@ -0,0 +1,254 @@
+package repobitbucket
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/fabien-marty/github-next-semantic-version/internal/app/repo"
+)
+
+const cloudPerPage = 50 // maximum page size of the Bitbucket Cloud API
+
+type cloudUser struct {
+	Nickname string `json:"nickname"`
+	Links    struct {
+		HTML struct {
+			Href string `json:"href"`
+		} `json:"html"`
+	} `json:"links"`
+}
+
+type cloudBranch struct {
+	Branch struct {
+		Name string `json:"name"`
+	} `json:"branch"`
+}
+
+type cloudPullRequest struct {
+	ID          int         `json:"id"`
+	Title       string      `json:"title"`
+	Description string      `json:"description"`
+	State       string      `json:"state"`
+	Draft       bool        `json:"draft"`
+	CreatedOn   *time.Time  `json:"created_on"`
+	UpdatedOn   *time.Time  `json:"updated_on"`
+	Author      *cloudUser  `json:"author"`
+	ClosedBy    *cloudUser  `json:"closed_by"`
+	Source      cloudBranch `json:"source"`
+	Destination cloudBranch `json:"destination"`
+	MergeCommit *struct {
+		Hash string `json:"hash"`
+	} `json:"merge_commit"`
+	Reviewers    []cloudUser `json:"reviewers"`
+	Participants []struct {
+		Approved bool       `json:"approved"`
+		User     *cloudUser `json:"user"`
+	} `json:"participants"`
+	Links struct {
+		HTML struct {
+			Href string `json:"href"`
+		} `json:"html"`
+	} `json:"links"`
+}
+
+type cloudPullRequestsResponse struct {
+	Values []cloudPullRequest `json:"values"`
+	Next   string             `json:"next"`
+}
+
+// cloudRepoPath returns the API path of the repository (Bitbucket Cloud)
+func (r *Adapter) cloudRepoPath() string {
+	return "repositories/" + url.PathEscape(r.owner) + "/" + url.PathEscape(r.repo)
+}
+
+// createPullRequestFromCloudPr converts a Bitbucket Cloud pull request
+//
+// Note: Bitbucket Cloud doesn't provide the merge date with the pull request, so MergedAt (and ClosedAt)
+// of merged pull requests are not set here (see getCloudMergeDate).
+func createPullRequestFromCloudPr(pr *cloudPullRequest) *repo.PullRequest {
+	if pr.ID == 0 || pr.UpdatedOn == nil || pr.Links.HTML.Href == "" || pr.Author == nil {
+		return nil
+	}
+	var closedAt *time.Time
+	mergeCommitSha := ""
+	mergedBy := ""
+	if pr.State == string(merged) {
+		if pr.MergeCommit != nil {
+			mergeCommitSha = pr.MergeCommit.Hash
+		}
+		if pr.ClosedBy != nil {
+			mergedBy = pr.ClosedBy.Nickname
+		}
+	} else if pr.State != string(open) {
+		closedAt = pr.UpdatedOn
+	}
+	reviewers := []string{}
+	for _, reviewer := range pr.Reviewers {
+		reviewers = append(reviewers, reviewer.Nickname)
+	}
+	approvingReviewers := []string{}
+	for _, participant := range pr.Participants {
+		if participant.Approved && participant.User != nil {
+			approvingReviewers = append(approvingReviewers, participant.User.Nickname)
+		}
+	}
+	return &repo.PullRequest{
+		Number:             pr.ID,
+		Title:              pr.Title,
+		UpdatedAt:          pr.UpdatedOn,
+		Labels:             []string{},
+		Branch:             pr.Source.Branch.Name,
+		Url:                pr.Links.HTML.Href,
+		AuthorLogin:        pr.Author.Nickname,
+		AuthorUrl:          pr.Author.Links.HTML.Href,
+		Body:               pr.Description,
+		Draft:              pr.Draft,
+		Assignees:          []string{},
+		RequestedReviewers: reviewers,
+		ApprovingReviewers: approvingReviewers,
+		BaseBranch:         pr.Destination.Branch.Name,
+		MergeCommitSha:     mergeCommitSha,
+		CreatedAt:          pr.CreatedOn,
+		ClosedAt:           closedAt,
+		MergedBy:           mergedBy,
+	}
+}
+
+// listCloudPullRequestsPage returns a page of pull requests (Bitbucket Cloud)
+// (next is the url of the page to fetch, empty for the first page)
+func (r *Adapter) listCloudPullRequestsPage(state state, base string, sortByUpdated bool, next string) (*pullRequestsPage, error) {
+	path := next
+	var query url.Values
+	if path == "" {
+		path = r.cloudRepoPath() + "/pullrequests"
+		query = url.Values{}
+		query.Set("state", string(state))
+		query.Set("q", fmt.Sprintf("destination.branch.name = %q", base))
+		query.Set("sort", "-created_on")
+		if sortByUpdated {
+			query.Set("sort", "-updated_on")
+		}
+		query.Set("pagelen", fmt.Sprint(cloudPerPage))
+	}
+	var resp cloudPullRequestsResponse
+	err := r.request(http.MethodGet, path, query, nil, &resp)
+	if err != nil {
+		return nil, err
+	}
+	res := &pullRequestsPage{prs: []*repo.PullRequest{}, next: resp.Next}
+	for i := range resp.Values {
+		pr := createPullRequestFromCloudPr(&resp.Values[i])
+		if pr != nil {
+			res.prs = append(res.prs, pr)
+		}
+	}
+	return res, nil
+}
+
+// getCloudMergeDate returns the merge date of the given merged pull request (Bitbucket Cloud)
+// (i.e. the date of the most recent MERGED state update of its activity, nil if not found)
+func (r *Adapter) getCloudMergeDate(number int) (*time.Time, error) {
+	path := fmt.Sprintf("%s/pullrequests/%d/activity", r.cloudRepoPath(), number)
+	query := url.Values{"pagelen": {fmt.Sprint(cloudPerPage)}}
+	for path != "" {
+		var page struct {
+			Values []struct {
+				Update *struct {
+					State string     `json:"state"`
+					Date  *time.Time `json:"date"`
+				} `json:"update"`
+			} `json:"values"`
+			Next string `json:"next"`
+		}
+		err := r.request(http.MethodGet, path, query, nil, &page)
+		if err != nil {
+			return nil, fmt.Errorf("can't get the activity of the pull request #%d: %w", number, err)
+		}
+		for _, activity := range page.Values {
+			if activity.Update != nil && activity.Update.State == string(merged) && activity.Update.Date != nil {
+				return activity.Update.Date, nil
+			}
+		}
+		path, query = page.Next, nil
+	}
+	return nil, nil
+}
+
+// listCloudTags returns the names of the most recent tags (first page) (Bitbucket Cloud)
+func (r *Adapter) listCloudTags() ([]string, error) {
+	var page struct {
+		Values []struct {
+			Name string `json:"name"`
+		} `json:"values"`
+	}
+	query := url.Values{"sort": {"-target.date"}, "pagelen": {fmt.Sprint(cloudPerPage)}}
+	err := r.request(http.MethodGet, r.cloudRepoPath()+"/refs/tags", query, nil, &page)
+	if err != nil {
+		return nil, err
+	}
+	res := []string{}
+	for _, tag := range page.Values {
+		res = append(res, tag.Name)
+	}
+	return res, nil
+}
+
+// createCloudTag creates an annotated tag on the given sha (or on the head of the given branch if sha is empty)
+// (Bitbucket Cloud)
+func (r *Adapter) createCloudTag(base string, sha string, tagName string, message string) error {
+	if sha == "" {
+		var branch struct {
+			Target struct {
+				Hash string `json:"hash"`
+			} `json:"target"`
+		}
+		err := r.request(http.MethodGet, r.cloudRepoPath()+"/refs/branches/"+url.PathEscape(base), nil, nil, &branch)
+		if err != nil {
+			return fmt.Errorf("can't get the head of the branch %s: %w", base, err)
+		}
+		sha = branch.Target.Hash
+	}
+	return r.request(http.MethodPost, r.cloudRepoPath()+"/refs/tags", nil, map[string]any{
+		"name":    tagName,
+		"target":  map[string]any{"hash": sha},
+		"message": message,
+	}, nil)
+}
+
+// listCloudComments returns the bodies of the (non-deleted) comments of the given pull request (Bitbucket Cloud)
+func (r *Adapter) listCloudComments(number int) ([]string, error) {
+	res := []string{}
+	path := fmt.Sprintf("%s/pullrequests/%d/comments", r.cloudRepoPath(), number)
+	query := url.Values{"pagelen": {fmt.Sprint(cloudPerPage)}}
+	for path != "" {
+		var page struct {
+			Values []struct {
+				Deleted bool `json:"deleted"`
+				Content struct {
+					Raw string `json:"raw"`
+				} `json:"content"`
+			} `json:"values"`
+			Next string `json:"next"`
+		}
+		err := r.request(http.MethodGet, path, query, nil, &page)
+		if err != nil {
+			return nil, err
+		}
+		for _, comment := range page.Values {
+			if !comment.Deleted {
+				res = append(res, comment.Content.Raw)
+			}
+		}
+		path, query = page.Next, nil
+	}
+	return res, nil
+}
+
+// addCloudComment adds a comment to the given pull request (Bitbucket Cloud)
+func (r *Adapter) addCloudComment(number int, body string) error {
+	return r.request(http.MethodPost, fmt.Sprintf("%s/pullrequests/%d/comments", r.cloudRepoPath(), number), nil, map[string]any{
+		"content": map[string]any{"raw": body},
+	}, nil)
+}
@@ -0,0 +1,227 @@
+package repobitbucket
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/fabien-marty/github-next-semantic-version/internal/app/repo"
+)
+
+const serverPerPage = 100
+
+type serverUser struct {
+	Name  string `json:"name"`
+	Links struct {
+		Self []struct {
+			Href string `json:"href"`
+		} `json:"self"`
+	} `json:"links"`
+}
+
+type serverParticipant struct {
+	User   *serverUser `json:"user"`
+	Status string      `json:"status"` // APPROVED, UNAPPROVED or NEEDS_WORK
+}
+
+type serverRef struct {
+	DisplayID string `json:"displayId"`
+}
+
+type serverPullRequest struct {
+	ID          int                 `json:"id"`
+	Title       string              `json:"title"`
+	Description string              `json:"description"`
+	State       string              `json:"state"`
+	Draft       bool                `json:"draft"`
+	CreatedDate int64               `json:"createdDate"` // milliseconds since epoch
+	UpdatedDate int64               `json:"updatedDate"`
+	ClosedDate  int64               `json:"closedDate"`
+	Author      *serverParticipant  `json:"author"`
+	Reviewers   []serverParticipant `json:"reviewers"`
+	FromRef     serverRef           `json:"fromRef"`
+	ToRef       serverRef           `json:"toRef"`
+	Properties  struct {
+		MergeCommit *struct {
+			ID string `json:"id"`
+		} `json:"mergeCommit"`
+	} `json:"properties"`
+	Links struct {
+		Self []struct {
+			Href string `json:"href"`
+		} `json:"self"`
+	} `json:"links"`
+}
+
+type serverPullRequestsResponse struct {
+	Values        []serverPullRequest `json:"values"`
+	IsLastPage    bool                `json:"isLastPage"`
+	NextPageStart int                 `json:"nextPageStart"`
+}
+
+// msToTime converts milliseconds since epoch to a time (nil if 0)
+func msToTime(ms int64) *time.Time {
+	if ms == 0 {
+		return nil
+	}
+	res := time.UnixMilli(ms).UTC()
+	return &res
+}
+
+// serverRepoPath returns the API path of the repository (Bitbucket Server)
+func (r *Adapter) serverRepoPath(api string) string {
+	return "rest/" + api + "/projects/" + url.PathEscape(r.owner) + "/repos/" + url.PathEscape(r.repo)
+}
+
+func createPullRequestFromServerPr(pr *serverPullRequest) *repo.PullRequest {
+	if pr.ID == 0 || pr.UpdatedDate == 0 || len(pr.Links.Self) == 0 || pr.Author == nil || pr.Author.User == nil {
+		return nil
+	}
+	var mergedAt *time.Time
+	mergeCommitSha := ""
+	if pr.State == string(merged) {
+		mergedAt = msToTime(pr.ClosedDate)
+		if pr.Properties.MergeCommit != nil {
+			mergeCommitSha = pr.Properties.MergeCommit.ID
+		}
+	}
+	reviewers := []string{}
+	approvingReviewers := []string{}
+	for _, reviewer := range pr.Reviewers {
+		if reviewer.User == nil {
+			continue
+		}
+		reviewers = append(reviewers, reviewer.User.Name)
+		if reviewer.Status == "APPROVED" {
+			approvingReviewers = append(approvingReviewers, reviewer.User.Name)
+		}
+	}
+	authorUrl := ""
+	if len(pr.Author.User.Links.Self) > 0 {
+		authorUrl = pr.Author.User.Links.Self[0].Href
+	}
+	return &repo.PullRequest{
+		Number:             pr.ID,
+		Title:              pr.Title,
+		MergedAt:           mergedAt,
+		UpdatedAt:          msToTime(pr.UpdatedDate),
+		Labels:             []string{},
+		Branch:             pr.FromRef.DisplayID,
+		Url:                pr.Links.Self[0].Href,
+		AuthorLogin:        pr.Author.User.Name,
+		AuthorUrl:          authorUrl,
+		Body:               pr.Description,
+		Draft:              pr.Draft,
+		Assignees:          []string{},
+		RequestedReviewers: reviewers,
+		ApprovingReviewers: approvingReviewers,
+		BaseBranch:         pr.ToRef.DisplayID,
+		MergeCommitSha:     mergeCommitSha,
+		CreatedAt:          msToTime(pr.CreatedDate),
+		ClosedAt:           msToTime(pr.ClosedDate),
+		MergedBy:           "", // not available
+	}
+}
+
+// listServerPullRequestsPage returns a page of pull requests (Bitbucket Server)
+// (next is the start index of the page to fetch, empty for the first page)
+func (r *Adapter) listServerPullRequestsPage(state state, base string, next string) (*pullRequestsPage, error) {
+	query := url.Values{}
+	query.Set("state", string(state))
+	query.Set("at", "refs/heads/"+base)
+	query.Set("direction", "INCOMING")
+	query.Set("order", "NEWEST")
+	query.Set("limit", strconv.Itoa(serverPerPage))
+	if next != "" {
+		query.Set("start", next)
+	}
+	var resp serverPullRequestsResponse
+	err := r.request(http.MethodGet, r.serverRepoPath("api/1.0")+"/pull-requests", query, nil, &resp)
+	if err != nil {
+		return nil, err
+	}
+	res := &pullRequestsPage{prs: []*repo.PullRequest{}}
+	if !resp.IsLastPage {
+		res.next = strconv.Itoa(resp.NextPageStart)
+	}
+	for i := range resp.Values {
+		pr := createPullRequestFromServerPr(&resp.Values[i])
+		if pr != nil {
+			res.prs = append(res.prs, pr)
+		}
+	}
+	return res, nil
+}
+
+// listServerTags returns the names of the most recent tags (first page) (Bitbucket Server)
+func (r *Adapter) listServerTags() ([]string, error) {
+	var page struct {
+		Values []struct {
+			DisplayID string `json:"displayId"`
+		} `json:"values"`
+	}
+	query := url.Values{"orderBy": {"MODIFICATION"}, "limit": {strconv.Itoa(serverPerPage)}}
+	err := r.request(http.MethodGet, r.serverRepoPath("api/1.0")+"/tags", query, nil, &page)
+	if err != nil {
+		return nil, err
+	}
+	res := []string{}
+	for _, tag := range page.Values {
+		res = append(res, tag.DisplayID)
+	}
+	return res, nil
+}
+
+// createServerTag creates an annotated tag on the given sha (or on the head of the given branch if sha is empty)
+// (Bitbucket Server)
+func (r *Adapter) createServerTag(base string, sha string, tagName string, message string) error {
+	startPoint := sha
+	if startPoint == "" {
+		startPoint = "refs/heads/" + base
+	}
+	return r.request(http.MethodPost, r.serverRepoPath("git/1.0")+"/tags", nil, map[string]any{
+		"name":       tagName,
+		"startPoint": startPoint,
+		"message":    message,
+	}, nil)
+}
+
+// listServerComments returns the bodies of the (top level) comments of the given pull request
+// (Bitbucket Server, from the activities of the pull request, the most recent first)
+func (r *Adapter) listServerComments(number int) ([]string, error) {
+	res := []string{}
+	query := url.Values{"limit": {strconv.Itoa(serverPerPage)}}
+	for {
+		var page struct {
+			Values []struct {
+				Action  string `json:"action"`
+				Comment struct {
+					Text string `json:"text"`
+				} `json:"comment"`
+			} `json:"values"`
+			IsLastPage    bool `json:"isLastPage"`
+			NextPageStart int  `json:"nextPageStart"`
+		}
+		err := r.request(http.MethodGet, r.serverRepoPath("api/1.0")+"/pull-requests/"+strconv.Itoa(number)+"/activities", query, nil, &page)
+		if err != nil {
+			return nil, err
+		}
+		for _, activity := range page.Values {
+			if activity.Action == "COMMENTED" {
+				res = append(res, activity.Comment.Text)
+			}
+		}
+		if page.IsLastPage {
+			return res, nil
+		}
+		query.Set("start", strconv.Itoa(page.NextPageStart))
+	}
+}
+
+// addServerComment adds a comment to the given pull request (Bitbucket Server)
+func (r *Adapter) addServerComment(number int, body string) error {
+	return r.request(http.MethodPost, r.serverRepoPath("api/1.0")+"/pull-requests/"+strconv.Itoa(number)+"/comments", nil, map[string]any{
+		"text": body,
+	}, nil)
+}
@@ -16,7 +16,7 @@ import (
 
 var cacheMissErr error = errors.New("cache miss")
 
-const cacheVersion = 1
+const cacheVersion = 2
 
 var _ repo.Port = &Adapter{}
 
@@ -226,31 +226,105 @@ func (r *Adapter) GetPullRequests(base string, onlyMerged bool) (res []*repo.Pul
 		}
 		return res, err
 	}
-	tmp := map[int]*repo.PullRequest{}
-	for _, pr := range updatedPrs {
-		tmp[pr.Number] = pr
-	}
-	for _, pr := range cachedPrs {
-		_, ok := tmp[pr.Number]
-		if !ok {
-			tmp[pr.Number] = pr
+	// (we don't iterate over a map here to keep a deterministic order)
+	seen := map[int]bool{}
+	for _, pr := range slices.Concat(updatedPrs, cachedPrs) {
+		if seen[pr.Number] {
+			continue
 		}
-	}
-	for _, pr := range tmp {
+		seen[pr.Number] = true
 		res = append(res, pr)
 	}
 	r.saveCache(base, onlyMerged, res)
 	return res, nil
 }
 
+// GetPullRequestsSince returns pull requests from the given base branch
+// (merged pull requests merged before the given time are not returned).
+//
+// If the cache is enabled, the (cached) full list of GetPullRequests is filtered,
+// else the call is passed through the upstream adapter.
+func (r *Adapter) GetPullRequestsSince(base string, onlyMerged bool, since time.Time) ([]*repo.PullRequest, error) {
+	if !r.IsEnabled() {
+		return r.upstreamAdapter.GetPullRequestsSince(base, onlyMerged, since)
+	}
+	res, err := r.GetPullRequests(base, onlyMerged)
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(slices.Clone(res), func(pr *repo.PullRequest) bool {
+		return pr.MergedAt != nil && pr.MergedAt.Before(since)
+	}), nil
+}
+
 func (r *Adapter) GetLastUpdatedPullRequests(base string, onlyMerged bool) ([]*repo.PullRequest, error) {
 	// pass-through
 	return r.upstreamAdapter.GetLastUpdatedPullRequests(base, onlyMerged)
 }
 
-func (r *Adapter) CreateRelease(base string, tagName string, body string, draft bool) error {
+func (r *Adapter) GetLinkedIssues(pr *repo.PullRequest) ([]*repo.Issue, error) {
+	// pass-through
+	return r.upstreamAdapter.GetLinkedIssues(pr)
+}
+
+func (r *Adapter) CreateRelease(opts repo.ReleaseOptions) (*repo.Release, error) {
+	// pass-through
+	return r.upstreamAdapter.CreateRelease(opts)
+}
+
+func (r *Adapter) GetLastReleases() ([]*repo.Release, error) {
+	// pass-through (releases are not cached)
+	return r.upstreamAdapter.GetLastReleases()
+}
+
+func (r *Adapter) UpdateRelease(release *repo.Release, opts repo.ReleaseOptions) (*repo.Release, error) {
+	// pass-through
+	return r.upstreamAdapter.UpdateRelease(release, opts)
+}
+
+func (r *Adapter) UploadReleaseAsset(release *repo.Release, asset repo.ReleaseAsset) error {
+	// pass-through
+	return r.upstreamAdapter.UploadReleaseAsset(release, asset)
+}
+
+func (r *Adapter) GetPullRequestComments(pr *repo.PullRequest) ([]string, error) {
+	// pass-through (comments are not cached)
+	return r.upstreamAdapter.GetPullRequestComments(pr)
+}
+
+func (r *Adapter) AddPullRequestComment(pr *repo.PullRequest, body string) error {
+	// pass-through
+	return r.upstreamAdapter.AddPullRequestComment(pr, body)
+}
+
+func (r *Adapter) AddPullRequestLabel(pr *repo.PullRequest, label string) error {
+	// pass-through
+	return r.upstreamAdapter.AddPullRequestLabel(pr, label)
+}
+
+func (r *Adapter) GetMilestones() ([]*repo.Milestone, error) {
+	// pass-through (milestones are not cached)
+	return r.upstreamAdapter.GetMilestones()
+}
+
+func (r *Adapter) CreateMilestone(title string) (*repo.Milestone, error) {
+	// pass-through
+	return r.upstreamAdapter.CreateMilestone(title)
+}
+
+func (r *Adapter) CloseMilestone(milestone *repo.Milestone) error {
+	// pass-through
+	return r.upstreamAdapter.CloseMilestone(milestone)
+}
+
+func (r *Adapter) GetMilestoneOpenItems(milestone *repo.Milestone) ([]repo.MilestoneItem, error) {
+	// pass-through
+	return r.upstreamAdapter.GetMilestoneOpenItems(milestone)
+}
+
+func (r *Adapter) SetMilestone(item repo.MilestoneItem, milestone *repo.Milestone) error {
 	// pass-through
-	return r.upstreamAdapter.CreateRelease(base, tagName, body, draft)
+	return r.upstreamAdapter.SetMilestone(item, milestone)
 }
 
 func (r *Adapter) IsEnabled() bool {
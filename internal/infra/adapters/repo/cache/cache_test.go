@@ -9,17 +9,12 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
-type release struct {
-	base    string
-	tagName string
-	body    string
-	draft   bool
-}
-
 type repoDummyAdapter struct {
 	prs                        []*repo.PullRequest
 	lastUpdatedPrs             []*repo.PullRequest
-	releases                   []release
+	releases                   []repo.ReleaseOptions
+	assets                     []repo.ReleaseAsset
+	comments                   map[int][]string
 	getPullRequestsSinceCalled bool
 }
 
@@ -28,6 +23,11 @@ func (d *repoDummyAdapter) GetPullRequests(base string, onlyMerged bool) ([]*rep
 	return d.prs, nil
 }
 
+func (d *repoDummyAdapter) GetPullRequestsSince(base string, onlyMerged bool, since time.Time) ([]*repo.PullRequest, error) {
+	d.getPullRequestsSinceCalled = true
+	return d.prs, nil
+}
+
 func (d *repoDummyAdapter) GetLastUpdatedPullRequests(base string, onlyMerged bool) ([]*repo.PullRequest, error) {
 	if d.lastUpdatedPrs == nil {
 		return d.prs, nil
@@ -35,24 +35,85 @@ func (d *repoDummyAdapter) GetLastUpdatedPullRequests(base string, onlyMerged bo
 	return d.lastUpdatedPrs, nil
 }
 
-func (d *repoDummyAdapter) CreateRelease(base string, tagName string, body string, draft bool) error {
-	d.releases = append(d.releases, release{
-		base:    base,
-		tagName: tagName,
-		body:    body,
-		draft:   draft,
-	})
+func (d *repoDummyAdapter) GetLinkedIssues(pr *repo.PullRequest) ([]*repo.Issue, error) {
+	return []*repo.Issue{{Number: pr.Number * 10}}, nil
+}
+
+func (d *repoDummyAdapter) CreateRelease(opts repo.ReleaseOptions) (*repo.Release, error) {
+	d.releases = append(d.releases, opts)
+	return &repo.Release{ID: int64(len(d.releases)), TagName: opts.TagName}, nil
+}
+
+func (d *repoDummyAdapter) GetLastReleases() ([]*repo.Release, error) {
+	res := []*repo.Release{}
+	for i := len(d.releases) - 1; i >= 0; i-- {
+		res = append(res, &repo.Release{ID: int64(i + 1), TagName: d.releases[i].TagName, Draft: d.releases[i].Draft})
+	}
+	return res, nil
+}
+
+func (d *repoDummyAdapter) UpdateRelease(release *repo.Release, opts repo.ReleaseOptions) (*repo.Release, error) {
+	d.releases[release.ID-1] = opts
+	return &repo.Release{ID: release.ID, TagName: opts.TagName, Draft: opts.Draft}, nil
+}
+
+func (d *repoDummyAdapter) UploadReleaseAsset(release *repo.Release, asset repo.ReleaseAsset) error {
+	d.assets = append(d.assets, asset)
+	return nil
+}
+
+func (d *repoDummyAdapter) GetPullRequestComments(pr *repo.PullRequest) ([]string, error) {
+	return d.comments[pr.Number], nil
+}
+
+func (d *repoDummyAdapter) AddPullRequestComment(pr *repo.PullRequest, body string) error {
+	if d.comments == nil {
+		d.comments = map[int][]string{}
+	}
+	d.comments[pr.Number] = append(d.comments[pr.Number], body)
+	return nil
+}
+
+func (d *repoDummyAdapter) AddPullRequestLabel(pr *repo.PullRequest, label string) error {
+	return nil
+}
+
+func (d *repoDummyAdapter) GetMilestones() ([]*repo.Milestone, error) {
+	return []*repo.Milestone{{ID: 1, Title: "v1.0.0"}}, nil
+}
+
+func (d *repoDummyAdapter) CreateMilestone(title string) (*repo.Milestone, error) {
+	return &repo.Milestone{ID: 2, Title: title}, nil
+}
+
+func (d *repoDummyAdapter) CloseMilestone(milestone *repo.Milestone) error {
+	return nil
+}
+
+func (d *repoDummyAdapter) GetMilestoneOpenItems(milestone *repo.Milestone) ([]repo.MilestoneItem, error) {
+	return []repo.MilestoneItem{}, nil
+}
+
+func (d *repoDummyAdapter) SetMilestone(item repo.MilestoneItem, milestone *repo.Milestone) error {
 	return nil
 }
 
 func TestCacheCreateRelease(t *testing.T) {
 	upstreamAdapter := &repoDummyAdapter{}
 	adapter := NewAdapter("owner", "repo", upstreamAdapter, AdapterOptions{})
-	assert.Nil(t, adapter.CreateRelease("base", "tagName", "body", true))
-	assert.Equal(t, upstreamAdapter.releases[0].base, "base")
-	assert.Equal(t, upstreamAdapter.releases[0].tagName, "tagName")
-	assert.Equal(t, upstreamAdapter.releases[0].body, "body")
-	assert.Equal(t, upstreamAdapter.releases[0].draft, true)
+	opts := repo.ReleaseOptions{Base: "base", TagName: "tagName", Body: "body", Draft: true, TargetSha: "sha"}
+	release, err := adapter.CreateRelease(opts)
+	assert.Nil(t, err)
+	assert.Equal(t, &repo.Release{ID: 1, TagName: "tagName"}, release)
+	assert.Equal(t, []repo.ReleaseOptions{opts}, upstreamAdapter.releases)
+	asset := repo.ReleaseAsset{Name: "foo", Content: []byte("bar")}
+	assert.Nil(t, adapter.UploadReleaseAsset(release, asset))
+	assert.Equal(t, []repo.ReleaseAsset{asset}, upstreamAdapter.assets)
+	pr := &repo.PullRequest{Number: 1}
+	assert.Nil(t, adapter.AddPullRequestComment(pr, "comment"))
+	comments, err := adapter.GetPullRequestComments(pr)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"comment"}, comments)
 }
 
 func TestCacheLocation(t *testing.T) {
@@ -124,3 +185,26 @@ func TestCacheGetPR2(t *testing.T) {
 	assert.False(t, upstreamAdapter.getPullRequestsSinceCalled)
 	assert.Equal(t, res[3].MergedAt.Year(), 2023)
 }
+
+func TestCacheGetPRSince(t *testing.T) {
+	_ = os.Mkdir("./tmp3", 0700)
+	defer func() {
+		_ = os.RemoveAll("./tmp3")
+	}()
+	pr1 := newPr(1, 2023, 1, 15, 0, 0, 0)
+	pr2 := newPr(2, 2023, 2, 15, 0, 0, 0)
+	pr3 := newPrNotMerged(3, 2023, 1, 1, 0, 0, 0)
+	upstreamAdapter := &repoDummyAdapter{prs: []*repo.PullRequest{pr1, pr2, pr3}}
+	since := time.Date(2023, 2, 1, 0, 0, 0, 0, time.UTC)
+	adapter := NewAdapter("owner", "repo", upstreamAdapter, AdapterOptions{CacheLocation: "./tmp3"})
+	res, err := adapter.GetPullRequestsSince("base", false, since)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(res))
+	for _, pr := range res {
+		assert.NotEqual(t, 1, pr.Number)
+	}
+	adapter = NewAdapter("owner", "repo", upstreamAdapter, AdapterOptions{CacheLocation: "foobar"}) // disabled cache => pass-through
+	res, err = adapter.GetPullRequestsSince("base", false, since)
+	assert.Nil(t, err)
+	assert.Equal(t, []*repo.PullRequest{pr1, pr2, pr3}, res)
+}
@@ -0,0 +1,424 @@
+package repofile
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fabien-marty/github-next-semantic-version/internal/app/repo"
+)
+
+var _ repo.Port = &Adapter{}
+
+type AdapterOptions struct {
+	ReleasesPath string // path of the file where created releases are recorded (JSON or YAML, depending on the extension), empty => <fixture path without extension>.releases.<fixture extension>
+}
+
+// Adapter is an offline repo adapter reading pull requests from a fixture file (JSON or YAML,
+// see Fixture) and recording created releases into a releases file (see Releases)
+//
+// It doesn't do any network request.
+type Adapter struct {
+	opts    AdapterOptions
+	fixture *Fixture
+	prs     []*repo.PullRequest
+	mutex   sync.Mutex // protects the releases file
+}
+
+func NewAdapter(fixturePath string, opts AdapterOptions) (*Adapter, error) {
+	fixture, err := ReadFixture(fixturePath)
+	if err != nil {
+		return nil, err
+	}
+	if opts.ReleasesPath == "" {
+		ext := filepath.Ext(fixturePath)
+		opts.ReleasesPath = strings.TrimSuffix(fixturePath, ext) + ".releases" + ext
+	}
+	prs := []*repo.PullRequest{}
+	for _, pr := range fixture.PullRequests {
+		if pr.Number == 0 {
+			return nil, fmt.Errorf("bad fixture file %s: pull requests must have a number", fixturePath)
+		}
+		if pr.UpdatedAt == nil && pr.CreatedAt == nil && pr.MergedAt == nil && pr.ClosedAt == nil {
+			return nil, fmt.Errorf("bad fixture file %s: the pull request #%d must have at least one date", fixturePath, pr.Number)
+		}
+		prs = append(prs, pr.ToPullRequest())
+	}
+	slog.Debug("fixture file read", slog.String("path", fixturePath), slog.Int("count", len(prs)))
+	return &Adapter{
+		opts:    opts,
+		fixture: fixture,
+		prs:     prs,
+	}, nil
+}
+
+// Owner returns the repository owner of the fixture (empty if not set)
+func (r *Adapter) Owner() string {
+	return r.fixture.Owner
+}
+
+// Repo returns the repository name of the fixture (empty if not set)
+func (r *Adapter) Repo() string {
+	return r.fixture.Repo
+}
+
+// WebBaseURL returns the web base url of the fixture (empty if not set)
+func (r *Adapter) WebBaseURL() string {
+	return r.fixture.WebBaseURL
+}
+
+// ReleasesPath returns the path of the file where created releases are recorded
+func (r *Adapter) ReleasesPath() string {
+	return r.opts.ReleasesPath
+}
+
+// listPullRequests returns copies of the pull requests of the fixture targetting the given base
+// (pull requests without base branch target all branches) and accepted by the given filter
+func (r *Adapter) listPullRequests(base string, filter func(pr *repo.PullRequest) bool) []*repo.PullRequest {
+	res := []*repo.PullRequest{}
+	for _, pr := range r.prs {
+		if pr.BaseBranch != "" && pr.BaseBranch != base {
+			continue
+		}
+		if !filter(pr) {
+			continue
+		}
+		tmp := *pr // the service can modify returned pull requests
+		tmp.Labels = slices.Clone(pr.Labels)
+		res = append(res, &tmp)
+	}
+	return res
+}
+
+// isOpened returns true if the pull request is still open
+func isOpened(pr *repo.PullRequest) bool {
+	return pr.MergedAt == nil && pr.ClosedAt == nil
+}
+
+func (r *Adapter) GetPullRequests(base string, onlyMerged bool) ([]*repo.PullRequest, error) {
+	return r.listPullRequests(base, func(pr *repo.PullRequest) bool {
+		return pr.MergedAt != nil || (!onlyMerged && isOpened(pr))
+	}), nil
+}
+
+func (r *Adapter) GetPullRequestsSince(base string, onlyMerged bool, since time.Time) ([]*repo.PullRequest, error) {
+	return r.listPullRequests(base, func(pr *repo.PullRequest) bool {
+		if pr.MergedAt != nil {
+			return !pr.MergedAt.Before(since)
+		}
+		return !onlyMerged && isOpened(pr)
+	}), nil
+}
+
+// GetLastUpdatedPullRequests returns all the pull requests (there is no pagination with a fixture file)
+// sorted by updatedAt (descending)
+func (r *Adapter) GetLastUpdatedPullRequests(base string, onlyMerged bool) ([]*repo.PullRequest, error) {
+	res, _ := r.GetPullRequests(base, onlyMerged)
+	slices.SortStableFunc(res, func(a, b *repo.PullRequest) int {
+		return b.UpdatedAt.Compare(*a.UpdatedAt)
+	})
+	return res, nil
+}
+
+// GetLinkedIssues returns the linked issues of the fixture (empty list if not set)
+func (r *Adapter) GetLinkedIssues(pr *repo.PullRequest) ([]*repo.Issue, error) {
+	if pr.LinkedIssues != nil {
+		return pr.LinkedIssues, nil
+	}
+	return []*repo.Issue{}, nil
+}
+
+// readReleases reads the releases file (empty list if it doesn't exist yet)
+func (r *Adapter) readReleases() (*Releases, error) {
+	releases := &Releases{Releases: []Release{}}
+	err := readFile(r.opts.ReleasesPath, releases)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("can't read the releases file: %w", err)
+	}
+	return releases, nil
+}
+
+// CreateRelease records the release in the releases file (appended to the already recorded ones)
+// (the id of the returned release is its position in the file, starting at 1)
+func (r *Adapter) CreateRelease(opts repo.ReleaseOptions) (*repo.Release, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	releases, err := r.readReleases()
+	if err != nil {
+		return nil, err
+	}
+	releases.Releases = append(releases.Releases, newRelease(opts))
+	err = writeFile(r.opts.ReleasesPath, releases)
+	if err != nil {
+		return nil, fmt.Errorf("can't write the releases file: %w", err)
+	}
+	slog.Debug("release recorded", slog.String("path", r.opts.ReleasesPath), slog.String("tagName", opts.TagName))
+	return releases.Releases[len(releases.Releases)-1].toRelease(len(releases.Releases)), nil
+}
+
+// GetLastReleases returns the releases recorded in the releases file (the most recent first)
+func (r *Adapter) GetLastReleases() ([]*repo.Release, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	releases, err := r.readReleases()
+	if err != nil {
+		return nil, err
+	}
+	res := []*repo.Release{}
+	for i := len(releases.Releases) - 1; i >= 0; i-- {
+		res = append(res, releases.Releases[i].toRelease(i+1))
+	}
+	return res, nil
+}
+
+// UpdateRelease replaces the given release in the releases file (its assets are kept)
+func (r *Adapter) UpdateRelease(release *repo.Release, opts repo.ReleaseOptions) (*repo.Release, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	releases, err := r.readReleases()
+	if err != nil {
+		return nil, err
+	}
+	if release.ID < 1 || release.ID > int64(len(releases.Releases)) {
+		return nil, fmt.Errorf("unknown release %s (id: %d) in the releases file", release.TagName, release.ID)
+	}
+	updated := newRelease(opts)
+	updated.Assets = releases.Releases[release.ID-1].Assets
+	releases.Releases[release.ID-1] = updated
+	err = writeFile(r.opts.ReleasesPath, releases)
+	if err != nil {
+		return nil, fmt.Errorf("can't write the releases file: %w", err)
+	}
+	slog.Debug("release updated", slog.String("path", r.opts.ReleasesPath), slog.String("tagName", opts.TagName))
+	return updated.toRelease(int(release.ID)), nil
+}
+
+// UploadReleaseAsset records the asset (name, content type, size and sha256) in the release of the releases file
+// (an existing asset with the same name is replaced)
+func (r *Adapter) UploadReleaseAsset(release *repo.Release, asset repo.ReleaseAsset) error {
+	content, err := asset.ReadAll()
+	if err != nil {
+		return fmt.Errorf("can't read the asset %s: %w", asset.Name, err)
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	releases, err := r.readReleases()
+	if err != nil {
+		return err
+	}
+	if release.ID < 1 || release.ID > int64(len(releases.Releases)) {
+		return fmt.Errorf("unknown release %s (id: %d) in the releases file", release.TagName, release.ID)
+	}
+	recorded := &releases.Releases[release.ID-1]
+	recorded.Assets = slices.DeleteFunc(recorded.Assets, func(a Asset) bool { return a.Name == asset.Name })
+	sum := sha256.Sum256(content)
+	recorded.Assets = append(recorded.Assets, Asset{
+		Name:        asset.Name,
+		ContentType: asset.GetContentType(),
+		Size:        len(content),
+		Sha256:      hex.EncodeToString(sum[:]),
+	})
+	err = writeFile(r.opts.ReleasesPath, releases)
+	if err != nil {
+		return fmt.Errorf("can't write the releases file: %w", err)
+	}
+	slog.Debug("release asset recorded", slog.String("path", r.opts.ReleasesPath), slog.String("tagName", release.TagName), slog.String("name", asset.Name))
+	return nil
+}
+
+// getPullRequestChanges returns the recorded changes of the given pull request (nil if there is none)
+func (r *Releases) getPullRequestChanges(number int) *PullRequestChanges {
+	for i := range r.PullRequests {
+		if r.PullRequests[i].Number == number {
+			return &r.PullRequests[i]
+		}
+	}
+	return nil
+}
+
+// recordPullRequestChange records a change (see the update function) of the given pull request in the releases file
+func (r *Adapter) recordPullRequestChange(number int, update func(changes *PullRequestChanges)) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	releases, err := r.readReleases()
+	if err != nil {
+		return err
+	}
+	changes := releases.getPullRequestChanges(number)
+	if changes == nil {
+		releases.PullRequests = append(releases.PullRequests, PullRequestChanges{Number: number})
+		changes = &releases.PullRequests[len(releases.PullRequests)-1]
+	}
+	update(changes)
+	err = writeFile(r.opts.ReleasesPath, releases)
+	if err != nil {
+		return fmt.Errorf("can't write the releases file: %w", err)
+	}
+	return nil
+}
+
+// GetPullRequestComments returns the comments recorded in the releases file for the given pull request
+func (r *Adapter) GetPullRequestComments(pr *repo.PullRequest) ([]string, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	releases, err := r.readReleases()
+	if err != nil {
+		return nil, err
+	}
+	changes := releases.getPullRequestChanges(pr.Number)
+	if changes == nil {
+		return []string{}, nil
+	}
+	return emptyIfNil(slices.Clone(changes.Comments)), nil
+}
+
+// AddPullRequestComment records the comment in the releases file
+func (r *Adapter) AddPullRequestComment(pr *repo.PullRequest, body string) error {
+	err := r.recordPullRequestChange(pr.Number, func(changes *PullRequestChanges) {
+		changes.Comments = append(changes.Comments, body)
+	})
+	if err != nil {
+		return err
+	}
+	slog.Debug("pull request comment recorded", slog.String("path", r.opts.ReleasesPath), slog.Int("number", pr.Number))
+	return nil
+}
+
+// AddPullRequestLabel records the label in the releases file
+// (if the label is not already set in the fixture or already recorded)
+func (r *Adapter) AddPullRequestLabel(pr *repo.PullRequest, label string) error {
+	for _, fixturePr := range r.prs {
+		if fixturePr.Number == pr.Number && slices.Contains(fixturePr.Labels, label) {
+			return nil
+		}
+	}
+	err := r.recordPullRequestChange(pr.Number, func(changes *PullRequestChanges) {
+		if !slices.Contains(changes.AddedLabels, label) {
+			changes.AddedLabels = append(changes.AddedLabels, label)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	slog.Debug("pull request label recorded", slog.String("path", r.opts.ReleasesPath), slog.Int("number", pr.Number), slog.String("label", label))
+	return nil
+}
+
+// getMilestones returns the current milestones (the recorded ones if any, else the fixture ones)
+func (r *Adapter) getMilestones(releases *Releases) []Milestone {
+	if releases.Milestones != nil {
+		return releases.Milestones
+	}
+	return slices.Clone(r.fixture.Milestones)
+}
+
+// GetMilestones returns the milestones of the fixture (with the changes recorded in the releases file)
+func (r *Adapter) GetMilestones() ([]*repo.Milestone, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	releases, err := r.readReleases()
+	if err != nil {
+		return nil, err
+	}
+	res := []*repo.Milestone{}
+	for i, milestone := range r.getMilestones(releases) {
+		res = append(res, &repo.Milestone{ID: int64(i + 1), Title: milestone.Title, Closed: milestone.Closed})
+	}
+	return res, nil
+}
+
+// recordMilestoneChange records a change (see the update function) of the milestones in the releases file
+func (r *Adapter) recordMilestoneChange(update func(milestones []Milestone) ([]Milestone, error)) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	releases, err := r.readReleases()
+	if err != nil {
+		return err
+	}
+	releases.Milestones, err = update(r.getMilestones(releases))
+	if err != nil {
+		return err
+	}
+	err = writeFile(r.opts.ReleasesPath, releases)
+	if err != nil {
+		return fmt.Errorf("can't write the releases file: %w", err)
+	}
+	return nil
+}
+
+// CreateMilestone records the milestone in the releases file
+func (r *Adapter) CreateMilestone(title string) (*repo.Milestone, error) {
+	var res *repo.Milestone
+	err := r.recordMilestoneChange(func(milestones []Milestone) ([]Milestone, error) {
+		milestones = append(milestones, Milestone{Title: title})
+		res = &repo.Milestone{ID: int64(len(milestones)), Title: title}
+		return milestones, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	slog.Debug("milestone recorded", slog.String("path", r.opts.ReleasesPath), slog.String("title", title))
+	return res, nil
+}
+
+// CloseMilestone records the milestone as closed in the releases file
+func (r *Adapter) CloseMilestone(milestone *repo.Milestone) error {
+	err := r.recordMilestoneChange(func(milestones []Milestone) ([]Milestone, error) {
+		if milestone.ID < 1 || milestone.ID > int64(len(milestones)) {
+			return nil, fmt.Errorf("unknown milestone %s (id: %d)", milestone.Title, milestone.ID)
+		}
+		milestones[milestone.ID-1].Closed = true
+		return milestones, nil
+	})
+	if err != nil {
+		return err
+	}
+	slog.Debug("milestone closed", slog.String("path", r.opts.ReleasesPath), slog.String("title", milestone.Title))
+	return nil
+}
+
+// GetMilestoneOpenItems returns the open pull requests of the fixture in the given milestone
+// (with the changes recorded in the releases file), the fixture has no issues
+func (r *Adapter) GetMilestoneOpenItems(milestone *repo.Milestone) ([]repo.MilestoneItem, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	releases, err := r.readReleases()
+	if err != nil {
+		return nil, err
+	}
+	res := []repo.MilestoneItem{}
+	for _, pr := range r.prs {
+		if !isOpened(pr) {
+			continue
+		}
+		title := pr.Milestone
+		changes := releases.getPullRequestChanges(pr.Number)
+		if changes != nil && changes.Milestone != "" {
+			title = changes.Milestone
+		}
+		if title == milestone.Title {
+			res = append(res, repo.MilestoneItem{Number: pr.Number, PullRequest: true})
+		}
+	}
+	return res, nil
+}
+
+// SetMilestone records the new milestone of the pull request in the releases file
+func (r *Adapter) SetMilestone(item repo.MilestoneItem, milestone *repo.Milestone) error {
+	err := r.recordPullRequestChange(item.Number, func(changes *PullRequestChanges) {
+		changes.Milestone = milestone.Title
+	})
+	if err != nil {
+		return err
+	}
+	slog.Debug("pull request milestone recorded", slog.String("path", r.opts.ReleasesPath), slog.Int("number", item.Number), slog.String("milestone", milestone.Title))
+	return nil
+}
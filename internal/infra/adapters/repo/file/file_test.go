@@ -0,0 +1,242 @@
+package repofile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fabien-marty/github-next-semantic-version/internal/app/repo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const yamlFixture = `
+owner: foo
+repo: bar
+webBaseURL: https://github.example.com
+pullRequests:
+  - number: 1
+    title: merged on main
+    mergedAt: 2024-01-02T00:00:00Z
+    labels: [feature]
+    baseBranch: main
+    linkedIssues:
+      - number: 10
+        title: issue
+  - number: 2
+    title: open on main
+    createdAt: 2024-01-03T00:00:00Z
+    baseBranch: main
+  - number: 3
+    title: closed (not merged) on main
+    closedAt: 2024-01-04T00:00:00Z
+    baseBranch: main
+  - number: 4
+    title: merged on all branches
+    mergedAt: 2024-01-05T00:00:00Z
+  - number: 5
+    title: merged on other
+    mergedAt: 2024-01-06T00:00:00Z
+    baseBranch: other
+`
+
+func writeTmpFile(t *testing.T, name string, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+func getNumbers(prs []*repo.PullRequest) []int {
+	res := []int{}
+	for _, pr := range prs {
+		res = append(res, pr.Number)
+	}
+	return res
+}
+
+func TestGetPullRequests(t *testing.T) {
+	adapter, err := NewAdapter(writeTmpFile(t, "fixture.yaml", yamlFixture), AdapterOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "foo", adapter.Owner())
+	assert.Equal(t, "bar", adapter.Repo())
+	assert.Equal(t, "https://github.example.com", adapter.WebBaseURL())
+
+	res, err := adapter.GetPullRequests("main", true)
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 4}, getNumbers(res))
+	mergedAt := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, &mergedAt, res[0].UpdatedAt)
+	assert.Equal(t, []string{"feature"}, res[0].Labels)
+	assert.Equal(t, []*repo.Issue{{Number: 10, Title: "issue", Labels: []string{}}}, res[0].LinkedIssues)
+	assert.Equal(t, []string{}, res[1].Labels)
+	assert.Nil(t, res[1].LinkedIssues)
+
+	res, err = adapter.GetPullRequests("main", false)
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 2, 4}, getNumbers(res))
+
+	res, err = adapter.GetPullRequestsSince("main", false, time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	assert.Equal(t, []int{2, 4}, getNumbers(res))
+
+	res, err = adapter.GetLastUpdatedPullRequests("other", true)
+	require.NoError(t, err)
+	assert.Equal(t, []int{5, 4}, getNumbers(res))
+
+	// returned pull requests are copies
+	res[0].Labels = []string{"modified"}
+	res, err = adapter.GetPullRequests("other", true)
+	require.NoError(t, err)
+	assert.Equal(t, []string{}, res[1].Labels)
+}
+
+func TestBadFixture(t *testing.T) {
+	_, err := NewAdapter(filepath.Join(t.TempDir(), "missing.json"), AdapterOptions{})
+	assert.Error(t, err)
+	_, err = NewAdapter(writeTmpFile(t, "fixture.json", `{"pullRequests": [{"title": "no number"}]}`), AdapterOptions{})
+	assert.ErrorContains(t, err, "must have a number")
+	_, err = NewAdapter(writeTmpFile(t, "fixture.json", `{"pullRequests": [{"number": 1}]}`), AdapterOptions{})
+	assert.ErrorContains(t, err, "must have at least one date")
+	_, err = NewAdapter(writeTmpFile(t, "fixture.json", `not json`), AdapterOptions{})
+	assert.Error(t, err)
+}
+
+func TestWriteFixture(t *testing.T) {
+	mergedAt := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	pr := &repo.PullRequest{
+		Number:             1,
+		Title:              "PR1",
+		MergedAt:           &mergedAt,
+		UpdatedAt:          &mergedAt,
+		Labels:             []string{"feature"},
+		Assignees:          []string{},
+		RequestedReviewers: []string{},
+		ApprovingReviewers: []string{},
+		BaseBranch:         "main",
+		LinkedIssues:       []*repo.Issue{{Number: 10, Title: "issue", Labels: []string{"bug"}}},
+	}
+	for _, name := range []string{"fixture.json", "fixture.yml"} {
+		path := filepath.Join(t.TempDir(), name)
+		err := WriteFixture(path, &Fixture{Owner: "foo", Repo: "bar", PullRequests: []PullRequest{NewPullRequest(pr)}})
+		require.NoError(t, err)
+		adapter, err := NewAdapter(path, AdapterOptions{})
+		require.NoError(t, err, name)
+		res, err := adapter.GetPullRequests("main", true)
+		require.NoError(t, err)
+		assert.Equal(t, []*repo.PullRequest{pr}, res, name)
+	}
+}
+
+func TestCreateRelease(t *testing.T) {
+	fixturePath := writeTmpFile(t, "fixture.json", `{"pullRequests": []}`)
+	adapter, err := NewAdapter(fixturePath, AdapterOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(filepath.Dir(fixturePath), "fixture.releases.json"), adapter.ReleasesPath())
+
+	release1, err := adapter.CreateRelease(repo.ReleaseOptions{Base: "main", TagName: "v1.0.0", Body: "body1"})
+	require.NoError(t, err)
+	release2, err := adapter.CreateRelease(repo.ReleaseOptions{Base: "main", TagName: "v1.1.0", Name: "MyApp v1.1.0", Body: "body2", Draft: true, Prerelease: true, MakeLatest: "false", TargetSha: "012345"})
+	require.NoError(t, err)
+	assert.Equal(t, &repo.Release{ID: 2, TagName: "v1.1.0", Name: "MyApp v1.1.0", Draft: true}, release2)
+
+	require.NoError(t, adapter.UploadReleaseAsset(release1, repo.ReleaseAsset{Name: "foo.txt", Content: []byte("old")}))
+	require.NoError(t, adapter.UploadReleaseAsset(release1, repo.ReleaseAsset{Name: "foo.txt", ContentType: "text/plain", Path: writeTmpFile(t, "foo.txt", "foo")}))
+	assert.Error(t, adapter.UploadReleaseAsset(&repo.Release{ID: 3, TagName: "v2.0.0"}, repo.ReleaseAsset{Name: "foo.txt", Content: []byte("foo")}))
+
+	last, err := adapter.GetLastReleases()
+	require.NoError(t, err)
+	assert.Equal(t, []*repo.Release{release2, release1}, last)
+	updated, err := adapter.UpdateRelease(release2, repo.ReleaseOptions{Base: "main", TagName: "v1.2.0", Body: "body3", Draft: true})
+	require.NoError(t, err)
+	assert.Equal(t, &repo.Release{ID: 2, TagName: "v1.2.0", Name: "v1.2.0", Draft: true}, updated)
+	updated, err = adapter.UpdateRelease(release2, repo.ReleaseOptions{Base: "main", TagName: "v1.1.0", Name: "MyApp v1.1.0", Body: "body2", Draft: true, Prerelease: true, MakeLatest: "false", TargetSha: "012345"})
+	require.NoError(t, err)
+	assert.Equal(t, release2, updated)
+
+	releases := &Releases{}
+	require.NoError(t, readFile(adapter.ReleasesPath(), releases))
+	assert.Equal(t, []Release{
+		{Base: "main", TagName: "v1.0.0", Name: "v1.0.0", Body: "body1", Assets: []Asset{
+			{Name: "foo.txt", ContentType: "text/plain", Size: 3, Sha256: "2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae"},
+		}},
+		{Base: "main", TagName: "v1.1.0", Name: "MyApp v1.1.0", Body: "body2", Draft: true, Prerelease: true, MakeLatest: "false", TargetSha: "012345"},
+	}, releases.Releases)
+}
+
+func TestPullRequestCommentsAndLabels(t *testing.T) {
+	fixturePath := writeTmpFile(t, "fixture.yaml", `pullRequests:
+  - number: 1
+    title: PR1
+    labels: [released]
+    createdAt: 2024-01-01T00:00:00Z
+`)
+	adapter, err := NewAdapter(fixturePath, AdapterOptions{})
+	require.NoError(t, err)
+	pr1, pr2 := &repo.PullRequest{Number: 1}, &repo.PullRequest{Number: 2}
+
+	comments, err := adapter.GetPullRequestComments(pr1)
+	require.NoError(t, err)
+	assert.Equal(t, []string{}, comments)
+	require.NoError(t, adapter.AddPullRequestComment(pr1, "Released in v1.0.0"))
+	require.NoError(t, adapter.AddPullRequestComment(pr2, "Released in v1.0.0"))
+	require.NoError(t, adapter.AddPullRequestComment(pr1, "Released in v1.1.0"))
+	comments, err = adapter.GetPullRequestComments(pr1)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Released in v1.0.0", "Released in v1.1.0"}, comments)
+
+	require.NoError(t, adapter.AddPullRequestLabel(pr1, "released")) // already set in the fixture
+	require.NoError(t, adapter.AddPullRequestLabel(pr2, "released"))
+	require.NoError(t, adapter.AddPullRequestLabel(pr2, "released"))
+
+	releases := &Releases{}
+	require.NoError(t, readFile(adapter.ReleasesPath(), releases))
+	assert.Equal(t, []PullRequestChanges{
+		{Number: 1, Comments: []string{"Released in v1.0.0", "Released in v1.1.0"}},
+		{Number: 2, Comments: []string{"Released in v1.0.0"}, AddedLabels: []string{"released"}},
+	}, releases.PullRequests)
+}
+
+func TestMilestones(t *testing.T) {
+	fixturePath := writeTmpFile(t, "fixture.yaml", `pullRequests:
+  - number: 1
+    title: PR1
+    milestone: v1.1.0
+    createdAt: 2024-01-01T00:00:00Z
+  - number: 2
+    title: PR2
+    milestone: v1.1.0
+    createdAt: 2024-01-01T00:00:00Z
+    mergedAt: 2024-01-02T00:00:00Z
+milestones:
+  - title: v1.0.0
+    closed: true
+  - title: v1.1.0
+`)
+	adapter, err := NewAdapter(fixturePath, AdapterOptions{})
+	require.NoError(t, err)
+
+	milestones, err := adapter.GetMilestones()
+	require.NoError(t, err)
+	assert.Equal(t, []*repo.Milestone{{ID: 1, Title: "v1.0.0", Closed: true}, {ID: 2, Title: "v1.1.0"}}, milestones)
+	next, err := adapter.CreateMilestone("v1.2.0")
+	require.NoError(t, err)
+	assert.Equal(t, &repo.Milestone{ID: 3, Title: "v1.2.0"}, next)
+	items, err := adapter.GetMilestoneOpenItems(milestones[1])
+	require.NoError(t, err)
+	assert.Equal(t, []repo.MilestoneItem{{Number: 1, PullRequest: true}}, items)
+	require.NoError(t, adapter.SetMilestone(items[0], next))
+	require.NoError(t, adapter.CloseMilestone(milestones[1]))
+	assert.Error(t, adapter.CloseMilestone(&repo.Milestone{ID: 4}))
+
+	milestones, err = adapter.GetMilestones()
+	require.NoError(t, err)
+	assert.Equal(t, []*repo.Milestone{{ID: 1, Title: "v1.0.0", Closed: true}, {ID: 2, Title: "v1.1.0", Closed: true}, {ID: 3, Title: "v1.2.0"}}, milestones)
+	items, err = adapter.GetMilestoneOpenItems(milestones[1])
+	require.NoError(t, err)
+	assert.Equal(t, []repo.MilestoneItem{}, items)
+	items, err = adapter.GetMilestoneOpenItems(milestones[2])
+	require.NoError(t, err)
+	assert.Equal(t, []repo.MilestoneItem{{Number: 1, PullRequest: true}}, items)
+}
@@ -0,0 +1,275 @@
+package repofile
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fabien-marty/github-next-semantic-version/internal/app/repo"
+	"gopkg.in/yaml.v3"
+)
+
+// Fixture is the content of a fixture file (see ReadFixture and WriteFixture)
+type Fixture struct {
+	Owner        string        `json:"owner,omitempty" yaml:"owner,omitempty"`           // repository owner (informative)
+	Repo         string        `json:"repo,omitempty" yaml:"repo,omitempty"`             // repository name (informative)
+	WebBaseURL   string        `json:"webBaseURL,omitempty" yaml:"webBaseURL,omitempty"` // web base url of the instance (without trailing slash)
+	PullRequests []PullRequest `json:"pullRequests" yaml:"pullRequests"`
+	Milestones   []Milestone   `json:"milestones,omitempty" yaml:"milestones,omitempty"`
+}
+
+// Milestone is the serialized form of a repo.Milestone (its id is its position in the list, starting at 1)
+type Milestone struct {
+	Title  string `json:"title" yaml:"title"`
+	Closed bool   `json:"closed,omitempty" yaml:"closed,omitempty"`
+}
+
+// PullRequest is the serialized form of a repo.PullRequest
+type PullRequest struct {
+	Number             int        `json:"number" yaml:"number"`
+	Title              string     `json:"title" yaml:"title"`
+	MergedAt           *time.Time `json:"mergedAt,omitempty" yaml:"mergedAt,omitempty"`
+	UpdatedAt          *time.Time `json:"updatedAt,omitempty" yaml:"updatedAt,omitempty"` // if not set, the most recent of createdAt, mergedAt and closedAt
+	Labels             []string   `json:"labels,omitempty" yaml:"labels,omitempty"`
+	Branch             string     `json:"branch,omitempty" yaml:"branch,omitempty"`
+	Url                string     `json:"url,omitempty" yaml:"url,omitempty"`
+	AuthorLogin        string     `json:"authorLogin,omitempty" yaml:"authorLogin,omitempty"`
+	AuthorUrl          string     `json:"authorUrl,omitempty" yaml:"authorUrl,omitempty"`
+	Body               string     `json:"body,omitempty" yaml:"body,omitempty"`
+	Draft              bool       `json:"draft,omitempty" yaml:"draft,omitempty"`
+	Milestone          string     `json:"milestone,omitempty" yaml:"milestone,omitempty"`
+	Assignees          []string   `json:"assignees,omitempty" yaml:"assignees,omitempty"`
+	RequestedReviewers []string   `json:"requestedReviewers,omitempty" yaml:"requestedReviewers,omitempty"`
+	ApprovingReviewers []string   `json:"approvingReviewers,omitempty" yaml:"approvingReviewers,omitempty"`
+	BaseBranch         string     `json:"baseBranch,omitempty" yaml:"baseBranch,omitempty"` // empty => the pull request targets all branches
+	MergeCommitSha     string     `json:"mergeCommitSha,omitempty" yaml:"mergeCommitSha,omitempty"`
+	CreatedAt          *time.Time `json:"createdAt,omitempty" yaml:"createdAt,omitempty"`
+	ClosedAt           *time.Time `json:"closedAt,omitempty" yaml:"closedAt,omitempty"`
+	MergedBy           string     `json:"mergedBy,omitempty" yaml:"mergedBy,omitempty"`
+	LinkedIssues       []Issue    `json:"linkedIssues,omitempty" yaml:"linkedIssues,omitempty"`
+}
+
+// Issue is the serialized form of a repo.Issue
+type Issue struct {
+	Number int      `json:"number" yaml:"number"`
+	Title  string   `json:"title" yaml:"title"`
+	Url    string   `json:"url,omitempty" yaml:"url,omitempty"`
+	Labels []string `json:"labels,omitempty" yaml:"labels,omitempty"`
+}
+
+// Release is a release recorded by the adapter (see Adapter.CreateRelease)
+type Release struct {
+	Base       string  `json:"base" yaml:"base"`
+	TagName    string  `json:"tagName" yaml:"tagName"`
+	Name       string  `json:"name" yaml:"name"`
+	Body       string  `json:"body" yaml:"body"`
+	Draft      bool    `json:"draft" yaml:"draft"`
+	Prerelease bool    `json:"prerelease" yaml:"prerelease"`
+	MakeLatest string  `json:"makeLatest,omitempty" yaml:"makeLatest,omitempty"`
+	TargetSha  string  `json:"targetSha,omitempty" yaml:"targetSha,omitempty"`
+	Assets     []Asset `json:"assets,omitempty" yaml:"assets,omitempty"`
+}
+
+// newRelease returns the release to record corresponding to the given options
+func newRelease(opts repo.ReleaseOptions) Release {
+	return Release{
+		Base:       opts.Base,
+		TagName:    opts.TagName,
+		Name:       opts.GetName(),
+		Body:       opts.Body,
+		Draft:      opts.Draft,
+		Prerelease: opts.Prerelease,
+		MakeLatest: opts.MakeLatest,
+		TargetSha:  opts.TargetSha,
+	}
+}
+
+// toRelease converts the recorded release (at the given position, starting at 1) to a repo.Release
+func (r Release) toRelease(position int) *repo.Release {
+	return &repo.Release{ID: int64(position), TagName: r.TagName, Name: r.Name, Draft: r.Draft}
+}
+
+// Asset is a release asset recorded by the adapter (see Adapter.UploadReleaseAsset)
+type Asset struct {
+	Name        string `json:"name" yaml:"name"`
+	ContentType string `json:"contentType" yaml:"contentType"`
+	Size        int    `json:"size" yaml:"size"`
+	Sha256      string `json:"sha256" yaml:"sha256"`
+}
+
+// PullRequestChanges are the changes of a pull request recorded by the adapter
+// (see Adapter.AddPullRequestComment and Adapter.AddPullRequestLabel)
+type PullRequestChanges struct {
+	Number      int      `json:"number" yaml:"number"`
+	Comments    []string `json:"comments,omitempty" yaml:"comments,omitempty"`
+	AddedLabels []string `json:"addedLabels,omitempty" yaml:"addedLabels,omitempty"`
+	Milestone   string   `json:"milestone,omitempty" yaml:"milestone,omitempty"` // new milestone title (see Adapter.SetMilestone)
+}
+
+// Releases is the content of a releases (output) file
+type Releases struct {
+	Releases     []Release            `json:"releases" yaml:"releases"`
+	PullRequests []PullRequestChanges `json:"pullRequests,omitempty" yaml:"pullRequests,omitempty"`
+	Milestones   []Milestone          `json:"milestones,omitempty" yaml:"milestones,omitempty"` // all the milestones (fixture ones included) after the first milestone change
+}
+
+func emptyIfNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
+
+// NewPullRequest converts a repo.PullRequest to its serialized form
+func NewPullRequest(pr *repo.PullRequest) PullRequest {
+	res := PullRequest{
+		Number:             pr.Number,
+		Title:              pr.Title,
+		MergedAt:           pr.MergedAt,
+		UpdatedAt:          pr.UpdatedAt,
+		Labels:             pr.Labels,
+		Branch:             pr.Branch,
+		Url:                pr.Url,
+		AuthorLogin:        pr.AuthorLogin,
+		AuthorUrl:          pr.AuthorUrl,
+		Body:               pr.Body,
+		Draft:              pr.Draft,
+		Milestone:          pr.Milestone,
+		Assignees:          pr.Assignees,
+		RequestedReviewers: pr.RequestedReviewers,
+		ApprovingReviewers: pr.ApprovingReviewers,
+		BaseBranch:         pr.BaseBranch,
+		MergeCommitSha:     pr.MergeCommitSha,
+		CreatedAt:          pr.CreatedAt,
+		ClosedAt:           pr.ClosedAt,
+		MergedBy:           pr.MergedBy,
+	}
+	for _, issue := range pr.LinkedIssues {
+		res.LinkedIssues = append(res.LinkedIssues, Issue{
+			Number: issue.Number,
+			Title:  issue.Title,
+			Url:    issue.Url,
+			Labels: issue.Labels,
+		})
+	}
+	return res
+}
+
+// ToPullRequest converts the serialized form to a repo.PullRequest
+// (missing slices are replaced by empty ones and a missing updatedAt is computed)
+func (p PullRequest) ToPullRequest() *repo.PullRequest {
+	updatedAt := p.UpdatedAt
+	for _, t := range []*time.Time{p.CreatedAt, p.MergedAt, p.ClosedAt} {
+		if t != nil && (updatedAt == nil || t.After(*updatedAt)) {
+			updatedAt = t
+		}
+	}
+	res := &repo.PullRequest{
+		Number:             p.Number,
+		Title:              p.Title,
+		MergedAt:           p.MergedAt,
+		UpdatedAt:          updatedAt,
+		Labels:             emptyIfNil(p.Labels),
+		Branch:             p.Branch,
+		Url:                p.Url,
+		AuthorLogin:        p.AuthorLogin,
+		AuthorUrl:          p.AuthorUrl,
+		Body:               p.Body,
+		Draft:              p.Draft,
+		Milestone:          p.Milestone,
+		Assignees:          emptyIfNil(p.Assignees),
+		RequestedReviewers: emptyIfNil(p.RequestedReviewers),
+		ApprovingReviewers: emptyIfNil(p.ApprovingReviewers),
+		BaseBranch:         p.BaseBranch,
+		MergeCommitSha:     p.MergeCommitSha,
+		CreatedAt:          p.CreatedAt,
+		ClosedAt:           p.ClosedAt,
+		MergedBy:           p.MergedBy,
+	}
+	if p.LinkedIssues != nil {
+		res.LinkedIssues = []*repo.Issue{}
+		for _, issue := range p.LinkedIssues {
+			res.LinkedIssues = append(res.LinkedIssues, &repo.Issue{
+				Number: issue.Number,
+				Title:  issue.Title,
+				Url:    issue.Url,
+				Labels: emptyIfNil(issue.Labels),
+			})
+		}
+	}
+	return res
+}
+
+// isYAML returns true if the given path has a YAML extension (.yaml or .yml)
+func isYAML(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// Marshal encodes the given value in YAML (if yamlFormat is true) or in (indented) JSON
+func Marshal(v any, yamlFormat bool) ([]byte, error) {
+	if yamlFormat {
+		var buf bytes.Buffer
+		encoder := yaml.NewEncoder(&buf)
+		encoder.SetIndent(2)
+		err := encoder.Encode(v)
+		if err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	res, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(res, '\n'), nil
+}
+
+// readFile decodes the given JSON or YAML file (depending on its extension) into v
+func readFile(path string, v any) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if isYAML(path) {
+		err = yaml.Unmarshal(content, v)
+	} else {
+		err = json.Unmarshal(content, v)
+	}
+	if err != nil {
+		return fmt.Errorf("can't decode %s: %w", path, err)
+	}
+	return nil
+}
+
+// writeFile encodes v in JSON or YAML (depending on the extension of the given path) into the given file
+func writeFile(path string, v any) error {
+	content, err := Marshal(v, isYAML(path))
+	if err != nil {
+		return fmt.Errorf("can't encode %s: %w", path, err)
+	}
+	return os.WriteFile(path, content, 0644)
+}
+
+// ReadFixture reads a fixture file (JSON or YAML, depending on the extension)
+func ReadFixture(path string) (*Fixture, error) {
+	res := &Fixture{}
+	err := readFile(path, res)
+	if err != nil {
+		return nil, fmt.Errorf("can't read the fixture file: %w", err)
+	}
+	return res, nil
+}
+
+// WriteFixture writes a fixture file (JSON or YAML, depending on the extension)
+func WriteFixture(path string, fixture *Fixture) error {
+	err := writeFile(path, fixture)
+	if err != nil {
+		return fmt.Errorf("can't write the fixture file: %w", err)
+	}
+	return nil
+}
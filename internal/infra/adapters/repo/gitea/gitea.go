@@ -0,0 +1,526 @@
+package repogitea
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fabien-marty/github-next-semantic-version/internal/app/repo"
+	"github.com/fabien-marty/github-next-semantic-version/internal/infra/adapters/repo/httpclient"
+)
+
+var _ repo.Port = &Adapter{}
+
+const perPage = 50 // default maximum page size of Gitea/Forgejo instances (MAX_RESPONSE_ITEMS)
+
+type state string
+
+const (
+	open   state = "open"
+	merged state = "merged"
+)
+
+type AdapterOptions struct {
+	Token      string       // access token (empty => anonymous)
+	BaseURL    string       // API base url (example: https://codeberg.org/api/v1/), mandatory
+	HTTPClient *http.Client // http client to use, nil => http.DefaultClient
+}
+
+// authenticate sets the authentication headers of the given API request (token authorization header)
+func (o AdapterOptions) authenticate(req *http.Request) {
+	if o.Token != "" {
+		req.Header.Set("Authorization", "token "+o.Token)
+	}
+}
+
+// Adapter is a repo adapter using the Gitea (or Forgejo) REST API
+type Adapter struct {
+	opts    AdapterOptions
+	baseURL *url.URL
+	api     *httpclient.APIClient
+	owner   string
+	repo    string
+}
+
+func NewAdapter(owner string, repo string, opts AdapterOptions) (*Adapter, error) {
+	baseURL, err := url.Parse(opts.BaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("can't parse the Gitea base url %s: %w", opts.BaseURL, err)
+	}
+	if baseURL.Scheme == "" || baseURL.Host == "" {
+		return nil, fmt.Errorf("bad Gitea base url: %s (scheme and host are mandatory)", opts.BaseURL)
+	}
+	if !strings.HasSuffix(baseURL.Path, "/") {
+		baseURL.Path += "/"
+	}
+	return &Adapter{
+		opts:    opts,
+		baseURL: baseURL,
+		api:     httpclient.NewAPIClient("Gitea", baseURL, opts.HTTPClient, opts.authenticate),
+		owner:   owner,
+		repo:    repo,
+	}, nil
+}
+
+// APIBaseURL returns the API base url corresponding to the given web base url
+// (example: https://codeberg.org => https://codeberg.org/api/v1/)
+func APIBaseURL(webBaseURL string) string {
+	return strings.TrimSuffix(webBaseURL, "/") + "/api/v1/"
+}
+
+// WebBaseURL returns the web base url (without trailing slash) corresponding to the given API base url
+// (example: https://gitea.example.com/api/v1/ => https://gitea.example.com)
+func WebBaseURL(baseURL string) (string, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return "", fmt.Errorf("can't parse the url %s: %w", baseURL, err)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("bad url: %s (scheme and host are mandatory)", baseURL)
+	}
+	path := strings.TrimSuffix(strings.TrimSuffix(u.Path, "/"), "/api/v1")
+	return u.Scheme + "://" + u.Host + path, nil
+}
+
+// repoPath returns the API path of the repository
+func (r *Adapter) repoPath() string {
+	return "repos/" + url.PathEscape(r.owner) + "/" + url.PathEscape(r.repo)
+}
+
+// request executes an API request on the given path (relative to the base url) and decodes
+// the JSON response into res (if not nil, see httpclient.APIClient.Request)
+func (r *Adapter) request(method string, path string, query url.Values, payload any, res any) (*http.Response, error) {
+	return r.api.Request(method, path, query, payload, res)
+}
+
+type giteaUser struct {
+	Login   string `json:"login"`
+	HTMLURL string `json:"html_url"`
+}
+
+type giteaPullRequest struct {
+	Number         int         `json:"number"`
+	Title          string      `json:"title"`
+	Body           string      `json:"body"`
+	HTMLURL        string      `json:"html_url"`
+	Draft          bool        `json:"draft"`
+	Merged         bool        `json:"merged"`
+	MergeCommitSha string      `json:"merge_commit_sha"`
+	CreatedAt      *time.Time  `json:"created_at"`
+	UpdatedAt      *time.Time  `json:"updated_at"`
+	MergedAt       *time.Time  `json:"merged_at"`
+	ClosedAt       *time.Time  `json:"closed_at"`
+	User           *giteaUser  `json:"user"`
+	MergedBy       *giteaUser  `json:"merged_by"`
+	Assignees      []giteaUser `json:"assignees"`
+	Reviewers      []giteaUser `json:"requested_reviewers"`
+	Labels         []struct {
+		Name string `json:"name"`
+	} `json:"labels"`
+	Milestone *struct {
+		Title string `json:"title"`
+	} `json:"milestone"`
+	Head *struct {
+		Ref string `json:"ref"`
+	} `json:"head"`
+	Base *struct {
+		Ref string `json:"ref"`
+	} `json:"base"`
+}
+
+func logins(users []giteaUser) []string {
+	res := []string{}
+	for _, user := range users {
+		res = append(res, user.Login)
+	}
+	return res
+}
+
+func (r *Adapter) createPullRequestFromGiteaPr(pr *giteaPullRequest) *repo.PullRequest {
+	if pr.Number == 0 || pr.UpdatedAt == nil || pr.HTMLURL == "" || pr.User == nil || pr.Head == nil || pr.Base == nil {
+		return nil
+	}
+	labels := []string{}
+	for _, label := range pr.Labels {
+		labels = append(labels, label.Name)
+	}
+	milestone := ""
+	if pr.Milestone != nil {
+		milestone = pr.Milestone.Title
+	}
+	var mergedAt *time.Time
+	mergeCommitSha := ""
+	mergedBy := ""
+	if pr.Merged {
+		mergedAt = pr.MergedAt
+		mergeCommitSha = pr.MergeCommitSha
+		if pr.MergedBy != nil {
+			mergedBy = pr.MergedBy.Login
+		}
+	}
+	return &repo.PullRequest{
+		Number:             pr.Number,
+		Title:              pr.Title,
+		MergedAt:           mergedAt,
+		UpdatedAt:          pr.UpdatedAt,
+		Labels:             labels,
+		Branch:             pr.Head.Ref,
+		Url:                pr.HTMLURL,
+		AuthorLogin:        pr.User.Login,
+		AuthorUrl:          pr.User.HTMLURL,
+		Body:               pr.Body,
+		Draft:              pr.Draft,
+		Milestone:          milestone,
+		Assignees:          logins(pr.Assignees),
+		RequestedReviewers: logins(pr.Reviewers),
+		ApprovingReviewers: []string{}, // not available in pull requests lists
+		BaseBranch:         pr.Base.Ref,
+		MergeCommitSha:     mergeCommitSha,
+		CreatedAt:          pr.CreatedAt,
+		ClosedAt:           pr.ClosedAt,
+		MergedBy:           mergedBy,
+	}
+}
+
+// listPullRequests returns the list of pull requests (targetting the given base) in the given state
+// sorted by the given sort (newest or recentupdate)
+//
+// The Gitea API can't filter pull requests by base branch, so the filtering is done here.
+//
+// If stopBefore is not nil, the pagination stops as soon as we get a pull request updated before
+// this time (so it's only relevant with sort="recentupdate") and merged pull requests merged before
+// this time are not returned.
+func (r *Adapter) listPullRequests(state state, base string, sort string, usePagination bool, stopBefore *time.Time) ([]*repo.PullRequest, error) {
+	query := url.Values{}
+	query.Set("state", "open")
+	if state == merged {
+		query.Set("state", "closed")
+	}
+	query.Set("sort", sort)
+	query.Set("limit", strconv.Itoa(perPage))
+	logger := slog.Default().With("base", base, "state", string(state), "sort", sort)
+	res := []*repo.PullRequest{}
+	for page := 1; ; page++ {
+		logger := logger.With("page", page)
+		logger.Debug("fetching pull-requests...")
+		query.Set("page", strconv.Itoa(page))
+		var prs []giteaPullRequest
+		resp, err := r.request(http.MethodGet, r.repoPath()+"/pulls", query, nil, &prs)
+		if err != nil {
+			return nil, err
+		}
+		tooOld := false
+		for i := range prs {
+			pr := &prs[i]
+			if stopBefore != nil && pr.UpdatedAt != nil && pr.UpdatedAt.Before(*stopBefore) {
+				// a PR merged after stopBefore can't be updated before stopBefore
+				tooOld = true
+				continue
+			}
+			pro := r.createPullRequestFromGiteaPr(pr)
+			if pro == nil || pro.BaseBranch != base {
+				continue
+			}
+			if state == merged && pro.MergedAt == nil {
+				continue
+			}
+			if stopBefore != nil && pro.MergedAt != nil && pro.MergedAt.Before(*stopBefore) {
+				continue
+			}
+			res = append(res, pro)
+		}
+		if tooOld {
+			logger.Debug("pull-requests older than the cutoff found => stop paginating", slog.Time("cutoff", *stopBefore))
+			break
+		}
+		if !usePagination || len(prs) == 0 || !strings.Contains(resp.Header.Get("Link"), `rel="next"`) {
+			break
+		}
+	}
+	logger.Debug("pull-requests fetched", slog.Int("count", len(res)))
+	return res, nil
+}
+
+func sortPRByUpdatedAt(a, b *repo.PullRequest) int {
+	return a.UpdatedAt.Compare(*b.UpdatedAt)
+}
+
+func (r *Adapter) GetLastUpdatedPullRequests(base string, onlyMerged bool) ([]*repo.PullRequest, error) {
+	if onlyMerged {
+		return r.listPullRequests(merged, base, "recentupdate", false, nil)
+	}
+	opened, err := r.listPullRequests(open, base, "recentupdate", false, nil)
+	if err != nil {
+		return nil, err
+	}
+	merged, err := r.listPullRequests(merged, base, "recentupdate", false, nil)
+	if err != nil {
+		return nil, err
+	}
+	tmp := []*repo.PullRequest{}
+	tmp = append(tmp, opened...)
+	tmp = append(tmp, merged...)
+	slices.SortFunc(tmp, sortPRByUpdatedAt)
+	slices.Reverse(tmp)
+	return tmp, nil
+}
+
+func (r *Adapter) GetPullRequests(base string, onlyMerged bool) ([]*repo.PullRequest, error) {
+	if onlyMerged {
+		return r.listPullRequests(merged, base, "newest", true, nil)
+	}
+	opened, err := r.listPullRequests(open, base, "newest", true, nil)
+	if err != nil {
+		return nil, err
+	}
+	merged, err := r.listPullRequests(merged, base, "newest", true, nil)
+	if err != nil {
+		return nil, err
+	}
+	return append(opened, merged...), nil
+}
+
+// GetPullRequestsSince returns merged pull requests merged after the given time
+// (+ all open pull requests if onlyMerged is false)
+//
+// Merged pull requests are read sorted by "last updated" (descending) so we can stop paginating
+// as soon as we get a pull request updated before the given time.
+func (r *Adapter) GetPullRequestsSince(base string, onlyMerged bool, since time.Time) ([]*repo.PullRequest, error) {
+	if onlyMerged {
+		return r.listPullRequests(merged, base, "recentupdate", true, &since)
+	}
+	opened, err := r.listPullRequests(open, base, "newest", true, nil)
+	if err != nil {
+		return nil, err
+	}
+	merged, err := r.listPullRequests(merged, base, "recentupdate", true, &since)
+	if err != nil {
+		return nil, err
+	}
+	return append(opened, merged...), nil
+}
+
+// GetLinkedIssues returns the issues closed by the given pull request
+//
+// The Gitea API doesn't expose the issues closed by a pull request, so an empty list is returned.
+func (r *Adapter) GetLinkedIssues(pr *repo.PullRequest) ([]*repo.Issue, error) {
+	if pr.LinkedIssues != nil {
+		return pr.LinkedIssues, nil
+	}
+	return []*repo.Issue{}, nil
+}
+
+type giteaRelease struct {
+	ID      int64  `json:"id"`
+	TagName string `json:"tag_name"`
+	Name    string `json:"name"`
+	Draft   bool   `json:"draft"`
+}
+
+func (r giteaRelease) toRelease() *repo.Release {
+	return &repo.Release{ID: r.ID, TagName: r.TagName, Name: r.Name, Draft: r.Draft}
+}
+
+// releasePayload returns the release payload (creation or edition) corresponding to the given options
+func releasePayload(opts repo.ReleaseOptions) map[string]any {
+	return map[string]any{
+		"tag_name":         opts.TagName,
+		"target_commitish": opts.GetTarget(),
+		"name":             opts.GetName(),
+		"body":             opts.Body,
+		"draft":            opts.Draft,
+		"prerelease":       opts.Prerelease,
+	}
+}
+
+func (r *Adapter) CreateRelease(opts repo.ReleaseOptions) (*repo.Release, error) {
+	var release giteaRelease
+	_, err := r.request(http.MethodPost, r.repoPath()+"/releases", nil, releasePayload(opts), &release)
+	if err != nil {
+		return nil, fmt.Errorf("can't create the Gitea release %s: %w", opts.TagName, err)
+	}
+	return release.toRelease(), nil
+}
+
+// GetLastReleases returns the first page of releases (drafts are only returned with write access)
+func (r *Adapter) GetLastReleases() ([]*repo.Release, error) {
+	var releases []giteaRelease
+	_, err := r.request(http.MethodGet, r.repoPath()+"/releases", url.Values{"limit": {strconv.Itoa(perPage)}}, nil, &releases)
+	if err != nil {
+		return nil, fmt.Errorf("can't list the Gitea releases: %w", err)
+	}
+	res := []*repo.Release{}
+	for _, release := range releases {
+		res = append(res, release.toRelease())
+	}
+	return res, nil
+}
+
+func (r *Adapter) UpdateRelease(release *repo.Release, opts repo.ReleaseOptions) (*repo.Release, error) {
+	var updated giteaRelease
+	_, err := r.request(http.MethodPatch, r.repoPath()+"/releases/"+strconv.FormatInt(release.ID, 10), nil, releasePayload(opts), &updated)
+	if err != nil {
+		return nil, fmt.Errorf("can't update the Gitea release %s: %w", release.TagName, err)
+	}
+	return updated.toRelease(), nil
+}
+
+// UploadReleaseAsset uploads the asset as a release attachment (an existing attachment with the same name is deleted first)
+func (r *Adapter) UploadReleaseAsset(release *repo.Release, asset repo.ReleaseAsset) error {
+	assetsPath := r.repoPath() + "/releases/" + strconv.FormatInt(release.ID, 10) + "/assets"
+	var existing []struct {
+		ID   int64  `json:"id"`
+		Name string `json:"name"`
+	}
+	_, err := r.request(http.MethodGet, assetsPath, nil, nil, &existing)
+	if err != nil {
+		return fmt.Errorf("can't list the assets of the release %s: %w", release.TagName, err)
+	}
+	for _, a := range existing {
+		if a.Name != asset.Name {
+			continue
+		}
+		slog.Debug("deleting the existing release asset", slog.String("name", asset.Name), slog.Int64("id", a.ID))
+		_, err = r.request(http.MethodDelete, assetsPath+"/"+strconv.FormatInt(a.ID, 10), nil, nil, nil)
+		if err != nil {
+			return fmt.Errorf("can't delete the existing asset %s: %w", asset.Name, err)
+		}
+	}
+	content, err := asset.ReadAll()
+	if err != nil {
+		return fmt.Errorf("can't read the asset %s: %w", asset.Name, err)
+	}
+	payload, err := httpclient.NewMultipartPayload("attachment", asset.Name, asset.GetContentType(), content)
+	if err != nil {
+		return err
+	}
+	_, err = r.request(http.MethodPost, assetsPath, url.Values{"name": {asset.Name}}, payload, nil)
+	if err != nil {
+		return fmt.Errorf("can't upload the asset %s: %w", asset.Name, err)
+	}
+	return nil
+}
+
+// GetPullRequestComments returns the bodies of the comments of the given pull request
+// (the endpoint is not paginated)
+func (r *Adapter) GetPullRequestComments(pr *repo.PullRequest) ([]string, error) {
+	var comments []struct {
+		Body string `json:"body"`
+	}
+	_, err := r.request(http.MethodGet, fmt.Sprintf("%s/issues/%d/comments", r.repoPath(), pr.Number), nil, nil, &comments)
+	if err != nil {
+		return nil, fmt.Errorf("can't list the comments of the pull request #%d: %w", pr.Number, err)
+	}
+	res := []string{}
+	for _, comment := range comments {
+		res = append(res, comment.Body)
+	}
+	return res, nil
+}
+
+func (r *Adapter) AddPullRequestComment(pr *repo.PullRequest, body string) error {
+	_, err := r.request(http.MethodPost, fmt.Sprintf("%s/issues/%d/comments", r.repoPath(), pr.Number), nil, map[string]any{"body": body}, nil)
+	if err != nil {
+		return fmt.Errorf("can't comment the pull request #%d: %w", pr.Number, err)
+	}
+	return nil
+}
+
+// AddPullRequestLabel adds the given label (by name, Gitea >= 1.19) to the given pull request
+// (the label must exist in the repository or in its organization)
+func (r *Adapter) AddPullRequestLabel(pr *repo.PullRequest, label string) error {
+	_, err := r.request(http.MethodPost, fmt.Sprintf("%s/issues/%d/labels", r.repoPath(), pr.Number), nil, map[string]any{"labels": []string{label}}, nil)
+	if err != nil {
+		return fmt.Errorf("can't add the label %s to the pull request #%d: %w", label, pr.Number, err)
+	}
+	return nil
+}
+
+// giteaMilestone is a Gitea milestone
+type giteaMilestone struct {
+	ID    int64  `json:"id"`
+	Title string `json:"title"`
+	State string `json:"state"`
+}
+
+func (m giteaMilestone) toMilestone() *repo.Milestone {
+	return &repo.Milestone{ID: m.ID, Title: m.Title, Closed: m.State == "closed"}
+}
+
+func (r *Adapter) GetMilestones() ([]*repo.Milestone, error) {
+	query := url.Values{}
+	query.Set("state", "all")
+	query.Set("limit", strconv.Itoa(perPage))
+	res := []*repo.Milestone{}
+	for page := 1; ; page++ {
+		query.Set("page", strconv.Itoa(page))
+		var milestones []giteaMilestone
+		resp, err := r.request(http.MethodGet, r.repoPath()+"/milestones", query, nil, &milestones)
+		if err != nil {
+			return nil, fmt.Errorf("can't list the Gitea milestones: %w", err)
+		}
+		for _, milestone := range milestones {
+			res = append(res, milestone.toMilestone())
+		}
+		if len(milestones) == 0 || !strings.Contains(resp.Header.Get("Link"), `rel="next"`) {
+			return res, nil
+		}
+	}
+}
+
+func (r *Adapter) CreateMilestone(title string) (*repo.Milestone, error) {
+	var milestone giteaMilestone
+	_, err := r.request(http.MethodPost, r.repoPath()+"/milestones", nil, map[string]any{"title": title}, &milestone)
+	if err != nil {
+		return nil, fmt.Errorf("can't create the Gitea milestone %s: %w", title, err)
+	}
+	return milestone.toMilestone(), nil
+}
+
+func (r *Adapter) CloseMilestone(milestone *repo.Milestone) error {
+	_, err := r.request(http.MethodPatch, fmt.Sprintf("%s/milestones/%d", r.repoPath(), milestone.ID), nil, map[string]any{"state": "closed"}, nil)
+	if err != nil {
+		return fmt.Errorf("can't close the Gitea milestone %s: %w", milestone.Title, err)
+	}
+	return nil
+}
+
+// GetMilestoneOpenItems returns the open issues and pull requests of the milestone
+// (with the issues API which also returns pull requests)
+func (r *Adapter) GetMilestoneOpenItems(milestone *repo.Milestone) ([]repo.MilestoneItem, error) {
+	query := url.Values{}
+	query.Set("state", "open")
+	query.Set("milestones", strconv.FormatInt(milestone.ID, 10))
+	query.Set("limit", strconv.Itoa(perPage))
+	res := []repo.MilestoneItem{}
+	for page := 1; ; page++ {
+		query.Set("page", strconv.Itoa(page))
+		var issues []struct {
+			Number      int  `json:"number"`
+			PullRequest *any `json:"pull_request"`
+		}
+		resp, err := r.request(http.MethodGet, r.repoPath()+"/issues", query, nil, &issues)
+		if err != nil {
+			return nil, fmt.Errorf("can't list the open issues of the Gitea milestone %s: %w", milestone.Title, err)
+		}
+		for _, issue := range issues {
+			res = append(res, repo.MilestoneItem{Number: issue.Number, PullRequest: issue.PullRequest != nil})
+		}
+		if len(issues) == 0 || !strings.Contains(resp.Header.Get("Link"), `rel="next"`) {
+			return res, nil
+		}
+	}
+}
+
+func (r *Adapter) SetMilestone(item repo.MilestoneItem, milestone *repo.Milestone) error {
+	_, err := r.request(http.MethodPatch, fmt.Sprintf("%s/issues/%d", r.repoPath(), item.Number), nil, map[string]any{"milestone": milestone.ID}, nil)
+	if err != nil {
+		return fmt.Errorf("can't set the Gitea milestone %s on #%d: %w", milestone.Title, item.Number, err)
+	}
+	return nil
+}
@@ -0,0 +1,368 @@
+package repogitea
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/fabien-marty/github-next-semantic-version/internal/app/repo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakePr struct {
+	number    int
+	base      string
+	updatedAt time.Time
+	mergedAt  *time.Time
+}
+
+func (p fakePr) toJSON() map[string]any {
+	return map[string]any{
+		"number":              p.number,
+		"title":               fmt.Sprintf("PR%d", p.number),
+		"body":                "body",
+		"html_url":            fmt.Sprintf("https://codeberg.org/foo/bar/pulls/%d", p.number),
+		"draft":               false,
+		"merged":              p.mergedAt != nil,
+		"merge_commit_sha":    fmt.Sprintf("sha%d", p.number),
+		"created_at":          p.updatedAt.Add(-time.Hour),
+		"updated_at":          p.updatedAt,
+		"merged_at":           p.mergedAt,
+		"closed_at":           p.mergedAt,
+		"user":                map[string]any{"login": "user", "html_url": "https://codeberg.org/user"},
+		"merged_by":           map[string]any{"login": "merger"},
+		"assignees":           []map[string]any{{"login": "assignee"}},
+		"requested_reviewers": []map[string]any{{"login": "reviewer"}},
+		"labels":              []map[string]any{{"name": "label"}},
+		"milestone":           map[string]any{"title": "v1"},
+		"head":                map[string]any{"ref": fmt.Sprintf("branch%d", p.number)},
+		"base":                map[string]any{"ref": p.base},
+	}
+}
+
+// newFakeServer returns a fake Gitea API server serving the given (already sorted) closed PRs
+// and a single open PR (#1000)
+func newFakeServer(t *testing.T, closedPrs []fakePr, perPage int) (*httptest.Server, *[]string) {
+	t.Helper()
+	calls := []string{}
+	mux := http.NewServeMux()
+	var server *httptest.Server
+	mux.HandleFunc("GET /api/v1/repos/foo/bar/pulls", func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.URL.RawQuery)
+		assert.Equal(t, "token secret", r.Header.Get("Authorization"))
+		prs := []fakePr{{number: 1000, base: "main", updatedAt: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)}}
+		if r.URL.Query().Get("state") == "closed" {
+			prs = closedPrs
+		}
+		page, err := strconv.Atoi(r.URL.Query().Get("page"))
+		require.NoError(t, err)
+		start := min((page-1)*perPage, len(prs))
+		end := min(start+perPage, len(prs))
+		if end < len(prs) {
+			w.Header().Set("Link", fmt.Sprintf(`<%s/api/v1/repos/foo/bar/pulls?page=%d>; rel="next"`, server.URL, page+1))
+		}
+		res := []map[string]any{}
+		for _, pr := range prs[start:end] {
+			res = append(res, pr.toJSON())
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(res)
+	})
+	server = httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+func newFakeAdapter(t *testing.T, server *httptest.Server) *Adapter {
+	t.Helper()
+	adapter, err := NewAdapter("foo", "bar", AdapterOptions{Token: "secret", BaseURL: APIBaseURL(server.URL)})
+	require.NoError(t, err)
+	return adapter
+}
+
+// newFakeClosedPrs returns 25 merged PRs targetting main (sorted by updatedAt descending),
+// a closed (not merged) PR and a merged PR targetting another branch
+func newFakeClosedPrs() []fakePr {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	res := []fakePr{}
+	for i := 25; i > 0; i-- {
+		mergedAt := base.Add(time.Duration(i) * time.Hour)
+		res = append(res, fakePr{number: i, base: "main", updatedAt: mergedAt.Add(time.Minute), mergedAt: &mergedAt})
+		if i == 22 {
+			res = append(res, fakePr{number: 100, base: "main", updatedAt: mergedAt})
+			otherMergedAt := mergedAt.Add(-time.Minute)
+			res = append(res, fakePr{number: 101, base: "other", updatedAt: mergedAt, mergedAt: &otherMergedAt})
+		}
+	}
+	return res
+}
+
+func TestWebBaseURL(t *testing.T) {
+	res, err := WebBaseURL("https://codeberg.org/api/v1/")
+	require.NoError(t, err)
+	assert.Equal(t, "https://codeberg.org", res)
+	res, err = WebBaseURL(APIBaseURL("https://example.com/gitea/"))
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/gitea", res)
+	_, err = WebBaseURL("codeberg.org")
+	assert.Error(t, err)
+	_, err = NewAdapter("foo", "bar", AdapterOptions{})
+	assert.Error(t, err)
+}
+
+func TestGetPullRequests(t *testing.T) {
+	server, calls := newFakeServer(t, newFakeClosedPrs(), 10)
+	adapter := newFakeAdapter(t, server)
+
+	res, err := adapter.GetPullRequests("main", true)
+	require.NoError(t, err)
+	require.Equal(t, 25, len(res)) // not merged PR and PR targetting another branch are filtered out
+	assert.Equal(t, 3, len(*calls))
+	mergedAt := time.Date(2024, 1, 2, 1, 0, 0, 0, time.UTC)
+	updatedAt := mergedAt.Add(time.Minute)
+	createdAt := updatedAt.Add(-time.Hour)
+	expected := &repo.PullRequest{
+		Number:             25,
+		Title:              "PR25",
+		MergedAt:           &mergedAt,
+		UpdatedAt:          &updatedAt,
+		Labels:             []string{"label"},
+		Branch:             "branch25",
+		Url:                "https://codeberg.org/foo/bar/pulls/25",
+		AuthorLogin:        "user",
+		AuthorUrl:          "https://codeberg.org/user",
+		Body:               "body",
+		Milestone:          "v1",
+		Assignees:          []string{"assignee"},
+		RequestedReviewers: []string{"reviewer"},
+		ApprovingReviewers: []string{},
+		BaseBranch:         "main",
+		MergeCommitSha:     "sha25",
+		CreatedAt:          &createdAt,
+		ClosedAt:           &mergedAt,
+		MergedBy:           "merger",
+	}
+	assert.Equal(t, expected, res[0])
+	for _, pr := range res {
+		assert.NotContains(t, []int{100, 101}, pr.Number)
+	}
+
+	*calls = []string{}
+	res, err = adapter.GetPullRequests("main", false)
+	require.NoError(t, err)
+	assert.Equal(t, 26, len(res))
+	assert.Equal(t, 1000, res[0].Number)
+	assert.Nil(t, res[0].MergedAt)
+	assert.Equal(t, "", res[0].MergeCommitSha)
+	assert.Equal(t, 4, len(*calls))
+}
+
+func TestGetPullRequestsSince(t *testing.T) {
+	server, calls := newFakeServer(t, newFakeClosedPrs(), 10)
+	adapter := newFakeAdapter(t, server)
+
+	since := time.Date(2024, 1, 1, 13, 30, 0, 0, time.UTC)
+	res, err := adapter.GetPullRequestsSince("main", true, since)
+	require.NoError(t, err)
+	assert.Equal(t, 12, len(res)) // PRs 14 => 25
+	assert.Equal(t, 2, len(*calls))
+	assert.Contains(t, (*calls)[0], "sort=recentupdate")
+}
+
+func TestGetLastUpdatedPullRequests(t *testing.T) {
+	server, calls := newFakeServer(t, newFakeClosedPrs(), 10)
+	adapter := newFakeAdapter(t, server)
+
+	res, err := adapter.GetLastUpdatedPullRequests("main", false)
+	require.NoError(t, err)
+	assert.Equal(t, 9, len(res)) // open PR + first page of closed PRs (without the not merged one and the one targetting another branch)
+	assert.Equal(t, 1000, res[0].Number)
+	assert.Equal(t, 25, res[1].Number)
+	assert.Equal(t, 2, len(*calls))
+}
+
+func TestCreateRelease(t *testing.T) {
+	var payload map[string]any
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v1/repos/foo/bar/releases", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"id": 1}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	adapter := newFakeAdapter(t, server)
+
+	_, err := adapter.CreateRelease(repo.ReleaseOptions{Base: "main", TagName: "v1.2.3", Body: "release notes", Draft: true})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{
+		"tag_name":         "v1.2.3",
+		"target_commitish": "main",
+		"name":             "v1.2.3",
+		"body":             "release notes",
+		"draft":            true,
+		"prerelease":       false,
+	}, payload)
+
+	_, err = adapter.CreateRelease(repo.ReleaseOptions{Base: "main", TagName: "v1.3.0-rc1", Name: "MyApp 1.3.0-rc1", Prerelease: true, TargetSha: "012345"})
+	require.NoError(t, err)
+	assert.Equal(t, "012345", payload["target_commitish"])
+	assert.Equal(t, "MyApp 1.3.0-rc1", payload["name"])
+	assert.Equal(t, true, payload["prerelease"])
+
+	server.Close()
+	_, err = adapter.CreateRelease(repo.ReleaseOptions{Base: "main", TagName: "v1.2.4", Body: "release notes"})
+	assert.Error(t, err)
+}
+
+func TestUploadReleaseAsset(t *testing.T) {
+	calls := []string{}
+	var filename, uploaded, contentType string
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v1/repos/foo/bar/releases", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"id": 12, "tag_name": "v1.2.3", "name": "v1.2.3", "draft": true}`))
+	})
+	mux.HandleFunc("GET /api/v1/repos/foo/bar/releases/12/assets", func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, "list")
+		_, _ = w.Write([]byte(`[{"id": 5, "name": "foo.txt"}, {"id": 6, "name": "bar.txt"}]`))
+	})
+	mux.HandleFunc("DELETE /api/v1/repos/foo/bar/releases/12/assets/{id}", func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, "delete "+r.PathValue("id"))
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("POST /api/v1/repos/foo/bar/releases/12/assets", func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, "upload "+r.URL.Query().Get("name"))
+		file, header, err := r.FormFile("attachment")
+		require.NoError(t, err)
+		defer file.Close()
+		body, _ := io.ReadAll(file)
+		filename, uploaded, contentType = header.Filename, string(body), header.Header.Get("Content-Type")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"id": 7}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	adapter := newFakeAdapter(t, server)
+
+	release, err := adapter.CreateRelease(repo.ReleaseOptions{Base: "main", TagName: "v1.2.3", Draft: true})
+	require.NoError(t, err)
+	assert.Equal(t, &repo.Release{ID: 12, TagName: "v1.2.3", Name: "v1.2.3", Draft: true}, release)
+	err = adapter.UploadReleaseAsset(release, repo.ReleaseAsset{Name: "foo.txt", ContentType: "text/plain", Content: []byte("foo")})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"list", "delete 5", "upload foo.txt"}, calls)
+	assert.Equal(t, "foo.txt", filename)
+	assert.Equal(t, "foo", uploaded)
+	assert.Equal(t, "text/plain", contentType)
+}
+
+func TestGetLastReleasesAndUpdateRelease(t *testing.T) {
+	var payload map[string]any
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/repos/foo/bar/releases", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`[{"id": 2, "tag_name": "v1.1.0", "name": "v1.1.0", "draft": true}, {"id": 1, "tag_name": "v1.0.0", "name": "v1.0.0"}]`))
+	})
+	mux.HandleFunc("PATCH /api/v1/repos/foo/bar/releases/2", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		_, _ = w.Write([]byte(`{"id": 2, "tag_name": "v2.0.0", "name": "v2.0.0", "draft": true}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	adapter := newFakeAdapter(t, server)
+
+	releases, err := adapter.GetLastReleases()
+	require.NoError(t, err)
+	assert.Equal(t, []*repo.Release{
+		{ID: 2, TagName: "v1.1.0", Name: "v1.1.0", Draft: true},
+		{ID: 1, TagName: "v1.0.0", Name: "v1.0.0"},
+	}, releases)
+
+	updated, err := adapter.UpdateRelease(releases[0], repo.ReleaseOptions{Base: "main", TagName: "v2.0.0", Body: "body", Draft: true})
+	require.NoError(t, err)
+	assert.Equal(t, &repo.Release{ID: 2, TagName: "v2.0.0", Name: "v2.0.0", Draft: true}, updated)
+	assert.Equal(t, "v2.0.0", payload["tag_name"])
+	assert.Equal(t, "body", payload["body"])
+}
+
+func TestPullRequestCommentsAndLabels(t *testing.T) {
+	var comment, labels map[string]any
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/repos/foo/bar/issues/1/comments", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`[{"body": "LGTM"}, {"body": "Released in v1.0.0"}]`))
+	})
+	mux.HandleFunc("POST /api/v1/repos/foo/bar/issues/1/comments", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&comment))
+		_, _ = w.Write([]byte(`{}`))
+	})
+	mux.HandleFunc("POST /api/v1/repos/foo/bar/issues/1/labels", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&labels))
+		_, _ = w.Write([]byte(`[]`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	adapter := newFakeAdapter(t, server)
+	pr := &repo.PullRequest{Number: 1}
+
+	comments, err := adapter.GetPullRequestComments(pr)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"LGTM", "Released in v1.0.0"}, comments)
+	require.NoError(t, adapter.AddPullRequestComment(pr, "Released in v1.1.0"))
+	assert.Equal(t, map[string]any{"body": "Released in v1.1.0"}, comment)
+	require.NoError(t, adapter.AddPullRequestLabel(pr, "released"))
+	assert.Equal(t, map[string]any{"labels": []any{"released"}}, labels)
+}
+
+func TestMilestones(t *testing.T) {
+	payloads := map[string]map[string]any{}
+	decode := func(t *testing.T, key string, r *http.Request) {
+		payload := map[string]any{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		payloads[key] = payload
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/repos/foo/bar/milestones", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "all", r.URL.Query().Get("state"))
+		_, _ = w.Write([]byte(`[{"id": 1, "title": "v1.0.0", "state": "closed"}, {"id": 2, "title": "v1.1.0", "state": "open"}]`))
+	})
+	mux.HandleFunc("POST /api/v1/repos/foo/bar/milestones", func(w http.ResponseWriter, r *http.Request) {
+		decode(t, "create", r)
+		_, _ = w.Write([]byte(`{"id": 3, "title": "v1.2.0", "state": "open"}`))
+	})
+	mux.HandleFunc("PATCH /api/v1/repos/foo/bar/milestones/2", func(w http.ResponseWriter, r *http.Request) {
+		decode(t, "close", r)
+		_, _ = w.Write([]byte(`{}`))
+	})
+	mux.HandleFunc("GET /api/v1/repos/foo/bar/issues", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "2", r.URL.Query().Get("milestones"))
+		assert.Equal(t, "open", r.URL.Query().Get("state"))
+		_, _ = w.Write([]byte(`[{"number": 10, "pull_request": null}, {"number": 11, "pull_request": {"merged": false}}]`))
+	})
+	mux.HandleFunc("PATCH /api/v1/repos/foo/bar/issues/11", func(w http.ResponseWriter, r *http.Request) {
+		decode(t, "set", r)
+		_, _ = w.Write([]byte(`{}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	adapter := newFakeAdapter(t, server)
+
+	milestones, err := adapter.GetMilestones()
+	require.NoError(t, err)
+	assert.Equal(t, []*repo.Milestone{{ID: 1, Title: "v1.0.0", Closed: true}, {ID: 2, Title: "v1.1.0"}}, milestones)
+	next, err := adapter.CreateMilestone("v1.2.0")
+	require.NoError(t, err)
+	assert.Equal(t, &repo.Milestone{ID: 3, Title: "v1.2.0"}, next)
+	assert.Equal(t, map[string]any{"title": "v1.2.0"}, payloads["create"])
+	items, err := adapter.GetMilestoneOpenItems(milestones[1])
+	require.NoError(t, err)
+	assert.Equal(t, []repo.MilestoneItem{{Number: 10}, {Number: 11, PullRequest: true}}, items)
+	require.NoError(t, adapter.SetMilestone(items[1], next))
+	assert.Equal(t, map[string]any{"milestone": float64(3)}, payloads["set"])
+	require.NoError(t, adapter.CloseMilestone(milestones[1]))
+	assert.Equal(t, map[string]any{"state": "closed"}, payloads["close"])
+}
@@ -0,0 +1,197 @@
+package repogithub
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	gh "github.com/google/go-github/v70/github"
+)
+
+const (
+	// GitHub refuses JWTs with an expiration time more than 10 minutes into the future
+	appJWTLifetime = 9 * time.Minute
+	// installation tokens are refreshed when they expire in less than this duration
+	appTokenRefreshMargin = time.Minute
+)
+
+type AppAuthOptions struct {
+	AppID          int64
+	InstallationID int64
+	PrivateKey     []byte // PEM encoded RSA private key (PKCS1 or PKCS8)
+}
+
+// appTransport is an http.RoundTripper authenticating requests as a GitHub App installation
+type appTransport struct {
+	upstream       http.RoundTripper
+	opts           AppAuthOptions
+	privateKey     *rsa.PrivateKey
+	accessTokenURL string
+	now            func() time.Time
+
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+// NewAppTransport returns an http.RoundTripper wrapping the given one (nil => http.DefaultTransport)
+// which authenticates requests with GitHub App installation tokens
+//
+// Installation tokens are obtained (with a JWT signed by the App private key) from the API at the
+// given base url (empty => api.github.com) and refreshed on expiry.
+func NewAppTransport(upstream http.RoundTripper, baseURL string, opts AppAuthOptions) (http.RoundTripper, error) {
+	if upstream == nil {
+		upstream = http.DefaultTransport
+	}
+	if opts.AppID <= 0 {
+		return nil, errors.New("bad GitHub App id")
+	}
+	if opts.InstallationID <= 0 {
+		return nil, errors.New("bad GitHub App installation id")
+	}
+	privateKey, err := parseRSAPrivateKey(opts.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("can't read the GitHub App private key: %w", err)
+	}
+	apiBaseURL, err := restBaseURL(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	return &appTransport{
+		upstream:       upstream,
+		opts:           opts,
+		privateKey:     privateKey,
+		accessTokenURL: apiBaseURL.JoinPath("app", "installations", fmt.Sprintf("%d", opts.InstallationID), "access_tokens").String(),
+		now:            time.Now,
+	}, nil
+}
+
+func parseRSAPrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("can't parse the private key (PKCS1 or PKCS8 expected): %w", err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("the private key is not a RSA key")
+	}
+	return rsaKey, nil
+}
+
+// jwt returns a new JWT (RS256) to authenticate as the GitHub App itself
+func (t *appTransport) jwt() (string, error) {
+	now := t.now()
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]any{
+		"iat": now.Add(-time.Minute).Unix(), // (to avoid clock drift issues, see GitHub documentation)
+		"exp": now.Add(appJWTLifetime).Unix(),
+		"iss": fmt.Sprintf("%d", t.opts.AppID),
+	})
+	if err != nil {
+		return "", err
+	}
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	hash := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, t.privateKey, crypto.SHA256, hash[:])
+	if err != nil {
+		return "", fmt.Errorf("can't sign the JWT: %w", err)
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// installationToken returns a valid installation token (a new one is requested if needed)
+func (t *appTransport) installationToken() (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.token != "" && t.now().Add(appTokenRefreshMargin).Before(t.expiresAt) {
+		return t.token, nil
+	}
+	logger := slog.Default().With(slog.Int64("appID", t.opts.AppID), slog.Int64("installationID", t.opts.InstallationID))
+	logger.Debug("requesting a new GitHub App installation token...")
+	jwt, err := t.jwt()
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequest(http.MethodPost, t.accessTokenURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("can't create the installation token request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+jwt)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	resp, err := t.upstream.RoundTrip(req)
+	if err != nil {
+		return "", fmt.Errorf("can't get a GitHub App installation token: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("can't read the installation token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusCreated {
+		return "", fmt.Errorf("can't get a GitHub App installation token: bad status code %d (body: %s)", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	var tokenResponse struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	err = json.Unmarshal(body, &tokenResponse)
+	if err != nil || tokenResponse.Token == "" {
+		return "", fmt.Errorf("can't decode the installation token response: %w", err)
+	}
+	t.token = tokenResponse.Token
+	t.expiresAt = tokenResponse.ExpiresAt
+	logger.Debug("new GitHub App installation token", slog.Time("expiresAt", t.expiresAt))
+	return t.token, nil
+}
+
+func (t *appTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := t.installationToken()
+	if err != nil {
+		if req.Body != nil {
+			_ = req.Body.Close()
+		}
+		return nil, err
+	}
+	req = req.Clone(req.Context()) // a RoundTripper must not modify the given request
+	req.Header.Set("Authorization", "token "+token)
+	return t.upstream.RoundTrip(req)
+}
+
+// restBaseURL returns the (normalized) REST API base url corresponding to the given one
+// (example: https://github.example.com/ => https://github.example.com/api/v3/)
+// If the given base url is empty, https://api.github.com/ is returned.
+func restBaseURL(baseURL string) (*url.URL, error) {
+	client := gh.NewClient(nil)
+	if baseURL == "" {
+		return client.BaseURL, nil
+	}
+	client, err := client.WithEnterpriseURLs(baseURL, baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("can't parse the url %s: %w", baseURL, err)
+	}
+	return client.BaseURL, nil
+}
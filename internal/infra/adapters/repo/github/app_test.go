@@ -0,0 +1,99 @@
+package repogithub
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fabien-marty/github-next-semantic-version/internal/app/repo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// verifyJWT checks the signature of the given JWT and returns its claims
+func verifyJWT(t *testing.T, jwt string, publicKey *rsa.PublicKey) map[string]any {
+	t.Helper()
+	parts := strings.Split(jwt, ".")
+	require.Len(t, parts, 3)
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	require.NoError(t, err)
+	hash := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	require.NoError(t, rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, hash[:], signature))
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	require.NoError(t, err)
+	claims := map[string]any{}
+	require.NoError(t, json.Unmarshal(payload, &claims))
+	return claims
+}
+
+func TestAppAuthentication(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	pemKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)})
+
+	tokens := 0
+	releases := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v3/app/installations/42/access_tokens", func(w http.ResponseWriter, r *http.Request) {
+		claims := verifyJWT(t, strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "), &privateKey.PublicKey)
+		assert.Equal(t, "123", claims["iss"])
+		tokens++
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"token":      fmt.Sprintf("ghs_%d", tokens),
+			"expires_at": time.Now().Add(time.Hour),
+		})
+	})
+	mux.HandleFunc("GET /api/v3/repos/foo/bar/pulls", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, fmt.Sprintf("token ghs_%d", tokens), r.Header.Get("Authorization"))
+		_, _ = w.Write([]byte("[]"))
+	})
+	mux.HandleFunc("POST /api/v3/repos/foo/bar/releases", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, fmt.Sprintf("token ghs_%d", tokens), r.Header.Get("Authorization"))
+		releases++
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte("{}"))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	adapter, err := NewAdapter("foo", "bar", AdapterOptions{
+		Token:   "ignored",
+		BaseURL: server.URL + "/",
+		App:     &AppAuthOptions{AppID: 123, InstallationID: 42, PrivateKey: pemKey},
+	})
+	require.NoError(t, err)
+	_, err = adapter.GetPullRequests("main", false)
+	require.NoError(t, err)
+	_, err = adapter.CreateRelease(repo.ReleaseOptions{Base: "main", TagName: "v1.0.0", Body: "body"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, tokens) // the token is reused
+	assert.Equal(t, 1, releases)
+
+	// the token is refreshed on expiry
+	transport := adapter.client.Client().Transport.(*appTransport)
+	transport.now = func() time.Time { return time.Now().Add(time.Hour) }
+	_, err = adapter.GetPullRequests("main", true)
+	require.NoError(t, err)
+	assert.Equal(t, 2, tokens)
+}
+
+func TestAppAuthenticationBadOptions(t *testing.T) {
+	_, err := NewAppTransport(nil, "", AppAuthOptions{AppID: 123, InstallationID: 42, PrivateKey: []byte("not a key")})
+	assert.ErrorContains(t, err, "private key")
+	_, err = NewAppTransport(nil, "", AppAuthOptions{InstallationID: 42})
+	assert.ErrorContains(t, err, "App id")
+	_, err = NewAppTransport(nil, "", AppAuthOptions{AppID: 123})
+	assert.ErrorContains(t, err, "installation id")
+}
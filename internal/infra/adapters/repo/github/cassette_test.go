@@ -0,0 +1,48 @@
+package repogithub
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fabien-marty/github-next-semantic-version/internal/infra/adapters/repo/httpclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCassetteRecordAndReplay(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	closedPrs := []fakePr{}
+	for i := 25; i > 0; i-- {
+		mergedAt := base.Add(time.Duration(i) * time.Hour)
+		closedPrs = append(closedPrs, fakePr{number: i, updatedAt: mergedAt, mergedAt: &mergedAt})
+	}
+	server, calls := newFakeServer(t, closedPrs, 10)
+	path := filepath.Join(t.TempDir(), "cassette.json")
+
+	cassette, err := httpclient.NewCassette(path, httpclient.CassetteRecord)
+	require.NoError(t, err)
+	adapter, err := NewAdapter("foo", "bar", AdapterOptions{Token: "secret", BaseURL: server.URL + "/", Transport: httpclient.TransportOptions{Cassette: cassette}, Concurrency: 4})
+	require.NoError(t, err)
+	recorded, err := adapter.GetPullRequests("main", false)
+	require.NoError(t, err)
+	assert.Equal(t, 25, len(recorded))
+	recordedCalls := *calls
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(content), "secret") // request headers are not recorded
+
+	server.Close()
+	cassette, err = httpclient.NewCassette(path, httpclient.CassetteReplay)
+	require.NoError(t, err)
+	adapter, err = NewAdapter("foo", "bar", AdapterOptions{BaseURL: server.URL + "/", Transport: httpclient.TransportOptions{Cassette: cassette}, Concurrency: 1})
+	require.NoError(t, err)
+	replayed, err := adapter.GetPullRequests("main", false)
+	require.NoError(t, err)
+	assert.Equal(t, recorded, replayed)
+	assert.Equal(t, recordedCalls, *calls)
+
+	_, err = adapter.GetPullRequests("other", false)
+	assert.ErrorContains(t, err, "no recorded interaction in the cassette")
+}
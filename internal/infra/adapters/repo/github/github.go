@@ -2,11 +2,18 @@ package repogithub
 
 import (
 	"context"
+	"fmt"
+	"io"
 	"log/slog"
+	"net/http"
+	"net/url"
 	"slices"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/fabien-marty/github-next-semantic-version/internal/app/repo"
+	"github.com/fabien-marty/github-next-semantic-version/internal/infra/adapters/repo/httpclient"
 	gh "github.com/google/go-github/v70/github"
 )
 
@@ -19,28 +26,131 @@ const (
 	merged state = "merged"
 )
 
+const defaultWebBaseURL = "https://github.com"
+
 type AdapterOptions struct {
-	Token string
+	Token       string
+	BaseURL     string // GitHub Enterprise Server API base url (example: https://github.example.com/api/v3/), empty => api.github.com
+	UploadURL   string // GitHub Enterprise Server upload url (example: https://github.example.com/api/uploads/), empty => same as BaseURL
+	Retry       httpclient.RetryOptions
+	App         *AppAuthOptions // if set, authenticate as a GitHub App installation (Token is ignored)
+	Transport   httpclient.TransportOptions
+	Concurrency int // max number of concurrent requests when listing pull requests, <=0 => 1 (no concurrency)
+	// if true, listed pull requests are completed with MergedBy and ApprovingReviewers
+	// (one or two more requests per pull request, see completePullRequests)
+	CompletePullRequests bool
 }
 
+// Adapter is a repo adapter using the GitHub REST API
+//
+// Listed pull requests have an empty ApprovingReviewers and MergedBy (they are not in the pull requests
+// list) unless AdapterOptions.CompletePullRequests is set, and a nil LinkedIssues (resolved by GetLinkedIssues).
+// The repogithubgraphql adapter gets all of them from the listing query.
 type Adapter struct {
 	opts   AdapterOptions
 	client *gh.Client
 	owner  string
 	repo   string
+	sem    chan struct{} // semaphore to limit the number of concurrent requests
+
+	issuesMu sync.Mutex
+	issues   map[int]*repo.Issue // cache of issues fetched by GetLinkedIssues (nil value => not an issue)
 }
 
-func NewAdapter(owner string, repo string, opts AdapterOptions) *Adapter {
-	client := gh.NewClient(nil)
-	if opts.Token != "" {
+func NewAdapter(owner string, repo string, opts AdapterOptions) (*Adapter, error) {
+	httpClient, err := NewHTTPClient(opts.BaseURL, opts.Transport, opts.Retry, opts.App)
+	if err != nil {
+		return nil, err
+	}
+	client := gh.NewClient(httpClient)
+	if opts.Token != "" && opts.App == nil {
 		client = client.WithAuthToken(opts.Token)
 	}
+	if opts.BaseURL != "" {
+		uploadURL := opts.UploadURL
+		if uploadURL == "" {
+			uploadURL = opts.BaseURL
+		}
+		client, err = client.WithEnterpriseURLs(opts.BaseURL, uploadURL)
+		if err != nil {
+			return nil, fmt.Errorf("can't configure GitHub Enterprise urls: %w", err)
+		}
+	}
 	return &Adapter{
 		client: client,
 		opts:   opts,
 		owner:  owner,
 		repo:   repo,
+		sem:    make(chan struct{}, max(opts.Concurrency, 1)),
+	}, nil
+}
+
+// NewHTTPClient returns an http client to use with the GitHub API at the given base url (empty => api.github.com)
+// with the given transport options, retry policy and (optional) GitHub App authentication
+func NewHTTPClient(baseURL string, transportOpts httpclient.TransportOptions, retryOpts httpclient.RetryOptions, app *AppAuthOptions) (*http.Client, error) {
+	transport, err := httpclient.NewTransport(transportOpts, retryOpts)
+	if err != nil {
+		return nil, err
+	}
+	if app != nil {
+		transport, err = NewAppTransport(transport, baseURL, *app)
+		if err != nil {
+			return nil, err
+		}
 	}
+	return &http.Client{Transport: transport}, nil
+}
+
+// WebBaseURL returns the web base url (without trailing slash) corresponding to the given API base url
+// (example: https://github.example.com/api/v3/ => https://github.example.com)
+// If the API base url is empty, https://github.com is returned.
+func WebBaseURL(baseURL string) (string, error) {
+	if baseURL == "" {
+		return defaultWebBaseURL, nil
+	}
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return "", fmt.Errorf("can't parse the url %s: %w", baseURL, err)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("bad url: %s (scheme and host are mandatory)", baseURL)
+	}
+	if strings.HasPrefix(u.Host, "api.") && u.Host != "api.github.com" {
+		// GitHub Enterprise Cloud with data residency: https://api.octocorp.ghe.com/ => https://octocorp.ghe.com
+		return u.Scheme + "://" + strings.TrimPrefix(u.Host, "api."), nil
+	}
+	if u.Host == "api.github.com" {
+		return defaultWebBaseURL, nil
+	}
+	return u.Scheme + "://" + u.Host, nil
+}
+
+// GraphQLURL returns the GraphQL endpoint corresponding to the given API base url
+// (example: https://github.example.com/api/v3/ => https://github.example.com/api/graphql)
+// If the API base url is empty, https://api.github.com/graphql is returned.
+func GraphQLURL(baseURL string) (string, error) {
+	if baseURL == "" {
+		return "https://api.github.com/graphql", nil
+	}
+	apiBaseURL, err := restBaseURL(baseURL)
+	if err != nil {
+		return "", err
+	}
+	u := *apiBaseURL
+	if strings.HasSuffix(u.Path, "/api/v3/") {
+		u.Path = strings.TrimSuffix(u.Path, "v3/") + "graphql"
+	} else {
+		u.Path += "graphql"
+	}
+	return u.String(), nil
+}
+
+// ctx returns the context to use for GitHub API calls
+//
+// Note: the pre-emptive rate limit check of the go-github client is bypassed
+// because rate limits are handled (with waits and retries) by our http transport
+func (r *Adapter) ctx() context.Context {
+	return context.WithValue(context.Background(), gh.BypassRateLimitCheck, true)
 }
 
 func (r *Adapter) createPullRequestFromGhPr(pr *gh.PullRequest) *repo.PullRequest {
@@ -62,60 +172,236 @@ func (r *Adapter) createPullRequestFromGhPr(pr *gh.PullRequest) *repo.PullReques
 	if pr.UpdatedAt != nil {
 		updatedAt = pr.UpdatedAt.GetTime()
 	}
+	assignees := []string{}
+	for _, assignee := range pr.Assignees {
+		if assignee.Login == nil {
+			continue
+		}
+		assignees = append(assignees, *assignee.Login)
+	}
+	requestedReviewers := []string{}
+	for _, reviewer := range pr.RequestedReviewers {
+		if reviewer.Login == nil {
+			continue
+		}
+		requestedReviewers = append(requestedReviewers, *reviewer.Login)
+	}
+	for _, team := range pr.RequestedTeams {
+		if team.Slug == nil {
+			continue
+		}
+		requestedReviewers = append(requestedReviewers, *team.Slug)
+	}
+	mergeCommitSha := ""
+	if mergedAt != nil {
+		// (for non merged PRs, merge_commit_sha is the test merge commit)
+		mergeCommitSha = pr.GetMergeCommitSHA()
+	}
 	return &repo.PullRequest{
-		Number:      *pr.Number,
-		Title:       *pr.Title,
-		MergedAt:    mergedAt,
-		UpdatedAt:   updatedAt,
-		Labels:      labels,
-		Branch:      *pr.Head.Ref,
-		Url:         *pr.HTMLURL,
-		AuthorLogin: *pr.User.Login,
-		AuthorUrl:   *pr.User.HTMLURL,
+		Number:             *pr.Number,
+		Title:              *pr.Title,
+		MergedAt:           mergedAt,
+		UpdatedAt:          updatedAt,
+		Labels:             labels,
+		Branch:             *pr.Head.Ref,
+		Url:                *pr.HTMLURL,
+		AuthorLogin:        *pr.User.Login,
+		AuthorUrl:          *pr.User.HTMLURL,
+		Body:               pr.GetBody(),
+		Draft:              pr.GetDraft(),
+		Milestone:          pr.GetMilestone().GetTitle(),
+		Assignees:          assignees,
+		RequestedReviewers: requestedReviewers,
+		ApprovingReviewers: []string{}, // not available in the pull requests list (see completePullRequests)
+		BaseBranch:         pr.GetBase().GetRef(),
+		MergeCommitSha:     mergeCommitSha,
+		CreatedAt:          pr.CreatedAt.GetTime(),
+		ClosedAt:           pr.ClosedAt.GetTime(),
+		MergedBy:           pr.GetMergedBy().GetLogin(), // (only available when getting a single PR, see completePullRequests)
+	}
+}
+
+// pullRequestsPage is a page of pull requests returned by the GitHub API
+type pullRequestsPage struct {
+	prs      []*gh.PullRequest
+	nextPage int
+	lastPage int
+}
+
+// listPullRequestsPage returns the given page of pull requests (with the given list options)
+func (r *Adapter) listPullRequestsPage(listOptions gh.PullRequestListOptions, page int, logger *slog.Logger) (*pullRequestsPage, error) {
+	listOptions.Page = page
+	r.sem <- struct{}{}
+	defer func() { <-r.sem }()
+	logger.Debug("fetching pull-requests...", slog.Int("page", page))
+	prs, resp, err := r.client.PullRequests.List(r.ctx(), r.owner, r.repo, &listOptions)
+	if err != nil {
+		return nil, err
 	}
+	return &pullRequestsPage{prs: prs, nextPage: resp.NextPage, lastPage: resp.LastPage}, nil
 }
 
-func (r *Adapter) getPullRequestsSince(state state, base string, sort string, usePagination bool) ([]*repo.PullRequest, error) {
+// listPullRequests returns the list of pull requests (targetting the given base) in the given state
+// sorted by the given sort field (descending)
+//
+// The first page is fetched alone, then (if the Link header gives us the last page) the next pages
+// are fetched in parallel by windows of opts.Concurrency pages (the order of the results is kept).
+//
+// If stopBefore is not nil, the pagination stops as soon as we get a pull request updated before
+// this time (so it's only relevant with sort="updated") and merged pull requests merged before
+// this time are not returned.
+func (r *Adapter) listPullRequests(state state, base string, sort string, usePagination bool, stopBefore *time.Time) ([]*repo.PullRequest, error) {
 	listOptionsState := "open"
 	if state == merged {
 		listOptionsState = "closed"
 	}
-	listOptions := &gh.PullRequestListOptions{
+	listOptions := gh.PullRequestListOptions{
 		State:     listOptionsState,
 		Base:      base,
 		Sort:      sort,
 		Direction: "desc", // we have to force this because the default depends on the sort value!!! (if Sort is "created" or not specified, Default is "desc", otherwise Default is "asc")
 		ListOptions: gh.ListOptions{
-			Page:    1,
 			PerPage: 100,
 		},
 	}
-	logger := slog.Default().With("base", base, "state", string(state), "sort", sort, "page", 1)
+	logger := slog.Default().With("base", base, "state", string(state), "sort", sort)
 	res := []*repo.PullRequest{}
+	nextPage := 1
+	lastPage := 1
+	for nextPage != 0 {
+		// pages to fetch (in parallel) in this window
+		windowEnd := nextPage
+		if nextPage > 1 && lastPage >= nextPage {
+			windowEnd = min(nextPage+cap(r.sem)-1, lastPage)
+		}
+		pages := make([]*pullRequestsPage, windowEnd-nextPage+1)
+		err := parallel(len(pages), func(i int) error {
+			var err error
+			pages[i], err = r.listPullRequestsPage(listOptions, nextPage+i, logger)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		tooOld := false
+		for _, page := range pages {
+			for _, pr := range page.prs {
+				if stopBefore != nil && pr.UpdatedAt != nil && pr.UpdatedAt.Before(*stopBefore) {
+					// a PR merged after stopBefore can't be updated before stopBefore
+					tooOld = true
+					continue
+				}
+				pro := r.createPullRequestFromGhPr(pr)
+				if pro == nil {
+					continue
+				}
+				if state == "merged" && pro.MergedAt == nil {
+					continue
+				}
+				if stopBefore != nil && pro.MergedAt != nil && pro.MergedAt.Before(*stopBefore) {
+					continue
+				}
+				res = append(res, pro)
+			}
+			if tooOld {
+				break
+			}
+		}
+		if tooOld {
+			logger.Debug("pull-requests older than the cutoff found => stop paginating", slog.Time("cutoff", *stopBefore))
+			break
+		}
+		if !usePagination {
+			break
+		}
+		lastFetchedPage := pages[len(pages)-1]
+		nextPage = lastFetchedPage.nextPage
+		if lastFetchedPage.lastPage > 0 {
+			lastPage = lastFetchedPage.lastPage
+		}
+	}
+	logger.Debug("pull-requests fetched", slog.Int("count", len(res)))
+	if r.opts.CompletePullRequests {
+		err := r.completePullRequests(res)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// completePullRequests fills MergedBy (by getting each merged pull request) and ApprovingReviewers
+// (by listing the reviews of each pull request) of the given pull requests
+//
+// Requests are done concurrently (bounded by opts.Concurrency).
+func (r *Adapter) completePullRequests(prs []*repo.PullRequest) error {
+	return parallel(len(prs), func(i int) error {
+		pr := prs[i]
+		r.sem <- struct{}{}
+		defer func() { <-r.sem }()
+		if pr.MergedAt != nil {
+			slog.Debug("fetching pull-request...", slog.Int("number", pr.Number))
+			ghPr, _, err := r.client.PullRequests.Get(r.ctx(), r.owner, r.repo, pr.Number)
+			if err != nil {
+				return fmt.Errorf("can't get the pull request #%d: %w", pr.Number, err)
+			}
+			pr.MergedBy = ghPr.GetMergedBy().GetLogin()
+		}
+		approvingReviewers, err := r.getApprovingReviewers(pr.Number)
+		if err != nil {
+			return fmt.Errorf("can't list the reviews of the pull request #%d: %w", pr.Number, err)
+		}
+		pr.ApprovingReviewers = approvingReviewers
+		return nil
+	})
+}
+
+// getApprovingReviewers returns the logins of the reviewers whose latest opinionated review
+// (approval or change request) of the given pull request is an approval (in order of first review)
+func (r *Adapter) getApprovingReviewers(number int) ([]string, error) {
+	reviewers := []string{}
+	latestStates := map[string]string{}
+	listOptions := gh.ListOptions{PerPage: 100}
 	for {
-		logger := logger.With("page", listOptions.Page)
-		logger.Debug("fetching pull-requests...")
-		prs, resp, err := r.client.PullRequests.List(context.Background(), r.owner, r.repo, listOptions)
+		reviews, resp, err := r.client.PullRequests.ListReviews(r.ctx(), r.owner, r.repo, number, &listOptions)
 		if err != nil {
 			return nil, err
 		}
-		for _, pr := range prs {
-			pro := r.createPullRequestFromGhPr(pr)
-			if pro == nil {
+		for _, review := range reviews {
+			login := review.GetUser().GetLogin()
+			state := review.GetState()
+			if login == "" || (state != "APPROVED" && state != "CHANGES_REQUESTED" && state != "DISMISSED") {
 				continue
 			}
-			if state == "merged" && pro.MergedAt == nil {
-				continue
+			if _, ok := latestStates[login]; !ok {
+				reviewers = append(reviewers, login)
 			}
-			res = append(res, pro)
+			latestStates[login] = state
 		}
-		if !usePagination || resp.NextPage == 0 {
+		if resp.NextPage == 0 {
 			break
 		}
 		listOptions.Page = resp.NextPage
 	}
-	logger.Debug("pull-requests fetched", slog.Int("count", len(res)))
-	return res, nil
+	return slices.DeleteFunc(reviewers, func(login string) bool { return latestStates[login] != "APPROVED" }), nil
+}
+
+// listOpenedAndMergedPullRequests returns opened and merged pull requests (fetched at the same time)
+// (stopBefore is only used for merged pull requests)
+func (r *Adapter) listOpenedAndMergedPullRequests(base string, openedSort string, mergedSort string, usePagination bool, stopBefore *time.Time) (openedPrs []*repo.PullRequest, mergedPrs []*repo.PullRequest, err error) {
+	err = parallel(2, func(i int) error {
+		var err error
+		if i == 0 {
+			openedPrs, err = r.listPullRequests(open, base, openedSort, usePagination, nil)
+		} else {
+			mergedPrs, err = r.listPullRequests(merged, base, mergedSort, usePagination, stopBefore)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return openedPrs, mergedPrs, nil
 }
 
 func sortPRByUpdatedAt(a, b *repo.PullRequest) int {
@@ -134,13 +420,9 @@ func sortPRByUpdatedAt(a, b *repo.PullRequest) int {
 
 func (r *Adapter) GetLastUpdatedPullRequests(base string, onlyMerged bool) ([]*repo.PullRequest, error) {
 	if onlyMerged {
-		return r.getPullRequestsSince(merged, base, "updated", false)
-	}
-	opened, err := r.getPullRequestsSince(open, base, "updated", false)
-	if err != nil {
-		return nil, err
+		return r.listPullRequests(merged, base, "updated", false, nil)
 	}
-	merged, err := r.getPullRequestsSince(merged, base, "updated", false)
+	opened, merged, err := r.listOpenedAndMergedPullRequests(base, "updated", "updated", false, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -154,33 +436,119 @@ func (r *Adapter) GetLastUpdatedPullRequests(base string, onlyMerged bool) ([]*r
 
 func (r *Adapter) GetPullRequests(base string, onlyMerged bool) (res []*repo.PullRequest, err error) {
 	if onlyMerged {
-		return r.getPullRequestsSince(merged, base, "created", true)
+		return r.listPullRequests(merged, base, "created", true, nil)
 	}
-	opened, err := r.getPullRequestsSince(open, base, "created", true)
+	opened, merged, err := r.listOpenedAndMergedPullRequests(base, "created", "created", true, nil)
 	if err != nil {
 		return nil, err
 	}
-	merged, err := r.getPullRequestsSince(merged, base, "created", true)
+	return append(opened, merged...), nil
+}
+
+// GetPullRequestsSince returns merged pull requests merged after the given time
+// (+ all open pull requests if onlyMerged is false)
+//
+// Merged pull requests are read sorted by "last updated" (descending) so we can stop paginating
+// as soon as we get a pull request updated before the given time.
+func (r *Adapter) GetPullRequestsSince(base string, onlyMerged bool, since time.Time) (res []*repo.PullRequest, err error) {
+	if onlyMerged {
+		return r.listPullRequests(merged, base, "updated", true, &since)
+	}
+	opened, merged, err := r.listOpenedAndMergedPullRequests(base, "created", "updated", true, &since)
 	if err != nil {
 		return nil, err
 	}
 	return append(opened, merged...), nil
 }
 
-func (r *Adapter) CreateRelease(base string, tagName string, body string, draft bool) error {
-	makeLatestAsString := "true"
-	prerelease := false
-	_, _, err := r.client.Repositories.CreateRelease(context.Background(), r.owner, r.repo, &gh.RepositoryRelease{
-		TagName:         &tagName,
-		TargetCommitish: &base,
-		Name:            &tagName,
-		Body:            &body,
-		Draft:           &draft,
-		Prerelease:      &prerelease,
-		MakeLatest:      &makeLatestAsString,
-	})
+// newGhRelease returns the GitHub release payload corresponding to the given options
+func newGhRelease(opts repo.ReleaseOptions) *gh.RepositoryRelease {
+	makeLatest := opts.MakeLatest
+	if makeLatest == "" {
+		makeLatest = "true"
+	}
+	return &gh.RepositoryRelease{
+		TagName:         gh.Ptr(opts.TagName),
+		TargetCommitish: gh.Ptr(opts.GetTarget()),
+		Name:            gh.Ptr(opts.GetName()),
+		Body:            gh.Ptr(opts.Body),
+		Draft:           gh.Ptr(opts.Draft),
+		Prerelease:      gh.Ptr(opts.Prerelease),
+		MakeLatest:      gh.Ptr(makeLatest),
+	}
+}
+
+func createReleaseFromGhRelease(release *gh.RepositoryRelease) *repo.Release {
+	return &repo.Release{
+		ID:      release.GetID(),
+		TagName: release.GetTagName(),
+		Name:    release.GetName(),
+		Draft:   release.GetDraft(),
+	}
+}
+
+func (r *Adapter) CreateRelease(opts repo.ReleaseOptions) (*repo.Release, error) {
+	release, _, err := r.client.Repositories.CreateRelease(r.ctx(), r.owner, r.repo, newGhRelease(opts))
 	if err != nil {
-		return err
+		return nil, err
+	}
+	return createReleaseFromGhRelease(release), nil
+}
+
+// GetLastReleases returns the first page of releases (drafts are only returned with push access)
+func (r *Adapter) GetLastReleases() ([]*repo.Release, error) {
+	releases, _, err := r.client.Repositories.ListReleases(r.ctx(), r.owner, r.repo, &gh.ListOptions{PerPage: 100})
+	if err != nil {
+		return nil, fmt.Errorf("can't list the releases: %w", err)
+	}
+	res := []*repo.Release{}
+	for _, release := range releases {
+		res = append(res, createReleaseFromGhRelease(release))
+	}
+	return res, nil
+}
+
+func (r *Adapter) UpdateRelease(release *repo.Release, opts repo.ReleaseOptions) (*repo.Release, error) {
+	updated, _, err := r.client.Repositories.EditRelease(r.ctx(), r.owner, r.repo, release.ID, newGhRelease(opts))
+	if err != nil {
+		return nil, fmt.Errorf("can't update the release %s: %w", release.TagName, err)
+	}
+	return createReleaseFromGhRelease(updated), nil
+}
+
+// UploadReleaseAsset uploads the asset with the upload API (an existing asset with the same name is deleted first)
+func (r *Adapter) UploadReleaseAsset(release *repo.Release, asset repo.ReleaseAsset) error {
+	existing, _, err := r.client.Repositories.ListReleaseAssets(r.ctx(), r.owner, r.repo, release.ID, &gh.ListOptions{PerPage: 100})
+	if err != nil {
+		return fmt.Errorf("can't list the assets of the release %s: %w", release.TagName, err)
+	}
+	for _, a := range existing {
+		if a.GetName() != asset.Name {
+			continue
+		}
+		slog.Debug("deleting the existing release asset", slog.String("name", asset.Name), slog.Int64("id", a.GetID()))
+		_, err = r.client.Repositories.DeleteReleaseAsset(r.ctx(), r.owner, r.repo, a.GetID())
+		if err != nil {
+			return fmt.Errorf("can't delete the existing asset %s: %w", asset.Name, err)
+		}
+	}
+	reader, size, err := asset.Open()
+	if err != nil {
+		return fmt.Errorf("can't read the asset %s: %w", asset.Name, err)
+	}
+	defer reader.Close()
+	u := fmt.Sprintf("repos/%s/%s/releases/%d/assets?name=%s", r.owner, r.repo, release.ID, url.QueryEscape(asset.Name))
+	req, err := r.client.NewUploadRequest(u, reader, size, asset.GetContentType())
+	if err != nil {
+		return fmt.Errorf("can't create the upload request: %w", err)
+	}
+	req.GetBody = func() (io.ReadCloser, error) { // so the request can be retried by our http transport
+		body, _, err := asset.Open()
+		return body, err
+	}
+	_, err = r.client.Do(r.ctx(), req, nil)
+	if err != nil {
+		return fmt.Errorf("can't upload the asset %s: %w", asset.Name, err)
 	}
 	return nil
 }
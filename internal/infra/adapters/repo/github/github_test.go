@@ -0,0 +1,423 @@
+package repogithub
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fabien-marty/github-next-semantic-version/internal/app/repo"
+	"github.com/fabien-marty/github-next-semantic-version/internal/infra/adapters/repo/httpclient"
+	gh "github.com/google/go-github/v70/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebBaseURL(t *testing.T) {
+	tests := []struct {
+		baseURL  string
+		expected string
+	}{
+		{"", "https://github.com"},
+		{"https://api.github.com/", "https://github.com"},
+		{"https://github.example.com/api/v3/", "https://github.example.com"},
+		{"https://github.example.com:8443/api/v3", "https://github.example.com:8443"},
+		{"https://api.octocorp.ghe.com/", "https://octocorp.ghe.com"},
+	}
+	for _, test := range tests {
+		res, err := WebBaseURL(test.baseURL)
+		assert.Nil(t, err, test.baseURL)
+		assert.Equal(t, test.expected, res, test.baseURL)
+	}
+	_, err := WebBaseURL("github.example.com")
+	assert.NotNil(t, err)
+}
+
+func TestGraphQLURL(t *testing.T) {
+	tests := []struct {
+		baseURL  string
+		expected string
+	}{
+		{"", "https://api.github.com/graphql"},
+		{"https://github.example.com/", "https://github.example.com/api/graphql"},
+		{"https://github.example.com/api/v3/", "https://github.example.com/api/graphql"},
+		{"https://api.octocorp.ghe.com/", "https://api.octocorp.ghe.com/graphql"},
+	}
+	for _, test := range tests {
+		res, err := GraphQLURL(test.baseURL)
+		assert.Nil(t, err, test.baseURL)
+		assert.Equal(t, test.expected, res, test.baseURL)
+	}
+}
+
+func TestNewAdapterWithEnterpriseURLs(t *testing.T) {
+	adapter, err := NewAdapter("foo", "bar", AdapterOptions{BaseURL: "https://github.example.com/"})
+	assert.Nil(t, err)
+	assert.Equal(t, "https://github.example.com/api/v3/", adapter.client.BaseURL.String())
+	assert.Equal(t, "https://github.example.com/api/uploads/", adapter.client.UploadURL.String())
+	adapter, err = NewAdapter("foo", "bar", AdapterOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, "https://api.github.com/", adapter.client.BaseURL.String())
+}
+
+type fakePr struct {
+	number    int
+	updatedAt time.Time
+	mergedAt  *time.Time
+}
+
+func (p fakePr) toJSON() map[string]any {
+	res := map[string]any{
+		"number":     p.number,
+		"title":      fmt.Sprintf("PR%d", p.number),
+		"created_at": p.updatedAt.Add(-time.Hour),
+		"updated_at": p.updatedAt,
+		"html_url":   fmt.Sprintf("https://github.com/foo/bar/pull/%d", p.number),
+		"head":       map[string]any{"ref": fmt.Sprintf("branch%d", p.number)},
+		"user":       map[string]any{"login": "user", "html_url": "https://github.com/user"},
+		"labels":     []map[string]any{{"name": "label"}},
+	}
+	if p.mergedAt != nil {
+		res["merged_at"] = *p.mergedAt
+	}
+	return res
+}
+
+// newFakeServer returns a fake GitHub API server serving the given closed pull requests
+// (already sorted by updatedAt descending) with the given page size
+// it returns the server and a pointer to the number of requests received
+func newFakeServer(t *testing.T, closedPrs []fakePr, perPage int) (*httptest.Server, *int) {
+	t.Helper()
+	calls := 0
+	var mu sync.Mutex
+	mux := http.NewServeMux()
+	var server *httptest.Server
+	mux.HandleFunc("/api/v3/repos/foo/bar/pulls", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls++
+		mu.Unlock()
+		prs := []fakePr{}
+		if r.URL.Query().Get("state") == "closed" {
+			prs = closedPrs
+		}
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		if page < 1 {
+			page = 1
+		}
+		start := (page - 1) * perPage
+		end := min(start+perPage, len(prs))
+		body := []map[string]any{}
+		for i := start; i < end; i++ {
+			body = append(body, prs[i].toJSON())
+		}
+		if end < len(prs) {
+			lastPage := (len(prs) + perPage - 1) / perPage
+			w.Header().Set("Link", fmt.Sprintf(`<%s/api/v3/repos/foo/bar/pulls?page=%d>; rel="next", <%s/api/v3/repos/foo/bar/pulls?page=%d>; rel="last"`, server.URL, page+1, server.URL, lastPage))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(body)
+	})
+	mux.HandleFunc("/api/v3/repos/foo/bar/pulls/{number}", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls++
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(w, `{"number": %s, "merged_by": {"login": "merger"}}`, r.PathValue("number"))
+	})
+	mux.HandleFunc("/api/v3/repos/foo/bar/pulls/{number}/reviews", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls++
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`[
+			{"user": {"login": "approver"}, "state": "APPROVED"},
+			{"user": {"login": "grumpy"}, "state": "APPROVED"},
+			{"user": {"login": "commenter"}, "state": "COMMENTED"},
+			{"user": {"login": "grumpy"}, "state": "CHANGES_REQUESTED"},
+			{"user": {"login": "approver"}, "state": "COMMENTED"}
+		]`))
+	})
+	server = httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+func newFakeAdapter(t *testing.T, server *httptest.Server) *Adapter {
+	t.Helper()
+	adapter, err := NewAdapter("foo", "bar", AdapterOptions{BaseURL: server.URL + "/"})
+	require.NoError(t, err)
+	return adapter
+}
+
+func TestGetPullRequestsSinceStopsPaginating(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	closedPrs := []fakePr{}
+	for i := 100; i > 0; i-- { // sorted by updatedAt descending
+		mergedAt := base.Add(time.Duration(i) * time.Hour)
+		closedPrs = append(closedPrs, fakePr{number: i, updatedAt: mergedAt.Add(time.Minute), mergedAt: &mergedAt})
+	}
+	closedPrs = append(closedPrs[:5], append([]fakePr{{number: 1000, updatedAt: base.Add(96 * time.Hour)}}, closedPrs[5:]...)...) // closed but not merged
+	server, calls := newFakeServer(t, closedPrs, 10)
+	adapter := newFakeAdapter(t, server)
+
+	res, err := adapter.GetPullRequestsSince("main", true, base.Add(85*time.Hour+30*time.Minute))
+	assert.Nil(t, err)
+	assert.Equal(t, 15, len(res)) // PRs 86 => 100
+	for _, pr := range res {
+		assert.GreaterOrEqual(t, pr.Number, 86)
+		assert.LessOrEqual(t, pr.Number, 100)
+	}
+	assert.Equal(t, 2, *calls) // we stopped after the second page
+
+	*calls = 0
+	res, err = adapter.GetPullRequests("main", true)
+	assert.Nil(t, err)
+	assert.Equal(t, 100, len(res))
+	assert.Equal(t, 11, *calls)
+}
+
+func TestCreatePullRequestFromGhPr(t *testing.T) {
+	createdAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	mergedAt := createdAt.Add(time.Hour)
+	adapter := &Adapter{}
+	pr := adapter.createPullRequestFromGhPr(&gh.PullRequest{
+		Number:             gh.Ptr(1),
+		Title:              gh.Ptr("title"),
+		Body:               gh.Ptr("body"),
+		Draft:              gh.Ptr(false),
+		CreatedAt:          &gh.Timestamp{Time: createdAt},
+		UpdatedAt:          &gh.Timestamp{Time: mergedAt},
+		MergedAt:           &gh.Timestamp{Time: mergedAt},
+		ClosedAt:           &gh.Timestamp{Time: mergedAt},
+		HTMLURL:            gh.Ptr("https://github.com/foo/bar/pull/1"),
+		Head:               &gh.PullRequestBranch{Ref: gh.Ptr("branch")},
+		Base:               &gh.PullRequestBranch{Ref: gh.Ptr("main")},
+		User:               &gh.User{Login: gh.Ptr("user"), HTMLURL: gh.Ptr("https://github.com/user")},
+		MergedBy:           &gh.User{Login: gh.Ptr("merger")},
+		MergeCommitSHA:     gh.Ptr("sha"),
+		Milestone:          &gh.Milestone{Title: gh.Ptr("v1")},
+		Assignees:          []*gh.User{{Login: gh.Ptr("assignee")}},
+		RequestedReviewers: []*gh.User{{Login: gh.Ptr("reviewer")}},
+		RequestedTeams:     []*gh.Team{{Slug: gh.Ptr("team")}},
+		Labels:             []*gh.Label{{Name: gh.Ptr("label")}},
+	})
+	require.NotNil(t, pr)
+	assert.Equal(t, "body", pr.Body)
+	assert.False(t, pr.Draft)
+	assert.Equal(t, "v1", pr.Milestone)
+	assert.Equal(t, []string{"assignee"}, pr.Assignees)
+	assert.Equal(t, []string{"reviewer", "team"}, pr.RequestedReviewers)
+	assert.Equal(t, []string{}, pr.ApprovingReviewers)
+	assert.Equal(t, "main", pr.BaseBranch)
+	assert.Equal(t, "sha", pr.MergeCommitSha)
+	assert.Equal(t, createdAt, *pr.CreatedAt)
+	assert.Equal(t, mergedAt, *pr.ClosedAt)
+	assert.Equal(t, "merger", pr.MergedBy)
+
+	// not merged => no merge commit sha (it's the test merge commit)
+	pr = adapter.createPullRequestFromGhPr(&gh.PullRequest{
+		Number:         gh.Ptr(2),
+		Title:          gh.Ptr("title"),
+		CreatedAt:      &gh.Timestamp{Time: createdAt},
+		UpdatedAt:      &gh.Timestamp{Time: mergedAt},
+		HTMLURL:        gh.Ptr("https://github.com/foo/bar/pull/2"),
+		Head:           &gh.PullRequestBranch{Ref: gh.Ptr("branch")},
+		User:           &gh.User{Login: gh.Ptr("user"), HTMLURL: gh.Ptr("https://github.com/user")},
+		MergeCommitSHA: gh.Ptr("test-merge-sha"),
+		Draft:          gh.Ptr(true),
+	})
+	require.NotNil(t, pr)
+	assert.Equal(t, "", pr.MergeCommitSha)
+	assert.True(t, pr.Draft)
+	assert.Nil(t, pr.ClosedAt)
+	assert.Equal(t, "", pr.Milestone)
+}
+
+func TestListPullRequestsConcurrently(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	closedPrs := []fakePr{}
+	for i := 100; i > 0; i-- { // sorted by updatedAt descending
+		mergedAt := base.Add(time.Duration(i) * time.Hour)
+		closedPrs = append(closedPrs, fakePr{number: i, updatedAt: mergedAt.Add(time.Minute), mergedAt: &mergedAt})
+	}
+	server, calls := newFakeServer(t, closedPrs, 10)
+	adapter, err := NewAdapter("foo", "bar", AdapterOptions{BaseURL: server.URL + "/", Concurrency: 4})
+	require.NoError(t, err)
+
+	res, err := adapter.GetPullRequests("main", true)
+	require.NoError(t, err)
+	require.Equal(t, 100, len(res))
+	for i, pr := range res {
+		assert.Equal(t, 100-i, pr.Number) // deterministic order
+	}
+	assert.Equal(t, 10, *calls)
+
+	// open and merged
+	*calls = 0
+	res, err = adapter.GetPullRequests("main", false)
+	require.NoError(t, err)
+	assert.Equal(t, 100, len(res))
+	assert.Equal(t, 11, *calls)
+
+	// with a cutoff, we stop at the end of the first window containing a too old PR
+	*calls = 0
+	res, err = adapter.GetPullRequestsSince("main", true, base.Add(85*time.Hour+30*time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 15, len(res)) // PRs 86 => 100
+	assert.Equal(t, 5, *calls)    // page 1 + window of pages 2 => 5
+}
+
+func TestCompletePullRequests(t *testing.T) {
+	mergedAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	closedPrs := []fakePr{{number: 2, updatedAt: mergedAt, mergedAt: &mergedAt}, {number: 1, updatedAt: mergedAt}}
+	server, calls := newFakeServer(t, closedPrs, 10)
+
+	// not completed by default
+	adapter := newFakeAdapter(t, server)
+	res, err := adapter.GetPullRequests("main", true)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(res))
+	assert.Equal(t, "", res[0].MergedBy)
+	assert.Equal(t, []string{}, res[0].ApprovingReviewers)
+	assert.Equal(t, 1, *calls)
+
+	*calls = 0
+	adapter, err = NewAdapter("foo", "bar", AdapterOptions{BaseURL: server.URL + "/", CompletePullRequests: true, Concurrency: 2})
+	require.NoError(t, err)
+	res, err = adapter.GetPullRequests("main", true)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(res))
+	assert.Equal(t, "merger", res[0].MergedBy)
+	assert.Equal(t, []string{"approver"}, res[0].ApprovingReviewers) // (latest opinionated reviews)
+	assert.Equal(t, 3, *calls)                                       // list + PR + reviews
+}
+
+func TestCreateRelease(t *testing.T) {
+	var payload map[string]any
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v3/repos/foo/bar/releases", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte("{}"))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	adapter := newFakeAdapter(t, server)
+
+	_, err := adapter.CreateRelease(repo.ReleaseOptions{Base: "main", TagName: "v1.2.3", Body: "release notes"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{
+		"tag_name":         "v1.2.3",
+		"target_commitish": "main",
+		"name":             "v1.2.3",
+		"body":             "release notes",
+		"draft":            false,
+		"prerelease":       false,
+		"make_latest":      "true",
+	}, payload)
+
+	_, err = adapter.CreateRelease(repo.ReleaseOptions{
+		Base:       "main",
+		TagName:    "v1.3.0-rc1",
+		Name:       "MyApp v1.3.0-rc1",
+		Body:       "release notes",
+		Draft:      true,
+		Prerelease: true,
+		MakeLatest: "legacy",
+		TargetSha:  "012345",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{
+		"tag_name":         "v1.3.0-rc1",
+		"target_commitish": "012345",
+		"name":             "MyApp v1.3.0-rc1",
+		"body":             "release notes",
+		"draft":            true,
+		"prerelease":       true,
+		"make_latest":      "legacy",
+	}, payload)
+}
+
+func TestUploadReleaseAsset(t *testing.T) {
+	calls := []string{}
+	var uploaded, contentType string
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v3/repos/foo/bar/releases/1/assets", func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, "list")
+		_, _ = w.Write([]byte(`[{"id": 5, "name": "foo.txt"}, {"id": 6, "name": "bar.txt"}]`))
+	})
+	mux.HandleFunc("DELETE /api/v3/repos/foo/bar/releases/assets/{id}", func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, "delete "+r.PathValue("id"))
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("POST /api/uploads/repos/foo/bar/releases/1/assets", func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, "upload "+r.URL.Query().Get("name"))
+		body, _ := io.ReadAll(r.Body)
+		uploaded = string(body)
+		contentType = r.Header.Get("Content-Type")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"id": 7}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	adapter := newFakeAdapter(t, server)
+
+	err := adapter.UploadReleaseAsset(&repo.Release{ID: 1, TagName: "v1.2.3"}, repo.ReleaseAsset{Name: "foo.txt", ContentType: "text/plain", Content: []byte("foo")})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"list", "delete 5", "upload foo.txt"}, calls)
+	assert.Equal(t, "foo", uploaded)
+	assert.Equal(t, "text/plain", contentType)
+
+	err = adapter.UploadReleaseAsset(&repo.Release{ID: 2, TagName: "v1.2.4"}, repo.ReleaseAsset{Name: "foo.txt", Content: []byte("foo")})
+	assert.Error(t, err)
+}
+
+func TestGetLastReleasesAndUpdateRelease(t *testing.T) {
+	var payload map[string]any
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v3/repos/foo/bar/releases", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "100", r.URL.Query().Get("per_page"))
+		_, _ = w.Write([]byte(`[{"id": 2, "tag_name": "v1.1.0", "name": "MyApp v1.1.0", "draft": true}, {"id": 1, "tag_name": "v1.0.0", "name": "v1.0.0"}]`))
+	})
+	mux.HandleFunc("PATCH /api/v3/repos/foo/bar/releases/2", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		_, _ = w.Write([]byte(`{"id": 2, "tag_name": "v2.0.0", "name": "v2.0.0", "draft": true}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	adapter := newFakeAdapter(t, server)
+
+	releases, err := adapter.GetLastReleases()
+	require.NoError(t, err)
+	assert.Equal(t, []*repo.Release{
+		{ID: 2, TagName: "v1.1.0", Name: "MyApp v1.1.0", Draft: true},
+		{ID: 1, TagName: "v1.0.0", Name: "v1.0.0"},
+	}, releases)
+
+	updated, err := adapter.UpdateRelease(releases[0], repo.ReleaseOptions{Base: "main", TagName: "v2.0.0", Body: "body", Draft: true})
+	require.NoError(t, err)
+	assert.Equal(t, &repo.Release{ID: 2, TagName: "v2.0.0", Name: "v2.0.0", Draft: true}, updated)
+	assert.Equal(t, "v2.0.0", payload["tag_name"])
+	assert.Equal(t, "main", payload["target_commitish"])
+	assert.Equal(t, "body", payload["body"])
+}
+
+func TestAdapterRateLimitError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset", fmt.Sprintf("%d", time.Now().Add(time.Hour).Unix()))
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`{"message": "API rate limit exceeded"}`))
+	}))
+	defer server.Close()
+	adapter := newFakeAdapter(t, server)
+	_, err := adapter.GetPullRequests("main", true)
+	var rateLimitErr *httpclient.RateLimitError
+	assert.True(t, errors.As(err, &rateLimitErr), err)
+}
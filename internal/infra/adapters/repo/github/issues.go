@@ -0,0 +1,150 @@
+package repogithub
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/fabien-marty/github-next-semantic-version/internal/app/repo"
+	gh "github.com/google/go-github/v70/github"
+)
+
+// closingKeywordsRegex matches GitHub closing keywords followed by an issue reference
+// (#123, owner/repo#123 or https://github.com/owner/repo/issues/123)
+// see https://docs.github.com/en/issues/tracking-your-work-with-issues/using-issues/linking-a-pull-request-to-an-issue
+var closingKeywordsRegex = regexp.MustCompile(`(?i)\b(?:close[sd]?|fix(?:e[sd])?|resolve[sd]?)\s*:?\s+(?:([\w.-]+)/([\w.-]+)#(\d+)|#(\d+)|https?://[^\s/]+/([\w.-]+)/([\w.-]+)/issues/(\d+))`)
+
+// parseClosingIssueNumbers returns the numbers of the issues (of the given repository) closed
+// by the given pull request body (without duplicates, in order of appearance)
+func parseClosingIssueNumbers(body string, owner string, repo string) []int {
+	res := []int{}
+	for _, match := range closingKeywordsRegex.FindAllStringSubmatch(body, -1) {
+		var matchOwner, matchRepo, number string
+		switch {
+		case match[3] != "":
+			matchOwner, matchRepo, number = match[1], match[2], match[3]
+		case match[4] != "":
+			matchOwner, matchRepo, number = owner, repo, match[4]
+		default:
+			matchOwner, matchRepo, number = match[5], match[6], match[7]
+		}
+		if !strings.EqualFold(matchOwner, owner) || !strings.EqualFold(matchRepo, repo) {
+			// issue of another repository
+			continue
+		}
+		n, err := strconv.Atoi(number)
+		if err != nil || slices.Contains(res, n) {
+			continue
+		}
+		res = append(res, n)
+	}
+	return res
+}
+
+// getIssue returns the issue with the given number (nil if it does not exist or if it's a pull request)
+func (r *Adapter) getIssue(number int) (*repo.Issue, error) {
+	r.issuesMu.Lock()
+	defer r.issuesMu.Unlock()
+	if r.issues == nil {
+		r.issues = map[int]*repo.Issue{}
+	}
+	if issue, ok := r.issues[number]; ok {
+		return issue, nil
+	}
+	logger := slog.Default().With(slog.Int("number", number))
+	logger.Debug("fetching issue...")
+	ghIssue, _, err := r.client.Issues.Get(r.ctx(), r.owner, r.repo, number)
+	if err != nil {
+		var errorResponse *gh.ErrorResponse
+		if errors.As(err, &errorResponse) && errorResponse.Response != nil && (errorResponse.Response.StatusCode == http.StatusNotFound || errorResponse.Response.StatusCode == http.StatusGone) {
+			logger.Debug("issue not found (or deleted) => ignoring")
+			r.issues[number] = nil
+			return nil, nil
+		}
+		return nil, fmt.Errorf("can't get the issue #%d: %w", number, err)
+	}
+	var issue *repo.Issue
+	if ghIssue.IsPullRequest() {
+		logger.Debug("this is a pull request, not an issue => ignoring")
+	} else {
+		labels := []string{}
+		for _, label := range ghIssue.Labels {
+			if label.Name == nil {
+				continue
+			}
+			labels = append(labels, *label.Name)
+		}
+		issue = &repo.Issue{
+			Number: number,
+			Title:  ghIssue.GetTitle(),
+			Url:    ghIssue.GetHTMLURL(),
+			Labels: labels,
+		}
+	}
+	r.issues[number] = issue
+	return issue, nil
+}
+
+// GetLinkedIssues returns the issues closed by the given pull request
+//
+// The REST API does not provide the list of closing issues, so we parse the closing keywords
+// in the pull request body (issues linked manually in the UI are not found, use the GraphQL API for that)
+// and we fetch each referenced issue (once per adapter).
+func (r *Adapter) GetLinkedIssues(pr *repo.PullRequest) ([]*repo.Issue, error) {
+	if pr.LinkedIssues != nil {
+		return pr.LinkedIssues, nil
+	}
+	res := []*repo.Issue{}
+	for _, number := range parseClosingIssueNumbers(pr.Body, r.owner, r.repo) {
+		issue, err := r.getIssue(number)
+		if err != nil {
+			return nil, err
+		}
+		if issue != nil {
+			res = append(res, issue)
+		}
+	}
+	return res, nil
+}
+
+// GetPullRequestComments returns the bodies of the issue comments of the given pull request
+// (review comments are not returned)
+func (r *Adapter) GetPullRequestComments(pr *repo.PullRequest) ([]string, error) {
+	res := []string{}
+	opts := &gh.IssueListCommentsOptions{ListOptions: gh.ListOptions{PerPage: 100}}
+	for {
+		comments, resp, err := r.client.Issues.ListComments(r.ctx(), r.owner, r.repo, pr.Number, opts)
+		if err != nil {
+			return nil, fmt.Errorf("can't list the comments of the pull request #%d: %w", pr.Number, err)
+		}
+		for _, comment := range comments {
+			res = append(res, comment.GetBody())
+		}
+		if resp.NextPage == 0 {
+			return res, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+func (r *Adapter) AddPullRequestComment(pr *repo.PullRequest, body string) error {
+	_, _, err := r.client.Issues.CreateComment(r.ctx(), r.owner, r.repo, pr.Number, &gh.IssueComment{Body: &body})
+	if err != nil {
+		return fmt.Errorf("can't comment the pull request #%d: %w", pr.Number, err)
+	}
+	return nil
+}
+
+// AddPullRequestLabel adds the given label to the given pull request (a missing label is created by GitHub)
+func (r *Adapter) AddPullRequestLabel(pr *repo.PullRequest, label string) error {
+	_, _, err := r.client.Issues.AddLabelsToIssue(r.ctx(), r.owner, r.repo, pr.Number, []string{label})
+	if err != nil {
+		return fmt.Errorf("can't add the label %s to the pull request #%d: %w", label, pr.Number, err)
+	}
+	return nil
+}
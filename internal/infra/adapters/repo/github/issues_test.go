@@ -0,0 +1,113 @@
+package repogithub
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fabien-marty/github-next-semantic-version/internal/app/repo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseClosingIssueNumbers(t *testing.T) {
+	tests := []struct {
+		body     string
+		expected []int
+	}{
+		{"", []int{}},
+		{"Fixes #123", []int{123}},
+		{"fix #1, closes #2 and Resolved: #3", []int{1, 2, 3}},
+		{"This PR fixes #12\n\nAlso closes foo/bar#13 and closes FOO/Bar#14", []int{12, 13, 14}},
+		{"resolves https://github.com/foo/bar/issues/15", []int{15}},
+		{"fixes other/repo#16 and https://github.com/other/bar/issues/17", []int{}},
+		{"See #18 (not a closing keyword), prefix#19", []int{}},
+		{"fixes #20, fixes #20", []int{20}},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.expected, parseClosingIssueNumbers(test.body, "foo", "bar"), test.body)
+	}
+}
+
+func TestGetLinkedIssues(t *testing.T) {
+	calls := map[string]int{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v3/repos/foo/bar/issues/{number}", func(w http.ResponseWriter, r *http.Request) {
+		number := r.PathValue("number")
+		calls[number]++
+		w.Header().Set("Content-Type", "application/json")
+		switch number {
+		case "1":
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"number":   1,
+				"title":    "Crash on startup",
+				"html_url": "https://github.com/foo/bar/issues/1",
+				"labels":   []map[string]any{{"name": "bug"}},
+			})
+		case "2":
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"number":       2,
+				"title":        "a pull request",
+				"html_url":     "https://github.com/foo/bar/pull/2",
+				"pull_request": map[string]any{"url": "https://api.github.com/repos/foo/bar/pulls/2"},
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"message": "Not Found"}`))
+		}
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	adapter := newFakeAdapter(t, server)
+
+	expected := []*repo.Issue{{Number: 1, Title: "Crash on startup", Url: "https://github.com/foo/bar/issues/1", Labels: []string{"bug"}}}
+	res, err := adapter.GetLinkedIssues(&repo.PullRequest{Number: 10, Body: "Fixes #1, fixes #2, fixes #3"})
+	require.NoError(t, err)
+	assert.Equal(t, expected, res)
+	res, err = adapter.GetLinkedIssues(&repo.PullRequest{Number: 11, Body: "closes #1"})
+	require.NoError(t, err)
+	assert.Equal(t, expected, res)
+	assert.Equal(t, map[string]int{"1": 1, "2": 1, "3": 1}, calls) // issues are fetched only once
+
+	// already resolved => returned as is
+	res, err = adapter.GetLinkedIssues(&repo.PullRequest{Number: 12, Body: "fixes #4", LinkedIssues: []*repo.Issue{}})
+	require.NoError(t, err)
+	assert.Equal(t, []*repo.Issue{}, res)
+	assert.Equal(t, 0, calls["4"])
+}
+
+func TestPullRequestCommentsAndLabels(t *testing.T) {
+	var comment map[string]any
+	var labels []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v3/repos/foo/bar/issues/1/comments", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("page") == "2" {
+			_, _ = w.Write([]byte(`[{"body": "Released in v1.0.0"}]`))
+			return
+		}
+		w.Header().Set("Link", `<http://`+r.Host+`/api/v3/repos/foo/bar/issues/1/comments?page=2>; rel="next"`)
+		_, _ = w.Write([]byte(`[{"body": "LGTM"}]`))
+	})
+	mux.HandleFunc("POST /api/v3/repos/foo/bar/issues/1/comments", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&comment))
+		_, _ = w.Write([]byte(`{}`))
+	})
+	mux.HandleFunc("POST /api/v3/repos/foo/bar/issues/1/labels", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&labels))
+		_, _ = w.Write([]byte(`[]`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	adapter := newFakeAdapter(t, server)
+	pr := &repo.PullRequest{Number: 1}
+
+	comments, err := adapter.GetPullRequestComments(pr)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"LGTM", "Released in v1.0.0"}, comments)
+	require.NoError(t, adapter.AddPullRequestComment(pr, "Released in v1.1.0"))
+	assert.Equal(t, map[string]any{"body": "Released in v1.1.0"}, comment)
+	require.NoError(t, adapter.AddPullRequestLabel(pr, "released"))
+	assert.Equal(t, []string{"released"}, labels)
+	assert.Error(t, adapter.AddPullRequestComment(&repo.PullRequest{Number: 2}, "foo"))
+}
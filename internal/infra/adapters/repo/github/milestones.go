@@ -0,0 +1,85 @@
+package repogithub
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/fabien-marty/github-next-semantic-version/internal/app/repo"
+	gh "github.com/google/go-github/v70/github"
+)
+
+// createMilestoneFromGhMilestone converts a GitHub milestone (the id is the milestone number)
+func createMilestoneFromGhMilestone(milestone *gh.Milestone) *repo.Milestone {
+	return &repo.Milestone{
+		ID:     int64(milestone.GetNumber()),
+		Title:  milestone.GetTitle(),
+		Closed: milestone.GetState() == "closed",
+	}
+}
+
+func (r *Adapter) GetMilestones() ([]*repo.Milestone, error) {
+	res := []*repo.Milestone{}
+	opts := &gh.MilestoneListOptions{State: "all", ListOptions: gh.ListOptions{PerPage: 100}}
+	for {
+		milestones, resp, err := r.client.Issues.ListMilestones(r.ctx(), r.owner, r.repo, opts)
+		if err != nil {
+			return nil, fmt.Errorf("can't list the milestones: %w", err)
+		}
+		for _, milestone := range milestones {
+			res = append(res, createMilestoneFromGhMilestone(milestone))
+		}
+		if resp.NextPage == 0 {
+			return res, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+func (r *Adapter) CreateMilestone(title string) (*repo.Milestone, error) {
+	milestone, _, err := r.client.Issues.CreateMilestone(r.ctx(), r.owner, r.repo, &gh.Milestone{Title: &title})
+	if err != nil {
+		return nil, fmt.Errorf("can't create the milestone %s: %w", title, err)
+	}
+	return createMilestoneFromGhMilestone(milestone), nil
+}
+
+func (r *Adapter) CloseMilestone(milestone *repo.Milestone) error {
+	_, _, err := r.client.Issues.EditMilestone(r.ctx(), r.owner, r.repo, int(milestone.ID), &gh.Milestone{State: gh.Ptr("closed")})
+	if err != nil {
+		return fmt.Errorf("can't close the milestone %s: %w", milestone.Title, err)
+	}
+	return nil
+}
+
+// GetMilestoneOpenItems returns the open issues and pull requests of the milestone
+// (with the issues API which also returns pull requests)
+func (r *Adapter) GetMilestoneOpenItems(milestone *repo.Milestone) ([]repo.MilestoneItem, error) {
+	res := []repo.MilestoneItem{}
+	opts := &gh.IssueListByRepoOptions{
+		Milestone:   strconv.FormatInt(milestone.ID, 10),
+		State:       "open",
+		ListOptions: gh.ListOptions{PerPage: 100},
+	}
+	for {
+		issues, resp, err := r.client.Issues.ListByRepo(r.ctx(), r.owner, r.repo, opts)
+		if err != nil {
+			return nil, fmt.Errorf("can't list the open issues of the milestone %s: %w", milestone.Title, err)
+		}
+		for _, issue := range issues {
+			res = append(res, repo.MilestoneItem{Number: issue.GetNumber(), PullRequest: issue.IsPullRequest()})
+		}
+		if resp.NextPage == 0 {
+			return res, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+func (r *Adapter) SetMilestone(item repo.MilestoneItem, milestone *repo.Milestone) error {
+	number := int(milestone.ID)
+	_, _, err := r.client.Issues.Edit(r.ctx(), r.owner, r.repo, item.Number, &gh.IssueRequest{Milestone: &number})
+	if err != nil {
+		return fmt.Errorf("can't set the milestone %s on #%d: %w", milestone.Title, item.Number, err)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package repogithub
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fabien-marty/github-next-semantic-version/internal/app/repo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMilestones(t *testing.T) {
+	payloads := map[string]map[string]any{}
+	decode := func(t *testing.T, key string, r *http.Request) {
+		payload := map[string]any{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		payloads[key] = payload
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v3/repos/foo/bar/milestones", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "all", r.URL.Query().Get("state"))
+		_, _ = w.Write([]byte(`[{"number": 1, "title": "v1.0.0", "state": "closed"}, {"number": 2, "title": "v1.1.0", "state": "open"}]`))
+	})
+	mux.HandleFunc("POST /api/v3/repos/foo/bar/milestones", func(w http.ResponseWriter, r *http.Request) {
+		decode(t, "create", r)
+		_, _ = w.Write([]byte(`{"number": 3, "title": "v1.2.0", "state": "open"}`))
+	})
+	mux.HandleFunc("PATCH /api/v3/repos/foo/bar/milestones/2", func(w http.ResponseWriter, r *http.Request) {
+		decode(t, "close", r)
+		_, _ = w.Write([]byte(`{}`))
+	})
+	mux.HandleFunc("GET /api/v3/repos/foo/bar/issues", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "2", r.URL.Query().Get("milestone"))
+		assert.Equal(t, "open", r.URL.Query().Get("state"))
+		_, _ = w.Write([]byte(`[{"number": 10}, {"number": 11, "pull_request": {"url": "https://api.github.com/repos/foo/bar/pulls/11"}}]`))
+	})
+	mux.HandleFunc("PATCH /api/v3/repos/foo/bar/issues/11", func(w http.ResponseWriter, r *http.Request) {
+		decode(t, "set", r)
+		_, _ = w.Write([]byte(`{}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	adapter := newFakeAdapter(t, server)
+
+	milestones, err := adapter.GetMilestones()
+	require.NoError(t, err)
+	assert.Equal(t, []*repo.Milestone{{ID: 1, Title: "v1.0.0", Closed: true}, {ID: 2, Title: "v1.1.0"}}, milestones)
+	next, err := adapter.CreateMilestone("v1.2.0")
+	require.NoError(t, err)
+	assert.Equal(t, &repo.Milestone{ID: 3, Title: "v1.2.0"}, next)
+	assert.Equal(t, map[string]any{"title": "v1.2.0"}, payloads["create"])
+	items, err := adapter.GetMilestoneOpenItems(milestones[1])
+	require.NoError(t, err)
+	assert.Equal(t, []repo.MilestoneItem{{Number: 10}, {Number: 11, PullRequest: true}}, items)
+	require.NoError(t, adapter.SetMilestone(items[1], next))
+	assert.Equal(t, map[string]any{"milestone": float64(3)}, payloads["set"])
+	require.NoError(t, adapter.CloseMilestone(milestones[1]))
+	assert.Equal(t, map[string]any{"state": "closed"}, payloads["close"])
+}
@@ -0,0 +1,24 @@
+package repogithub
+
+import "sync"
+
+// parallel calls fn(0), fn(1)... fn(n-1) concurrently and waits for all of them
+// it returns the error of the smallest index (nil if all calls succeed)
+func parallel(n int, fn func(i int) error) error {
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = fn(i)
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,653 @@
+package repogithubgraphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fabien-marty/github-next-semantic-version/internal/app/repo"
+	"github.com/fabien-marty/github-next-semantic-version/internal/infra/adapters/repo/httpclient"
+)
+
+var _ repo.Port = &Adapter{}
+
+const (
+	perPage = 100
+
+	// maxNodes is the maximum number of nodes a GraphQL query can request
+	// (see https://docs.github.com/en/graphql/overview/rate-limits-and-node-limits-for-the-graphql-api)
+	maxNodes = 500000
+
+	// pullRequestsQuery is the GraphQL query used to list pull requests (one page)
+	//
+	// Note: nested connections are multiplied by the page size in the node count (see maxNodes),
+	// so their sizes are kept small (longer lists are truncated).
+	pullRequestsQuery = `query($owner: String!, $name: String!, $base: String!, $states: [PullRequestState!], $orderField: IssueOrderField!, $first: Int!, $cursor: String) {
+  repository(owner: $owner, name: $name) {
+    pullRequests(baseRefName: $base, states: $states, first: $first, after: $cursor, orderBy: {field: $orderField, direction: DESC}) {
+      pageInfo {
+        hasNextPage
+        endCursor
+      }
+      nodes {
+        number
+        title
+        url
+        body
+        isDraft
+        createdAt
+        updatedAt
+        mergedAt
+        closedAt
+        headRefName
+        baseRefName
+        author {
+          __typename
+          login
+          url
+        }
+        mergedBy {
+          __typename
+          login
+        }
+        mergeCommit {
+          oid
+        }
+        milestone {
+          title
+        }
+        assignees(first: 10) {
+          nodes {
+            login
+          }
+        }
+        reviewRequests(first: 10) {
+          nodes {
+            requestedReviewer {
+              ... on User {
+                login
+              }
+              ... on Team {
+                slug
+              }
+              ... on Mannequin {
+                login
+              }
+              ... on Bot {
+                __typename
+                login
+              }
+            }
+          }
+        }
+        latestOpinionatedReviews(first: 10) {
+          nodes {
+            state
+            author {
+              __typename
+              login
+            }
+          }
+        }
+        labels(first: 100) {
+          nodes {
+            name
+          }
+        }
+        closingIssuesReferences(first: 10) {
+          ...closingIssues
+        }
+      }
+    }
+  }
+}
+` + closingIssuesFragment
+
+	// linkedIssuesQuery is the GraphQL query used to get the issues closed by a single pull request
+	linkedIssuesQuery = `query($owner: String!, $name: String!, $number: Int!) {
+  repository(owner: $owner, name: $name) {
+    pullRequest(number: $number) {
+      closingIssuesReferences(first: 50) {
+        ...closingIssues
+      }
+    }
+  }
+}
+` + closingIssuesFragment
+
+	closingIssuesFragment = `fragment closingIssues on IssueConnection {
+  nodes {
+    number
+    title
+    url
+    labels(first: 20) {
+      nodes {
+        name
+      }
+    }
+  }
+}`
+)
+
+type AdapterOptions struct {
+	Token       string
+	GraphQLURL  string       // GraphQL endpoint, empty => https://api.github.com/graphql
+	WebBaseURL  string       // web base url (without trailing slash), empty => https://github.com (used for deleted users)
+	HTTPClient  *http.Client // http client to use, nil => http.DefaultClient
+	Concurrency int          // max number of concurrent requests when listing pull requests, <=0 => 1 (no concurrency)
+}
+
+// Adapter is a repo adapter using the GitHub GraphQL API to read pull requests
+// (releases are created with the given release adapter because there is no GraphQL mutation for that)
+//
+// Pull requests are more complete than the ones returned by the REST adapter (repogithub) when
+// listing: MergedBy, ApprovingReviewers and LinkedIssues are filled from the same query (the REST
+// adapter needs extra requests to get them, see repogithub.AdapterOptions.CompletePullRequests).
+// Other fields are the same with both adapters (bot logins included, the "[bot]" suffix of the REST API
+// is added to the GraphQL ones).
+type Adapter struct {
+	opts           AdapterOptions
+	owner          string
+	repo           string
+	releaseAdapter repo.Port
+	sem            chan struct{} // semaphore to limit the number of concurrent requests
+}
+
+func NewAdapter(owner string, repo string, releaseAdapter repo.Port, opts AdapterOptions) *Adapter {
+	if opts.GraphQLURL == "" {
+		opts.GraphQLURL = "https://api.github.com/graphql"
+	}
+	if opts.WebBaseURL == "" {
+		opts.WebBaseURL = "https://github.com"
+	}
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = http.DefaultClient
+	}
+	return &Adapter{
+		opts:           opts,
+		owner:          owner,
+		repo:           repo,
+		releaseAdapter: releaseAdapter,
+		sem:            make(chan struct{}, max(opts.Concurrency, 1)),
+	}
+}
+
+type graphqlRequest struct {
+	Query     string         `json:"query"`
+	Variables map[string]any `json:"variables"`
+}
+
+type graphqlError struct {
+	Message string `json:"message"`
+	Type    string `json:"type"`
+}
+
+type graphqlLogin struct {
+	Typename string `json:"__typename"`
+	Login    string `json:"login"`
+}
+
+// login returns the login like the REST API does (with a "[bot]" suffix for bots)
+func (l *graphqlLogin) login() string {
+	if l.Typename == "Bot" {
+		return l.Login + "[bot]"
+	}
+	return l.Login
+}
+
+type graphqlPullRequest struct {
+	Number      int        `json:"number"`
+	Title       string     `json:"title"`
+	Url         string     `json:"url"`
+	Body        string     `json:"body"`
+	IsDraft     bool       `json:"isDraft"`
+	CreatedAt   *time.Time `json:"createdAt"`
+	UpdatedAt   *time.Time `json:"updatedAt"`
+	MergedAt    *time.Time `json:"mergedAt"`
+	ClosedAt    *time.Time `json:"closedAt"`
+	HeadRefName string     `json:"headRefName"`
+	BaseRefName string     `json:"baseRefName"`
+	Author      *struct {
+		graphqlLogin
+		Url string `json:"url"`
+	} `json:"author"`
+	MergedBy    *graphqlLogin `json:"mergedBy"`
+	MergeCommit *struct {
+		Oid string `json:"oid"`
+	} `json:"mergeCommit"`
+	Milestone *struct {
+		Title string `json:"title"`
+	} `json:"milestone"`
+	Assignees struct {
+		Nodes []graphqlLogin `json:"nodes"`
+	} `json:"assignees"`
+	ReviewRequests struct {
+		Nodes []struct {
+			RequestedReviewer *struct {
+				graphqlLogin
+				Slug string `json:"slug"`
+			} `json:"requestedReviewer"`
+		} `json:"nodes"`
+	} `json:"reviewRequests"`
+	LatestOpinionatedReviews struct {
+		Nodes []struct {
+			State  string        `json:"state"`
+			Author *graphqlLogin `json:"author"`
+		} `json:"nodes"`
+	} `json:"latestOpinionatedReviews"`
+	Labels struct {
+		Nodes []struct {
+			Name string `json:"name"`
+		} `json:"nodes"`
+	} `json:"labels"`
+	ClosingIssuesReferences graphqlIssues `json:"closingIssuesReferences"`
+}
+
+type graphqlIssues struct {
+	Nodes []struct {
+		Number int    `json:"number"`
+		Title  string `json:"title"`
+		Url    string `json:"url"`
+		Labels struct {
+			Nodes []struct {
+				Name string `json:"name"`
+			} `json:"nodes"`
+		} `json:"labels"`
+	} `json:"nodes"`
+}
+
+func (i *graphqlIssues) toIssues() []*repo.Issue {
+	res := []*repo.Issue{}
+	for _, node := range i.Nodes {
+		labels := []string{}
+		for _, label := range node.Labels.Nodes {
+			labels = append(labels, label.Name)
+		}
+		res = append(res, &repo.Issue{
+			Number: node.Number,
+			Title:  node.Title,
+			Url:    node.Url,
+			Labels: labels,
+		})
+	}
+	return res
+}
+
+type graphqlLinkedIssuesResponse struct {
+	Data struct {
+		Repository *struct {
+			PullRequest *struct {
+				ClosingIssuesReferences graphqlIssues `json:"closingIssuesReferences"`
+			} `json:"pullRequest"`
+		} `json:"repository"`
+	} `json:"data"`
+	Errors []graphqlError `json:"errors"`
+}
+
+type graphqlPullRequestsResponse struct {
+	Data struct {
+		Repository *struct {
+			PullRequests struct {
+				PageInfo struct {
+					HasNextPage bool   `json:"hasNextPage"`
+					EndCursor   string `json:"endCursor"`
+				} `json:"pageInfo"`
+				Nodes []graphqlPullRequest `json:"nodes"`
+			} `json:"pullRequests"`
+		} `json:"repository"`
+	} `json:"data"`
+	Errors []graphqlError `json:"errors"`
+}
+
+// query executes the given GraphQL query and decodes the response into res
+func (r *Adapter) query(query string, variables map[string]any, res any) error {
+	payload, err := json.Marshal(graphqlRequest{Query: query, Variables: variables})
+	if err != nil {
+		return fmt.Errorf("can't encode the GraphQL request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, r.opts.GraphQLURL, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("can't create the GraphQL request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	req.Header["X-Idempotency-Key"] = nil // read-only queries => safe to retry on 5xx errors (see net/http.Transport)
+	if r.opts.Token != "" {
+		req.Header.Set("Authorization", "bearer "+r.opts.Token)
+	}
+	resp, err := r.opts.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("can't execute the GraphQL request: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("can't read the GraphQL response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("bad status code for the GraphQL request: %d (body: %s)", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	err = json.Unmarshal(body, res)
+	if err != nil {
+		return fmt.Errorf("can't decode the GraphQL response: %w", err)
+	}
+	return nil
+}
+
+// newGraphqlErrors returns a Go error from the given (not empty) list of GraphQL errors
+// (a *httpclient.RateLimitError if we hit a rate limit, it's retried by the retry transport if any,
+// see httpclient.NewRetryTransport)
+func newGraphqlErrors(errors []graphqlError) error {
+	messages := []string{}
+	for _, e := range errors {
+		if e.Type == httpclient.GraphQLRateLimitedType {
+			return &httpclient.RateLimitError{StatusCode: http.StatusOK, Message: e.Message}
+		}
+		messages = append(messages, e.Message)
+	}
+	return fmt.Errorf("GraphQL errors: %s", strings.Join(messages, ", "))
+}
+
+func (r *Adapter) createPullRequestFromGraphqlPr(pr *graphqlPullRequest) *repo.PullRequest {
+	if pr.Number == 0 || pr.UpdatedAt == nil || pr.Url == "" {
+		return nil
+	}
+	labels := []string{}
+	for _, label := range pr.Labels.Nodes {
+		labels = append(labels, label.Name)
+	}
+	authorLogin := "ghost" // deleted users are returned as null authors by the GraphQL API (and as "ghost" by the REST one)
+	authorUrl := r.opts.WebBaseURL + "/ghost"
+	if pr.Author != nil {
+		authorLogin = pr.Author.login()
+		authorUrl = pr.Author.Url
+	}
+	assignees := []string{}
+	for _, assignee := range pr.Assignees.Nodes {
+		assignees = append(assignees, assignee.login())
+	}
+	requestedReviewers := []string{}
+	for _, request := range pr.ReviewRequests.Nodes {
+		if request.RequestedReviewer == nil {
+			continue
+		}
+		if request.RequestedReviewer.Login != "" {
+			requestedReviewers = append(requestedReviewers, request.RequestedReviewer.login())
+		} else if request.RequestedReviewer.Slug != "" {
+			requestedReviewers = append(requestedReviewers, request.RequestedReviewer.Slug)
+		}
+	}
+	approvingReviewers := []string{}
+	for _, review := range pr.LatestOpinionatedReviews.Nodes {
+		if review.State == "APPROVED" && review.Author != nil {
+			approvingReviewers = append(approvingReviewers, review.Author.login())
+		}
+	}
+	milestone := ""
+	if pr.Milestone != nil {
+		milestone = pr.Milestone.Title
+	}
+	mergeCommitSha := ""
+	if pr.MergedAt != nil && pr.MergeCommit != nil {
+		mergeCommitSha = pr.MergeCommit.Oid
+	}
+	mergedBy := ""
+	if pr.MergedBy != nil {
+		mergedBy = pr.MergedBy.login()
+	}
+	return &repo.PullRequest{
+		Number:             pr.Number,
+		Title:              pr.Title,
+		MergedAt:           pr.MergedAt,
+		UpdatedAt:          pr.UpdatedAt,
+		Labels:             labels,
+		Branch:             pr.HeadRefName,
+		Url:                pr.Url,
+		AuthorLogin:        authorLogin,
+		AuthorUrl:          authorUrl,
+		Body:               pr.Body,
+		Draft:              pr.IsDraft,
+		Milestone:          milestone,
+		Assignees:          assignees,
+		RequestedReviewers: requestedReviewers,
+		ApprovingReviewers: approvingReviewers,
+		BaseBranch:         pr.BaseRefName,
+		MergeCommitSha:     mergeCommitSha,
+		CreatedAt:          pr.CreatedAt,
+		ClosedAt:           pr.ClosedAt,
+		MergedBy:           mergedBy,
+		LinkedIssues:       pr.ClosingIssuesReferences.toIssues(),
+	}
+}
+
+// listPullRequests returns the list of pull requests (targetting the given base) in the given
+// GraphQL state (OPEN or MERGED) sorted by the given order field (CREATED_AT or UPDATED_AT, descending)
+//
+// If stopBefore is not nil, the pagination stops as soon as we get a pull request updated before
+// this time (so it's only relevant with orderField=UPDATED_AT) and merged pull requests merged before
+// this time are not returned.
+func (r *Adapter) listPullRequests(state string, base string, orderField string, usePagination bool, stopBefore *time.Time) ([]*repo.PullRequest, error) {
+	variables := map[string]any{
+		"owner":      r.owner,
+		"name":       r.repo,
+		"base":       base,
+		"states":     []string{state},
+		"orderField": orderField,
+		"first":      perPage,
+		"cursor":     nil,
+	}
+	logger := slog.Default().With("base", base, "state", state, "orderField", orderField)
+	res := []*repo.PullRequest{}
+	for page := 1; ; page++ {
+		logger := logger.With("page", page)
+		logger.Debug("fetching pull-requests (GraphQL)...")
+		var resp graphqlPullRequestsResponse
+		r.sem <- struct{}{}
+		err := r.query(pullRequestsQuery, variables, &resp)
+		<-r.sem
+		if err != nil {
+			return nil, err
+		}
+		if len(resp.Errors) > 0 {
+			return nil, newGraphqlErrors(resp.Errors)
+		}
+		if resp.Data.Repository == nil {
+			return nil, fmt.Errorf("repository %s/%s not found", r.owner, r.repo)
+		}
+		tooOld := false
+		for i := range resp.Data.Repository.PullRequests.Nodes {
+			pr := &resp.Data.Repository.PullRequests.Nodes[i]
+			if stopBefore != nil && pr.UpdatedAt != nil && pr.UpdatedAt.Before(*stopBefore) {
+				// a PR merged after stopBefore can't be updated before stopBefore
+				tooOld = true
+				continue
+			}
+			pro := r.createPullRequestFromGraphqlPr(pr)
+			if pro == nil {
+				continue
+			}
+			if stopBefore != nil && pro.MergedAt != nil && pro.MergedAt.Before(*stopBefore) {
+				continue
+			}
+			res = append(res, pro)
+		}
+		if tooOld {
+			logger.Debug("pull-requests older than the cutoff found => stop paginating", slog.Time("cutoff", *stopBefore))
+			break
+		}
+		pageInfo := resp.Data.Repository.PullRequests.PageInfo
+		if !usePagination || !pageInfo.HasNextPage {
+			break
+		}
+		variables["cursor"] = pageInfo.EndCursor
+	}
+	logger.Debug("pull-requests fetched", slog.Int("count", len(res)))
+	return res, nil
+}
+
+func sortPRByUpdatedAt(a, b *repo.PullRequest) int {
+	if (a == nil) || (b == nil) {
+		panic("can't be nil")
+	}
+	if (a.UpdatedAt == nil) || (b.UpdatedAt == nil) {
+		panic("UpdateAt can't be nil")
+	}
+	if a.UpdatedAt.Before(*b.UpdatedAt) {
+		return -1
+	} else {
+		return 1
+	}
+}
+
+// listOpenedAndMergedPullRequests lists open and merged pull requests (at the same time if opts.Concurrency > 1)
+// (stopBefore only applies to merged pull requests)
+func (r *Adapter) listOpenedAndMergedPullRequests(base string, openedOrderField string, mergedOrderField string, usePagination bool, stopBefore *time.Time) (opened []*repo.PullRequest, merged []*repo.PullRequest, err error) {
+	var openedErr, mergedErr error
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		opened, openedErr = r.listPullRequests("OPEN", base, openedOrderField, usePagination, nil)
+	}()
+	merged, mergedErr = r.listPullRequests("MERGED", base, mergedOrderField, usePagination, stopBefore)
+	wg.Wait()
+	if openedErr != nil {
+		return nil, nil, openedErr
+	}
+	if mergedErr != nil {
+		return nil, nil, mergedErr
+	}
+	return opened, merged, nil
+}
+
+func (r *Adapter) GetLastUpdatedPullRequests(base string, onlyMerged bool) ([]*repo.PullRequest, error) {
+	if onlyMerged {
+		return r.listPullRequests("MERGED", base, "UPDATED_AT", false, nil)
+	}
+	opened, merged, err := r.listOpenedAndMergedPullRequests(base, "UPDATED_AT", "UPDATED_AT", false, nil)
+	if err != nil {
+		return nil, err
+	}
+	tmp := []*repo.PullRequest{}
+	tmp = append(tmp, opened...)
+	tmp = append(tmp, merged...)
+	slices.SortFunc(tmp, sortPRByUpdatedAt)
+	slices.Reverse(tmp)
+	return tmp, nil
+}
+
+func (r *Adapter) GetPullRequests(base string, onlyMerged bool) ([]*repo.PullRequest, error) {
+	if onlyMerged {
+		return r.listPullRequests("MERGED", base, "CREATED_AT", true, nil)
+	}
+	opened, merged, err := r.listOpenedAndMergedPullRequests(base, "CREATED_AT", "CREATED_AT", true, nil)
+	if err != nil {
+		return nil, err
+	}
+	return append(opened, merged...), nil
+}
+
+// GetPullRequestsSince returns merged pull requests merged after the given time
+// (+ all open pull requests if onlyMerged is false)
+//
+// Merged pull requests are read sorted by "last updated" (descending) so we can stop paginating
+// as soon as we get a pull request updated before the given time.
+func (r *Adapter) GetPullRequestsSince(base string, onlyMerged bool, since time.Time) ([]*repo.PullRequest, error) {
+	if onlyMerged {
+		return r.listPullRequests("MERGED", base, "UPDATED_AT", true, &since)
+	}
+	opened, merged, err := r.listOpenedAndMergedPullRequests(base, "CREATED_AT", "UPDATED_AT", true, &since)
+	if err != nil {
+		return nil, err
+	}
+	return append(opened, merged...), nil
+}
+
+// GetLinkedIssues returns the issues closed by the given pull request
+// (they are already resolved when listing pull requests with this adapter, so a request
+// is only done for pull requests coming from somewhere else)
+func (r *Adapter) GetLinkedIssues(pr *repo.PullRequest) ([]*repo.Issue, error) {
+	if pr.LinkedIssues != nil {
+		return pr.LinkedIssues, nil
+	}
+	var resp graphqlLinkedIssuesResponse
+	err := r.query(linkedIssuesQuery, map[string]any{"owner": r.owner, "name": r.repo, "number": pr.Number}, &resp)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Errors) > 0 {
+		return nil, newGraphqlErrors(resp.Errors)
+	}
+	if resp.Data.Repository == nil || resp.Data.Repository.PullRequest == nil {
+		return nil, fmt.Errorf("pull request %s/%s#%d not found", r.owner, r.repo, pr.Number)
+	}
+	return resp.Data.Repository.PullRequest.ClosingIssuesReferences.toIssues(), nil
+}
+
+func (r *Adapter) CreateRelease(opts repo.ReleaseOptions) (*repo.Release, error) {
+	// pass-through (there is no GraphQL mutation to create a release)
+	return r.releaseAdapter.CreateRelease(opts)
+}
+
+func (r *Adapter) GetLastReleases() ([]*repo.Release, error) {
+	// pass-through
+	return r.releaseAdapter.GetLastReleases()
+}
+
+func (r *Adapter) UpdateRelease(release *repo.Release, opts repo.ReleaseOptions) (*repo.Release, error) {
+	// pass-through (there is no GraphQL mutation to update a release)
+	return r.releaseAdapter.UpdateRelease(release, opts)
+}
+
+func (r *Adapter) UploadReleaseAsset(release *repo.Release, asset repo.ReleaseAsset) error {
+	// pass-through (there is no GraphQL mutation to upload a release asset)
+	return r.releaseAdapter.UploadReleaseAsset(release, asset)
+}
+
+func (r *Adapter) GetPullRequestComments(pr *repo.PullRequest) ([]string, error) {
+	// pass-through
+	return r.releaseAdapter.GetPullRequestComments(pr)
+}
+
+func (r *Adapter) AddPullRequestComment(pr *repo.PullRequest, body string) error {
+	// pass-through
+	return r.releaseAdapter.AddPullRequestComment(pr, body)
+}
+
+func (r *Adapter) AddPullRequestLabel(pr *repo.PullRequest, label string) error {
+	// pass-through
+	return r.releaseAdapter.AddPullRequestLabel(pr, label)
+}
+
+func (r *Adapter) GetMilestones() ([]*repo.Milestone, error) {
+	// pass-through
+	return r.releaseAdapter.GetMilestones()
+}
+
+func (r *Adapter) CreateMilestone(title string) (*repo.Milestone, error) {
+	// pass-through
+	return r.releaseAdapter.CreateMilestone(title)
+}
+
+func (r *Adapter) CloseMilestone(milestone *repo.Milestone) error {
+	// pass-through
+	return r.releaseAdapter.CloseMilestone(milestone)
+}
+
+func (r *Adapter) GetMilestoneOpenItems(milestone *repo.Milestone) ([]repo.MilestoneItem, error) {
+	// pass-through
+	return r.releaseAdapter.GetMilestoneOpenItems(milestone)
+}
+
+func (r *Adapter) SetMilestone(item repo.MilestoneItem, milestone *repo.Milestone) error {
+	// pass-through
+	return r.releaseAdapter.SetMilestone(item, milestone)
+}
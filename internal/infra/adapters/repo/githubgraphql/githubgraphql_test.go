@@ -0,0 +1,475 @@
+package repogithubgraphql
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fabien-marty/github-next-semantic-version/internal/app/repo"
+	repogithub "github.com/fabien-marty/github-next-semantic-version/internal/infra/adapters/repo/github"
+	"github.com/fabien-marty/github-next-semantic-version/internal/infra/adapters/repo/httpclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakePr struct {
+	number    int
+	updatedAt time.Time
+	mergedAt  *time.Time
+	ghost     bool
+	bot       bool // if true, the author, the merger, a reviewer and the approver are bots
+}
+
+func (p fakePr) toJSON() map[string]any {
+	res := map[string]any{
+		"number":      p.number,
+		"title":       fmt.Sprintf("PR%d", p.number),
+		"url":         fmt.Sprintf("https://github.com/foo/bar/pull/%d", p.number),
+		"body":        "body",
+		"createdAt":   p.updatedAt.Add(-time.Hour),
+		"updatedAt":   p.updatedAt,
+		"mergedAt":    p.mergedAt,
+		"closedAt":    p.mergedAt,
+		"headRefName": fmt.Sprintf("branch%d", p.number),
+		"baseRefName": "main",
+		"author":      map[string]any{"login": "user", "url": "https://github.com/user"},
+		"mergedBy":    map[string]any{"login": "merger"},
+		"mergeCommit": map[string]any{"oid": fmt.Sprintf("sha%d", p.number)},
+		"milestone":   map[string]any{"title": "v1"},
+		"assignees":   map[string]any{"nodes": []map[string]any{{"login": "assignee"}}},
+		"reviewRequests": map[string]any{"nodes": []map[string]any{
+			{"requestedReviewer": map[string]any{"login": "reviewer"}},
+			{"requestedReviewer": map[string]any{"slug": "team"}},
+		}},
+		"latestOpinionatedReviews": map[string]any{"nodes": []map[string]any{
+			{"state": "APPROVED", "author": map[string]any{"login": "approver"}},
+			{"state": "CHANGES_REQUESTED", "author": map[string]any{"login": "grumpy"}},
+		}},
+		"labels":                  map[string]any{"nodes": []map[string]any{{"name": "label"}}},
+		"closingIssuesReferences": fakeIssues(p.number),
+	}
+	if p.ghost {
+		res["author"] = nil
+	}
+	if p.bot {
+		res["author"] = map[string]any{"__typename": "Bot", "login": "dependabot", "url": "https://github.com/apps/dependabot"}
+		res["mergedBy"] = map[string]any{"__typename": "Bot", "login": "mergify"}
+		res["reviewRequests"] = map[string]any{"nodes": []map[string]any{
+			{"requestedReviewer": map[string]any{"__typename": "Bot", "login": "copilot-pull-request-reviewer"}},
+			{"requestedReviewer": map[string]any{"slug": "team"}},
+		}}
+		res["latestOpinionatedReviews"] = map[string]any{"nodes": []map[string]any{
+			{"state": "APPROVED", "author": map[string]any{"__typename": "Bot", "login": "approver-bot"}},
+		}}
+	}
+	return res
+}
+
+func fakeIssues(prNumber int) map[string]any {
+	return map[string]any{"nodes": []map[string]any{{
+		"number": prNumber * 10,
+		"title":  fmt.Sprintf("Issue%d", prNumber*10),
+		"url":    fmt.Sprintf("https://github.com/foo/bar/issues/%d", prNumber*10),
+		"labels": map[string]any{"nodes": []map[string]any{{"name": "bug"}}},
+	}}}
+}
+
+// newFakeServer returns a fake GitHub GraphQL server serving the given merged pull requests
+// (already sorted by updatedAt descending) with the given page size
+// it returns the server and a pointer to the number of requests received
+func newFakeServer(t *testing.T, mergedPrs []fakePr, perPage int) (*httptest.Server, *int) {
+	t.Helper()
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		assert.Equal(t, "/api/graphql", r.URL.Path)
+		assert.Equal(t, "bearer token", r.Header.Get("Authorization"))
+		var req struct {
+			Variables struct {
+				Owner  string   `json:"owner"`
+				Name   string   `json:"name"`
+				States []string `json:"states"`
+				Cursor *string  `json:"cursor"`
+				Number *int     `json:"number"`
+			} `json:"variables"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		w.Header().Set("Content-Type", "application/json")
+		if req.Variables.Owner != "foo" || req.Variables.Name != "bar" {
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"data":   map[string]any{"repository": nil},
+				"errors": []map[string]any{{"type": "NOT_FOUND", "message": "Could not resolve to a Repository"}},
+			})
+			return
+		}
+		if req.Variables.Number != nil {
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"data": map[string]any{
+					"repository": map[string]any{
+						"pullRequest": map[string]any{"closingIssuesReferences": fakeIssues(*req.Variables.Number)},
+					},
+				},
+			})
+			return
+		}
+		prs := []fakePr{}
+		if req.Variables.States[0] == "MERGED" {
+			prs = mergedPrs
+		}
+		start := 0
+		if req.Variables.Cursor != nil {
+			start, _ = strconv.Atoi(*req.Variables.Cursor)
+		}
+		end := min(start+perPage, len(prs))
+		nodes := []map[string]any{}
+		for i := start; i < end; i++ {
+			nodes = append(nodes, prs[i].toJSON())
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"data": map[string]any{
+				"repository": map[string]any{
+					"pullRequests": map[string]any{
+						"pageInfo": map[string]any{"hasNextPage": end < len(prs), "endCursor": strconv.Itoa(end)},
+						"nodes":    nodes,
+					},
+				},
+			},
+		})
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+func newFakeAdapter(server *httptest.Server, owner string) *Adapter {
+	return NewAdapter(owner, "bar", nil, AdapterOptions{
+		Token:      "token",
+		GraphQLURL: server.URL + "/api/graphql",
+		WebBaseURL: "https://github.com",
+	})
+}
+
+func newMergedPrs(base time.Time, count int) []fakePr {
+	res := []fakePr{}
+	for i := count; i > 0; i-- { // sorted by updatedAt descending
+		mergedAt := base.Add(time.Duration(i) * time.Hour)
+		res = append(res, fakePr{number: i, updatedAt: mergedAt.Add(time.Minute), mergedAt: &mergedAt, ghost: i == 1, bot: i == 2})
+	}
+	return res
+}
+
+func TestGetPullRequests(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	server, calls := newFakeServer(t, newMergedPrs(base, 25), 10)
+	adapter := newFakeAdapter(server, "foo")
+
+	res, err := adapter.GetPullRequests("main", true)
+	assert.Nil(t, err)
+	assert.Equal(t, 25, len(res))
+	assert.Equal(t, 3, *calls)
+	updatedAt := base.Add(25*time.Hour + time.Minute)
+	mergedAt := base.Add(25 * time.Hour)
+	createdAt := updatedAt.Add(-time.Hour)
+	// same mapping as the REST adapter (for shared fields)
+	assert.Equal(t, &repo.PullRequest{
+		Number:             25,
+		Title:              "PR25",
+		MergedAt:           &mergedAt,
+		UpdatedAt:          &updatedAt,
+		Labels:             []string{"label"},
+		Branch:             "branch25",
+		Url:                "https://github.com/foo/bar/pull/25",
+		AuthorLogin:        "user",
+		AuthorUrl:          "https://github.com/user",
+		Body:               "body",
+		Milestone:          "v1",
+		Assignees:          []string{"assignee"},
+		RequestedReviewers: []string{"reviewer", "team"},
+		ApprovingReviewers: []string{"approver"},
+		BaseBranch:         "main",
+		MergeCommitSha:     "sha25",
+		CreatedAt:          &createdAt,
+		ClosedAt:           &mergedAt,
+		MergedBy:           "merger",
+		LinkedIssues: []*repo.Issue{
+			{Number: 250, Title: "Issue250", Url: "https://github.com/foo/bar/issues/250", Labels: []string{"bug"}},
+		},
+	}, res[0])
+	// bots (like with the REST API)
+	assert.Equal(t, "dependabot[bot]", res[23].AuthorLogin)
+	assert.Equal(t, "https://github.com/apps/dependabot", res[23].AuthorUrl)
+	assert.Equal(t, "mergify[bot]", res[23].MergedBy)
+	assert.Equal(t, []string{"copilot-pull-request-reviewer[bot]", "team"}, res[23].RequestedReviewers)
+	assert.Equal(t, []string{"approver-bot[bot]"}, res[23].ApprovingReviewers)
+	// deleted user
+	assert.Equal(t, "ghost", res[24].AuthorLogin)
+	assert.Equal(t, "https://github.com/ghost", res[24].AuthorUrl)
+
+	*calls = 0
+	res, err = adapter.GetPullRequests("main", false)
+	assert.Nil(t, err)
+	assert.Equal(t, 25, len(res))
+	assert.Equal(t, 4, *calls) // 1 for open PRs + 3 for merged ones
+
+	*calls = 0
+	res, err = adapter.GetLastUpdatedPullRequests("main", true)
+	assert.Nil(t, err)
+	assert.Equal(t, 10, len(res)) // first page only
+	assert.Equal(t, 1, *calls)
+}
+
+func TestGetPullRequestsSinceStopsPaginating(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	server, calls := newFakeServer(t, newMergedPrs(base, 100), 10)
+	adapter := newFakeAdapter(server, "foo")
+
+	res, err := adapter.GetPullRequestsSince("main", true, base.Add(85*time.Hour+30*time.Minute))
+	assert.Nil(t, err)
+	assert.Equal(t, 15, len(res)) // PRs 86 => 100
+	for _, pr := range res {
+		assert.GreaterOrEqual(t, pr.Number, 86)
+		assert.LessOrEqual(t, pr.Number, 100)
+	}
+	assert.Equal(t, 2, *calls) // we stopped after the second page
+}
+
+func TestGraphQLErrors(t *testing.T) {
+	server, _ := newFakeServer(t, nil, 10)
+	adapter := newFakeAdapter(server, "unknown")
+	_, err := adapter.GetPullRequests("main", true)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Could not resolve to a Repository")
+
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Bad credentials", http.StatusUnauthorized)
+	}))
+	defer server.Close()
+	adapter = newFakeAdapter(server, "foo")
+	_, err = adapter.GetPullRequests("main", true)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "401")
+
+	// rate limits (returned with a 200 status code) => typed error (retried by the retry transport)
+	calls := 0
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		if calls == 1 {
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Unix(), 10))
+			_, _ = w.Write([]byte(`{"data": null, "errors": [{"type": "RATE_LIMITED", "message": "API rate limit exceeded"}]}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"data": {"repository": {"pullRequests": {"pageInfo": {"hasNextPage": false}, "nodes": []}}}}`))
+	}))
+	defer server.Close()
+	adapter = newFakeAdapter(server, "foo")
+	_, err = adapter.GetPullRequests("main", true)
+	var rateLimitErr *httpclient.RateLimitError
+	require.True(t, errors.As(err, &rateLimitErr))
+	assert.Equal(t, "API rate limit exceeded", rateLimitErr.Message)
+	calls = 0
+	adapter.opts.HTTPClient = &http.Client{Transport: httpclient.NewRetryTransport(nil, httpclient.RetryOptions{MaxRetries: 1, MaxWait: time.Hour})}
+	_, err = adapter.GetPullRequests("main", true)
+	require.NoError(t, err)
+	assert.Equal(t, 2, calls)
+}
+
+func TestGetLinkedIssues(t *testing.T) {
+	server, calls := newFakeServer(t, nil, 10)
+	adapter := newFakeAdapter(server, "foo")
+
+	// already resolved => no request
+	issues := []*repo.Issue{{Number: 1}}
+	res, err := adapter.GetLinkedIssues(&repo.PullRequest{Number: 1, LinkedIssues: issues})
+	assert.Nil(t, err)
+	assert.Equal(t, issues, res)
+	assert.Equal(t, 0, *calls)
+
+	res, err = adapter.GetLinkedIssues(&repo.PullRequest{Number: 3})
+	assert.Nil(t, err)
+	assert.Equal(t, []*repo.Issue{{Number: 30, Title: "Issue30", Url: "https://github.com/foo/bar/issues/30", Labels: []string{"bug"}}}, res)
+	assert.Equal(t, 1, *calls)
+}
+
+// queryNodeCost returns the maximum number of nodes requested by the given GraphQL query (with GitHub rules:
+// each connection counts its page size multiplied by the page sizes of its parent connections)
+//
+// Fragment spreads must be expanded before and "first" variables are given in the vars map.
+func queryNodeCost(t *testing.T, query string, vars map[string]int) int {
+	t.Helper()
+	firstRegex := regexp.MustCompile(`(?:^|[^$\w])first:\s*(\$?\w+)`)
+	total := 0
+	stack := []int{1}
+	parenDepth := 0
+	segment := strings.Builder{}
+	for _, c := range query {
+		switch {
+		case c == '(':
+			parenDepth++
+		case c == ')':
+			parenDepth--
+		case c == '{' && parenDepth == 0:
+			multiplier := stack[len(stack)-1]
+			if match := firstRegex.FindStringSubmatch(segment.String()); match != nil {
+				first, ok := vars[match[1]]
+				if !ok {
+					var err error
+					first, err = strconv.Atoi(match[1])
+					require.NoError(t, err)
+				}
+				multiplier *= first
+				total += multiplier
+			}
+			stack = append(stack, multiplier)
+			segment.Reset()
+			continue
+		case c == '}' && parenDepth == 0:
+			stack = stack[:len(stack)-1]
+			segment.Reset()
+			continue
+		}
+		segment.WriteRune(c)
+	}
+	return total
+}
+
+func TestQueriesNodeCost(t *testing.T) {
+	fragmentBody := closingIssuesFragment[strings.Index(closingIssuesFragment, "{"):]
+	expand := func(query string) string {
+		return strings.ReplaceAll(strings.TrimSuffix(query, closingIssuesFragment), "...closingIssues", fragmentBody)
+	}
+	assert.Equal(t, 100+100*100+100*10+100*10*20, queryNodeCost(t, "{ a(first: 100) { b(first: 100) { c } d(first: 10) { e(first: 20) { f } } } }", nil))
+
+	cost := queryNodeCost(t, expand(pullRequestsQuery), map[string]int{"$first": perPage})
+	assert.Greater(t, cost, perPage)
+	assert.Less(t, cost, maxNodes, "the pull requests query is too expensive: %d nodes", cost)
+	cost = queryNodeCost(t, expand(linkedIssuesQuery), nil)
+	assert.Less(t, cost, maxNodes, "the linked issues query is too expensive: %d nodes", cost)
+}
+
+// newFakeRestServer returns a fake GitHub REST server serving the given merged pull requests
+// (with the same data as the fake GraphQL server)
+func newFakeRestServer(t *testing.T, mergedPrs []fakePr) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v3/repos/foo/bar/pulls", func(w http.ResponseWriter, r *http.Request) {
+		prs := []map[string]any{}
+		if r.URL.Query().Get("state") == "closed" {
+			for _, pr := range mergedPrs {
+				user := map[string]any{"login": "user", "html_url": "https://github.com/user", "type": "User"}
+				reviewer := map[string]any{"login": "reviewer"}
+				if pr.bot {
+					user = map[string]any{"login": "dependabot[bot]", "html_url": "https://github.com/apps/dependabot", "type": "Bot"}
+					reviewer = map[string]any{"login": "copilot-pull-request-reviewer[bot]", "type": "Bot"}
+				}
+				prs = append(prs, map[string]any{
+					"number":              pr.number,
+					"title":               fmt.Sprintf("PR%d", pr.number),
+					"html_url":            fmt.Sprintf("https://github.com/foo/bar/pull/%d", pr.number),
+					"body":                "body",
+					"created_at":          pr.updatedAt.Add(-time.Hour),
+					"updated_at":          pr.updatedAt,
+					"merged_at":           pr.mergedAt,
+					"closed_at":           pr.mergedAt,
+					"head":                map[string]any{"ref": fmt.Sprintf("branch%d", pr.number)},
+					"base":                map[string]any{"ref": "main"},
+					"user":                user,
+					"merge_commit_sha":    fmt.Sprintf("sha%d", pr.number),
+					"milestone":           map[string]any{"title": "v1"},
+					"assignees":           []map[string]any{{"login": "assignee"}},
+					"requested_reviewers": []map[string]any{reviewer},
+					"requested_teams":     []map[string]any{{"slug": "team"}},
+					"labels":              []map[string]any{{"name": "label"}},
+				})
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(prs)
+	})
+	isBot := func(r *http.Request) bool {
+		number, _ := strconv.Atoi(r.PathValue("number"))
+		return slices.ContainsFunc(mergedPrs, func(pr fakePr) bool { return pr.number == number && pr.bot })
+	}
+	mux.HandleFunc("/api/v3/repos/foo/bar/pulls/{number}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		mergedBy := "merger"
+		if isBot(r) {
+			mergedBy = "mergify[bot]"
+		}
+		_, _ = fmt.Fprintf(w, `{"number": %s, "merged_by": {"login": %q}}`, r.PathValue("number"), mergedBy)
+	})
+	mux.HandleFunc("/api/v3/repos/foo/bar/pulls/{number}/reviews", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if isBot(r) {
+			_, _ = w.Write([]byte(`[{"user": {"login": "approver-bot[bot]", "type": "Bot"}, "state": "APPROVED"}]`))
+			return
+		}
+		_, _ = w.Write([]byte(`[{"user": {"login": "approver"}, "state": "APPROVED"}, {"user": {"login": "grumpy"}, "state": "CHANGES_REQUESTED"}]`))
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestRestParity(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	mergedPrs := newMergedPrs(base, 5)[:4] // (without the ghost one, with a bot one)
+	graphqlServer, _ := newFakeServer(t, mergedPrs, 10)
+	restServer := newFakeRestServer(t, mergedPrs)
+	graphqlPrs, err := newFakeAdapter(graphqlServer, "foo").GetPullRequests("main", true)
+	require.NoError(t, err)
+
+	for _, complete := range []bool{false, true} {
+		restAdapter, err := repogithub.NewAdapter("foo", "bar", repogithub.AdapterOptions{BaseURL: restServer.URL + "/api/v3/", CompletePullRequests: complete})
+		require.NoError(t, err)
+		restPrs, err := restAdapter.GetPullRequests("main", true)
+		require.NoError(t, err)
+		require.Equal(t, len(graphqlPrs), len(restPrs))
+		for i, pr := range graphqlPrs {
+			// documented differences (see the Adapter doc comments)
+			expected := *pr
+			expected.LinkedIssues = nil
+			if !complete {
+				expected.ApprovingReviewers = []string{}
+				expected.MergedBy = ""
+			}
+			assert.Equal(t, &expected, restPrs[i])
+		}
+	}
+}
+
+func TestConcurrency(t *testing.T) {
+	for _, concurrency := range []int{1, 2} {
+		t.Run(strconv.Itoa(concurrency), func(t *testing.T) {
+			var mu sync.Mutex
+			inFlight, maxInFlight := 0, 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				inFlight++
+				maxInFlight = max(maxInFlight, inFlight)
+				mu.Unlock()
+				time.Sleep(50 * time.Millisecond)
+				mu.Lock()
+				inFlight--
+				mu.Unlock()
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(`{"data": {"repository": {"pullRequests": {"pageInfo": {"hasNextPage": false}, "nodes": []}}}}`))
+			}))
+			t.Cleanup(server.Close)
+			adapter := NewAdapter("foo", "bar", nil, AdapterOptions{GraphQLURL: server.URL, Concurrency: concurrency})
+
+			_, err := adapter.GetPullRequests("main", false)
+			require.NoError(t, err)
+			assert.Equal(t, concurrency, maxInFlight)
+		})
+	}
+}
@@ -0,0 +1,581 @@
+package repogitlab
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fabien-marty/github-next-semantic-version/internal/app/repo"
+	"github.com/fabien-marty/github-next-semantic-version/internal/infra/adapters/repo/httpclient"
+)
+
+var _ repo.Port = &Adapter{}
+
+const (
+	perPage = 100
+
+	defaultBaseURL = "https://gitlab.com/api/v4/"
+
+	releaseAssetsPackage = "release-assets" // name of the generic package where release assets are uploaded
+)
+
+type state string
+
+const (
+	opened state = "opened"
+	merged state = "merged"
+)
+
+type AdapterOptions struct {
+	Token      string       // personal, group or project access token (empty => anonymous)
+	BaseURL    string       // API base url (example: https://gitlab.example.com/api/v4/), empty => https://gitlab.com/api/v4/
+	HTTPClient *http.Client // http client to use, nil => http.DefaultClient
+}
+
+// authenticate sets the authentication headers of the given API request (PRIVATE-TOKEN header)
+func (o AdapterOptions) authenticate(req *http.Request) {
+	if o.Token != "" {
+		req.Header.Set("PRIVATE-TOKEN", o.Token)
+	}
+}
+
+// Adapter is a repo adapter using the GitLab REST API (merge requests are mapped to pull requests)
+//
+// The repository owner is the full namespace of the project (it can contain subgroups: group/subgroup).
+type Adapter struct {
+	opts    AdapterOptions
+	baseURL *url.URL
+	api     *httpclient.APIClient
+	owner   string
+	repo    string
+}
+
+func NewAdapter(owner string, repo string, opts AdapterOptions) (*Adapter, error) {
+	if opts.BaseURL == "" {
+		opts.BaseURL = defaultBaseURL
+	}
+	baseURL, err := url.Parse(opts.BaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("can't parse the GitLab base url %s: %w", opts.BaseURL, err)
+	}
+	if baseURL.Scheme == "" || baseURL.Host == "" {
+		return nil, fmt.Errorf("bad GitLab base url: %s (scheme and host are mandatory)", opts.BaseURL)
+	}
+	if !strings.HasSuffix(baseURL.Path, "/") {
+		baseURL.Path += "/"
+	}
+	return &Adapter{
+		opts:    opts,
+		baseURL: baseURL,
+		api:     httpclient.NewAPIClient("GitLab", baseURL, opts.HTTPClient, opts.authenticate),
+		owner:   owner,
+		repo:    repo,
+	}, nil
+}
+
+// WebBaseURL returns the web base url (without trailing slash) corresponding to the given API base url
+// (example: https://gitlab.example.com/api/v4/ => https://gitlab.example.com)
+// If the API base url is empty, https://gitlab.com is returned.
+func WebBaseURL(baseURL string) (string, error) {
+	if baseURL == "" {
+		baseURL = defaultBaseURL
+	}
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return "", fmt.Errorf("can't parse the url %s: %w", baseURL, err)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("bad url: %s (scheme and host are mandatory)", baseURL)
+	}
+	path := strings.TrimSuffix(strings.TrimSuffix(u.Path, "/"), "/api/v4")
+	return u.Scheme + "://" + u.Host + path, nil
+}
+
+// projectPath returns the (escaped) API path of the project
+func (r *Adapter) projectPath() string {
+	return "projects/" + url.PathEscape(r.owner+"/"+r.repo)
+}
+
+// request executes an API request on the given path (relative to the base url) and decodes
+// the JSON response into res (if not nil, see httpclient.APIClient.Request)
+func (r *Adapter) request(method string, path string, query url.Values, payload any, res any) (*http.Response, error) {
+	return r.api.Request(method, path, query, payload, res)
+}
+
+type gitlabUser struct {
+	Username string `json:"username"`
+	WebURL   string `json:"web_url"`
+}
+
+type gitlabMergeRequest struct {
+	IID            int          `json:"iid"`
+	Title          string       `json:"title"`
+	Description    string       `json:"description"`
+	WebURL         string       `json:"web_url"`
+	Draft          bool         `json:"draft"`
+	Labels         []string     `json:"labels"`
+	SourceBranch   string       `json:"source_branch"`
+	TargetBranch   string       `json:"target_branch"`
+	MergeCommitSha string       `json:"merge_commit_sha"`
+	SquashSha      string       `json:"squash_commit_sha"`
+	CreatedAt      *time.Time   `json:"created_at"`
+	UpdatedAt      *time.Time   `json:"updated_at"`
+	MergedAt       *time.Time   `json:"merged_at"`
+	ClosedAt       *time.Time   `json:"closed_at"`
+	Author         *gitlabUser  `json:"author"`
+	MergeUser      *gitlabUser  `json:"merge_user"`
+	MergedBy       *gitlabUser  `json:"merged_by"` // deprecated (replaced by merge_user in GitLab 14.7)
+	Assignees      []gitlabUser `json:"assignees"`
+	Reviewers      []gitlabUser `json:"reviewers"`
+	Milestone      *struct {
+		Title string `json:"title"`
+	} `json:"milestone"`
+}
+
+type gitlabIssue struct {
+	IID    int      `json:"iid"`
+	Title  string   `json:"title"`
+	WebURL string   `json:"web_url"`
+	Labels []string `json:"labels"`
+}
+
+func usernames(users []gitlabUser) []string {
+	res := []string{}
+	for _, user := range users {
+		res = append(res, user.Username)
+	}
+	return res
+}
+
+func (r *Adapter) createPullRequestFromGitlabMr(mr *gitlabMergeRequest) *repo.PullRequest {
+	if mr.IID == 0 || mr.UpdatedAt == nil || mr.WebURL == "" || mr.Author == nil {
+		return nil
+	}
+	labels := mr.Labels
+	if labels == nil {
+		labels = []string{}
+	}
+	milestone := ""
+	if mr.Milestone != nil {
+		milestone = mr.Milestone.Title
+	}
+	mergeCommitSha := ""
+	mergedBy := ""
+	if mr.MergedAt != nil {
+		mergeCommitSha = mr.MergeCommitSha
+		if mergeCommitSha == "" {
+			// fast-forward merge with squash
+			mergeCommitSha = mr.SquashSha
+		}
+		if mr.MergeUser != nil {
+			mergedBy = mr.MergeUser.Username
+		} else if mr.MergedBy != nil {
+			mergedBy = mr.MergedBy.Username
+		}
+	}
+	return &repo.PullRequest{
+		Number:             mr.IID,
+		Title:              mr.Title,
+		MergedAt:           mr.MergedAt,
+		UpdatedAt:          mr.UpdatedAt,
+		Labels:             labels,
+		Branch:             mr.SourceBranch,
+		Url:                mr.WebURL,
+		AuthorLogin:        mr.Author.Username,
+		AuthorUrl:          mr.Author.WebURL,
+		Body:               mr.Description,
+		Draft:              mr.Draft,
+		Milestone:          milestone,
+		Assignees:          usernames(mr.Assignees),
+		RequestedReviewers: usernames(mr.Reviewers),
+		ApprovingReviewers: []string{}, // not available in merge requests lists
+		BaseBranch:         mr.TargetBranch,
+		MergeCommitSha:     mergeCommitSha,
+		CreatedAt:          mr.CreatedAt,
+		ClosedAt:           mr.ClosedAt,
+		MergedBy:           mergedBy,
+	}
+}
+
+// listMergeRequests returns the list of merge requests (targetting the given base) in the given state
+// sorted by the given order field (created_at or updated_at, descending)
+//
+// If stopBefore is not nil, the pagination stops as soon as we get a merge request updated before
+// this time (so it's only relevant with orderBy="updated_at") and merge requests merged before
+// this time are not returned.
+func (r *Adapter) listMergeRequests(state state, base string, orderBy string, usePagination bool, stopBefore *time.Time) ([]*repo.PullRequest, error) {
+	query := url.Values{}
+	query.Set("state", string(state))
+	query.Set("target_branch", base)
+	query.Set("order_by", orderBy)
+	query.Set("sort", "desc")
+	query.Set("per_page", strconv.Itoa(perPage))
+	logger := slog.Default().With("base", base, "state", string(state), "orderBy", orderBy)
+	res := []*repo.PullRequest{}
+	page := "1"
+	for {
+		logger := logger.With("page", page)
+		logger.Debug("fetching merge-requests...")
+		query.Set("page", page)
+		var mrs []gitlabMergeRequest
+		resp, err := r.request(http.MethodGet, r.projectPath()+"/merge_requests", query, nil, &mrs)
+		if err != nil {
+			return nil, err
+		}
+		tooOld := false
+		for i := range mrs {
+			mr := &mrs[i]
+			if stopBefore != nil && mr.UpdatedAt != nil && mr.UpdatedAt.Before(*stopBefore) {
+				// a MR merged after stopBefore can't be updated before stopBefore
+				tooOld = true
+				continue
+			}
+			pr := r.createPullRequestFromGitlabMr(mr)
+			if pr == nil {
+				continue
+			}
+			if state == merged && pr.MergedAt == nil {
+				continue
+			}
+			if stopBefore != nil && pr.MergedAt != nil && pr.MergedAt.Before(*stopBefore) {
+				continue
+			}
+			res = append(res, pr)
+		}
+		if tooOld {
+			logger.Debug("merge-requests older than the cutoff found => stop paginating", slog.Time("cutoff", *stopBefore))
+			break
+		}
+		page = resp.Header.Get("X-Next-Page")
+		if !usePagination || page == "" {
+			break
+		}
+	}
+	logger.Debug("merge-requests fetched", slog.Int("count", len(res)))
+	return res, nil
+}
+
+func sortPRByUpdatedAt(a, b *repo.PullRequest) int {
+	return a.UpdatedAt.Compare(*b.UpdatedAt)
+}
+
+func (r *Adapter) GetLastUpdatedPullRequests(base string, onlyMerged bool) ([]*repo.PullRequest, error) {
+	if onlyMerged {
+		return r.listMergeRequests(merged, base, "updated_at", false, nil)
+	}
+	opened, err := r.listMergeRequests(opened, base, "updated_at", false, nil)
+	if err != nil {
+		return nil, err
+	}
+	merged, err := r.listMergeRequests(merged, base, "updated_at", false, nil)
+	if err != nil {
+		return nil, err
+	}
+	tmp := []*repo.PullRequest{}
+	tmp = append(tmp, opened...)
+	tmp = append(tmp, merged...)
+	slices.SortFunc(tmp, sortPRByUpdatedAt)
+	slices.Reverse(tmp)
+	return tmp, nil
+}
+
+func (r *Adapter) GetPullRequests(base string, onlyMerged bool) ([]*repo.PullRequest, error) {
+	if onlyMerged {
+		return r.listMergeRequests(merged, base, "created_at", true, nil)
+	}
+	opened, err := r.listMergeRequests(opened, base, "created_at", true, nil)
+	if err != nil {
+		return nil, err
+	}
+	merged, err := r.listMergeRequests(merged, base, "created_at", true, nil)
+	if err != nil {
+		return nil, err
+	}
+	return append(opened, merged...), nil
+}
+
+// GetPullRequestsSince returns merge requests merged after the given time
+// (+ all open merge requests if onlyMerged is false)
+//
+// Merged merge requests are read sorted by "last updated" (descending) so we can stop paginating
+// as soon as we get a merge request updated before the given time.
+func (r *Adapter) GetPullRequestsSince(base string, onlyMerged bool, since time.Time) ([]*repo.PullRequest, error) {
+	if onlyMerged {
+		return r.listMergeRequests(merged, base, "updated_at", true, &since)
+	}
+	opened, err := r.listMergeRequests(opened, base, "created_at", true, nil)
+	if err != nil {
+		return nil, err
+	}
+	merged, err := r.listMergeRequests(merged, base, "updated_at", true, &since)
+	if err != nil {
+		return nil, err
+	}
+	return append(opened, merged...), nil
+}
+
+// GetLinkedIssues returns the issues closed by the given merge request (on merge)
+func (r *Adapter) GetLinkedIssues(pr *repo.PullRequest) ([]*repo.Issue, error) {
+	if pr.LinkedIssues != nil {
+		return pr.LinkedIssues, nil
+	}
+	query := url.Values{}
+	query.Set("per_page", strconv.Itoa(perPage))
+	var issues []gitlabIssue
+	_, err := r.request(http.MethodGet, fmt.Sprintf("%s/merge_requests/%d/closes_issues", r.projectPath(), pr.Number), query, nil, &issues)
+	if err != nil {
+		return nil, fmt.Errorf("can't get the issues closed by the merge request !%d: %w", pr.Number, err)
+	}
+	res := []*repo.Issue{}
+	for _, issue := range issues {
+		labels := issue.Labels
+		if labels == nil {
+			labels = []string{}
+		}
+		res = append(res, &repo.Issue{
+			Number: issue.IID,
+			Title:  issue.Title,
+			Url:    issue.WebURL,
+			Labels: labels,
+		})
+	}
+	return res, nil
+}
+
+// CreateRelease creates a GitLab release (and the corresponding tag on the base branch if it doesn't exist)
+//
+// GitLab doesn't support draft releases, so an error is returned if draft is true.
+func (r *Adapter) CreateRelease(opts repo.ReleaseOptions) (*repo.Release, error) {
+	if opts.Draft {
+		return nil, fmt.Errorf("draft releases are not supported by GitLab")
+	}
+	_, err := r.request(http.MethodPost, r.projectPath()+"/releases", nil, map[string]any{
+		"tag_name":    opts.TagName,
+		"ref":         opts.GetTarget(),
+		"name":        opts.GetName(),
+		"description": opts.Body,
+	}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("can't create the GitLab release %s: %w", opts.TagName, err)
+	}
+	return &repo.Release{TagName: opts.TagName, Name: opts.GetName()}, nil
+}
+
+// GetLastReleases returns the first page of releases (GitLab has no draft releases)
+func (r *Adapter) GetLastReleases() ([]*repo.Release, error) {
+	var releases []struct {
+		TagName string `json:"tag_name"`
+		Name    string `json:"name"`
+	}
+	_, err := r.request(http.MethodGet, r.projectPath()+"/releases", url.Values{"per_page": {strconv.Itoa(perPage)}}, nil, &releases)
+	if err != nil {
+		return nil, fmt.Errorf("can't list the GitLab releases: %w", err)
+	}
+	res := []*repo.Release{}
+	for _, release := range releases {
+		res = append(res, &repo.Release{TagName: release.TagName, Name: release.Name})
+	}
+	return res, nil
+}
+
+// UpdateRelease updates the name and the description of the release
+//
+// GitLab releases are identified by their tag, so an error is returned if the tag name (or the target) changes.
+func (r *Adapter) UpdateRelease(release *repo.Release, opts repo.ReleaseOptions) (*repo.Release, error) {
+	if opts.TagName != release.TagName {
+		return nil, fmt.Errorf("can't retag the GitLab release %s (to %s)", release.TagName, opts.TagName)
+	}
+	if opts.Draft {
+		return nil, fmt.Errorf("draft releases are not supported by GitLab")
+	}
+	_, err := r.request(http.MethodPut, r.projectPath()+"/releases/"+url.PathEscape(release.TagName), nil, map[string]any{
+		"name":        opts.GetName(),
+		"description": opts.Body,
+	}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("can't update the GitLab release %s: %w", release.TagName, err)
+	}
+	return &repo.Release{TagName: release.TagName, Name: opts.GetName()}, nil
+}
+
+// UploadReleaseAsset uploads the asset to the generic package registry of the project
+// (package: release-assets, version: the tag name) and links it to the release
+// (an existing link with the same name is deleted first)
+func (r *Adapter) UploadReleaseAsset(release *repo.Release, asset repo.ReleaseAsset) error {
+	content, err := asset.ReadAll()
+	if err != nil {
+		return fmt.Errorf("can't read the asset %s: %w", asset.Name, err)
+	}
+	packagePath := r.projectPath() + "/packages/generic/" + releaseAssetsPackage + "/" + url.PathEscape(release.TagName) + "/" + url.PathEscape(asset.Name)
+	_, err = r.request(http.MethodPut, packagePath, nil, httpclient.RawPayload{ContentType: asset.GetContentType(), Content: content}, nil)
+	if err != nil {
+		return fmt.Errorf("can't upload the asset %s: %w", asset.Name, err)
+	}
+	linksPath := r.projectPath() + "/releases/" + url.PathEscape(release.TagName) + "/assets/links"
+	var existing []struct {
+		ID   int64  `json:"id"`
+		Name string `json:"name"`
+	}
+	_, err = r.request(http.MethodGet, linksPath, nil, nil, &existing)
+	if err != nil {
+		return fmt.Errorf("can't list the asset links of the release %s: %w", release.TagName, err)
+	}
+	for _, link := range existing {
+		if link.Name != asset.Name {
+			continue
+		}
+		slog.Debug("deleting the existing release asset link", slog.String("name", asset.Name), slog.Int64("id", link.ID))
+		_, err = r.request(http.MethodDelete, linksPath+"/"+strconv.FormatInt(link.ID, 10), nil, nil, nil)
+		if err != nil {
+			return fmt.Errorf("can't delete the existing asset link %s: %w", asset.Name, err)
+		}
+	}
+	_, err = r.request(http.MethodPost, linksPath, nil, map[string]any{
+		"name":      asset.Name,
+		"url":       r.baseURL.String() + packagePath,
+		"link_type": "package",
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("can't link the asset %s to the release %s: %w", asset.Name, release.TagName, err)
+	}
+	return nil
+}
+
+// GetPullRequestComments returns the bodies of the (non-system) notes of the given merge request
+func (r *Adapter) GetPullRequestComments(pr *repo.PullRequest) ([]string, error) {
+	query := url.Values{}
+	query.Set("per_page", strconv.Itoa(perPage))
+	query.Set("order_by", "created_at")
+	query.Set("sort", "asc")
+	res := []string{}
+	page := "1"
+	for page != "" {
+		query.Set("page", page)
+		var notes []struct {
+			Body   string `json:"body"`
+			System bool   `json:"system"`
+		}
+		resp, err := r.request(http.MethodGet, fmt.Sprintf("%s/merge_requests/%d/notes", r.projectPath(), pr.Number), query, nil, &notes)
+		if err != nil {
+			return nil, fmt.Errorf("can't list the notes of the merge request !%d: %w", pr.Number, err)
+		}
+		for _, note := range notes {
+			if !note.System {
+				res = append(res, note.Body)
+			}
+		}
+		page = resp.Header.Get("X-Next-Page")
+	}
+	return res, nil
+}
+
+func (r *Adapter) AddPullRequestComment(pr *repo.PullRequest, body string) error {
+	_, err := r.request(http.MethodPost, fmt.Sprintf("%s/merge_requests/%d/notes", r.projectPath(), pr.Number), nil, map[string]any{"body": body}, nil)
+	if err != nil {
+		return fmt.Errorf("can't comment the merge request !%d: %w", pr.Number, err)
+	}
+	return nil
+}
+
+// AddPullRequestLabel adds the given label to the given merge request (a missing label is created by GitLab)
+func (r *Adapter) AddPullRequestLabel(pr *repo.PullRequest, label string) error {
+	_, err := r.request(http.MethodPut, fmt.Sprintf("%s/merge_requests/%d", r.projectPath(), pr.Number), nil, map[string]any{"add_labels": label}, nil)
+	if err != nil {
+		return fmt.Errorf("can't add the label %s to the merge request !%d: %w", label, pr.Number, err)
+	}
+	return nil
+}
+
+// gitlabMilestone is a GitLab (project) milestone
+type gitlabMilestone struct {
+	ID    int64  `json:"id"`
+	Title string `json:"title"`
+	State string `json:"state"`
+}
+
+func (m gitlabMilestone) toMilestone() *repo.Milestone {
+	return &repo.Milestone{ID: m.ID, Title: m.Title, Closed: m.State == "closed"}
+}
+
+// GetMilestones returns the project milestones (group milestones are not returned)
+func (r *Adapter) GetMilestones() ([]*repo.Milestone, error) {
+	query := url.Values{}
+	query.Set("per_page", strconv.Itoa(perPage))
+	res := []*repo.Milestone{}
+	page := "1"
+	for page != "" {
+		query.Set("page", page)
+		var milestones []gitlabMilestone
+		resp, err := r.request(http.MethodGet, r.projectPath()+"/milestones", query, nil, &milestones)
+		if err != nil {
+			return nil, fmt.Errorf("can't list the GitLab milestones: %w", err)
+		}
+		for _, milestone := range milestones {
+			res = append(res, milestone.toMilestone())
+		}
+		page = resp.Header.Get("X-Next-Page")
+	}
+	return res, nil
+}
+
+func (r *Adapter) CreateMilestone(title string) (*repo.Milestone, error) {
+	var milestone gitlabMilestone
+	_, err := r.request(http.MethodPost, r.projectPath()+"/milestones", nil, map[string]any{"title": title}, &milestone)
+	if err != nil {
+		return nil, fmt.Errorf("can't create the GitLab milestone %s: %w", title, err)
+	}
+	return milestone.toMilestone(), nil
+}
+
+func (r *Adapter) CloseMilestone(milestone *repo.Milestone) error {
+	_, err := r.request(http.MethodPut, fmt.Sprintf("%s/milestones/%d", r.projectPath(), milestone.ID), nil, map[string]any{"state_event": "close"}, nil)
+	if err != nil {
+		return fmt.Errorf("can't close the GitLab milestone %s: %w", milestone.Title, err)
+	}
+	return nil
+}
+
+// GetMilestoneOpenItems returns the open issues and merge requests of the milestone
+func (r *Adapter) GetMilestoneOpenItems(milestone *repo.Milestone) ([]repo.MilestoneItem, error) {
+	res := []repo.MilestoneItem{}
+	for _, kind := range []string{"issues", "merge_requests"} {
+		query := url.Values{}
+		query.Set("per_page", strconv.Itoa(perPage))
+		page := "1"
+		for page != "" {
+			query.Set("page", page)
+			var items []struct {
+				IID   int    `json:"iid"`
+				State string `json:"state"`
+			}
+			resp, err := r.request(http.MethodGet, fmt.Sprintf("%s/milestones/%d/%s", r.projectPath(), milestone.ID, kind), query, nil, &items)
+			if err != nil {
+				return nil, fmt.Errorf("can't list the %s of the GitLab milestone %s: %w", kind, milestone.Title, err)
+			}
+			for _, item := range items {
+				if item.State == "opened" {
+					res = append(res, repo.MilestoneItem{Number: item.IID, PullRequest: kind == "merge_requests"})
+				}
+			}
+			page = resp.Header.Get("X-Next-Page")
+		}
+	}
+	return res, nil
+}
+
+func (r *Adapter) SetMilestone(item repo.MilestoneItem, milestone *repo.Milestone) error {
+	kind := "issues"
+	if item.PullRequest {
+		kind = "merge_requests"
+	}
+	_, err := r.request(http.MethodPut, fmt.Sprintf("%s/%s/%d", r.projectPath(), kind, item.Number), nil, map[string]any{"milestone_id": milestone.ID}, nil)
+	if err != nil {
+		return fmt.Errorf("can't set the GitLab milestone %s on %s %d: %w", milestone.Title, kind, item.Number, err)
+	}
+	return nil
+}
@@ -0,0 +1,386 @@
+package repogitlab
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/fabien-marty/github-next-semantic-version/internal/app/repo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeMr struct {
+	iid       int
+	updatedAt time.Time
+	mergedAt  *time.Time
+}
+
+func (m fakeMr) toJSON() map[string]any {
+	return map[string]any{
+		"iid":               m.iid,
+		"title":             fmt.Sprintf("MR%d", m.iid),
+		"description":       "description",
+		"web_url":           fmt.Sprintf("https://gitlab.example.com/group/sub/bar/-/merge_requests/%d", m.iid),
+		"draft":             false,
+		"labels":            []string{"label"},
+		"source_branch":     fmt.Sprintf("branch%d", m.iid),
+		"target_branch":     "main",
+		"merge_commit_sha":  nil,
+		"squash_commit_sha": fmt.Sprintf("sha%d", m.iid),
+		"created_at":        m.updatedAt.Add(-time.Hour),
+		"updated_at":        m.updatedAt,
+		"merged_at":         m.mergedAt,
+		"closed_at":         nil,
+		"author":            map[string]any{"username": "user", "web_url": "https://gitlab.example.com/user"},
+		"merge_user":        map[string]any{"username": "merger"},
+		"assignees":         []map[string]any{{"username": "assignee"}},
+		"reviewers":         []map[string]any{{"username": "reviewer"}},
+		"milestone":         map[string]any{"title": "v1"},
+	}
+}
+
+// newFakeServer returns a fake GitLab API server serving the given (already sorted) merged MRs
+// and a single opened MR (#1000) for the project group/sub/bar
+func newFakeServer(t *testing.T, mergedMrs []fakeMr, perPage int) (*httptest.Server, *[]string) {
+	t.Helper()
+	calls := []string{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v4/projects/group%2Fsub%2Fbar/merge_requests", func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.URL.RawQuery)
+		assert.Equal(t, "secret", r.Header.Get("PRIVATE-TOKEN"))
+		assert.Equal(t, "main", r.URL.Query().Get("target_branch"))
+		assert.Equal(t, "desc", r.URL.Query().Get("sort"))
+		mrs := []fakeMr{{iid: 1000, updatedAt: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)}}
+		if r.URL.Query().Get("state") == "merged" {
+			mrs = mergedMrs
+		}
+		page, err := strconv.Atoi(r.URL.Query().Get("page"))
+		require.NoError(t, err)
+		start := min((page-1)*perPage, len(mrs))
+		end := min(start+perPage, len(mrs))
+		if end < len(mrs) {
+			w.Header().Set("X-Next-Page", strconv.Itoa(page+1))
+		} else {
+			w.Header().Set("X-Next-Page", "")
+		}
+		res := []map[string]any{}
+		for _, mr := range mrs[start:end] {
+			res = append(res, mr.toJSON())
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(res)
+	})
+	mux.HandleFunc("GET /api/v4/projects/group%2Fsub%2Fbar/merge_requests/{iid}/closes_issues", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode([]map[string]any{{
+			"iid":     42,
+			"title":   "Crash on startup",
+			"web_url": "https://gitlab.example.com/group/sub/bar/-/issues/42",
+			"labels":  []string{"bug"},
+		}})
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+func newFakeAdapter(t *testing.T, server *httptest.Server) *Adapter {
+	t.Helper()
+	adapter, err := NewAdapter("group/sub", "bar", AdapterOptions{Token: "secret", BaseURL: server.URL + "/api/v4"})
+	require.NoError(t, err)
+	return adapter
+}
+
+func newFakeMergedMrs() []fakeMr {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	res := []fakeMr{}
+	for i := 25; i > 0; i-- { // sorted by updatedAt descending
+		mergedAt := base.Add(time.Duration(i) * time.Hour)
+		res = append(res, fakeMr{iid: i, updatedAt: mergedAt.Add(time.Minute), mergedAt: &mergedAt})
+	}
+	return res
+}
+
+func TestWebBaseURL(t *testing.T) {
+	tests := []struct {
+		baseURL  string
+		expected string
+	}{
+		{"", "https://gitlab.com"},
+		{"https://gitlab.com/api/v4/", "https://gitlab.com"},
+		{"https://gitlab.example.com/api/v4", "https://gitlab.example.com"},
+		{"https://example.com/gitlab/api/v4/", "https://example.com/gitlab"},
+	}
+	for _, test := range tests {
+		res, err := WebBaseURL(test.baseURL)
+		require.NoError(t, err)
+		assert.Equal(t, test.expected, res, test.baseURL)
+	}
+	_, err := WebBaseURL("gitlab.com")
+	assert.Error(t, err)
+}
+
+func TestGetPullRequests(t *testing.T) {
+	server, calls := newFakeServer(t, newFakeMergedMrs(), 10)
+	adapter := newFakeAdapter(t, server)
+
+	res, err := adapter.GetPullRequests("main", true)
+	require.NoError(t, err)
+	require.Equal(t, 25, len(res))
+	assert.Equal(t, 3, len(*calls))
+	mergedAt := time.Date(2024, 1, 2, 1, 0, 0, 0, time.UTC)
+	updatedAt := mergedAt.Add(time.Minute)
+	createdAt := updatedAt.Add(-time.Hour)
+	expected := &repo.PullRequest{
+		Number:             25,
+		Title:              "MR25",
+		MergedAt:           &mergedAt,
+		UpdatedAt:          &updatedAt,
+		Labels:             []string{"label"},
+		Branch:             "branch25",
+		Url:                "https://gitlab.example.com/group/sub/bar/-/merge_requests/25",
+		AuthorLogin:        "user",
+		AuthorUrl:          "https://gitlab.example.com/user",
+		Body:               "description",
+		Milestone:          "v1",
+		Assignees:          []string{"assignee"},
+		RequestedReviewers: []string{"reviewer"},
+		ApprovingReviewers: []string{},
+		BaseBranch:         "main",
+		MergeCommitSha:     "sha25",
+		CreatedAt:          &createdAt,
+		MergedBy:           "merger",
+	}
+	assert.Equal(t, expected, res[0])
+
+	*calls = []string{}
+	res, err = adapter.GetPullRequests("main", false)
+	require.NoError(t, err)
+	assert.Equal(t, 26, len(res))
+	assert.Equal(t, 1000, res[0].Number)
+	assert.Nil(t, res[0].MergedAt)
+	assert.Equal(t, "", res[0].MergeCommitSha)
+	assert.Equal(t, "", res[0].MergedBy)
+	assert.Equal(t, 4, len(*calls))
+}
+
+func TestGetPullRequestsSince(t *testing.T) {
+	server, calls := newFakeServer(t, newFakeMergedMrs(), 10)
+	adapter := newFakeAdapter(t, server)
+
+	since := time.Date(2024, 1, 1, 17, 30, 0, 0, time.UTC)
+	res, err := adapter.GetPullRequestsSince("main", true, since)
+	require.NoError(t, err)
+	assert.Equal(t, 8, len(res)) // MRs 18 => 25
+	for _, pr := range res {
+		assert.True(t, pr.MergedAt.After(since))
+	}
+	assert.Equal(t, 1, len(*calls)) // the first page contains MRs updated before since => stop paginating
+	assert.Contains(t, (*calls)[0], "order_by=updated_at")
+}
+
+func TestGetLastUpdatedPullRequests(t *testing.T) {
+	server, calls := newFakeServer(t, newFakeMergedMrs(), 10)
+	adapter := newFakeAdapter(t, server)
+
+	res, err := adapter.GetLastUpdatedPullRequests("main", false)
+	require.NoError(t, err)
+	assert.Equal(t, 11, len(res))
+	assert.Equal(t, 1000, res[0].Number)
+	assert.Equal(t, 25, res[1].Number)
+	assert.Equal(t, 2, len(*calls)) // no pagination
+}
+
+func TestGetLinkedIssues(t *testing.T) {
+	server, _ := newFakeServer(t, nil, 10)
+	adapter := newFakeAdapter(t, server)
+
+	res, err := adapter.GetLinkedIssues(&repo.PullRequest{Number: 12})
+	require.NoError(t, err)
+	assert.Equal(t, []*repo.Issue{{Number: 42, Title: "Crash on startup", Url: "https://gitlab.example.com/group/sub/bar/-/issues/42", Labels: []string{"bug"}}}, res)
+}
+
+func TestCreateRelease(t *testing.T) {
+	var payload map[string]any
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v4/projects/group%2Fsub%2Fbar/releases", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"tag_name": "v1.2.3"}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	adapter := newFakeAdapter(t, server)
+
+	_, err := adapter.CreateRelease(repo.ReleaseOptions{Base: "main", TagName: "v1.2.3", Body: "release notes"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"tag_name": "v1.2.3", "ref": "main", "name": "v1.2.3", "description": "release notes"}, payload)
+
+	_, err = adapter.CreateRelease(repo.ReleaseOptions{Base: "main", TagName: "v1.2.4", Name: "MyApp v1.2.4", Body: "release notes", TargetSha: "012345"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"tag_name": "v1.2.4", "ref": "012345", "name": "MyApp v1.2.4", "description": "release notes"}, payload)
+
+	_, err = adapter.CreateRelease(repo.ReleaseOptions{Base: "main", TagName: "v1.2.4", Body: "release notes", Draft: true})
+	assert.ErrorContains(t, err, "draft releases are not supported")
+
+	server.Close()
+	_, err = adapter.CreateRelease(repo.ReleaseOptions{Base: "main", TagName: "v1.2.5", Body: "release notes"})
+	assert.Error(t, err)
+}
+
+func TestUploadReleaseAsset(t *testing.T) {
+	calls := []string{}
+	var uploaded string
+	var link map[string]any
+	mux := http.NewServeMux()
+	mux.HandleFunc("PUT /api/v4/projects/group%2Fsub%2Fbar/packages/generic/release-assets/v1.2.3/foo.txt", func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, "upload")
+		body, _ := io.ReadAll(r.Body)
+		uploaded = string(body)
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"message": "201 Created"}`))
+	})
+	mux.HandleFunc("GET /api/v4/projects/group%2Fsub%2Fbar/releases/v1.2.3/assets/links", func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, "list")
+		_, _ = w.Write([]byte(`[{"id": 5, "name": "foo.txt"}, {"id": 6, "name": "bar.txt"}]`))
+	})
+	mux.HandleFunc("DELETE /api/v4/projects/group%2Fsub%2Fbar/releases/v1.2.3/assets/links/{id}", func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, "delete "+r.PathValue("id"))
+		_, _ = w.Write([]byte(`{}`))
+	})
+	mux.HandleFunc("POST /api/v4/projects/group%2Fsub%2Fbar/releases/v1.2.3/assets/links", func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, "link")
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&link))
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	adapter := newFakeAdapter(t, server)
+
+	err := adapter.UploadReleaseAsset(&repo.Release{TagName: "v1.2.3"}, repo.ReleaseAsset{Name: "foo.txt", Content: []byte("foo")})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"upload", "list", "delete 5", "link"}, calls)
+	assert.Equal(t, "foo", uploaded)
+	assert.Equal(t, map[string]any{
+		"name":      "foo.txt",
+		"url":       server.URL + "/api/v4/projects/group%2Fsub%2Fbar/packages/generic/release-assets/v1.2.3/foo.txt",
+		"link_type": "package",
+	}, link)
+}
+
+func TestGetLastReleasesAndUpdateRelease(t *testing.T) {
+	var payload map[string]any
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v4/projects/group%2Fsub%2Fbar/releases", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`[{"tag_name": "v1.1.0", "name": "MyApp v1.1.0"}, {"tag_name": "v1.0.0", "name": "v1.0.0"}]`))
+	})
+	mux.HandleFunc("PUT /api/v4/projects/group%2Fsub%2Fbar/releases/v1.1.0", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		_, _ = w.Write([]byte(`{}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	adapter := newFakeAdapter(t, server)
+
+	releases, err := adapter.GetLastReleases()
+	require.NoError(t, err)
+	assert.Equal(t, []*repo.Release{{TagName: "v1.1.0", Name: "MyApp v1.1.0"}, {TagName: "v1.0.0", Name: "v1.0.0"}}, releases)
+
+	updated, err := adapter.UpdateRelease(releases[0], repo.ReleaseOptions{TagName: "v1.1.0", Body: "body"})
+	require.NoError(t, err)
+	assert.Equal(t, &repo.Release{TagName: "v1.1.0", Name: "v1.1.0"}, updated)
+	assert.Equal(t, map[string]any{"name": "v1.1.0", "description": "body"}, payload)
+
+	_, err = adapter.UpdateRelease(releases[0], repo.ReleaseOptions{TagName: "v2.0.0"})
+	assert.ErrorContains(t, err, "can't retag")
+}
+
+func TestPullRequestCommentsAndLabels(t *testing.T) {
+	var comment, update map[string]any
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v4/projects/group%2Fsub%2Fbar/merge_requests/1/notes", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("page") == "1" {
+			w.Header().Set("X-Next-Page", "2")
+			_, _ = w.Write([]byte(`[{"body": "LGTM"}, {"body": "added 1 commit", "system": true}]`))
+			return
+		}
+		_, _ = w.Write([]byte(`[{"body": "Released in v1.0.0"}]`))
+	})
+	mux.HandleFunc("POST /api/v4/projects/group%2Fsub%2Fbar/merge_requests/1/notes", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&comment))
+		_, _ = w.Write([]byte(`{}`))
+	})
+	mux.HandleFunc("PUT /api/v4/projects/group%2Fsub%2Fbar/merge_requests/1", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&update))
+		_, _ = w.Write([]byte(`{}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	adapter := newFakeAdapter(t, server)
+	pr := &repo.PullRequest{Number: 1}
+
+	comments, err := adapter.GetPullRequestComments(pr)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"LGTM", "Released in v1.0.0"}, comments)
+	require.NoError(t, adapter.AddPullRequestComment(pr, "Released in v1.1.0"))
+	assert.Equal(t, map[string]any{"body": "Released in v1.1.0"}, comment)
+	require.NoError(t, adapter.AddPullRequestLabel(pr, "released"))
+	assert.Equal(t, map[string]any{"add_labels": "released"}, update)
+}
+
+func TestMilestones(t *testing.T) {
+	payloads := map[string]map[string]any{}
+	decode := func(t *testing.T, key string, r *http.Request) {
+		payload := map[string]any{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		payloads[key] = payload
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v4/projects/group%2Fsub%2Fbar/milestones", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`[{"id": 101, "iid": 1, "title": "1.0.0", "state": "closed"}, {"id": 102, "iid": 2, "title": "1.1.0", "state": "active"}]`))
+	})
+	mux.HandleFunc("POST /api/v4/projects/group%2Fsub%2Fbar/milestones", func(w http.ResponseWriter, r *http.Request) {
+		decode(t, "create", r)
+		_, _ = w.Write([]byte(`{"id": 103, "iid": 3, "title": "1.2.0", "state": "active"}`))
+	})
+	mux.HandleFunc("PUT /api/v4/projects/group%2Fsub%2Fbar/milestones/102", func(w http.ResponseWriter, r *http.Request) {
+		decode(t, "close", r)
+		_, _ = w.Write([]byte(`{}`))
+	})
+	mux.HandleFunc("GET /api/v4/projects/group%2Fsub%2Fbar/milestones/102/issues", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`[{"iid": 10, "state": "opened"}, {"iid": 11, "state": "closed"}]`))
+	})
+	mux.HandleFunc("GET /api/v4/projects/group%2Fsub%2Fbar/milestones/102/merge_requests", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`[{"iid": 12, "state": "opened"}, {"iid": 13, "state": "merged"}]`))
+	})
+	mux.HandleFunc("PUT /api/v4/projects/group%2Fsub%2Fbar/merge_requests/12", func(w http.ResponseWriter, r *http.Request) {
+		decode(t, "set", r)
+		_, _ = w.Write([]byte(`{}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	adapter := newFakeAdapter(t, server)
+
+	milestones, err := adapter.GetMilestones()
+	require.NoError(t, err)
+	assert.Equal(t, []*repo.Milestone{{ID: 101, Title: "1.0.0", Closed: true}, {ID: 102, Title: "1.1.0"}}, milestones)
+	next, err := adapter.CreateMilestone("1.2.0")
+	require.NoError(t, err)
+	assert.Equal(t, &repo.Milestone{ID: 103, Title: "1.2.0"}, next)
+	assert.Equal(t, map[string]any{"title": "1.2.0"}, payloads["create"])
+	items, err := adapter.GetMilestoneOpenItems(milestones[1])
+	require.NoError(t, err)
+	assert.Equal(t, []repo.MilestoneItem{{Number: 10}, {Number: 12, PullRequest: true}}, items)
+	require.NoError(t, adapter.SetMilestone(items[1], next))
+	assert.Equal(t, map[string]any{"milestone_id": float64(103)}, payloads["set"])
+	require.NoError(t, adapter.CloseMilestone(milestones[1]))
+	assert.Equal(t, map[string]any{"state_event": "close"}, payloads["close"])
+}
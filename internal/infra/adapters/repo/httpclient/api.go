@@ -0,0 +1,131 @@
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strings"
+)
+
+// RawPayload is an API request payload sent as is (instead of being encoded in JSON, see APIClient.Request)
+type RawPayload struct {
+	ContentType string
+	Content     []byte
+}
+
+// NewMultipartPayload returns a multipart/form-data payload with the given file (name, content type
+// and content) in the given field
+func NewMultipartPayload(field string, filename string, contentType string, content []byte) (RawPayload, error) {
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", mime.FormatMediaType("form-data", map[string]string{"name": field, "filename": filename}))
+	header.Set("Content-Type", contentType)
+	part, err := writer.CreatePart(header)
+	if err == nil {
+		_, err = part.Write(content)
+	}
+	if err == nil {
+		err = writer.Close()
+	}
+	if err != nil {
+		return RawPayload{}, fmt.Errorf("can't encode the file %s: %w", filename, err)
+	}
+	return RawPayload{ContentType: writer.FormDataContentType(), Content: buf.Bytes()}, nil
+}
+
+// APIClient is a minimal client for the JSON REST APIs of the providers without SDK (GitLab, Gitea, Bitbucket)
+type APIClient struct {
+	name       string                  // name of the API (used in error messages, example: "GitLab")
+	baseURL    *url.URL                // (with a trailing slash)
+	httpClient *http.Client            // (see NewClient)
+	auth       func(req *http.Request) // sets the authentication headers of a request (nil => anonymous requests)
+}
+
+// NewAPIClient returns an API client for the given base url (a trailing slash is added if missing)
+//
+// name is the name of the API used in error messages (example: "GitLab"), httpClient the http client
+// to use (nil => http.DefaultClient) and auth a function setting the authentication headers of each
+// request (nil => anonymous requests).
+func NewAPIClient(name string, baseURL *url.URL, httpClient *http.Client, auth func(req *http.Request)) *APIClient {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	u := *baseURL
+	if !strings.HasSuffix(u.Path, "/") {
+		u.Path += "/"
+	}
+	return &APIClient{
+		name:       name,
+		baseURL:    &u,
+		httpClient: httpClient,
+		auth:       auth,
+	}
+}
+
+// Request executes an API request on the given path (absolute url or relative to the base url) and decodes
+// the JSON response into res (if not nil)
+//
+// The payload (if not nil) is encoded in JSON, except RawPayload ones which are sent as is. A status code
+// outside the 2xx range is returned as an error (with the response body).
+func (c *APIClient) Request(method string, path string, query url.Values, payload any, res any) (*http.Response, error) {
+	fullURL := path
+	if !strings.HasPrefix(path, "http://") && !strings.HasPrefix(path, "https://") {
+		fullURL = c.baseURL.String() + path
+	}
+	if len(query) > 0 {
+		fullURL += "?" + query.Encode()
+	}
+	var reqBody io.Reader
+	contentType := ""
+	switch p := payload.(type) {
+	case nil:
+	case RawPayload:
+		reqBody = bytes.NewReader(p.Content)
+		contentType = p.ContentType
+	default:
+		encoded, err := json.Marshal(payload)
+		if err != nil {
+			return nil, fmt.Errorf("can't encode the %s request: %w", c.name, err)
+		}
+		reqBody = bytes.NewReader(encoded)
+		contentType = "application/json"
+	}
+	req, err := http.NewRequestWithContext(context.Background(), method, fullURL, reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("can't create the %s request: %w", c.name, err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.auth != nil {
+		c.auth(req)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("can't execute the %s request: %w", c.name, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("can't read the %s response: %w", c.name, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("bad status code for %s %s: %d (body: %s)", method, req.URL.Path, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	if res != nil {
+		err = json.Unmarshal(body, res)
+		if err != nil {
+			return nil, fmt.Errorf("can't decode the %s response: %w", c.name, err)
+		}
+	}
+	return resp, nil
+}
@@ -0,0 +1,106 @@
+package httpclient
+
+import (
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type apiTestRequest struct {
+	method      string
+	path        string
+	query       string
+	contentType string
+	token       string
+	body        string
+}
+
+// newAPITestClient returns an API client (with a "Test" name and a token auth callback) on a fake
+// server returning the given status and body, and the list of requests received by the server
+func newAPITestClient(t *testing.T, status int, body string) (*APIClient, *httptest.Server, *[]apiTestRequest) {
+	t.Helper()
+	requests := []apiTestRequest{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content, _ := io.ReadAll(r.Body)
+		requests = append(requests, apiTestRequest{
+			method:      r.Method,
+			path:        r.URL.Path,
+			query:       r.URL.RawQuery,
+			contentType: r.Header.Get("Content-Type"),
+			token:       r.Header.Get("Authorization"),
+			body:        string(content),
+		})
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	baseURL, err := url.Parse(server.URL + "/api/v1")
+	require.NoError(t, err)
+	client := NewAPIClient("Test", baseURL, server.Client(), func(req *http.Request) {
+		req.Header.Set("Authorization", "token secret")
+	})
+	return client, server, &requests
+}
+
+func TestAPIClientRequest(t *testing.T) {
+	client, server, requests := newAPITestClient(t, http.StatusCreated, `{"id": 42}`)
+
+	res := struct {
+		ID int `json:"id"`
+	}{}
+	resp, err := client.Request(http.MethodPost, "repos/foo", url.Values{"page": []string{"2"}}, map[string]string{"name": "bar"}, &res)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, 42, res.ID)
+	_, err = client.Request(http.MethodPut, "repos/foo/raw", nil, RawPayload{ContentType: "text/plain", Content: []byte("raw content")}, nil)
+	require.NoError(t, err)
+	_, err = client.Request(http.MethodGet, server.URL+"/uploads/file", nil, nil, nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, []apiTestRequest{
+		{method: http.MethodPost, path: "/api/v1/repos/foo", query: "page=2", contentType: "application/json", token: "token secret", body: `{"name":"bar"}`},
+		{method: http.MethodPut, path: "/api/v1/repos/foo/raw", contentType: "text/plain", token: "token secret", body: "raw content"},
+		{method: http.MethodGet, path: "/uploads/file", token: "token secret"},
+	}, *requests)
+}
+
+func TestAPIClientRequestErrors(t *testing.T) {
+	client, _, _ := newAPITestClient(t, http.StatusNotFound, "not found\n")
+	_, err := client.Request(http.MethodGet, "repos/foo", nil, nil, nil)
+	require.Error(t, err)
+	assert.Equal(t, "bad status code for GET /api/v1/repos/foo: 404 (body: not found)", err.Error())
+
+	client, _, _ = newAPITestClient(t, http.StatusOK, "not json")
+	res := map[string]any{}
+	_, err = client.Request(http.MethodGet, "repos/foo", nil, nil, &res)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "can't decode the Test response")
+}
+
+func TestNewMultipartPayload(t *testing.T) {
+	payload, err := NewMultipartPayload("attachment", "notes.txt", "text/plain", []byte("hello"))
+	require.NoError(t, err)
+
+	mediaType, params, err := mime.ParseMediaType(payload.ContentType)
+	require.NoError(t, err)
+	assert.Equal(t, "multipart/form-data", mediaType)
+	reader := multipart.NewReader(strings.NewReader(string(payload.Content)), params["boundary"])
+	part, err := reader.NextPart()
+	require.NoError(t, err)
+	assert.Equal(t, "attachment", part.FormName())
+	assert.Equal(t, "notes.txt", part.FileName())
+	assert.Equal(t, "text/plain", part.Header.Get("Content-Type"))
+	content, err := io.ReadAll(part)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(content))
+	_, err = reader.NextPart()
+	assert.ErrorIs(t, err, io.EOF)
+}
@@ -0,0 +1,236 @@
+package httpclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+type CassetteMode string
+
+const (
+	CassetteRecord CassetteMode = "record" // requests are sent and every request/response is saved into the cassette file
+	CassetteReplay CassetteMode = "replay" // responses are served from the cassette file (no network request)
+)
+
+// cassetteBody is a recorded body: as a string if it's valid UTF-8, else as base64 (binary uploads/downloads)
+type cassetteBody struct {
+	Body       string `json:"body,omitempty"`
+	BodyBase64 []byte `json:"bodyBase64,omitempty"`
+}
+
+func newCassetteBody(body []byte) cassetteBody {
+	if utf8.Valid(body) {
+		return cassetteBody{Body: string(body)}
+	}
+	return cassetteBody{BodyBase64: body}
+}
+
+// bytes returns the recorded body
+func (b cassetteBody) bytes() []byte {
+	if b.BodyBase64 != nil {
+		return b.BodyBase64
+	}
+	return []byte(b.Body)
+}
+
+// cassetteRequest is a recorded request (headers are not recorded, so credentials are never saved)
+type cassetteRequest struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+	cassetteBody
+}
+
+// cassetteResponse is a recorded response
+type cassetteResponse struct {
+	StatusCode int         `json:"statusCode"`
+	Header     http.Header `json:"header"`
+	cassetteBody
+}
+
+type cassetteInteraction struct {
+	Request  cassetteRequest  `json:"request"`
+	Response cassetteResponse `json:"response"`
+}
+
+type cassetteFile struct {
+	Interactions []cassetteInteraction `json:"interactions"`
+}
+
+// Cassette records HTTP interactions into a (JSON) file or replays them from it
+//
+// In replay mode, a request is matched with recorded ones by method, url and body. If the same request
+// was recorded several times (pagination refresh, retries...), recorded responses are served in order
+// (and the last one is served again when they are exhausted).
+//
+// A cassette can be shared by several http clients (see TransportOptions.Cassette).
+type Cassette struct {
+	mode  CassetteMode
+	path  string
+	mutex sync.Mutex
+	file  cassetteFile
+	next  map[string]int // replay mode: index (in the recorded responses of the key) of the next response to serve
+	byKey map[string][]cassetteResponse
+}
+
+// NewCassette returns a new cassette in the given mode
+// (in replay mode, the given file is read; in record mode, it's (re)created on the first request)
+func NewCassette(path string, mode CassetteMode) (*Cassette, error) {
+	res := &Cassette{
+		mode:  mode,
+		path:  path,
+		file:  cassetteFile{Interactions: []cassetteInteraction{}},
+		next:  map[string]int{},
+		byKey: map[string][]cassetteResponse{},
+	}
+	switch mode {
+	case CassetteRecord:
+	case CassetteReplay:
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("can't read the cassette file: %w", err)
+		}
+		err = json.Unmarshal(content, &res.file)
+		if err != nil {
+			return nil, fmt.Errorf("can't decode the cassette file %s: %w", path, err)
+		}
+		for _, interaction := range res.file.Interactions {
+			key := cassetteKey(interaction.Request)
+			res.byKey[key] = append(res.byKey[key], interaction.Response)
+		}
+	default:
+		return nil, fmt.Errorf("unknown cassette mode: %s (must be '%s' or '%s')", mode, CassetteRecord, CassetteReplay)
+	}
+	return res, nil
+}
+
+func cassetteKey(req cassetteRequest) string {
+	return req.Method + " " + req.URL + "\n" + string(req.bytes())
+}
+
+// Transport returns an http.RoundTripper recording the interactions made with the given upstream
+// (record mode) or serving them from the cassette (replay mode, the upstream is not used)
+func (c *Cassette) Transport(upstream http.RoundTripper) http.RoundTripper {
+	return &cassetteTransport{upstream: upstream, cassette: c}
+}
+
+// cassetteTransport is an http.RoundTripper using a cassette
+type cassetteTransport struct {
+	upstream http.RoundTripper
+	cassette *Cassette
+}
+
+func (t *cassetteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	cReq := cassetteRequest{Method: req.Method, URL: req.URL.String()}
+	if req.Body != nil && req.Body != http.NoBody {
+		body, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("can't read the request body: %w", err)
+		}
+		cReq.cassetteBody = newCassetteBody(body)
+		req = req.Clone(req.Context()) // a RoundTripper must not modify the given request
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	if t.cassette.mode == CassetteReplay {
+		return t.cassette.replay(req, cReq)
+	}
+	resp, err := t.upstream.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("can't read the response body: %w", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	header := resp.Header.Clone()
+	header.Del("Set-Cookie")
+	err = t.cassette.record(cassetteInteraction{
+		Request: cReq,
+		Response: cassetteResponse{
+			StatusCode:   resp.StatusCode,
+			Header:       header,
+			cassetteBody: newCassetteBody(redactCassetteBody(cReq, body)),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// redactCassetteBody removes the token from access token responses (GitHub App installation tokens)
+func redactCassetteBody(req cassetteRequest, body []byte) []byte {
+	if !strings.HasSuffix(strings.SplitN(req.URL, "?", 2)[0], "/access_tokens") {
+		return body
+	}
+	var decoded map[string]any
+	if json.Unmarshal(body, &decoded) != nil {
+		return body
+	}
+	if _, found := decoded["token"]; found {
+		decoded["token"] = "REDACTED"
+	}
+	res, err := json.Marshal(decoded)
+	if err != nil {
+		return body
+	}
+	return res
+}
+
+// record appends the given interaction to the cassette and (re)writes the cassette file
+// (the file is rewritten after each interaction to keep a usable trace even if the program fails)
+func (c *Cassette) record(interaction cassetteInteraction) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.file.Interactions = append(c.file.Interactions, interaction)
+	content, err := json.MarshalIndent(c.file, "", "  ")
+	if err != nil {
+		return fmt.Errorf("can't encode the cassette: %w", err)
+	}
+	err = os.WriteFile(c.path, content, 0644)
+	if err != nil {
+		return fmt.Errorf("can't write the cassette file: %w", err)
+	}
+	return nil
+}
+
+// replay returns the next recorded response matching the given request
+func (c *Cassette) replay(req *http.Request, cReq cassetteRequest) (*http.Response, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	key := cassetteKey(cReq)
+	responses := c.byKey[key]
+	if len(responses) == 0 {
+		return nil, fmt.Errorf("no recorded interaction in the cassette %s for %s %s", c.path, cReq.Method, cReq.URL)
+	}
+	index := min(c.next[key], len(responses)-1)
+	c.next[key] = index + 1
+	recorded := responses[index]
+	body := recorded.bytes()
+	header := recorded.Header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	slog.Debug("http response replayed", slog.String("method", cReq.Method), slog.String("url", cReq.URL), slog.Int("statusCode", recorded.StatusCode))
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", recorded.StatusCode, http.StatusText(recorded.StatusCode)),
+		StatusCode:    recorded.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
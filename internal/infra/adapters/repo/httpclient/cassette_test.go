@@ -0,0 +1,101 @@
+package httpclient
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCassetteReplayInOrder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"interactions": [
+		{"request": {"method": "POST", "url": "https://example.com/graphql", "body": "query1"}, "response": {"statusCode": 502, "body": "bad gateway"}},
+		{"request": {"method": "POST", "url": "https://example.com/graphql", "body": "query1"}, "response": {"statusCode": 200, "body": "response1"}},
+		{"request": {"method": "POST", "url": "https://example.com/graphql", "body": "query2"}, "response": {"statusCode": 200, "body": "response2"}}
+	]}`), 0644))
+	cassette, err := NewCassette(path, CassetteReplay)
+	require.NoError(t, err)
+	client := &http.Client{Transport: cassette.Transport(nil)}
+	for _, expected := range []struct {
+		body       string
+		statusCode int
+		response   string
+	}{
+		{"query2", 200, "response2"},
+		{"query1", 502, "bad gateway"},
+		{"query1", 200, "response1"},
+		{"query1", 200, "response1"}, // the last one is served again
+	} {
+		resp, err := client.Post("https://example.com/graphql", "text/plain", strings.NewReader(expected.body))
+		require.NoError(t, err)
+		body := readAndRestoreBody(resp)
+		resp.Body.Close()
+		assert.Equal(t, expected.statusCode, resp.StatusCode)
+		assert.Equal(t, expected.response, body)
+	}
+
+	_, err = NewCassette(filepath.Join(t.TempDir(), "missing.json"), CassetteReplay)
+	assert.Error(t, err)
+	_, err = NewCassette(path, "foo")
+	assert.Error(t, err)
+}
+
+func TestCassetteRedactsInstallationTokens(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /app/installations/1/access_tokens", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"token": "ghs_secret", "expires_at": "2024-01-01T00:00:00Z"}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	cassette, err := NewCassette(path, CassetteRecord)
+	require.NoError(t, err)
+	client := &http.Client{Transport: cassette.Transport(http.DefaultTransport)}
+
+	resp, err := client.Post(server.URL+"/app/installations/1/access_tokens", "application/json", nil)
+	require.NoError(t, err)
+	assert.Contains(t, readAndRestoreBody(resp), "ghs_secret") // the caller gets the real token
+	resp.Body.Close()
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(content), "ghs_secret")
+	assert.Contains(t, string(content), "REDACTED")
+}
+
+func TestCassetteBinaryBodies(t *testing.T) {
+	binary := []byte{0x1f, 0x8b, 0x08, 0x00, 0xff, 0xfe, 0x00, 0x80}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		_, _ = w.Write(body) // echo
+	}))
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	cassette, err := NewCassette(path, CassetteRecord)
+	require.NoError(t, err)
+	client := &http.Client{Transport: cassette.Transport(http.DefaultTransport)}
+	resp, err := client.Post(server.URL+"/upload", "application/octet-stream", bytes.NewReader(binary))
+	require.NoError(t, err)
+	resp.Body.Close()
+	server.Close()
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(content), `"bodyBase64": "H4sIAP/+AIA="`)
+
+	cassette, err = NewCassette(path, CassetteReplay)
+	require.NoError(t, err)
+	client = &http.Client{Transport: cassette.Transport(nil)}
+	resp, err = client.Post(server.URL+"/upload", "application/octet-stream", bytes.NewReader(binary))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, binary, body)
+}
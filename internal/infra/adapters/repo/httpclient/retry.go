@@ -0,0 +1,283 @@
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultRetryMaxWait   = 5 * time.Minute
+	defaultRetryBaseDelay = time.Second
+	// GitHub documentation: "if the retry-after header is not present, wait for at least one minute"
+	defaultSecondaryRateLimitWait = time.Minute
+	// (same for GraphQL rate limits without rate limit headers)
+	defaultGraphQLRateLimitWait = time.Minute
+)
+
+type RetryOptions struct {
+	MaxRetries int           // max number of retries for a single request, <=0 => no retry
+	MaxWait    time.Duration // max time to wait for a rate limit reset (or a Retry-After), <=0 => 5 minutes
+	BaseDelay  time.Duration // base delay of the exponential backoff for 5xx errors, <=0 => 1 second
+}
+
+// GraphQLRateLimitedType is the type of GitHub GraphQL errors returned on rate limits
+const GraphQLRateLimitedType = "RATE_LIMITED"
+
+// RateLimitError is returned when a (primary or secondary) rate limit is hit
+// and we can't (or don't want to) wait anymore
+type RateLimitError struct {
+	StatusCode int
+	Secondary  bool      // true for secondary rate limits (abuse detection)
+	ResetAt    time.Time // when the rate limit should be reset (zero if unknown)
+	Message    string    // message returned by the API
+}
+
+func (e *RateLimitError) Error() string {
+	kind := "primary"
+	if e.Secondary {
+		kind = "secondary"
+	}
+	res := fmt.Sprintf("API %s rate limit exceeded (status code: %d)", kind, e.StatusCode)
+	if !e.ResetAt.IsZero() {
+		res += fmt.Sprintf(", reset at %s", e.ResetAt.Format(time.RFC3339))
+	}
+	if e.Message != "" {
+		res += fmt.Sprintf(": %s", e.Message)
+	}
+	return res
+}
+
+// retryTransport is an http.RoundTripper retrying requests on rate limits and 5xx errors
+type retryTransport struct {
+	upstream http.RoundTripper
+	opts     RetryOptions
+	now      func() time.Time
+	sleep    func(ctx context.Context, d time.Duration) error
+}
+
+// NewRetryTransport returns an http.RoundTripper wrapping the given one (nil => http.DefaultTransport)
+// with a retry policy:
+//
+//   - primary rate limits (X-RateLimit-Remaining: 0): wait until X-RateLimit-Reset (if less than opts.MaxWait)
+//   - secondary rate limits: wait for Retry-After seconds (if less than opts.MaxWait)
+//   - GraphQL rate limits (200 status code with a RATE_LIMITED error, see graphqlRateLimitMessage): same as
+//     primary rate limits
+//   - 5xx errors: exponential backoff (opts.BaseDelay, then x2 for each retry), only for idempotent
+//     requests (see isIdempotent) because the request may have been processed (example: a POST creating
+//     a release)
+//
+// When retries run out on a rate limit, a *RateLimitError is returned.
+func NewRetryTransport(upstream http.RoundTripper, opts RetryOptions) http.RoundTripper {
+	if upstream == nil {
+		upstream = http.DefaultTransport
+	}
+	if opts.MaxWait <= 0 {
+		opts.MaxWait = defaultRetryMaxWait
+	}
+	if opts.BaseDelay <= 0 {
+		opts.BaseDelay = defaultRetryBaseDelay
+	}
+	return &retryTransport{
+		upstream: upstream,
+		opts:     opts,
+		now:      time.Now,
+		sleep:    sleepWithContext,
+	}
+}
+
+func sleepWithContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	logger := slog.Default().With(slog.String("method", req.Method), slog.String("url", req.URL.Path))
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 && req.Body != nil {
+			if req.GetBody == nil {
+				return nil, fmt.Errorf("can't retry the request %s %s: the body can't be rewound", req.Method, req.URL.Path)
+			}
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, fmt.Errorf("can't rewind the request body: %w", err)
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+		resp, err := t.upstream.RoundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+		if remaining := resp.Header.Get("X-RateLimit-Remaining"); remaining != "" {
+			logger.Debug("API quota", slog.String("remaining", remaining), slog.String("limit", resp.Header.Get("X-RateLimit-Limit")), slog.String("resource", resp.Header.Get("X-RateLimit-Resource")))
+		}
+		wait, rateLimitErr := t.retryDelay(req, resp, attempt)
+		if wait < 0 {
+			// no need to retry
+			return resp, nil
+		}
+		if attempt >= t.opts.MaxRetries || wait > t.opts.MaxWait {
+			if rateLimitErr == nil {
+				return resp, nil
+			}
+			discardBody(resp)
+			logger.Debug("rate limit hit and no more retry", slog.Int("attempt", attempt), slog.Duration("wait", wait))
+			return nil, rateLimitErr
+		}
+		discardBody(resp)
+		logger.Warn(fmt.Sprintf("API error (status code: %d) => let's retry in %s", resp.StatusCode, wait), slog.Int("attempt", attempt+1), slog.Int("maxRetries", t.opts.MaxRetries))
+		err = t.sleep(req.Context(), wait)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// retryDelay returns the delay to wait before retrying the request which gave the given response
+// (a negative delay means that the request must not be retried) and the error to return if we can't retry
+// (nil if it's not a rate limit)
+func (t *retryTransport) retryDelay(req *http.Request, resp *http.Response, attempt int) (time.Duration, *RateLimitError) {
+	switch {
+	case resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusTooManyRequests:
+		message := readAndRestoreBody(resp)
+		rateLimitErr := &RateLimitError{StatusCode: resp.StatusCode, Message: message}
+		if wait, ok := t.rateLimitHeadersDelay(resp, rateLimitErr); ok {
+			return wait, rateLimitErr
+		}
+		if strings.Contains(strings.ToLower(message), "secondary rate limit") {
+			rateLimitErr.Secondary = true
+			rateLimitErr.ResetAt = t.now().Add(defaultSecondaryRateLimitWait)
+			return defaultSecondaryRateLimitWait, rateLimitErr
+		}
+		// classic permission error
+		return -1, nil
+	case resp.StatusCode == http.StatusOK && isGraphQLRequest(req):
+		message, rateLimited := graphqlRateLimitMessage(resp)
+		if !rateLimited {
+			return -1, nil
+		}
+		rateLimitErr := &RateLimitError{StatusCode: resp.StatusCode, Message: message}
+		if wait, ok := t.rateLimitHeadersDelay(resp, rateLimitErr); ok {
+			return wait, rateLimitErr
+		}
+		rateLimitErr.ResetAt = t.now().Add(defaultGraphQLRateLimitWait)
+		return defaultGraphQLRateLimitWait, rateLimitErr
+	case resp.StatusCode == http.StatusInternalServerError || resp.StatusCode == http.StatusBadGateway || resp.StatusCode == http.StatusServiceUnavailable || resp.StatusCode == http.StatusGatewayTimeout:
+		if !isIdempotent(req) {
+			return -1, nil
+		}
+		return t.opts.BaseDelay * time.Duration(1<<attempt), nil
+	}
+	return -1, nil
+}
+
+// rateLimitHeadersDelay returns the delay to wait given by the rate limit headers of the given response
+// (Retry-After for secondary rate limits or X-RateLimit-Remaining/X-RateLimit-Reset for primary ones),
+// false if there is no such header (rateLimitErr is completed with the reset time)
+func (t *retryTransport) rateLimitHeadersDelay(resp *http.Response, rateLimitErr *RateLimitError) (time.Duration, bool) {
+	if retryAfter := resp.Header.Get("Retry-After"); retryAfter != "" {
+		seconds, err := strconv.Atoi(retryAfter)
+		if err == nil {
+			wait := time.Duration(seconds) * time.Second
+			rateLimitErr.Secondary = true
+			rateLimitErr.ResetAt = t.now().Add(wait)
+			return wait, true
+		}
+	}
+	if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+		reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64)
+		if err == nil {
+			rateLimitErr.ResetAt = time.Unix(reset, 0)
+			return max(rateLimitErr.ResetAt.Sub(t.now())+time.Second, 0), true // +1s to avoid clock skew issues
+		}
+	}
+	return 0, false
+}
+
+// isGraphQLRequest returns true if the given request is a GraphQL one
+// (POST on a path ending with /graphql, example: /graphql or /api/graphql)
+func isGraphQLRequest(req *http.Request) bool {
+	return req.Method == http.MethodPost && strings.HasSuffix(req.URL.Path, "/graphql")
+}
+
+// graphqlRateLimitMessage returns the message of the RATE_LIMITED error of the given GraphQL response
+// (the body is restored so it can be read again) and false if there is no such error
+//
+// Note: GitHub returns GraphQL rate limits with a 200 status code.
+func graphqlRateLimitMessage(resp *http.Response) (string, bool) {
+	if resp.Body == nil {
+		return "", false
+	}
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	var graphqlResponse struct {
+		Errors []struct {
+			Type    string `json:"type"`
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if json.Unmarshal(body, &graphqlResponse) != nil {
+		return "", false
+	}
+	for _, e := range graphqlResponse.Errors {
+		if e.Type == GraphQLRateLimitedType {
+			return e.Message, true
+		}
+	}
+	return "", false
+}
+
+// isIdempotent returns true if the given request can be sent again without side effects
+// (same rules as net/http: idempotent method or Idempotency-Key/X-Idempotency-Key header, even nil)
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	_, ok := req.Header["Idempotency-Key"]
+	if !ok {
+		_, ok = req.Header["X-Idempotency-Key"]
+	}
+	return ok
+}
+
+// readAndRestoreBody reads the body of the given response (and restores it so it can be read again)
+// and returns the error message (or the raw body if it's not a JSON error with a message)
+func readAndRestoreBody(resp *http.Response) string {
+	if resp.Body == nil {
+		return ""
+	}
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	var errorResponse struct {
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(body, &errorResponse) == nil && errorResponse.Message != "" {
+		return errorResponse.Message
+	}
+	return strings.TrimSpace(string(body))
+}
+
+func discardBody(resp *http.Response) {
+	if resp.Body == nil {
+		return
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+}
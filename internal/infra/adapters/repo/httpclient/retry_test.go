@@ -0,0 +1,239 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeResponse struct {
+	status  int
+	headers map[string]string
+	body    string
+}
+
+// newRetryTestClient returns an http client using a retry transport (with a fake clock and a fake sleep)
+// on a fake server returning the given responses (the last one is repeated)
+func newRetryTestClient(t *testing.T, opts RetryOptions, responses ...fakeResponse) (*http.Client, *httptest.Server, *[]time.Duration) {
+	t.Helper()
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		response := responses[min(calls, len(responses)-1)]
+		calls++
+		for k, v := range response.headers {
+			w.Header().Set(k, v)
+		}
+		w.WriteHeader(response.status)
+		_, _ = w.Write([]byte(response.body))
+	}))
+	t.Cleanup(server.Close)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	sleeps := []time.Duration{}
+	transport := NewRetryTransport(nil, opts).(*retryTransport)
+	transport.now = func() time.Time { return now }
+	transport.sleep = func(ctx context.Context, d time.Duration) error {
+		sleeps = append(sleeps, d)
+		return nil
+	}
+	return &http.Client{Transport: transport}, server, &sleeps
+}
+
+func TestRetryTransport5xx(t *testing.T) {
+	client, server, sleeps := newRetryTestClient(t, RetryOptions{MaxRetries: 3, BaseDelay: time.Second},
+		fakeResponse{status: 502},
+		fakeResponse{status: 503},
+		fakeResponse{status: 200, body: "ok"},
+	)
+	resp, err := client.Get(server.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second}, *sleeps)
+
+	// retries run out => the last response is returned as is
+	client, server, sleeps = newRetryTestClient(t, RetryOptions{MaxRetries: 2, BaseDelay: time.Second}, fakeResponse{status: 500})
+	resp, err = client.Get(server.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, 500, resp.StatusCode)
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second}, *sleeps)
+}
+
+func TestRetryTransportPrimaryRateLimit(t *testing.T) {
+	reset := time.Date(2024, 1, 1, 0, 1, 0, 0, time.UTC)
+	rateLimited := fakeResponse{
+		status: 403,
+		headers: map[string]string{
+			"X-RateLimit-Remaining": "0",
+			"X-RateLimit-Reset":     fmt.Sprintf("%d", reset.Unix()),
+		},
+		body: `{"message": "API rate limit exceeded"}`,
+	}
+	client, server, sleeps := newRetryTestClient(t, RetryOptions{MaxRetries: 3}, rateLimited, fakeResponse{status: 200})
+	resp, err := client.Get(server.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, []time.Duration{61 * time.Second}, *sleeps)
+
+	// reset too far in the future => typed error without waiting
+	client, server, sleeps = newRetryTestClient(t, RetryOptions{MaxRetries: 3, MaxWait: 30 * time.Second}, rateLimited)
+	_, err = client.Get(server.URL)
+	var rateLimitErr *RateLimitError
+	require.True(t, errors.As(err, &rateLimitErr))
+	assert.False(t, rateLimitErr.Secondary)
+	assert.Equal(t, reset, rateLimitErr.ResetAt.UTC())
+	assert.Equal(t, "API rate limit exceeded", rateLimitErr.Message)
+	assert.Empty(t, *sleeps)
+}
+
+func TestRetryTransportSecondaryRateLimit(t *testing.T) {
+	client, server, sleeps := newRetryTestClient(t, RetryOptions{MaxRetries: 2},
+		fakeResponse{status: 429, headers: map[string]string{"Retry-After": "10"}},
+	)
+	_, err := client.Get(server.URL)
+	var rateLimitErr *RateLimitError
+	require.True(t, errors.As(err, &rateLimitErr))
+	assert.True(t, rateLimitErr.Secondary)
+	assert.Equal(t, 429, rateLimitErr.StatusCode)
+	assert.Equal(t, []time.Duration{10 * time.Second, 10 * time.Second}, *sleeps)
+
+	// without Retry-After header
+	client, server, sleeps = newRetryTestClient(t, RetryOptions{MaxRetries: 1},
+		fakeResponse{status: 403, body: `{"message": "You have exceeded a secondary rate limit."}`},
+		fakeResponse{status: 200},
+	)
+	resp, err := client.Get(server.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, []time.Duration{time.Minute}, *sleeps)
+}
+
+func TestRetryTransportGraphQLRateLimit(t *testing.T) {
+	reset := time.Date(2024, 1, 1, 0, 1, 0, 0, time.UTC)
+	rateLimited := fakeResponse{
+		status: 200,
+		headers: map[string]string{
+			"X-RateLimit-Remaining": "0",
+			"X-RateLimit-Reset":     fmt.Sprintf("%d", reset.Unix()),
+		},
+		body: `{"data": null, "errors": [{"type": "RATE_LIMITED", "message": "API rate limit exceeded for user ID 1."}]}`,
+	}
+	client, server, sleeps := newRetryTestClient(t, RetryOptions{MaxRetries: 3}, rateLimited, fakeResponse{status: 200, body: `{"data": {}}`})
+	resp, err := client.Post(server.URL+"/api/graphql", "application/json", strings.NewReader("{}"))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, `{"data": {}}`, string(body))
+	assert.Equal(t, []time.Duration{61 * time.Second}, *sleeps)
+
+	// retries run out => typed error (without rate limit headers => 1 minute)
+	rateLimited.headers = nil
+	client, server, sleeps = newRetryTestClient(t, RetryOptions{MaxRetries: 1}, rateLimited)
+	_, err = client.Post(server.URL+"/graphql", "application/json", strings.NewReader("{}"))
+	var rateLimitErr *RateLimitError
+	require.True(t, errors.As(err, &rateLimitErr))
+	assert.Equal(t, 200, rateLimitErr.StatusCode)
+	assert.Equal(t, "API rate limit exceeded for user ID 1.", rateLimitErr.Message)
+	assert.Equal(t, []time.Duration{time.Minute}, *sleeps)
+
+	// other GraphQL errors => no retry (and the body can still be read)
+	client, server, sleeps = newRetryTestClient(t, RetryOptions{MaxRetries: 3},
+		fakeResponse{status: 200, body: `{"errors": [{"type": "NOT_FOUND", "message": "not found"}]}`},
+	)
+	resp, err = client.Post(server.URL+"/graphql", "application/json", strings.NewReader("{}"))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err = io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), "NOT_FOUND")
+	assert.Empty(t, *sleeps)
+
+	// not a GraphQL request => no retry
+	client, server, sleeps = newRetryTestClient(t, RetryOptions{MaxRetries: 3}, rateLimited)
+	resp, err = client.Post(server.URL+"/other", "application/json", strings.NewReader("{}"))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Empty(t, *sleeps)
+}
+
+func TestRetryTransportNoRetry(t *testing.T) {
+	// classic permission error => no retry
+	client, server, sleeps := newRetryTestClient(t, RetryOptions{MaxRetries: 3},
+		fakeResponse{status: 403, body: `{"message": "Resource not accessible by integration"}`},
+	)
+	resp, err := client.Get(server.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, 403, resp.StatusCode)
+	assert.Empty(t, *sleeps)
+}
+
+func TestRetryTransportRewindsBody(t *testing.T) {
+	bodies := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		if len(bodies) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer server.Close()
+	transport := NewRetryTransport(nil, RetryOptions{MaxRetries: 1, BaseDelay: time.Millisecond})
+	client := &http.Client{Transport: transport}
+	req, err := http.NewRequest(http.MethodPut, server.URL, strings.NewReader("payload"))
+	require.NoError(t, err)
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, []string{"payload", "payload"}, bodies)
+}
+
+func TestRetryTransportNoRetryOfNonIdempotent5xx(t *testing.T) {
+	// the POST may have been processed => no retry
+	client, server, sleeps := newRetryTestClient(t, RetryOptions{MaxRetries: 3, BaseDelay: time.Second},
+		fakeResponse{status: 502},
+		fakeResponse{status: 200, body: "ok"},
+	)
+	resp, err := client.Post(server.URL, "application/json", strings.NewReader("{}"))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, 502, resp.StatusCode)
+	assert.Empty(t, *sleeps)
+
+	// ... unless it's marked as idempotent
+	client, server, sleeps = newRetryTestClient(t, RetryOptions{MaxRetries: 3, BaseDelay: time.Second},
+		fakeResponse{status: 502},
+		fakeResponse{status: 200, body: "ok"},
+	)
+	req, err := http.NewRequest(http.MethodPost, server.URL, strings.NewReader("{}"))
+	require.NoError(t, err)
+	req.Header["X-Idempotency-Key"] = nil
+	resp, err = client.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, []time.Duration{time.Second}, *sleeps)
+
+	// rate limits are still retried (the request was rejected)
+	client, server, sleeps = newRetryTestClient(t, RetryOptions{MaxRetries: 3},
+		fakeResponse{status: 403, headers: map[string]string{"Retry-After": "10"}},
+		fakeResponse{status: 200, body: "ok"},
+	)
+	resp, err = client.Post(server.URL, "application/json", strings.NewReader("{}"))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, []time.Duration{10 * time.Second}, *sleeps)
+}
@@ -0,0 +1,116 @@
+// Package httpclient provides the http client (proxy, TLS, timeouts, retries on rate limits and 5xx errors,
+// cassettes) shared by the repo adapters of all the providers
+package httpclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+type TransportOptions struct {
+	ProxyURL       string        // HTTP(S) proxy url, empty => HTTPS_PROXY/HTTP_PROXY/NO_PROXY env vars are used
+	CABundleFile   string        // path of a PEM file with extra CA certificates (added to the system ones)
+	ClientCertFile string        // path of a PEM client certificate (for mutual TLS)
+	ClientKeyFile  string        // path of the PEM private key of the client certificate
+	Timeout        time.Duration // timeout for connecting and waiting for the response headers (per attempt), <=0 => no timeout
+	UserAgent      string        // user agent, empty => default one (of the Go http client or of the provider SDK)
+	Cassette       *Cassette     // if set, HTTP interactions are recorded into (or replayed from) this cassette
+}
+
+// userAgentTransport is an http.RoundTripper overriding the User-Agent header
+type userAgentTransport struct {
+	upstream  http.RoundTripper
+	userAgent string
+}
+
+func (t *userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context()) // a RoundTripper must not modify the given request
+	req.Header.Set("User-Agent", t.userAgent)
+	return t.upstream.RoundTrip(req)
+}
+
+// NewBaseTransport returns a new base http.RoundTripper configured with the given options (without retries)
+func NewBaseTransport(opts TransportOptions) (http.RoundTripper, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if opts.ProxyURL != "" {
+		proxyURL, err := url.Parse(opts.ProxyURL)
+		if err != nil || proxyURL.Scheme == "" || proxyURL.Host == "" {
+			return nil, fmt.Errorf("bad proxy url: %s", opts.ProxyURL)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	if opts.CABundleFile != "" || opts.ClientCertFile != "" || opts.ClientKeyFile != "" {
+		tlsConfig, err := newTLSConfig(opts)
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+	if opts.Timeout > 0 {
+		transport.DialContext = (&net.Dialer{Timeout: opts.Timeout, KeepAlive: 30 * time.Second}).DialContext
+		transport.TLSHandshakeTimeout = opts.Timeout
+		transport.ResponseHeaderTimeout = opts.Timeout
+	}
+	var res http.RoundTripper = transport
+	if opts.UserAgent != "" {
+		res = &userAgentTransport{upstream: res, userAgent: opts.UserAgent}
+	}
+	if opts.Cassette != nil {
+		res = opts.Cassette.Transport(res)
+	}
+	return res, nil
+}
+
+func newTLSConfig(opts TransportOptions) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if opts.CABundleFile != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		pemData, err := os.ReadFile(opts.CABundleFile)
+		if err != nil {
+			return nil, fmt.Errorf("can't read the CA bundle file: %w", err)
+		}
+		if !pool.AppendCertsFromPEM(pemData) {
+			return nil, fmt.Errorf("no valid PEM certificate found in the CA bundle file: %s", opts.CABundleFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if opts.ClientCertFile != "" || opts.ClientKeyFile != "" {
+		if opts.ClientCertFile == "" || opts.ClientKeyFile == "" {
+			return nil, errors.New("both client certificate and client key files must be set")
+		}
+		cert, err := tls.LoadX509KeyPair(opts.ClientCertFile, opts.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("can't load the client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// NewTransport returns a new http.RoundTripper configured with the given transport options and retry policy
+func NewTransport(transportOpts TransportOptions, retryOpts RetryOptions) (http.RoundTripper, error) {
+	transport, err := NewBaseTransport(transportOpts)
+	if err != nil {
+		return nil, err
+	}
+	return NewRetryTransport(transport, retryOpts), nil
+}
+
+// NewClient returns an http client configured with the given transport options and retry policy
+func NewClient(transportOpts TransportOptions, retryOpts RetryOptions) (*http.Client, error) {
+	transport, err := NewTransport(transportOpts, retryOpts)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{Transport: transport}, nil
+}
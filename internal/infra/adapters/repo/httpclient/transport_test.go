@@ -0,0 +1,82 @@
+package httpclient
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransportProxyAndUserAgent(t *testing.T) {
+	requests := []*http.Request{}
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r)
+		_, _ = w.Write([]byte("[]"))
+	}))
+	defer proxy.Close()
+	client, err := NewClient(TransportOptions{ProxyURL: proxy.URL, UserAgent: "my-agent"}, RetryOptions{})
+	require.NoError(t, err)
+	resp, err := client.Get("http://api.example.com/repos/foo/bar/pulls")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Len(t, requests, 1)
+	assert.Equal(t, "api.example.com", requests[0].Host)
+	assert.Equal(t, "/repos/foo/bar/pulls", requests[0].URL.Path)
+	assert.Equal(t, "my-agent", requests[0].Header.Get("User-Agent"))
+
+	_, err = NewBaseTransport(TransportOptions{ProxyURL: "not-an-url"})
+	assert.ErrorContains(t, err, "bad proxy url")
+}
+
+func TestTransportCABundle(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("[]"))
+	}))
+	defer server.Close()
+
+	// without the CA bundle => unknown authority
+	client, err := NewClient(TransportOptions{}, RetryOptions{})
+	require.NoError(t, err)
+	_, err = client.Get(server.URL)
+	assert.Error(t, err)
+
+	caBundleFile := filepath.Join(t.TempDir(), "ca.pem")
+	pemData := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	require.NoError(t, os.WriteFile(caBundleFile, pemData, 0600))
+	client, err = NewClient(TransportOptions{CABundleFile: caBundleFile}, RetryOptions{})
+	require.NoError(t, err)
+	resp, err := client.Get(server.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+}
+
+func TestTransportTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(500 * time.Millisecond)
+		_, _ = w.Write([]byte("[]"))
+	}))
+	defer server.Close()
+	client, err := NewClient(TransportOptions{Timeout: 50 * time.Millisecond}, RetryOptions{})
+	require.NoError(t, err)
+	_, err = client.Get(server.URL)
+	assert.ErrorContains(t, err, "timeout")
+}
+
+func TestTransportBadOptions(t *testing.T) {
+	_, err := NewBaseTransport(TransportOptions{CABundleFile: "/does/not/exist"})
+	assert.ErrorContains(t, err, "CA bundle")
+	emptyFile := filepath.Join(t.TempDir(), "empty.pem")
+	require.NoError(t, os.WriteFile(emptyFile, []byte("foo"), 0600))
+	_, err = NewBaseTransport(TransportOptions{CABundleFile: emptyFile})
+	assert.ErrorContains(t, err, "no valid PEM certificate")
+	_, err = NewClient(TransportOptions{ClientCertFile: emptyFile}, RetryOptions{})
+	assert.ErrorContains(t, err, "both client certificate and client key")
+	_, err = NewBaseTransport(TransportOptions{ClientCertFile: emptyFile, ClientKeyFile: emptyFile})
+	assert.ErrorContains(t, err, "client certificate")
+}
@@ -1,17 +1,26 @@
 package cli
 
 import (
+	"cmp"
 	"fmt"
 	"log/slog"
+	"net/url"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/fabien-marty/github-next-semantic-version/internal/app"
 	"github.com/fabien-marty/github-next-semantic-version/internal/app/git"
 	"github.com/fabien-marty/github-next-semantic-version/internal/app/repo"
+	gitcommon "github.com/fabien-marty/github-next-semantic-version/internal/infra/adapters/git/common"
+	gitgogit "github.com/fabien-marty/github-next-semantic-version/internal/infra/adapters/git/gogit"
 	gitlocal "github.com/fabien-marty/github-next-semantic-version/internal/infra/adapters/git/local"
+	repobitbucket "github.com/fabien-marty/github-next-semantic-version/internal/infra/adapters/repo/bitbucket"
 	repocache "github.com/fabien-marty/github-next-semantic-version/internal/infra/adapters/repo/cache"
+	repofile "github.com/fabien-marty/github-next-semantic-version/internal/infra/adapters/repo/file"
 	repogithub "github.com/fabien-marty/github-next-semantic-version/internal/infra/adapters/repo/github"
+	repogitlab "github.com/fabien-marty/github-next-semantic-version/internal/infra/adapters/repo/gitlab"
+	"github.com/fabien-marty/github-next-semantic-version/internal/infra/adapters/repo/httpclient"
 	"github.com/fabien-marty/slog-helpers/pkg/slogc"
 	"github.com/urfave/cli/v2"
 )
@@ -29,11 +38,197 @@ var commonCliFlags = []cli.Flag{
 		Usage:   "log format (text-human, text, json, json-gcp)",
 		EnvVars: []string{"LOG_FORMAT"},
 	},
+	&cli.StringFlag{
+		Name:    "git-backend",
+		Value:   "exec",
+		Usage:   "git backend to use: 'exec' (uses the git binary) or 'gogit' (pure go implementation, no git binary needed)",
+		EnvVars: []string{"GNSV_GIT_BACKEND"},
+	},
+	&cli.BoolFlag{
+		Name:    "auto-fetch",
+		Value:   false,
+		Usage:   "If set, fetch tags (and unshallow) the local git repository if needed (only with the 'exec' git backend)",
+		EnvVars: []string{"GNSV_AUTO_FETCH"},
+	},
+	&cli.StringFlag{
+		Name:    "remote",
+		Value:   "",
+		Usage:   "git remote to use for tags and branches; if not set, 'origin' is used (or 'upstream' if 'origin' looks like a fork of 'upstream')",
+		EnvVars: []string{"GNSV_REMOTE"},
+	},
+	&cli.StringFlag{
+		Name:    "repo-remote",
+		Value:   "",
+		Usage:   "git remote to use for guessing the repository owner and name; if not set, the same as --remote",
+		EnvVars: []string{"GNSV_REPO_REMOTE"},
+	},
+	&cli.StringFlag{
+		Name:    "provider",
+		Value:   "auto",
+		Usage:   "Repository hosting provider: 'github', 'gitlab', 'gitea' (also for Forgejo), 'bitbucket' or 'auto' (guessed from the CI environment or from the git remote host, GitHub if unknown)",
+		EnvVars: []string{"GNSV_PROVIDER"},
+	},
+	&cli.StringFlag{
+		Name:    "repo-backend",
+		Value:   "api",
+		Usage:   "Where to read pull-requests from: 'api' (the API of the provider, see --provider) or 'file:PATH' (offline, from a JSON or YAML fixture file, see github-export-pull-requests; created releases are recorded into --repo-backend-releases-file)",
+		EnvVars: []string{"GNSV_REPO_BACKEND"},
+	},
+	&cli.StringFlag{
+		Name:    "repo-backend-releases-file",
+		Usage:   "With --repo-backend=file:PATH, path of the JSON or YAML file where created releases are recorded; if not set, PATH with a '.releases' suffix before the extension",
+		EnvVars: []string{"GNSV_REPO_BACKEND_RELEASES_FILE"},
+	},
 	&cli.StringFlag{
 		Name:    "github-token",
 		Usage:   "github token",
 		EnvVars: []string{"GITHUB_TOKEN"},
 	},
+	&cli.Int64Flag{
+		Name:    "github-app-id",
+		Usage:   "GitHub App id (to authenticate as a GitHub App installation instead of using --github-token)",
+		EnvVars: []string{"GNSV_GITHUB_APP_ID"},
+	},
+	&cli.Int64Flag{
+		Name:    "github-app-installation-id",
+		Usage:   "GitHub App installation id (mandatory with --github-app-id)",
+		EnvVars: []string{"GNSV_GITHUB_APP_INSTALLATION_ID"},
+	},
+	&cli.StringFlag{
+		Name:    "github-app-private-key-file",
+		Usage:   "path of the GitHub App private key (PEM) file (mandatory with --github-app-id if --github-app-private-key is not set)",
+		EnvVars: []string{"GNSV_GITHUB_APP_PRIVATE_KEY_FILE"},
+	},
+	&cli.StringFlag{
+		Name:    "github-app-private-key",
+		Usage:   "GitHub App private key (PEM content), you should prefer the env var to the flag",
+		EnvVars: []string{"GNSV_GITHUB_APP_PRIVATE_KEY"},
+	},
+	&cli.StringFlag{
+		Name:    "github-base-url",
+		Value:   "",
+		Usage:   "GitHub Enterprise Server API base url (example: https://github.example.com/api/v3/); if not set, api.github.com is used",
+		EnvVars: []string{"GNSV_GITHUB_BASE_URL"},
+	},
+	&cli.StringFlag{
+		Name:    "github-upload-url",
+		Value:   "",
+		Usage:   "GitHub Enterprise Server upload url (example: https://github.example.com/api/uploads/); if not set, the same as --github-base-url",
+		EnvVars: []string{"GNSV_GITHUB_UPLOAD_URL"},
+	},
+	&cli.StringFlag{
+		Name:    "github-api",
+		Value:   "rest",
+		Usage:   "GitHub API to use for reading pull-requests: 'rest' or 'graphql' (far less requests for big repositories)",
+		EnvVars: []string{"GNSV_GITHUB_API"},
+	},
+	&cli.BoolFlag{
+		Name:    "github-complete-pull-requests",
+		Value:   false,
+		Usage:   "With --github-api=rest, get each merged pull-request and the reviews of each pull-request to know who merged/approved it (more requests, not needed with --github-api=graphql)",
+		EnvVars: []string{"GNSV_GITHUB_COMPLETE_PULL_REQUESTS"},
+	},
+	&cli.IntFlag{
+		Name:    "http-max-retries",
+		Aliases: []string{"github-max-retries"},
+		Value:   3,
+		Usage:   "Max number of retries of an API request (on rate limits or 5xx errors of idempotent requests), 0 => no retry",
+		EnvVars: []string{"GNSV_HTTP_MAX_RETRIES", "GNSV_GITHUB_MAX_RETRIES"},
+	},
+	&cli.IntFlag{
+		Name:    "http-max-rate-limit-wait",
+		Aliases: []string{"github-max-rate-limit-wait"},
+		Value:   300,
+		Usage:   "Max time (in seconds) to wait for an API rate limit reset before failing",
+		EnvVars: []string{"GNSV_HTTP_MAX_RATE_LIMIT_WAIT", "GNSV_GITHUB_MAX_RATE_LIMIT_WAIT"},
+	},
+	&cli.StringFlag{
+		Name:    "http-proxy",
+		Aliases: []string{"github-proxy"},
+		Usage:   "HTTP(S) proxy url to use for API requests; if not set, HTTPS_PROXY/HTTP_PROXY/NO_PROXY env vars are used",
+		EnvVars: []string{"GNSV_HTTP_PROXY", "GNSV_GITHUB_PROXY"},
+	},
+	&cli.StringFlag{
+		Name:    "http-ca-bundle",
+		Aliases: []string{"github-ca-bundle"},
+		Usage:   "path of a PEM file with extra CA certificates to trust for API requests (added to the system ones)",
+		EnvVars: []string{"GNSV_HTTP_CA_BUNDLE", "GNSV_GITHUB_CA_BUNDLE"},
+	},
+	&cli.StringFlag{
+		Name:    "http-client-cert",
+		Aliases: []string{"github-client-cert"},
+		Usage:   "path of a PEM client certificate to use for API requests (mutual TLS, needs --http-client-key)",
+		EnvVars: []string{"GNSV_HTTP_CLIENT_CERT", "GNSV_GITHUB_CLIENT_CERT"},
+	},
+	&cli.StringFlag{
+		Name:    "http-client-key",
+		Aliases: []string{"github-client-key"},
+		Usage:   "path of the PEM private key of --http-client-cert",
+		EnvVars: []string{"GNSV_HTTP_CLIENT_KEY", "GNSV_GITHUB_CLIENT_KEY"},
+	},
+	&cli.IntFlag{
+		Name:    "http-timeout",
+		Aliases: []string{"github-timeout"},
+		Value:   60,
+		Usage:   "Timeout (in seconds) for connecting and waiting for the response of an API request, 0 => no timeout",
+		EnvVars: []string{"GNSV_HTTP_TIMEOUT", "GNSV_GITHUB_TIMEOUT"},
+	},
+	&cli.StringFlag{
+		Name:    "http-user-agent",
+		Aliases: []string{"github-user-agent"},
+		Usage:   "User agent to use for API requests; if not set, the default one is used",
+		EnvVars: []string{"GNSV_HTTP_USER_AGENT", "GNSV_GITHUB_USER_AGENT"},
+	},
+	&cli.StringFlag{
+		Name:    "http-record",
+		Usage:   "path of a cassette (JSON) file where all the API requests and responses are recorded (request headers, so credentials, are not recorded), useful to attach a reproducible trace to a bug report",
+		EnvVars: []string{"GNSV_HTTP_RECORD"},
+	},
+	&cli.StringFlag{
+		Name:    "http-replay",
+		Usage:   "path of a cassette (JSON) file (see --http-record) to serve API responses from (no network request)",
+		EnvVars: []string{"GNSV_HTTP_REPLAY"},
+	},
+	&cli.StringFlag{
+		Name:    "gitlab-token",
+		Usage:   "GitLab (personal, group or project) access token (with --provider=gitlab)",
+		EnvVars: []string{"GNSV_GITLAB_TOKEN", "GITLAB_TOKEN"},
+	},
+	&cli.StringFlag{
+		Name:    "gitlab-base-url",
+		Usage:   "GitLab API base url (with --provider=gitlab, example: https://gitlab.example.com/api/v4/), if not set, https://gitlab.com/api/v4/ is used",
+		EnvVars: []string{"GNSV_GITLAB_BASE_URL", "CI_API_V4_URL"},
+	},
+	&cli.StringFlag{
+		Name:    "gitea-token",
+		Usage:   "Gitea/Forgejo access token (with --provider=gitea)",
+		EnvVars: []string{"GNSV_GITEA_TOKEN", "GITEA_TOKEN"},
+	},
+	&cli.StringFlag{
+		Name:    "gitea-base-url",
+		Usage:   "Gitea/Forgejo API base url (with --provider=gitea, example: https://codeberg.org/api/v1/), if not set, it's guessed from the git remote host",
+		EnvVars: []string{"GNSV_GITEA_BASE_URL"},
+	},
+	&cli.StringFlag{
+		Name:    "bitbucket-token",
+		Usage:   "Bitbucket (repository, project or workspace) access token (with --provider=bitbucket)",
+		EnvVars: []string{"GNSV_BITBUCKET_TOKEN", "BITBUCKET_TOKEN"},
+	},
+	&cli.StringFlag{
+		Name:    "bitbucket-username",
+		Usage:   "Bitbucket username (with --provider=bitbucket and --bitbucket-app-password, ignored if --bitbucket-token is set)",
+		EnvVars: []string{"GNSV_BITBUCKET_USERNAME"},
+	},
+	&cli.StringFlag{
+		Name:    "bitbucket-app-password",
+		Usage:   "Bitbucket app password (Bitbucket Cloud) or password (Bitbucket Server) for --bitbucket-username",
+		EnvVars: []string{"GNSV_BITBUCKET_APP_PASSWORD"},
+	},
+	&cli.StringFlag{
+		Name:    "bitbucket-base-url",
+		Usage:   "Bitbucket Server/Data Center url (with --provider=bitbucket, example: https://bitbucket.example.com/), if not set, Bitbucket Cloud is used",
+		EnvVars: []string{"GNSV_BITBUCKET_BASE_URL"},
+	},
 	&cli.StringFlag{
 		Name:    "repo-owner",
 		Usage:   "repository owner (organization); if not set, we are going to try to guess",
@@ -75,6 +270,30 @@ var commonCliFlags = []cli.Flag{
 		Usage:   "Coma separated list of PR labels that PRs must have to be considered (OR condition, empty => no filtering)",
 		EnvVars: []string{"GNSV_MUST_HAVE_LABELS"},
 	},
+	&cli.BoolFlag{
+		Name:    "linked-issues",
+		Value:   false,
+		Usage:   "Resolve the issues closed by PRs (available in templates as .LinkedIssues, with the 'rest' GitHub API only closing keywords in PR bodies are considered)",
+		EnvVars: []string{"GNSV_LINKED_ISSUES"},
+	},
+	&cli.BoolFlag{
+		Name:    "linked-issues-labels",
+		Value:   false,
+		Usage:   "Use also the labels of the issues closed by PRs for major/minor classification (implies --linked-issues)",
+		EnvVars: []string{"GNSV_LINKED_ISSUES_LABELS"},
+	},
+	&cli.StringFlag{
+		Name:    "labels-fallback",
+		Value:   "none",
+		Usage:   "How to get the labels of PRs without labels (useful with Bitbucket which has no labels): 'none', 'title-prefix' (conventional commit like prefix of the title, 'fix(parser)!: foo' => 'fix' and 'breaking' labels) or 'branch-prefix' (source branch prefix, 'feature/foo' => 'feature' label)",
+		EnvVars: []string{"GNSV_LABELS_FALLBACK"},
+	},
+	&cli.IntFlag{
+		Name:    "concurrency",
+		Value:   4,
+		Usage:   "Maximum number of concurrent requests to the repository API (pages, open/merged PRs, branches), 1 => sequential",
+		EnvVars: []string{"GNSV_CONCURRENCY"},
+	},
 	&cli.IntFlag{
 		Name:  "minimal-delay-in-seconds",
 		Value: 5,
@@ -132,30 +351,67 @@ func setDefaultLogger(cCtx *cli.Context) {
 	slog.SetDefault(logger)
 }
 
-func getRepoOwnerAndRepoName(cCtx *cli.Context, gitLocalAdapter git.Port) (repoOwner string, repoName string, err error) {
+func getRepoOwnerAndRepoName(cCtx *cli.Context, provider string, gitLocalAdapter git.Port, remote string) (repoOwner string, repoName string, err error) {
 	repoOwner = cCtx.String("repo-owner")
 	repoName = cCtx.String("repo-name")
 	if repoOwner == "" || repoName == "" {
-		ghActions := os.Getenv("GITHUB_ACTIONS")
-		if ghActions == "true" {
-			repoOwner, repoName = guessGHRepoFromEnv()
-		} else {
-			repoOwner, repoName = gitLocalAdapter.GuessGHRepo()
-		}
+		repoOwner, repoName = providers[provider].guessRepo(cCtx, gitLocalAdapter, remote)
 		if repoOwner == "" || repoName == "" {
 			return "", "", cli.Exit("Can't guess the repository owner and name => please provide them as CLI flags", 1)
 		}
 	}
 	return repoOwner, repoName, nil
 }
-func guessGHRepoFromEnv() (owner string, repo string) {
-	ghOwner := os.Getenv("GITHUB_REPOSITORY_OWNER")
-	ghRepository := os.Getenv("GITHUB_REPOSITORY")
-	if ghOwner != "" && ghRepository != "" {
-		// we are in a GitHub Actions environment
-		return ghOwner, ghRepository[len(ghOwner)+1:]
+
+// getRemoteUrl returns the url of the given git remote (empty string if not found)
+func getRemoteUrl(gitLocalAdapter git.Port, remote string) string {
+	remoteUrls, err := gitLocalAdapter.GetRemoteUrls()
+	if err != nil {
+		slog.Warn("can't list git remotes", slog.String("err", err.Error()))
+		return ""
 	}
-	return "", ""
+	return remoteUrls[remote]
+}
+
+// getProvider returns the name of the repository hosting provider to use (see providers)
+//
+// With --provider=auto, the provider is guessed from the CI environment, then from the host
+// of the given git remote (GitHub if unknown).
+func getProvider(cCtx *cli.Context, gitLocalAdapter git.Port, remote string) (string, error) {
+	provider := cCtx.String("provider")
+	if alias, found := providerAliases[provider]; found {
+		provider = alias
+	}
+	if _, found := providers[provider]; found {
+		return provider, nil
+	}
+	if provider != "auto" {
+		return "", cli.Exit(fmt.Sprintf("Unknown --provider value: %s (must be 'auto' or one of: %s)", provider, strings.Join(providerNames(), ", ")), 1)
+	}
+	switch {
+	case os.Getenv("GITEA_ACTIONS") == "true" || os.Getenv("FORGEJO_ACTIONS") == "true":
+		// must be tested before GITHUB_ACTIONS (also set by Gitea/Forgejo Actions)
+		provider = "gitea"
+	case os.Getenv("GITLAB_CI") == "true":
+		provider = "gitlab"
+	case os.Getenv("GITHUB_ACTIONS") == "true":
+		provider = "github"
+	case os.Getenv("BITBUCKET_BUILD_NUMBER") != "":
+		provider = "bitbucket"
+	default:
+		provider = gitcommon.GuessProvider(getRemoteUrl(gitLocalAdapter, remote), gitcommon.ProviderHosts{
+			GitHub:    getGitHubHosts(cCtx),
+			GitLab:    getGitLabHosts(cCtx),
+			Gitea:     getGiteaHosts(cCtx),
+			Bitbucket: getBitbucketHosts(cCtx),
+		})
+		if provider == "" {
+			slog.Debug("can't guess the provider from the git remote => let's use github")
+			provider = "github"
+		}
+	}
+	slog.Debug(fmt.Sprintf("provider guessed: %s", provider))
+	return provider, nil
 }
 
 func specialSplit(s string, sep string) []string {
@@ -173,23 +429,273 @@ func specialSplit(s string, sep string) []string {
 	return res
 }
 
+// getGitHubHosts returns the extra GitHub hosts to accept when guessing the repository from git remotes
+// (the host of the configured GitHub Enterprise Server, if any)
+func getGitHubHosts(cCtx *cli.Context) []string {
+	webBaseURL, err := repogithub.WebBaseURL(cCtx.String("github-base-url"))
+	if err != nil {
+		return nil
+	}
+	u, err := url.Parse(webBaseURL)
+	if err != nil {
+		return nil
+	}
+	return []string{u.Hostname()}
+}
+
+// getGitLabHosts returns the extra GitLab hosts to accept when guessing the repository from git remotes
+// (the host of the configured self-hosted GitLab, if any)
+func getGitLabHosts(cCtx *cli.Context) []string {
+	webBaseURL, err := repogitlab.WebBaseURL(cCtx.String("gitlab-base-url"))
+	if err != nil {
+		return nil
+	}
+	u, err := url.Parse(webBaseURL)
+	if err != nil {
+		return nil
+	}
+	return []string{u.Hostname()}
+}
+
+// getGiteaHosts returns the extra Gitea/Forgejo hosts to accept when guessing the provider from git remotes
+// (the host of the configured Gitea/Forgejo instance, if any)
+func getGiteaHosts(cCtx *cli.Context) []string {
+	if cCtx.String("gitea-base-url") == "" {
+		return nil
+	}
+	u, err := url.Parse(cCtx.String("gitea-base-url"))
+	if err != nil {
+		return nil
+	}
+	return []string{u.Hostname()}
+}
+
+// getBitbucketHosts returns the extra Bitbucket hosts to accept when guessing the provider from git remotes
+// (the host of the configured Bitbucket Server/Data Center, if any)
+func getBitbucketHosts(cCtx *cli.Context) []string {
+	if !repobitbucket.IsServerURL(cCtx.String("bitbucket-base-url")) {
+		return nil
+	}
+	u, err := url.Parse(cCtx.String("bitbucket-base-url"))
+	if err != nil {
+		return nil
+	}
+	return []string{u.Hostname()}
+}
+
+// getGitHubAppAuthOptions returns the GitHub App authentication options (nil if --github-app-id is not set)
+func getGitHubAppAuthOptions(cCtx *cli.Context) (*repogithub.AppAuthOptions, error) {
+	appID := cCtx.Int64("github-app-id")
+	if appID == 0 {
+		return nil, nil
+	}
+	installationID := cCtx.Int64("github-app-installation-id")
+	if installationID == 0 {
+		return nil, cli.Exit("You have to set --github-app-installation-id with --github-app-id", 1)
+	}
+	privateKey := []byte(cCtx.String("github-app-private-key"))
+	if len(privateKey) == 0 {
+		privateKeyFile := cCtx.String("github-app-private-key-file")
+		if privateKeyFile == "" {
+			return nil, cli.Exit("You have to set --github-app-private-key-file or --github-app-private-key with --github-app-id", 1)
+		}
+		var err error
+		privateKey, err = os.ReadFile(privateKeyFile)
+		if err != nil {
+			return nil, cli.Exit(fmt.Sprintf("Can't read the GitHub App private key file: %s", err), 1)
+		}
+	}
+	return &repogithub.AppAuthOptions{
+		AppID:          appID,
+		InstallationID: installationID,
+		PrivateKey:     privateKey,
+	}, nil
+}
+
+func getGitAdapter(cCtx *cli.Context, localGitPath string, remote string) (git.Port, error) {
+	switch cCtx.String("git-backend") {
+	case "exec":
+		return gitlocal.NewAdapter(gitlocal.AdapterOptions{
+			LocalGitPath:     localGitPath,
+			OriginBranchName: remote,
+			GitHubHosts:      getGitHubHosts(cCtx),
+			AutoFetch:        cCtx.Bool("auto-fetch"),
+		}), nil
+	case "gogit":
+		if cCtx.Bool("auto-fetch") {
+			slog.Warn("--auto-fetch is not supported with the 'gogit' git backend => ignored")
+		}
+		return gitgogit.NewAdapter(gitgogit.AdapterOptions{
+			LocalGitPath:     localGitPath,
+			OriginBranchName: remote,
+			GitHubHosts:      getGitHubHosts(cCtx),
+		}), nil
+	default:
+		return nil, cli.Exit(fmt.Sprintf("Unknown git backend: %s (must be 'exec' or 'gogit')", cCtx.String("git-backend")), 1)
+	}
+}
+
+// getRemotes returns the git remote to use for tags/branches and the one to use for guessing the repository owner/name
+// (if not set explicitly, we prefer "upstream" if "origin" looks like a fork of "upstream")
+func getRemotes(cCtx *cli.Context, localGitPath string) (tagsRemote string, repoRemote string, err error) {
+	tagsRemote = cCtx.String("remote")
+	repoRemote = cCtx.String("repo-remote")
+	if tagsRemote == "" {
+		gitAdapter, err := getGitAdapter(cCtx, localGitPath, "")
+		if err != nil {
+			return "", "", err
+		}
+		remoteUrls, err := gitAdapter.GetRemoteUrls()
+		if err != nil {
+			slog.Warn("can't list git remotes => let's use origin", slog.String("err", err.Error()))
+			tagsRemote = "origin"
+		} else {
+			tagsRemote = gitcommon.GuessPreferredRemote(remoteUrls, getGitHubHosts(cCtx)...)
+			if tagsRemote != "origin" {
+				slog.Info(fmt.Sprintf("origin remote looks like a fork of %s remote => let's use %s remote (use --remote to override)", tagsRemote, tagsRemote))
+			}
+		}
+	}
+	if repoRemote == "" {
+		repoRemote = tagsRemote
+	}
+	return tagsRemote, repoRemote, nil
+}
+
+// getHTTPCassette returns the cassette to use for http clients (nil if --http-record and --http-replay are not set)
+func getHTTPCassette(cCtx *cli.Context) (*httpclient.Cassette, error) {
+	recordPath := cCtx.String("http-record")
+	replayPath := cCtx.String("http-replay")
+	var cassette *httpclient.Cassette
+	var err error
+	switch {
+	case recordPath != "" && replayPath != "":
+		return nil, cli.Exit("--http-record and --http-replay are mutually exclusive", 1)
+	case recordPath != "":
+		cassette, err = httpclient.NewCassette(recordPath, httpclient.CassetteRecord)
+	case replayPath != "":
+		cassette, err = httpclient.NewCassette(replayPath, httpclient.CassetteReplay)
+	default:
+		return nil, nil
+	}
+	if err != nil {
+		return nil, cli.Exit(err.Error(), 1)
+	}
+	return cassette, nil
+}
+
+// getHTTPTransportOptions returns the http transport options (proxy, tls...) with the given cassette
+// (nil if not used, see getHTTPCassette)
+func getHTTPTransportOptions(cCtx *cli.Context, cassette *httpclient.Cassette) httpclient.TransportOptions {
+	return httpclient.TransportOptions{
+		ProxyURL:       cCtx.String("http-proxy"),
+		CABundleFile:   cCtx.String("http-ca-bundle"),
+		ClientCertFile: cCtx.String("http-client-cert"),
+		ClientKeyFile:  cCtx.String("http-client-key"),
+		Timeout:        time.Duration(cCtx.Int("http-timeout")) * time.Second,
+		UserAgent:      cCtx.String("http-user-agent"),
+		Cassette:       cassette,
+	}
+}
+
+// getRetryOptions returns the retry options for API requests
+func getRetryOptions(cCtx *cli.Context) httpclient.RetryOptions {
+	return httpclient.RetryOptions{
+		MaxRetries: cCtx.Int("http-max-retries"),
+		MaxWait:    time.Duration(cCtx.Int("http-max-rate-limit-wait")) * time.Second,
+	}
+}
+
+// getAPIRepoAdapter returns the repo adapter of the provider (see getProvider), the repository owner and name
+// and the corresponding web base url (http clients use the given cassette, nil if not used)
+func getAPIRepoAdapter(cCtx *cli.Context, gitLocalAdapter git.Port, remote string, cassette *httpclient.Cassette) (repoAdapter repo.Port, repoOwner string, repoName string, webBaseURL string, err error) {
+	provider, err := getProvider(cCtx, gitLocalAdapter, remote)
+	if err != nil {
+		return nil, "", "", "", err
+	}
+	if checkFlags := providers[provider].checkFlags; checkFlags != nil {
+		err = checkFlags(cCtx)
+		if err != nil {
+			return nil, "", "", "", err
+		}
+	}
+	repoOwner, repoName, err = getRepoOwnerAndRepoName(cCtx, provider, gitLocalAdapter, remote)
+	if err != nil {
+		return nil, "", "", "", err
+	}
+	repoAdapter, webBaseURL, err = providers[provider].newRepoAdapter(cCtx, repoOwner, repoName, gitLocalAdapter, remote, cassette)
+	if err != nil {
+		return nil, "", "", "", err
+	}
+	return repoAdapter, repoOwner, repoName, webBaseURL, nil
+}
+
+// getFileRepoAdapter returns the offline repo adapter reading the given fixture file, the repository owner
+// and name (from CLI flags or from the fixture) and the web base url (from the fixture or from --github-base-url)
+func getFileRepoAdapter(cCtx *cli.Context, fixturePath string) (repoAdapter repo.Port, repoOwner string, repoName string, webBaseURL string, err error) {
+	fileAdapter, err := repofile.NewAdapter(fixturePath, repofile.AdapterOptions{
+		ReleasesPath: cCtx.String("repo-backend-releases-file"),
+	})
+	if err != nil {
+		return nil, "", "", "", cli.Exit(err.Error(), 1)
+	}
+	repoOwner = cmp.Or(cCtx.String("repo-owner"), fileAdapter.Owner())
+	repoName = cmp.Or(cCtx.String("repo-name"), fileAdapter.Repo())
+	webBaseURL = fileAdapter.WebBaseURL()
+	if webBaseURL == "" {
+		webBaseURL, err = repogithub.WebBaseURL(cCtx.String("github-base-url"))
+		if err != nil {
+			return nil, "", "", "", cli.Exit(fmt.Sprintf("Bad --github-base-url: %s", err), 1)
+		}
+	}
+	slog.Debug(fmt.Sprintf("offline file repo backend: %s (releases are recorded into %s)", fixturePath, fileAdapter.ReleasesPath()))
+	return fileAdapter, repoOwner, repoName, webBaseURL, nil
+}
+
 func getService(cCtx *cli.Context) (*app.Service, error) {
 	localGitPath := cCtx.Args().Get(0)
 	if localGitPath == "" {
 		return nil, cli.Exit("You have to set LOCAL_GIT_REPO_PATH argument (use . for the currently dir)", 1)
 	}
-	var gitLocalAdapter git.Port = gitlocal.NewAdapter(gitlocal.AdapterOptions{
-		LocalGitPath: localGitPath,
-	})
-	repoOwner, repoName, err := getRepoOwnerAndRepoName(cCtx, gitLocalAdapter)
+	tagsRemote, repoRemote, err := getRemotes(cCtx, localGitPath)
+	if err != nil {
+		return nil, err
+	}
+	slog.Debug(fmt.Sprintf("Git remote for tags: %s, git remote for repository guessing: %s", tagsRemote, repoRemote))
+	gitLocalAdapter, err := getGitAdapter(cCtx, localGitPath, tagsRemote)
+	if err != nil {
+		return nil, err
+	}
+	repoGitAdapter := gitLocalAdapter
+	if repoRemote != tagsRemote {
+		repoGitAdapter, err = getGitAdapter(cCtx, localGitPath, repoRemote)
+		if err != nil {
+			return nil, err
+		}
+	}
+	cassette, err := getHTTPCassette(cCtx)
+	if err != nil {
+		return nil, err
+	}
+	var repoAdapter repo.Port
+	var repoOwner, repoName, webBaseURL string
+	if fixturePath, found := strings.CutPrefix(cCtx.String("repo-backend"), "file:"); found {
+		repoAdapter, repoOwner, repoName, webBaseURL, err = getFileRepoAdapter(cCtx, fixturePath)
+	} else if cCtx.String("repo-backend") == "api" {
+		repoAdapter, repoOwner, repoName, webBaseURL, err = getAPIRepoAdapter(cCtx, repoGitAdapter, repoRemote, cassette)
+	} else {
+		err = cli.Exit(fmt.Sprintf("Unknown --repo-backend value: %s (must be 'api' or 'file:PATH')", cCtx.String("repo-backend")), 1)
+	}
 	if err != nil {
 		return nil, err
 	}
 	slog.Debug(fmt.Sprintf("Repository owner: %s, repository name: %s", repoOwner, repoName))
-	repoGithubAdapter := repogithub.NewAdapter(repoOwner, repoName, repogithub.AdapterOptions{Token: cCtx.String("github-token")})
-	var repoAdapter repo.Port = repoGithubAdapter
-	if cCtx.Bool("cache") {
-		repoAdapter = repocache.NewAdapter(repoOwner, repoName, repoGithubAdapter, repocache.AdapterOptions{
+	labelsFallback, err := getLabelsFallback(cCtx)
+	if err != nil {
+		return nil, err
+	}
+	if cCtx.Bool("cache") && !strings.HasPrefix(cCtx.String("repo-backend"), "file:") {
+		repoAdapter = repocache.NewAdapter(repoOwner, repoName, repoAdapter, repocache.AdapterOptions{
 			CacheLocation:        cCtx.String("cache-location"),
 			CacheLifetime:        cCtx.Int("cache-lifetime"),
 			CacheDontTryToUpdate: cCtx.Bool("cache-dont-try-to-update"),
@@ -204,11 +710,28 @@ func getService(cCtx *cli.Context) (*app.Service, error) {
 		TagRegex:                  cCtx.String("tag-regex"),
 		RepoOwner:                 repoOwner,
 		RepoName:                  repoName,
+		WebBaseURL:                webBaseURL,
+		ResolveLinkedIssues:       cCtx.Bool("linked-issues"),
+		UseLinkedIssuesLabels:     cCtx.Bool("linked-issues-labels"),
+		Concurrency:               cCtx.Int("concurrency"),
+		LabelsFallback:            labelsFallback,
 	}
 	service := app.NewService(appConfig, repoAdapter, gitLocalAdapter)
 	return service, nil
 }
 
+// getLabelsFallback returns the labels fallback to use (see --labels-fallback)
+func getLabelsFallback(cCtx *cli.Context) (string, error) {
+	switch cCtx.String("labels-fallback") {
+	case "none", "":
+		return app.LabelsFallbackNone, nil
+	case app.LabelsFallbackTitlePrefix, app.LabelsFallbackBranchPrefix:
+		return cCtx.String("labels-fallback"), nil
+	default:
+		return "", cli.Exit(fmt.Sprintf("Unknown --labels-fallback value: %s (must be 'none', '%s' or '%s')", cCtx.String("labels-fallback"), app.LabelsFallbackTitlePrefix, app.LabelsFallbackBranchPrefix), 1)
+	}
+}
+
 func getBranches(cCtx *cli.Context, service *app.Service) []string {
 	branches := specialSplit(cCtx.String("branches"), ",")
 	if len(branches) == 0 {
@@ -1,17 +1,70 @@
 package cli
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
 	"os"
+	"slices"
 
 	"github.com/fabien-marty/github-next-semantic-version/internal/app"
 	"github.com/urfave/cli/v2"
 )
 
+// releasePayload is the would-be API payload printed in dry-run mode
+type releasePayload struct {
+	TagName    string   `json:"tag_name"`
+	Target     string   `json:"target_commitish"`
+	Name       string   `json:"name"`
+	Body       string   `json:"body"`
+	Draft      bool     `json:"draft"`
+	Prerelease bool     `json:"prerelease"`
+	MakeLatest string   `json:"make_latest"`
+	Assets     []string `json:"assets"`
+}
+
+// printDryRunPayload prints the would-be API payload of the given prepared release (as indented JSON)
+func printDryRunPayload(next *app.NextRelease) error {
+	payload := releasePayload{
+		TagName:    next.Options.TagName,
+		Target:     next.Options.GetTarget(),
+		Name:       next.Options.GetName(),
+		Body:       next.Options.Body,
+		Draft:      next.Options.Draft,
+		Prerelease: next.Options.Prerelease,
+		MakeLatest: next.Options.MakeLatest,
+		Assets:     []string{},
+	}
+	for _, asset := range next.Assets {
+		payload.Assets = append(payload.Assets, asset.Name)
+	}
+	content, err := json.MarshalIndent(payload, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(content))
+	return nil
+}
+
+// releaseExitError returns the CLI exit error corresponding to a release creation (or dry-run) error
+func releaseExitError(err error) error {
+	if err == app.ErrNoRelease {
+		return cli.Exit(errors.New("no need to create a release => use --release-force if you want to force a version bump and a new release"), 2)
+	}
+	return cli.Exit(err.Error(), 2)
+}
+
 func createReleaseAction(cCtx *cli.Context) error {
 	setDefaultLogger(cCtx)
+	makeLatest := cCtx.String("release-make-latest")
+	if !slices.Contains([]string{"true", "false", "legacy"}, makeLatest) {
+		return cli.Exit(fmt.Sprintf("bad value for --release-make-latest: %s (must be 'true', 'false' or 'legacy')", makeLatest), 1)
+	}
+	milestoneNextBump := cCtx.String("milestone-next-bump")
+	if !slices.Contains([]string{"major", "minor", "patch"}, milestoneNextBump) {
+		return cli.Exit(fmt.Sprintf("bad value for --milestone-next-bump: %s (must be 'major', 'minor' or 'patch')", milestoneNextBump), 1)
+	}
 	service, err := getService(cCtx)
 	if err != nil {
 		return err
@@ -25,12 +78,40 @@ func createReleaseAction(cCtx *cli.Context) error {
 		}
 		releaseBodyTemplate = string(body)
 	}
-	newTag, err := service.CreateNextRelease(branches, !cCtx.Bool("release-force"), cCtx.Bool("release-draft"), releaseBodyTemplate)
-	if err != nil {
-		if err == app.ErrNoRelease {
-			return cli.Exit(errors.New("no need to create a release => use --release-force if you want to force a version bump and a new release"), 2)
+	opts := app.ReleaseOptions{
+		Draft:        cCtx.Bool("release-draft"),
+		RollingDraft: cCtx.Bool("release-rolling-draft"),
+		BodyTemplate: releaseBodyTemplate,
+		NameTemplate: cCtx.String("release-name-template"),
+		Prerelease:   cCtx.Bool("release-prerelease"),
+		MakeLatest:   makeLatest,
+		TargetSha:    cCtx.String("release-target-sha"),
+
+		Assets:             cCtx.StringSlice("asset"),
+		AssetContentType:   cCtx.String("asset-content-type"),
+		AssetUploadRetries: cCtx.Int("asset-upload-retries"),
+
+		CommentTemplate:   cCtx.String("released-comment-template"),
+		ReleasedLabel:     cCtx.String("released-label"),
+		PostReleaseDryRun: cCtx.Bool("post-release-dry-run"),
+
+		Milestones:        cCtx.Bool("milestones"),
+		MilestoneNextBump: milestoneNextBump,
+	}
+	if cCtx.Bool("dry-run") {
+		next, err := service.DryRunNextRelease(branches, !cCtx.Bool("release-force"), opts)
+		if err != nil {
+			return releaseExitError(err)
+		}
+		err = printDryRunPayload(next)
+		if err != nil {
+			return cli.Exit(fmt.Sprintf("can't print the release payload: %s", err), 2)
 		}
-		return cli.Exit(err.Error(), 2)
+		return nil
+	}
+	newTag, err := service.CreateNextRelease(branches, !cCtx.Bool("release-force"), opts)
+	if err != nil {
+		return releaseExitError(err)
 	}
 	fmt.Println(newTag)
 	return nil
@@ -44,6 +125,12 @@ func CreateReleaseMain() {
 		Usage:   "if set, the release is created in draft mode",
 		EnvVars: []string{"GNSV_RELEASE_DRAFT"},
 	})
+	cliFlags = append(cliFlags, &cli.BoolFlag{
+		Name:    "release-rolling-draft",
+		Value:   false,
+		Usage:   "if set, the draft release created by a previous run (not a draft created by hand) is updated (retagged) instead of creating a new one (implies release-draft)",
+		EnvVars: []string{"GNSV_RELEASE_ROLLING_DRAFT"},
+	})
 	cliFlags = append(cliFlags, &cli.StringFlag{
 		Name:    "release-body-template",
 		Value:   "{{ range . }}- {{.Title}} (#{{.Number}})\n{{ end }}",
@@ -56,6 +143,83 @@ func CreateReleaseMain() {
 		Usage:   "golang template path to generate the release body (if set, release-body-template option is ignored)",
 		EnvVars: []string{"GNSV_RELEASE_BODY_TEMPLATE_PATH"},
 	})
+	cliFlags = append(cliFlags, &cli.StringFlag{
+		Name:    "release-name-template",
+		Value:   "",
+		Usage:   "golang template to generate the release name (available variables: .NewVersion, .OldVersion, .Branch), empty => the tag name",
+		EnvVars: []string{"GNSV_RELEASE_NAME_TEMPLATE"},
+	})
+	cliFlags = append(cliFlags, &cli.BoolFlag{
+		Name:    "release-prerelease",
+		Value:   false,
+		Usage:   "if set, the release is marked as a prerelease",
+		EnvVars: []string{"GNSV_RELEASE_PRERELEASE"},
+	})
+	cliFlags = append(cliFlags, &cli.StringFlag{
+		Name:    "release-make-latest",
+		Value:   "true",
+		Usage:   "make-latest policy of the release: 'true', 'false' or 'legacy' (GitHub only, see the GitHub API)",
+		EnvVars: []string{"GNSV_RELEASE_MAKE_LATEST"},
+	})
+	cliFlags = append(cliFlags, &cli.StringFlag{
+		Name:    "release-target-sha",
+		Value:   "",
+		Usage:   "exact commit sha to tag (avoids racing with new pushes on the branch), 'auto' => the head of the branch in the local repository, empty => the branch head at creation time",
+		EnvVars: []string{"GNSV_RELEASE_TARGET_SHA"},
+	})
+	cliFlags = append(cliFlags, &cli.StringSliceFlag{
+		Name:    "asset",
+		Usage:   "glob pattern of local files to upload to the created release (can be used multiple times), a SHA256SUMS file is also generated and uploaded",
+		EnvVars: []string{"GNSV_ASSETS"},
+	})
+	cliFlags = append(cliFlags, &cli.StringFlag{
+		Name:    "asset-content-type",
+		Value:   "",
+		Usage:   "content type of uploaded assets, empty => guessed from the file extension",
+		EnvVars: []string{"GNSV_ASSET_CONTENT_TYPE"},
+	})
+	cliFlags = append(cliFlags, &cli.IntFlag{
+		Name:    "asset-upload-retries",
+		Value:   3,
+		Usage:   "max number of retries of a failed asset upload, 0 => no retry",
+		EnvVars: []string{"GNSV_ASSET_UPLOAD_RETRIES"},
+	})
+	cliFlags = append(cliFlags, &cli.StringFlag{
+		Name:    "released-comment-template",
+		Value:   "",
+		Usage:   "golang template of the comment added to each released PR (available variables: .NewVersion, .OldVersion, .Branch, .Name, .PullRequest), example: 'Released in {{ .NewVersion }}', empty => no comment (PRs already having the same comment are not commented again)",
+		EnvVars: []string{"GNSV_RELEASED_COMMENT_TEMPLATE"},
+	})
+	cliFlags = append(cliFlags, &cli.StringFlag{
+		Name:    "released-label",
+		Value:   "",
+		Usage:   "label added to each released PR, empty => no label",
+		EnvVars: []string{"GNSV_RELEASED_LABEL"},
+	})
+	cliFlags = append(cliFlags, &cli.BoolFlag{
+		Name:    "post-release-dry-run",
+		Value:   false,
+		Usage:   "if set, the comments and labels of released PRs (and the milestones changes) are only logged (not done)",
+		EnvVars: []string{"GNSV_POST_RELEASE_DRY_RUN"},
+	})
+	cliFlags = append(cliFlags, &cli.BoolFlag{
+		Name:    "milestones",
+		Value:   false,
+		Usage:   "if set, the milestone named after the new version (example: v1.4.0 or 1.4.0) is closed, the next milestone is created (if needed) and the open issues/PRs of the closed milestone are moved to it",
+		EnvVars: []string{"GNSV_MILESTONES"},
+	})
+	cliFlags = append(cliFlags, &cli.StringFlag{
+		Name:    "milestone-next-bump",
+		Value:   "minor",
+		Usage:   "how the next milestone is computed from the new version (with --milestones): 'major', 'minor' or 'patch'",
+		EnvVars: []string{"GNSV_MILESTONE_NEXT_BUMP"},
+	})
+	cliFlags = append(cliFlags, &cli.BoolFlag{
+		Name:    "dry-run",
+		Value:   false,
+		Usage:   "if set, nothing is created or changed: the would-be release payload (JSON) is printed instead of the new tag and the other actions are only logged",
+		EnvVars: []string{"GNSV_DRY_RUN"},
+	})
 	cliFlags = append(cliFlags, &cli.BoolFlag{
 		Name:    "release-force",
 		Usage:   "if set, force the version bump and the creation of a release (even if there is no PR)",
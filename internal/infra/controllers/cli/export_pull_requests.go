@@ -0,0 +1,83 @@
+package cli
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	repofile "github.com/fabien-marty/github-next-semantic-version/internal/infra/adapters/repo/file"
+	"github.com/urfave/cli/v2"
+)
+
+func exportPullRequestsAction(cCtx *cli.Context) error {
+	setDefaultLogger(cCtx)
+	output := cCtx.String("output")
+	if format := cCtx.String("format"); format != "json" && format != "yaml" {
+		return cli.Exit(fmt.Sprintf("Unknown --format value: %s (must be 'json' or 'yaml')", format), 1)
+	}
+	if ext := strings.ToLower(filepath.Ext(output)); output != "-" && ext != ".json" && ext != ".yaml" && ext != ".yml" {
+		return cli.Exit("--output must have a .json, .yaml or .yml extension", 1)
+	}
+	service, err := getService(cCtx)
+	if err != nil {
+		return err
+	}
+	branches := getBranches(cCtx, service)
+	prs, err := service.ExportPullRequests(branches, !cCtx.Bool("consider-also-non-merged-prs"))
+	if err != nil {
+		return cli.Exit(err.Error(), 2)
+	}
+	fixture := &repofile.Fixture{
+		Owner:        service.Config.RepoOwner,
+		Repo:         service.Config.RepoName,
+		WebBaseURL:   service.Config.WebBaseURL,
+		PullRequests: []repofile.PullRequest{},
+	}
+	for _, pr := range prs {
+		fixture.PullRequests = append(fixture.PullRequests, repofile.NewPullRequest(pr))
+	}
+	if output != "-" {
+		err = repofile.WriteFixture(output, fixture)
+		if err != nil {
+			return cli.Exit(err.Error(), 2)
+		}
+		slog.Info(fmt.Sprintf("%d pull-requests exported to %s", len(prs), output))
+		return nil
+	}
+	content, err := repofile.Marshal(fixture, cCtx.String("format") == "yaml")
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("Can't encode the pull-requests: %s", err), 2)
+	}
+	fmt.Print(string(content))
+	return nil
+}
+
+func ExportPullRequestsMain() {
+	cliFlags := make([]cli.Flag, len(commonCliFlags))
+	copy(cliFlags, commonCliFlags)
+	cliFlags = append(cliFlags, &cli.StringFlag{
+		Name:    "output",
+		Value:   "-",
+		Usage:   "Path of the fixture file to write (JSON or YAML, depending on the extension), '-' => stdout (see --format)",
+		EnvVars: []string{"GNSV_EXPORT_OUTPUT"},
+	})
+	cliFlags = append(cliFlags, &cli.StringFlag{
+		Name:    "format",
+		Value:   "json",
+		Usage:   "Format of the fixture written on stdout (with --output=-): 'json' or 'yaml'",
+		EnvVars: []string{"GNSV_EXPORT_FORMAT"},
+	})
+	app := &cli.App{
+		Name:      "github-export-pull-requests",
+		Usage:     "Export the pull-requests seen by the repo adapter into a fixture file (usable offline with --repo-backend=file:PATH)",
+		Action:    exportPullRequestsAction,
+		ArgsUsage: "LOCAL_GIT_REPO_PATH",
+		Flags:     cliFlags,
+	}
+	if err := app.Run(os.Args); err != nil {
+		fmt.Fprintf(os.Stderr, "bad CLI arguments: %s\n", slog.String("err", err.Error()))
+		os.Exit(1)
+	}
+}
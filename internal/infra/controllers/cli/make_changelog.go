@@ -29,7 +29,7 @@ func makeChangelogAction(cCtx *cli.Context) error {
 	if cCtx.String("starting-tag") == "LATEST" && !cCtx.Bool("future") {
 		return cli.Exit("LATEST is only compatible with --future", 1)
 	}
-	changelog, err := service.GenerateChangelog(branches, !cCtx.Bool("consider-also-non-merged-prs"), cCtx.Bool("future"), cCtx.String("starting-tag"), templateString)
+	changelog, err := service.GenerateChangelog(branches, !cCtx.Bool("consider-also-non-merged-prs"), cCtx.Bool("future"), cCtx.String("starting-tag"), cCtx.String("milestone"), templateString)
 	if err != nil {
 		if err == app.ErrNoRelease {
 			return cli.Exit(errors.New("no need to create a release => use --release-force if you want to force a version bump and a new release"), 2)
@@ -60,6 +60,12 @@ func MakeChangelogMain() {
 		Usage:   "if set, defining a starting tag (excluded) for changelog generation, the special value 'LATEST' (combined with --future) will use the latest semantic tag to get only the future section",
 		EnvVars: []string{"GNSV_CHANGELOG_STARTING_TAG"},
 	})
+	cliFlags = append(cliFlags, &cli.StringFlag{
+		Name:    "milestone",
+		Value:   "",
+		Usage:   "if set, only the PRs in this milestone (title) are included in the changelog",
+		EnvVars: []string{"GNSV_CHANGELOG_MILESTONE"},
+	})
 	app := &cli.App{
 		Name:      "github-generate-changelog",
 		Usage:     "Make a changelog from local git tags and GitHub merged PRs",
@@ -0,0 +1,278 @@
+package cli
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+
+	"github.com/fabien-marty/github-next-semantic-version/internal/app/git"
+	"github.com/fabien-marty/github-next-semantic-version/internal/app/repo"
+	gitcommon "github.com/fabien-marty/github-next-semantic-version/internal/infra/adapters/git/common"
+	repobitbucket "github.com/fabien-marty/github-next-semantic-version/internal/infra/adapters/repo/bitbucket"
+	repogitea "github.com/fabien-marty/github-next-semantic-version/internal/infra/adapters/repo/gitea"
+	repogithub "github.com/fabien-marty/github-next-semantic-version/internal/infra/adapters/repo/github"
+	repogithubgraphql "github.com/fabien-marty/github-next-semantic-version/internal/infra/adapters/repo/githubgraphql"
+	repogitlab "github.com/fabien-marty/github-next-semantic-version/internal/infra/adapters/repo/gitlab"
+	"github.com/fabien-marty/github-next-semantic-version/internal/infra/adapters/repo/httpclient"
+	"github.com/urfave/cli/v2"
+)
+
+// provider is a repository hosting provider (GitHub, GitLab...)
+type provider struct {
+	// guessRepo returns the repository owner and name guessed from the CI environment
+	// or from the url of the given git remote (empty strings if it can't be guessed)
+	guessRepo func(cCtx *cli.Context, gitLocalAdapter git.Port, remote string) (owner string, repo string)
+	// newRepoAdapter returns the repo adapter of the provider and the corresponding web base url
+	// (http clients must use the given cassette, nil if not used)
+	newRepoAdapter func(cCtx *cli.Context, repoOwner string, repoName string, gitLocalAdapter git.Port, remote string, cassette *httpclient.Cassette) (repo.Port, string, error)
+	// checkFlags returns an error if a set flag is not supported by the provider (nil => all flags are supported)
+	// (it's called before doing anything, so an unsupported post-release step can't fail after the release creation)
+	checkFlags func(cCtx *cli.Context) error
+}
+
+// providers are the supported repository hosting providers (by name, see --provider)
+var providers = map[string]provider{
+	"github": {
+		guessRepo:      guessGHRepo,
+		newRepoAdapter: getGitHubRepoAdapter,
+	},
+	"gitlab": {
+		guessRepo:      guessGitLabRepo,
+		newRepoAdapter: getGitLabRepoAdapter,
+	},
+	"gitea": {
+		guessRepo:      guessGiteaRepo,
+		newRepoAdapter: getGiteaRepoAdapter,
+	},
+	"bitbucket": {
+		guessRepo:      guessBitbucketRepo,
+		newRepoAdapter: getBitbucketRepoAdapter,
+		checkFlags:     checkBitbucketFlags,
+	},
+}
+
+// providerAliases are alternative names of providers
+var providerAliases = map[string]string{
+	"forgejo": "gitea",
+}
+
+// providerNames returns the sorted names of the supported providers
+func providerNames() []string {
+	res := []string{}
+	for name := range providers {
+		res = append(res, name)
+	}
+	slices.Sort(res)
+	return res
+}
+
+// guessGHRepo returns the GitHub repository owner and name from GitHub Actions variables
+// or from the url of the given git remote
+func guessGHRepo(cCtx *cli.Context, gitLocalAdapter git.Port, remote string) (owner string, repo string) {
+	if owner, repo := guessGHRepoFromEnv(); owner != "" {
+		return owner, repo
+	}
+	return gitLocalAdapter.GuessGHRepo()
+}
+
+// guessGHRepoFromEnv returns the repository owner and name from GitHub Actions variables
+// (also set by Gitea/Forgejo Actions), empty strings if we are not in such an environment
+func guessGHRepoFromEnv() (owner string, repo string) {
+	if os.Getenv("GITHUB_ACTIONS") != "true" {
+		return "", ""
+	}
+	ghOwner := os.Getenv("GITHUB_REPOSITORY_OWNER")
+	ghRepository := os.Getenv("GITHUB_REPOSITORY")
+	if ghOwner != "" && ghRepository != "" {
+		// we are in a GitHub Actions environment
+		return ghOwner, ghRepository[len(ghOwner)+1:]
+	}
+	return "", ""
+}
+
+// guessGitLabRepo returns the GitLab namespace and project name from GitLab CI variables
+// or from the url of the given git remote
+func guessGitLabRepo(cCtx *cli.Context, gitLocalAdapter git.Port, remote string) (owner string, repo string) {
+	if os.Getenv("GITLAB_CI") == "true" {
+		// we are in a GitLab CI environment
+		return os.Getenv("CI_PROJECT_NAMESPACE"), os.Getenv("CI_PROJECT_NAME")
+	}
+	return gitcommon.ExtractGitLabRepoFromRemoteUrl(getRemoteUrl(gitLocalAdapter, remote), getGitLabHosts(cCtx)...)
+}
+
+// getGitHubRepoAdapter returns the GitHub repo adapter (REST or GraphQL, see --github-api)
+// and the corresponding web base url
+func getGitHubRepoAdapter(cCtx *cli.Context, repoOwner string, repoName string, _ git.Port, _ string, cassette *httpclient.Cassette) (repoAdapter repo.Port, webBaseURL string, err error) {
+	webBaseURL, err = repogithub.WebBaseURL(cCtx.String("github-base-url"))
+	if err != nil {
+		return nil, "", cli.Exit(fmt.Sprintf("Bad --github-base-url: %s", err), 1)
+	}
+	retryOptions := getRetryOptions(cCtx)
+	appAuthOptions, err := getGitHubAppAuthOptions(cCtx)
+	if err != nil {
+		return nil, "", err
+	}
+	token := cCtx.String("github-token")
+	if appAuthOptions != nil {
+		slog.Debug("GitHub App authentication => --github-token ignored")
+		token = ""
+	}
+	transportOptions := getHTTPTransportOptions(cCtx, cassette)
+	repoGithubAdapter, err := repogithub.NewAdapter(repoOwner, repoName, repogithub.AdapterOptions{
+		Token:       token,
+		BaseURL:     cCtx.String("github-base-url"),
+		UploadURL:   cCtx.String("github-upload-url"),
+		Retry:       retryOptions,
+		App:         appAuthOptions,
+		Transport:   transportOptions,
+		Concurrency: cCtx.Int("concurrency"),
+		// (with GraphQL, the REST adapter is only used for releases)
+		CompletePullRequests: cCtx.Bool("github-complete-pull-requests") && cCtx.String("github-api") == "rest",
+	})
+	if err != nil {
+		return nil, "", cli.Exit(err.Error(), 1)
+	}
+	repoAdapter = repoGithubAdapter
+	switch cCtx.String("github-api") {
+	case "rest":
+	case "graphql":
+		graphQLURL, err := repogithub.GraphQLURL(cCtx.String("github-base-url"))
+		if err != nil {
+			return nil, "", cli.Exit(fmt.Sprintf("Bad --github-base-url: %s", err), 1)
+		}
+		httpClient, err := repogithub.NewHTTPClient(cCtx.String("github-base-url"), transportOptions, retryOptions, appAuthOptions)
+		if err != nil {
+			return nil, "", cli.Exit(err.Error(), 1)
+		}
+		repoAdapter = repogithubgraphql.NewAdapter(repoOwner, repoName, repoGithubAdapter, repogithubgraphql.AdapterOptions{
+			Token:       token,
+			GraphQLURL:  graphQLURL,
+			WebBaseURL:  webBaseURL,
+			HTTPClient:  httpClient,
+			Concurrency: cCtx.Int("concurrency"),
+		})
+	default:
+		return nil, "", cli.Exit(fmt.Sprintf("Unknown --github-api value: %s (must be 'rest' or 'graphql')", cCtx.String("github-api")), 1)
+	}
+	return repoAdapter, webBaseURL, nil
+}
+
+// getGitLabRepoAdapter returns the GitLab repo adapter and the corresponding web base url
+func getGitLabRepoAdapter(cCtx *cli.Context, repoOwner string, repoName string, _ git.Port, _ string, cassette *httpclient.Cassette) (repo.Port, string, error) {
+	webBaseURL, err := repogitlab.WebBaseURL(cCtx.String("gitlab-base-url"))
+	if err != nil {
+		return nil, "", cli.Exit(fmt.Sprintf("Bad --gitlab-base-url: %s", err), 1)
+	}
+	httpClient, err := httpclient.NewClient(getHTTPTransportOptions(cCtx, cassette), getRetryOptions(cCtx))
+	if err != nil {
+		return nil, "", cli.Exit(err.Error(), 1)
+	}
+	repoAdapter, err := repogitlab.NewAdapter(repoOwner, repoName, repogitlab.AdapterOptions{
+		Token:      cCtx.String("gitlab-token"),
+		BaseURL:    cCtx.String("gitlab-base-url"),
+		HTTPClient: httpClient,
+	})
+	if err != nil {
+		return nil, "", cli.Exit(err.Error(), 1)
+	}
+	return repoAdapter, webBaseURL, nil
+}
+
+// getGiteaRepoAdapter returns the Gitea/Forgejo repo adapter and the corresponding web base url
+//
+// If --gitea-base-url is not set, the instance url is read from Gitea/Forgejo Actions
+// environment or guessed from the host of the given git remote (https is assumed).
+func getGiteaRepoAdapter(cCtx *cli.Context, repoOwner string, repoName string, gitLocalAdapter git.Port, remote string, cassette *httpclient.Cassette) (repo.Port, string, error) {
+	baseURL := cCtx.String("gitea-base-url")
+	if baseURL == "" {
+		if serverURL := os.Getenv("GITHUB_SERVER_URL"); serverURL != "" && os.Getenv("GITHUB_ACTIONS") == "true" {
+			baseURL = repogitea.APIBaseURL(serverURL)
+		} else if host, _ := gitcommon.ParseRemoteUrl(getRemoteUrl(gitLocalAdapter, remote)); host != "" {
+			baseURL = repogitea.APIBaseURL("https://" + host)
+		} else {
+			return nil, "", cli.Exit("Can't guess the Gitea/Forgejo url => please provide it with --gitea-base-url", 1)
+		}
+		slog.Debug(fmt.Sprintf("Gitea/Forgejo API base url guessed: %s", baseURL))
+	}
+	webBaseURL, err := repogitea.WebBaseURL(baseURL)
+	if err != nil {
+		return nil, "", cli.Exit(fmt.Sprintf("Bad --gitea-base-url: %s", err), 1)
+	}
+	httpClient, err := httpclient.NewClient(getHTTPTransportOptions(cCtx, cassette), getRetryOptions(cCtx))
+	if err != nil {
+		return nil, "", cli.Exit(err.Error(), 1)
+	}
+	repoAdapter, err := repogitea.NewAdapter(repoOwner, repoName, repogitea.AdapterOptions{
+		Token:      cCtx.String("gitea-token"),
+		BaseURL:    baseURL,
+		HTTPClient: httpClient,
+	})
+	if err != nil {
+		return nil, "", cli.Exit(err.Error(), 1)
+	}
+	return repoAdapter, webBaseURL, nil
+}
+
+// guessGiteaRepo returns the Gitea/Forgejo repository owner and name from Gitea/Forgejo Actions
+// variables or from the url of the given git remote
+func guessGiteaRepo(cCtx *cli.Context, gitLocalAdapter git.Port, remote string) (owner string, repo string) {
+	if owner, repo := guessGHRepoFromEnv(); owner != "" {
+		return owner, repo
+	}
+	return gitcommon.ExtractOwnerAndRepoFromRemoteUrl(getRemoteUrl(gitLocalAdapter, remote))
+}
+
+// guessBitbucketRepo returns the Bitbucket workspace (or project key) and repository slug
+// from Bitbucket Pipelines variables or from the url of the given git remote
+func guessBitbucketRepo(cCtx *cli.Context, gitLocalAdapter git.Port, remote string) (owner string, repo string) {
+	if os.Getenv("BITBUCKET_BUILD_NUMBER") != "" {
+		// we are in a Bitbucket Pipelines environment
+		return os.Getenv("BITBUCKET_WORKSPACE"), os.Getenv("BITBUCKET_REPO_SLUG")
+	}
+	return gitcommon.ExtractBitbucketRepoFromRemoteUrl(getRemoteUrl(gitLocalAdapter, remote), getBitbucketHosts(cCtx)...)
+}
+
+// checkBitbucketFlags returns an error if labels, milestones or (with Bitbucket Server/Data Center) release
+// assets are asked for (Bitbucket doesn't support them)
+func checkBitbucketFlags(cCtx *cli.Context) error {
+	if cCtx.String("released-label") != "" {
+		return cli.Exit("--released-label is not supported with --provider=bitbucket (Bitbucket pull requests have no labels)", 1)
+	}
+	if cCtx.Bool("milestones") {
+		return cli.Exit("--milestones is not supported with --provider=bitbucket (Bitbucket has no milestones)", 1)
+	}
+	if len(cCtx.StringSlice("asset")) > 0 && repobitbucket.IsServerURL(cCtx.String("bitbucket-base-url")) {
+		return cli.Exit("--asset is not supported with Bitbucket Server/Data Center (no downloads section)", 1)
+	}
+	return nil
+}
+
+// getBitbucketRepoAdapter returns the Bitbucket (Cloud or Server/Data Center) repo adapter
+// and the corresponding web base url
+//
+// Bitbucket Server/Data Center is used if --bitbucket-base-url is set to something else
+// than the Bitbucket Cloud API url.
+func getBitbucketRepoAdapter(cCtx *cli.Context, repoOwner string, repoName string, _ git.Port, _ string, cassette *httpclient.Cassette) (repo.Port, string, error) {
+	baseURL := cCtx.String("bitbucket-base-url")
+	webBaseURL, err := repobitbucket.WebBaseURL(baseURL)
+	if err != nil {
+		return nil, "", cli.Exit(fmt.Sprintf("Bad --bitbucket-base-url: %s", err), 1)
+	}
+	httpClient, err := httpclient.NewClient(getHTTPTransportOptions(cCtx, cassette), getRetryOptions(cCtx))
+	if err != nil {
+		return nil, "", cli.Exit(err.Error(), 1)
+	}
+	repoAdapter, err := repobitbucket.NewAdapter(repoOwner, repoName, repobitbucket.AdapterOptions{
+		Token:       cCtx.String("bitbucket-token"),
+		Username:    cCtx.String("bitbucket-username"),
+		AppPassword: cCtx.String("bitbucket-app-password"),
+		BaseURL:     baseURL,
+		Server:      repobitbucket.IsServerURL(baseURL),
+		HTTPClient:  httpClient,
+	})
+	if err != nil {
+		return nil, "", cli.Exit(err.Error(), 1)
+	}
+	return repoAdapter, webBaseURL, nil
+}